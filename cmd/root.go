@@ -15,6 +15,7 @@ func Execute() {
 	}
 
 	command.AddCommand(serverCmd())
+	command.AddCommand(workerCmd())
 
 	if err := command.Execute(); err != nil {
 		log.Fatal().Msgf("failed run app: %s", err.Error())
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/syahidfrd/go-boilerplate/internal/worker"
+)
+
+func workerCmd() *cobra.Command {
+	var concurrency int
+	var command = &cobra.Command{
+		Use:   "worker",
+		Short: "Run background job worker",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if concurrency < 1 {
+				return fmt.Errorf("invalid concurrency %d, the worker runs at least 1 job at once", concurrency)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			w := worker.NewWorker(concurrency)
+			w.Run()
+		},
+	}
+
+	command.Flags().IntVar(&concurrency, "concurrency", 4, "Run up to the given number of jobs at once")
+	return command
+}
@@ -0,0 +1,103 @@
+// Package app builds the connections and services shared by the commands, so that the server
+// and the worker run the same services configured the same way.
+package app
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/cache"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/config"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/storage"
+	"github.com/syahidfrd/go-boilerplate/internal/todo"
+	"github.com/syahidfrd/go-boilerplate/internal/user"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+	"gorm.io/gorm"
+)
+
+const (
+	// eventReplaySize is roughly how many events of each user are kept for resuming streams
+	eventReplaySize = 1000
+	// eventReplayTTL is how long the events of a user are kept after the last one
+	eventReplayTTL = 24 * time.Hour
+)
+
+// App holds the connections and services the commands are built from
+type App struct {
+	DB            *gorm.DB
+	Redis         *redis.Client
+	Broker        *events.Broker
+	Jobs          *jobs.Queue
+	Webhooks      *webhook.Service
+	Users         *user.Service
+	Notifications *notification.Service
+	Todos         *todo.Service
+}
+
+// New connects to the database and Redis and creates the services with the provided
+// configuration. It doesn't touch the database, which the server migrates.
+func New(cfg *config.Config) *App {
+	// Initialize database
+	dbConn, err := db.NewPostgres(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+
+	// Initialize Redis cache
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: cfg.CacheURL,
+	})
+	redisCache := cache.NewRedis(redisClient)
+
+	// Initialize event broker, shared by every instance through Redis
+	broker := events.NewBroker(redisClient, eventReplaySize, eventReplayTTL)
+
+	// Initialize the outbox of domain events
+	eventOutbox := outbox.New(dbConn)
+
+	// Initialize the queue of background jobs, run by the worker command
+	jobQueue := jobs.NewQueue(dbConn)
+
+	// Initialize attachment storage
+	blobStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize attachment storage")
+	}
+
+	// Initialize services
+	webhookStore := webhook.NewStore(dbConn)
+	webhookService := webhook.NewService(webhookStore, webhook.NewClient(cfg.Webhook.Timeout, cfg.Webhook.AllowPrivate), cfg.Webhook.MaxAttempts)
+
+	userStore := user.NewStore(dbConn)
+	userService := user.NewService(userStore, eventOutbox)
+
+	notificationStore := notification.NewStore(dbConn)
+	notificationService := notification.NewService(notificationStore)
+	notificationService.Register(notification.ChannelWebhook, notification.NewWebhookNotifier(webhookService))
+	if cfg.Email.SMTPHost != "" {
+		notificationService.Register(notification.ChannelEmail, notification.NewEmailNotifier(notification.NewSMTPMailer(cfg.Email), userService))
+	}
+
+	todoStore := todo.NewStore(dbConn)
+	todoService := todo.NewService(todoStore, redisCache, userService, blobStore, broker, webhookService, notificationService, eventOutbox, jobQueue, todo.AttachmentLimits{
+		MaxFileSize: cfg.Storage.MaxFileSize,
+		UserQuota:   cfg.Storage.UserQuota,
+	})
+
+	return &App{
+		DB:            dbConn,
+		Redis:         redisClient,
+		Broker:        broker,
+		Jobs:          jobQueue,
+		Webhooks:      webhookService,
+		Users:         userService,
+		Notifications: notificationService,
+		Todos:         todoService,
+	}
+}
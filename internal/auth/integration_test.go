@@ -8,11 +8,15 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/jwt"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
 	"github.com/syahidfrd/go-boilerplate/internal/user"
 )
@@ -37,16 +41,41 @@ func setupTestServices(t *testing.T) (*Service, *handler, *JWTMiddleware, *test.
 	sharedContainer.CleanupAll(t)
 
 	userStore := user.NewStore(sharedContainer.DB)
-	userService := user.NewService(userStore)
+	userService := user.NewService(userStore, outbox.New(sharedContainer.DB))
 	jwtService := jwt.NewService("test-secret-key-for-integration-tests")
 
-	authService := NewService(userService, jwtService)
+	authService := NewService(userService, jwtService, &recordingDispatcher{})
 	authHandler := NewHandler(authService)
 	jwtMiddleware := NewJWTMiddleware(jwtService)
 
 	return authService, authHandler, jwtMiddleware, sharedContainer
 }
 
+// recordingDispatcher records the events dispatched to it
+type recordingDispatcher struct {
+	mu     sync.Mutex
+	keys   []string
+	types  []string
+	events []any
+}
+
+// DispatchSystem records an event
+func (d *recordingDispatcher) DispatchSystem(ctx context.Context, key, eventType string, data any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = append(d.keys, key)
+	d.types = append(d.types, eventType)
+	d.events = append(d.events, data)
+	return nil
+}
+
+// dispatched returns the types of the events dispatched so far
+func (d *recordingDispatcher) dispatched() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.types)
+}
+
 func TestSignUpIntegration(t *testing.T) {
 	_, handler, _, _ := setupTestServices(t)
 
@@ -116,6 +145,49 @@ func TestSignUpIntegration(t *testing.T) {
 	}
 }
 
+func TestSignUpDispatchIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+	ctx := context.Background()
+
+	dispatcher := &recordingDispatcher{}
+	service := NewService(user.NewService(user.NewStore(sharedContainer.DB), outbox.New(sharedContainer.DB)), jwt.NewService("test-secret-key-for-integration-tests"), dispatcher)
+
+	_, err := service.SignUp(ctx, &SignUpRequest{Email: "new@example.com", Password: "password123"})
+	require.NoError(t, err)
+
+	// Failed sign ups write no event
+	_, err = service.SignUp(ctx, &SignUpRequest{Email: "new@example.com", Password: "password123"})
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
+
+	// Sign ups are dispatched once their event is relayed, not by the sign up itself
+	assert.Empty(t, dispatcher.dispatched())
+	relayed, err := outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 100).Relay(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, relayed)
+
+	consumerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		outbox.NewConsumer(sharedContainer.Redis, user.OutboxTopic, "signup-webhooks", service.HandleOutbox).Run(consumerCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(dispatcher.dispatched()) == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []string{EventSignedUp}, dispatcher.dispatched())
+	assert.NotEmpty(t, dispatcher.keys[0])
+	event, ok := dispatcher.events[0].(SignedUp)
+	require.True(t, ok)
+	assert.NotZero(t, event.ID)
+	assert.Equal(t, "new@example.com", event.Email)
+	assert.False(t, event.CreatedAt.IsZero())
+}
+
 func TestSignUpDuplicateEmailIntegration(t *testing.T) {
 	_, handler, _, _ := setupTestServices(t)
 
@@ -2,10 +2,14 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/rs/zerolog/log"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/jwt"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
 	"github.com/syahidfrd/go-boilerplate/internal/user"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,10 +23,27 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 )
 
+// EventSignedUp is the type of the event dispatched when a user signs up
+const EventSignedUp = "user.signed_up"
+
+// Dispatcher delivers events that aren't about the data of any user to the operator, like
+// the webhook service does. Events are identified by a key and delivered once per key.
+type Dispatcher interface {
+	DispatchSystem(ctx context.Context, key, eventType string, data any) error
+}
+
 // Service provides authentication business logic operations
 type Service struct {
 	userService *user.Service
 	jwtService  *jwt.Service
+	dispatcher  Dispatcher
+}
+
+// SignedUp represents the user in sign up events
+type SignedUp struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // SignUpRequest represents the request payload for user registration
@@ -48,10 +69,11 @@ type SignInResponse struct {
 }
 
 // NewService creates a new auth service with the provided dependencies
-func NewService(userService *user.Service, jwtService *jwt.Service) *Service {
+func NewService(userService *user.Service, jwtService *jwt.Service, dispatcher Dispatcher) *Service {
 	return &Service{
 		userService: userService,
 		jwtService:  jwtService,
+		dispatcher:  dispatcher,
 	}
 }
 
@@ -77,9 +99,8 @@ func (s *Service) SignUp(ctx context.Context, req *SignUpRequest) (*SignUpRespon
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Create user through user service
-	_, err = s.userService.Create(ctx, req.Email, hashedPassword)
-	if err != nil {
+	// Create user through user service, along with the event its sign up is dispatched from
+	if _, err := s.userService.Create(ctx, req.Email, hashedPassword); err != nil {
 		// For now, assume any user creation error is due to duplicate email
 		// You can add more specific error checking here based on user service errors
 		return nil, ErrUserAlreadyExists
@@ -90,6 +111,28 @@ func (s *Service) SignUp(ctx context.Context, req *SignUpRequest) (*SignUpRespon
 	}, nil
 }
 
+// HandleOutbox handles a domain event of users relayed from the outbox by dispatching the
+// sign up of created users to the operator. The event ID keys the dispatch, so an event
+// handled again isn't delivered twice.
+func (s *Service) HandleOutbox(ctx context.Context, event outbox.Event) error {
+	if event.Type != user.EventCreated {
+		return nil
+	}
+
+	var created user.Created
+	if err := json.Unmarshal(event.Payload, &created); err != nil {
+		// Retrying wouldn't make it any less malformed
+		log.Error().Err(err).Msgf("skipping malformed %s event %s", event.Type, event.ID)
+		return nil
+	}
+
+	signedUp := SignedUp{ID: created.ID, Email: created.Email, CreatedAt: created.CreatedAt}
+	if err := s.dispatcher.DispatchSystem(ctx, event.ID, EventSignedUp, signedUp); err != nil {
+		return fmt.Errorf("failed to dispatch sign up event: %w", err)
+	}
+	return nil
+}
+
 // SignIn handles user authentication by validating credentials and generating JWT token
 func (s *Service) SignIn(ctx context.Context, req *SignInRequest) (*SignInResponse, error) {
 	// Get user by email
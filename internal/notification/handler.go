@@ -0,0 +1,180 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/pagination"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/render"
+)
+
+// defaultPageLimit is the number of notifications returned when no limit is requested
+const defaultPageLimit = 20
+
+// handler handles HTTP requests for the notification inbox
+type handler struct {
+	svc       *Service
+	validator *validator.Validate
+}
+
+// NewHandler creates a new notification handler with the provided service
+func NewHandler(svc *Service) *handler {
+	return &handler{
+		svc:       svc,
+		validator: validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// GetByUserID handles requests to list the inbox of the authenticated user
+func (h *handler) GetByUserID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var err error
+	query := r.URL.Query()
+	params := &ListParams{
+		Limit:  defaultPageLimit,
+		Cursor: query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": "invalid query parameter: limit"})
+			return
+		}
+	}
+	if unread := query.Get("unread"); unread != "" {
+		if params.Unread, err = strconv.ParseBool(unread); err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": "invalid query parameter: unread"})
+			return
+		}
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetByUserID(ctx, userID, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, pagination.ErrInvalidCursor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get notifications: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		query.Set("cursor", page.NextCursor)
+		next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// Update handles requests to mark a notification of the authenticated user as read or unread
+func (h *handler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	notification, err := h.svc.Update(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotificationNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrNotificationNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update notification: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, notification)
+}
+
+// MarkAllRead handles requests to mark every notification of the authenticated user as read
+func (h *handler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	marked, err := h.svc.MarkAllRead(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to mark notifications as read: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, map[string]int64{"marked": marked})
+}
+
+// Delete handles requests to remove a notification from the inbox of the authenticated user
+func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.Delete(ctx, userID, int64(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrNotificationNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrNotificationNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete notification: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,139 @@
+//go:build integration
+
+package notification
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	// Run standard migrations + Notification model
+	sharedContainer.RunStandardMigrations(&testing.T{})
+	if err := sharedContainer.DB.AutoMigrate(&Notification{}); err != nil {
+		panic("failed to migrate Notification model: " + err.Error())
+	}
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+func setupTestServices(t *testing.T) (*Service, *handler, *test.Container) {
+	t.Helper()
+
+	// Clean all data before each test
+	sharedContainer.CleanupAll(t)
+
+	service := NewService(NewStore(sharedContainer.DB))
+	handler := NewHandler(service)
+
+	return service, handler, sharedContainer
+}
+
+func createAuthenticatedContext(userID int64) context.Context {
+	return context.WithValue(context.Background(), auth.UserIDKey, userID)
+}
+
+// notify sends an in-app notification to a user
+func notify(t *testing.T, service *Service, userID int64, title string) {
+	t.Helper()
+
+	msg := &Message{UserID: userID, Type: "todo.reminder", Title: title, Data: map[string]int{"todo_id": 1}}
+	require.NoError(t, service.Send(context.Background(), ChannelInApp, msg))
+}
+
+func TestNotificationInboxIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	for _, title := range []string{"first", "second", "third"} {
+		notify(t, service, 1, title)
+	}
+	notify(t, service, 2, "other")
+
+	inboxRequest := func(fn http.HandlerFunc, userID int64, method, url, id string, body any) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			fn(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: method,
+			URL:    url,
+			Body:   body,
+		})
+	}
+
+	// Newest first, paginated with a cursor
+	resp := inboxRequest(handler.GetByUserID, 1, http.MethodGet, "/notifications?limit=2", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data := resp.Body["data"].([]any)
+	require.Len(t, data, 2)
+	assert.Equal(t, "third", data[0].(map[string]any)["title"])
+	assert.Equal(t, map[string]any{"todo_id": float64(1)}, data[0].(map[string]any)["data"])
+	assert.Nil(t, data[0].(map[string]any)["read_at"])
+	assert.Equal(t, true, resp.Body["has_more"])
+	assert.Equal(t, float64(3), resp.Body["unread_count"])
+	cursor := resp.Body["next_cursor"].(string)
+	assert.Equal(t, `</notifications?cursor=`+cursor+`&limit=2>; rel="next"`, resp.Headers.Get("Link"))
+	firstID := strconv.FormatInt(int64(data[0].(map[string]any)["id"].(float64)), 10)
+
+	resp = inboxRequest(handler.GetByUserID, 1, http.MethodGet, "/notifications?limit=2&cursor="+cursor, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data = resp.Body["data"].([]any)
+	require.Len(t, data, 1)
+	assert.Equal(t, "first", data[0].(map[string]any)["title"])
+	assert.Equal(t, false, resp.Body["has_more"])
+
+	resp = inboxRequest(handler.GetByUserID, 1, http.MethodGet, "/notifications?cursor=abc", "", nil)
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid cursor")
+
+	// Marking as read and unread
+	resp = inboxRequest(handler.Update, 1, http.MethodPatch, "/notifications", firstID, map[string]any{"read": true})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, resp.Body["read_at"])
+
+	resp = inboxRequest(handler.GetByUserID, 1, http.MethodGet, "/notifications?unread=true", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, resp.Body["data"].([]any), 2)
+	assert.Equal(t, float64(2), resp.Body["unread_count"])
+
+	resp = inboxRequest(handler.Update, 1, http.MethodPatch, "/notifications", firstID, map[string]any{"read": false})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body["read_at"])
+
+	resp = inboxRequest(handler.Update, 1, http.MethodPatch, "/notifications", firstID, map[string]any{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Notifications of other users can't be seen or changed
+	resp = inboxRequest(handler.Update, 2, http.MethodPatch, "/notifications", firstID, map[string]any{"read": true})
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "notification not found")
+	resp = inboxRequest(handler.Delete, 2, http.MethodDelete, "/notifications", firstID, nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "notification not found")
+
+	resp = inboxRequest(handler.MarkAllRead, 1, http.MethodPost, "/notifications/read", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(3), resp.Body["marked"])
+
+	page, err := service.GetByUserID(context.Background(), 2, &ListParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), page.UnreadCount)
+
+	resp = inboxRequest(handler.Delete, 1, http.MethodDelete, "/notifications", firstID, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	page, err = service.GetByUserID(context.Background(), 1, &ListParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.Zero(t, page.UnreadCount)
+}
@@ -0,0 +1,87 @@
+// Package notification notifies users through pluggable channels: an in-app inbox, email and
+// webhooks. Whatever sends notifications picks a channel, the service hands the message to
+// the notifier registered for it.
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Channel names a way of notifying users
+type Channel string
+
+const (
+	// ChannelInApp stores notifications in the inbox of the user
+	ChannelInApp Channel = "in_app"
+	// ChannelEmail sends notifications to the email address of the user
+	ChannelEmail Channel = "email"
+	// ChannelWebhook dispatches notifications to the webhooks of the user subscribed to their type
+	ChannelWebhook Channel = "webhook"
+)
+
+var (
+	// ErrNotificationNotFound is returned when a requested notification cannot be found
+	ErrNotificationNotFound = errors.New("notification not found")
+	// ErrUnknownChannel is returned when no notifier is registered for a channel
+	ErrUnknownChannel = errors.New("unknown notification channel")
+)
+
+// Message represents what a user is notified of, whatever the channel
+type Message struct {
+	UserID int64
+	// Type is the type of the event the message is about, like todo.reminder
+	Type  string
+	Title string
+	Body  string
+	// Data is the subject of the message, sent as is to webhooks and kept in the inbox
+	Data any
+}
+
+// Notifier delivers messages through a channel
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface
+type NotifierFunc func(ctx context.Context, msg *Message) error
+
+// Notify calls f(ctx, msg)
+func (f NotifierFunc) Notify(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// Notification represents a message in the in-app inbox of a user
+type Notification struct {
+	ID        int64           `json:"id" gorm:"index:idx_notifications_user,priority:2"`
+	UserID    int64           `json:"-" gorm:"index:idx_notifications_user,priority:1"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data" gorm:"type:jsonb"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ListParams represents the filters and pagination of an inbox request
+type ListParams struct {
+	Unread bool
+	Limit  int `validate:"min=1,max=100"`
+	Cursor string
+}
+
+// Page represents a single page of notifications along with the cursor of the next page
+// and the number of unread notifications in the inbox
+type Page struct {
+	Data        []Notification `json:"data"`
+	NextCursor  string         `json:"next_cursor"`
+	HasMore     bool           `json:"has_more"`
+	UnreadCount int64          `json:"unread_count"`
+}
+
+// UpdateRequest represents the request payload for marking a notification as read or unread
+type UpdateRequest struct {
+	Read *bool `json:"read" validate:"required"`
+}
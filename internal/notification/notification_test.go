@@ -0,0 +1,55 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Send(t *testing.T) {
+	svc := NewService(nil)
+	assert.True(t, svc.Supports(ChannelInApp))
+	assert.False(t, svc.Supports(ChannelEmail))
+
+	err := svc.Send(context.Background(), ChannelEmail, &Message{UserID: 1})
+	assert.ErrorIs(t, err, ErrUnknownChannel)
+
+	var got *Message
+	svc.Register(ChannelEmail, NotifierFunc(func(_ context.Context, msg *Message) error {
+		got = msg
+		return nil
+	}))
+	assert.True(t, svc.Supports(ChannelEmail))
+
+	msg := &Message{UserID: 1, Title: "Hello"}
+	require.NoError(t, svc.Send(context.Background(), ChannelEmail, msg))
+	assert.Same(t, msg, got)
+
+	svc.Register(ChannelWebhook, NotifierFunc(func(context.Context, *Message) error {
+		return errors.New("boom")
+	}))
+	err = svc.Send(context.Background(), ChannelWebhook, msg)
+	assert.EqualError(t, err, "failed to send webhook notification: boom")
+}
+
+func TestBuildEmail(t *testing.T) {
+	date := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	email := string(buildEmail("Todos <todos@example.com>", "user@example.com", "Reminder: Café\r\nBcc: evil@example.com", "Due soon.\n\nLa café est prête.", date))
+
+	header, body, ok := strings.Cut(email, "\r\n\r\n")
+	require.True(t, ok)
+
+	assert.Contains(t, header, "From: Todos <todos@example.com>\r\n")
+	assert.Contains(t, header, "To: user@example.com\r\n")
+	assert.Contains(t, header, "Subject: =?utf-8?q?Reminder:_Caf=C3=A9_Bcc:_evil@example.com?=\r\n")
+	assert.Contains(t, header, "Date: Fri, 01 Mar 2024 09:00:00 +0000\r\n")
+	assert.Contains(t, header, "Content-Transfer-Encoding: quoted-printable")
+	assert.NotContains(t, header, "\r\nBcc:")
+
+	assert.Equal(t, "Due soon.\r\n\r\nLa caf=C3=A9 est pr=C3=AAte.", body)
+}
@@ -0,0 +1,138 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/pagination"
+)
+
+// Service provides notification business logic operations and sends messages through the
+// notifiers registered for each channel
+type Service struct {
+	store     *store
+	notifiers map[Channel]Notifier
+}
+
+// NewService creates a new notification service with the provided store. The in-app inbox is
+// always available, other channels are registered with Register.
+func NewService(store *store) *Service {
+	s := &Service{
+		store:     store,
+		notifiers: map[Channel]Notifier{},
+	}
+	s.notifiers[ChannelInApp] = NotifierFunc(s.notifyInApp)
+	return s
+}
+
+// Register makes a channel available, sending its messages with the given notifier. Channels
+// are registered at startup, before anything is sent.
+func (s *Service) Register(channel Channel, notifier Notifier) {
+	s.notifiers[channel] = notifier
+}
+
+// Supports reports whether a notifier is registered for a channel
+func (s *Service) Supports(channel Channel) bool {
+	_, ok := s.notifiers[channel]
+	return ok
+}
+
+// Send sends a message through a channel
+func (s *Service) Send(ctx context.Context, channel Channel, msg *Message) error {
+	notifier, ok := s.notifiers[channel]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChannel, channel)
+	}
+	if err := notifier.Notify(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send %s notification: %w", channel, err)
+	}
+	return nil
+}
+
+// notifyInApp stores a message in the inbox of its user
+func (s *Service) notifyInApp(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification data: %w", err)
+	}
+
+	notification := &Notification{
+		UserID:    msg.UserID,
+		Type:      msg.Type,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.Save(ctx, notification); err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+	return nil
+}
+
+// GetByUserID retrieves a page of the inbox of the specified user, newest first
+func (s *Service) GetByUserID(ctx context.Context, userID int64, params *ListParams) (*Page, error) {
+	afterID, err := pagination.DecodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether a next page exists
+	notifications, err := s.store.GetByUserID(ctx, userID, params.Unread, afterID, params.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	unread, err := s.store.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	page := &Page{Data: notifications, UnreadCount: unread}
+	if len(notifications) > params.Limit {
+		page.Data = notifications[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = pagination.EncodeCursor(page.Data[params.Limit-1].ID)
+	}
+
+	return page, nil
+}
+
+// Update marks a notification of the specified user as read or unread. Marking a read
+// notification as read keeps the time it was first read.
+func (s *Service) Update(ctx context.Context, userID, id int64, req *UpdateRequest) (*Notification, error) {
+	notification, err := s.store.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case *req.Read && notification.ReadAt == nil:
+		now := time.Now()
+		notification.ReadAt = &now
+	case !*req.Read:
+		notification.ReadAt = nil
+	}
+
+	if err := s.store.Save(ctx, notification); err != nil {
+		return nil, fmt.Errorf("failed to update notification: %w", err)
+	}
+	return notification, nil
+}
+
+// MarkAllRead marks every unread notification of the specified user as read, returning how
+// many were marked
+func (s *Service) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	marked, err := s.store.MarkAllRead(ctx, userID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return marked, nil
+}
+
+// Delete removes a notification from the inbox of the specified user
+func (s *Service) Delete(ctx context.Context, userID, id int64) error {
+	return s.store.Delete(ctx, userID, id)
+}
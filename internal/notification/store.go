@@ -0,0 +1,86 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// store implements notification data persistence using GORM
+type store struct {
+	dbConn *gorm.DB
+}
+
+// NewStore creates a new notification store with the provided database connection
+func NewStore(dbConn *gorm.DB) *store {
+	return &store{dbConn: dbConn}
+}
+
+// Save persists a notification to the database (create or update)
+func (s *store) Save(ctx context.Context, notification *Notification) error {
+	return s.dbConn.WithContext(ctx).Save(notification).Error
+}
+
+// GetByID retrieves a notification by its ID from the database, scoped to its user
+func (s *store) GetByID(ctx context.Context, userID, id int64) (*Notification, error) {
+	var notification Notification
+	err := s.dbConn.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&notification).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// GetByUserID retrieves a page of the notifications of a user, newest first, after the
+// notification with the given ID when it isn't zero
+func (s *store) GetByUserID(ctx context.Context, userID int64, unread bool, afterID int64, limit int) ([]Notification, error) {
+	query := s.dbConn.WithContext(ctx).Where("user_id = ?", userID)
+	if unread {
+		query = query.Where("read_at IS NULL")
+	}
+	if afterID != 0 {
+		query = query.Where("id < ?", afterID)
+	}
+
+	var notifications []Notification
+	if err := query.Order("id DESC").Limit(limit).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// CountUnread returns the number of unread notifications of a user
+func (s *store) CountUnread(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	err := s.dbConn.WithContext(ctx).
+		Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkAllRead marks every unread notification of a user as read at the given time, returning
+// how many were marked
+func (s *store) MarkAllRead(ctx context.Context, userID int64, at time.Time) (int64, error) {
+	result := s.dbConn.WithContext(ctx).
+		Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", at)
+	return result.RowsAffected, result.Error
+}
+
+// Delete removes a notification of a user from the database
+func (s *store) Delete(ctx context.Context, userID, id int64) error {
+	result := s.dbConn.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&Notification{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
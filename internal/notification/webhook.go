@@ -0,0 +1,15 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+)
+
+// NewWebhookNotifier creates a notifier dispatching messages to the webhooks of their user
+// subscribed to their type, with their data as the event data
+func NewWebhookNotifier(webhooks *webhook.Service) Notifier {
+	return NotifierFunc(func(ctx context.Context, msg *Message) error {
+		return webhooks.Dispatch(ctx, msg.UserID, msg.Type, msg.Data)
+	})
+}
@@ -33,3 +33,18 @@ func (r *RedisCache) Set(ctx context.Context, key string, value string, ttl time
 func (r *RedisCache) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
+
+// HGet retrieves the value of a field stored in a Redis hash
+func (r *RedisCache) HGet(ctx context.Context, key, field string) (string, error) {
+	return r.client.HGet(ctx, key, field).Result()
+}
+
+// HSet stores a field value in a Redis hash. The TTL is only applied when the
+// hash has none yet, so every field expires no later than the first one written
+func (r *RedisCache) HSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	pipe.ExpireNX(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
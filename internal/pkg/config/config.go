@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v9"
 	"github.com/joho/godotenv"
@@ -11,9 +12,13 @@ import (
 // Config represents the main application configuration structure
 // It contains all environment variables and nested configuration objects
 type Config struct {
-	AppSecret string `env:"APP_SECRET"`
-	CacheURL  string `env:"CACHE_URL"`
-	Database  Database
+	AppSecret      string        `env:"APP_SECRET"`
+	CacheURL       string        `env:"CACHE_URL"`
+	TrashRetention time.Duration `env:"TRASH_RETENTION" envDefault:"720h"`
+	Database       Database
+	Storage        Storage
+	Webhook        Webhook
+	Email          Email
 }
 
 // Database represents the database connection configuration
@@ -28,6 +33,40 @@ type Database struct {
 	MaxOpenConn int    `env:"DATABASE_MAX_OPEN_CONN"`
 }
 
+// Storage represents the attachment storage configuration
+// Backend selects where blobs are stored, either "local" (under Dir) or "s3"
+type Storage struct {
+	Backend     string `env:"STORAGE_BACKEND" envDefault:"local"`
+	Dir         string `env:"STORAGE_DIR" envDefault:"data/attachments"`
+	S3Endpoint  string `env:"STORAGE_S3_ENDPOINT"`
+	S3Bucket    string `env:"STORAGE_S3_BUCKET"`
+	S3Region    string `env:"STORAGE_S3_REGION" envDefault:"us-east-1"`
+	S3AccessKey string `env:"STORAGE_S3_ACCESS_KEY"`
+	S3SecretKey string `env:"STORAGE_S3_SECRET_KEY"`
+	MaxFileSize int64  `env:"STORAGE_MAX_FILE_SIZE" envDefault:"26214400"`
+	UserQuota   int64  `env:"STORAGE_USER_QUOTA" envDefault:"1073741824"`
+}
+
+// Webhook represents the webhook delivery configuration
+// SignupURL, when set, receives a signed user.signed_up event for every new account
+type Webhook struct {
+	MaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	Timeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	AllowPrivate bool          `env:"WEBHOOK_ALLOW_PRIVATE" envDefault:"false"`
+	SignupURL    string        `env:"WEBHOOK_SIGNUP_URL"`
+	SignupSecret string        `env:"WEBHOOK_SIGNUP_SECRET"`
+}
+
+// Email represents the outgoing email configuration
+// Email notifications are only available when SMTPHost is set
+type Email struct {
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	From         string `env:"EMAIL_FROM"`
+}
+
 // DataSourceName returns a PostgreSQL connection string formatted with the database configuration.
 func (d Database) DataSourceName() string {
 	return fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=disable",
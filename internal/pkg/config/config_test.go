@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,9 +61,13 @@ func TestLoadEnv(t *testing.T) {
 	// Save original environment
 	originalEnv := make(map[string]string)
 	envVars := []string{
-		"APP_SECRET", "CACHE_URL",
+		"APP_SECRET", "CACHE_URL", "TRASH_RETENTION",
 		"DATABASE_HOST", "DATABASE_PORT", "DATABASE_USER", "DATABASE_PASSWORD",
 		"DATABASE_NAME", "DATABASE_MAX_IDLE_CONN", "DATABASE_MAX_OPEN_CONN",
+		"STORAGE_BACKEND", "STORAGE_DIR", "STORAGE_S3_ENDPOINT", "STORAGE_S3_BUCKET", "STORAGE_S3_REGION",
+		"STORAGE_S3_ACCESS_KEY", "STORAGE_S3_SECRET_KEY", "STORAGE_MAX_FILE_SIZE", "STORAGE_USER_QUOTA",
+		"WEBHOOK_MAX_ATTEMPTS", "WEBHOOK_TIMEOUT", "WEBHOOK_ALLOW_PRIVATE", "WEBHOOK_SIGNUP_URL", "WEBHOOK_SIGNUP_SECRET",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "EMAIL_FROM",
 	}
 
 	for _, envVar := range envVars {
@@ -84,6 +89,7 @@ func TestLoadEnv(t *testing.T) {
 	testEnv := map[string]string{
 		"APP_SECRET":             "test-jwt-secret",
 		"CACHE_URL":              "localhost:6379",
+		"TRASH_RETENTION":        "48h",
 		"DATABASE_HOST":          "localhost",
 		"DATABASE_PORT":          "5432",
 		"DATABASE_USER":          "testuser",
@@ -91,6 +97,25 @@ func TestLoadEnv(t *testing.T) {
 		"DATABASE_NAME":          "testdb",
 		"DATABASE_MAX_IDLE_CONN": "5",
 		"DATABASE_MAX_OPEN_CONN": "10",
+		"STORAGE_BACKEND":        "s3",
+		"STORAGE_DIR":            "/var/lib/attachments",
+		"STORAGE_S3_ENDPOINT":    "http://localhost:9000",
+		"STORAGE_S3_BUCKET":      "attachments",
+		"STORAGE_S3_REGION":      "eu-west-1",
+		"STORAGE_S3_ACCESS_KEY":  "access-key",
+		"STORAGE_S3_SECRET_KEY":  "secret-key",
+		"STORAGE_MAX_FILE_SIZE":  "1048576",
+		"STORAGE_USER_QUOTA":     "10485760",
+		"WEBHOOK_MAX_ATTEMPTS":   "3",
+		"WEBHOOK_TIMEOUT":        "5s",
+		"WEBHOOK_ALLOW_PRIVATE":  "true",
+		"WEBHOOK_SIGNUP_URL":     "https://hooks.example.com/signups",
+		"WEBHOOK_SIGNUP_SECRET":  "signup-secret",
+		"SMTP_HOST":              "smtp.example.com",
+		"SMTP_PORT":              "2525",
+		"SMTP_USERNAME":          "mailer",
+		"SMTP_PASSWORD":          "mailer-pass",
+		"EMAIL_FROM":             "Todos <todos@example.com>",
 	}
 
 	for key, value := range testEnv {
@@ -104,6 +129,7 @@ func TestLoadEnv(t *testing.T) {
 	assert.NotNil(t, config)
 	assert.Equal(t, "test-jwt-secret", config.AppSecret)
 	assert.Equal(t, "localhost:6379", config.CacheURL)
+	assert.Equal(t, 48*time.Hour, config.TrashRetention)
 
 	// Verify database configuration
 	assert.Equal(t, "localhost", config.Database.Host)
@@ -113,15 +139,44 @@ func TestLoadEnv(t *testing.T) {
 	assert.Equal(t, "testdb", config.Database.Name)
 	assert.Equal(t, 5, config.Database.MaxIdleConn)
 	assert.Equal(t, 10, config.Database.MaxOpenConn)
+
+	// Verify storage configuration
+	assert.Equal(t, "s3", config.Storage.Backend)
+	assert.Equal(t, "/var/lib/attachments", config.Storage.Dir)
+	assert.Equal(t, "http://localhost:9000", config.Storage.S3Endpoint)
+	assert.Equal(t, "attachments", config.Storage.S3Bucket)
+	assert.Equal(t, "eu-west-1", config.Storage.S3Region)
+	assert.Equal(t, "access-key", config.Storage.S3AccessKey)
+	assert.Equal(t, "secret-key", config.Storage.S3SecretKey)
+	assert.Equal(t, int64(1048576), config.Storage.MaxFileSize)
+	assert.Equal(t, int64(10485760), config.Storage.UserQuota)
+
+	// Verify webhook configuration
+	assert.Equal(t, 3, config.Webhook.MaxAttempts)
+	assert.Equal(t, 5*time.Second, config.Webhook.Timeout)
+	assert.True(t, config.Webhook.AllowPrivate)
+	assert.Equal(t, "https://hooks.example.com/signups", config.Webhook.SignupURL)
+	assert.Equal(t, "signup-secret", config.Webhook.SignupSecret)
+
+	// Verify email configuration
+	assert.Equal(t, "smtp.example.com", config.Email.SMTPHost)
+	assert.Equal(t, 2525, config.Email.SMTPPort)
+	assert.Equal(t, "mailer", config.Email.SMTPUsername)
+	assert.Equal(t, "mailer-pass", config.Email.SMTPPassword)
+	assert.Equal(t, "Todos <todos@example.com>", config.Email.From)
 }
 
 func TestLoadEnv_WithDefaults(t *testing.T) {
 	// Save original environment
 	originalEnv := make(map[string]string)
 	envVars := []string{
-		"APP_SECRET", "CACHE_URL",
+		"APP_SECRET", "CACHE_URL", "TRASH_RETENTION",
 		"DATABASE_HOST", "DATABASE_PORT", "DATABASE_USER", "DATABASE_PASSWORD",
 		"DATABASE_NAME", "DATABASE_MAX_IDLE_CONN", "DATABASE_MAX_OPEN_CONN",
+		"STORAGE_BACKEND", "STORAGE_DIR", "STORAGE_S3_ENDPOINT", "STORAGE_S3_BUCKET", "STORAGE_S3_REGION",
+		"STORAGE_S3_ACCESS_KEY", "STORAGE_S3_SECRET_KEY", "STORAGE_MAX_FILE_SIZE", "STORAGE_USER_QUOTA",
+		"WEBHOOK_MAX_ATTEMPTS", "WEBHOOK_TIMEOUT", "WEBHOOK_ALLOW_PRIVATE", "WEBHOOK_SIGNUP_URL", "WEBHOOK_SIGNUP_SECRET",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "EMAIL_FROM",
 	}
 
 	for _, envVar := range envVars {
@@ -151,8 +206,20 @@ func TestLoadEnv_WithDefaults(t *testing.T) {
 	assert.NotNil(t, config)
 	assert.Equal(t, "", config.AppSecret)
 	assert.Equal(t, "", config.CacheURL)
+	assert.Equal(t, 30*24*time.Hour, config.TrashRetention)
 	assert.Equal(t, 0, config.Database.MaxIdleConn)
 	assert.Equal(t, 0, config.Database.MaxOpenConn)
+	assert.Equal(t, "local", config.Storage.Backend)
+	assert.Equal(t, "data/attachments", config.Storage.Dir)
+	assert.Equal(t, "us-east-1", config.Storage.S3Region)
+	assert.Equal(t, int64(25<<20), config.Storage.MaxFileSize)
+	assert.Equal(t, int64(1<<30), config.Storage.UserQuota)
+	assert.Equal(t, 8, config.Webhook.MaxAttempts)
+	assert.Equal(t, 10*time.Second, config.Webhook.Timeout)
+	assert.False(t, config.Webhook.AllowPrivate)
+	assert.Equal(t, "", config.Webhook.SignupURL)
+	assert.Equal(t, "", config.Email.SMTPHost)
+	assert.Equal(t, 587, config.Email.SMTPPort)
 }
 
 func TestLoadEnv_IntegerParsing(t *testing.T) {
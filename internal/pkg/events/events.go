@@ -0,0 +1,334 @@
+// Package events delivers events to subscribers across server instances through Redis. Each
+// event is appended to a capped stream per topic, which is the replay buffer subscribers resume
+// from after a reconnection, and announced on a single Pub/Sub channel every instance listens
+// to, which fans it out to its local subscribers.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// channel is the Pub/Sub channel events are announced on
+	channel = "events"
+	// bufferSize is how many live events a subscriber can fall behind by before it is dropped
+	bufferSize = 64
+)
+
+// ErrClosed is returned when subscribing to a broker that was stopped
+var ErrClosed = errors.New("broker closed")
+
+// Event represents something that happened on a topic. The ID is assigned when the event is
+// published, IDs of the same topic increase with time.
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// message is an event as announced on the Pub/Sub channel
+type message struct {
+	Topic string `json:"topic"`
+	Event
+}
+
+// Broker publishes events and delivers them to the subscribers of this instance
+type Broker struct {
+	client     *redis.Client
+	replaySize int64
+	replayTTL  time.Duration
+
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker creates a broker keeping the last replaySize events of each topic for replayTTL
+// after the last one was published
+func NewBroker(client *redis.Client, replaySize int64, replayTTL time.Duration) *Broker {
+	return &Broker{
+		client:     client,
+		replaySize: replaySize,
+		replayTTL:  replayTTL,
+		subs:       map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// streamKey returns the key of the replay buffer of a topic
+func streamKey(topic string) string {
+	return "events:" + topic
+}
+
+// Publish publishes an event of the given type with data marshalled to JSON on a topic
+func (b *Broker) Publish(ctx context.Context, topic, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	key := streamKey(topic)
+	id, err := b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: b.replaySize,
+		Approx: true,
+		Values: map[string]any{"type": eventType, "data": string(payload)},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+	b.client.Expire(ctx, key, b.replayTTL)
+
+	msg, err := json.Marshal(message{Topic: topic, Event: Event{ID: id, Type: eventType, Data: payload}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := b.client.Publish(ctx, channel, msg).Err(); err != nil {
+		return fmt.Errorf("failed to announce event: %w", err)
+	}
+	return nil
+}
+
+// Run listens to the events announced by every instance and delivers them to the local
+// subscribers of their topic until the context is done, at which point the broker stops.
+// Every subscription is closed when Run returns, and subscribers that fall too far behind
+// are dropped, they are expected to reconnect and resume from the replay buffer.
+func (b *Broker) Run(ctx context.Context) error {
+	pubsub := b.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	defer func() { b.close(ctx.Err() != nil) }()
+
+	// Wait for the subscription to be confirmed, so that no event is missed from now on
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var msg message
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Warn().Err(err).Msg("dropping malformed event")
+				continue
+			}
+			b.dispatch(msg.Topic, msg.Event)
+		}
+	}
+}
+
+// dispatch delivers an event to the local subscribers of a topic
+func (b *Broker) dispatch(topic string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs[topic] {
+		select {
+		case sub.live <- event:
+		default:
+			b.remove(topic, sub)
+		}
+	}
+}
+
+// close closes every subscription, and stops the broker if requested
+func (b *Broker) close(stop bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = b.closed || stop
+	for topic, subs := range b.subs {
+		for sub := range subs {
+			b.remove(topic, sub)
+		}
+	}
+}
+
+// remove unregisters a subscription and closes its live channel, b.mu must be held
+func (b *Broker) remove(topic string, sub *Subscription) {
+	if _, ok := b.subs[topic][sub]; !ok {
+		return
+	}
+	delete(b.subs[topic], sub)
+	if len(b.subs[topic]) == 0 {
+		delete(b.subs, topic)
+	}
+	close(sub.live)
+}
+
+// Subscription represents a subscriber to a topic. Events are received on C, which is closed
+// when the subscription ends, whether closed, dropped for lagging behind or because the
+// broker stopped.
+type Subscription struct {
+	// C delivers the replayed events first, then live ones
+	C <-chan Event
+	// Reset is set when the events since the requested one are no longer all in the replay
+	// buffer, in which case the subscriber should reload its state instead
+	Reset bool
+
+	broker *Broker
+	topic  string
+	live   chan Event
+}
+
+// Subscribe subscribes to the events of a topic. When lastID is set, the events published
+// after it that are still in the replay buffer are delivered first.
+func (b *Broker) Subscribe(ctx context.Context, topic, lastID string) (*Subscription, error) {
+	sub := &Subscription{broker: b, topic: topic, live: make(chan Event, bufferSize)}
+
+	// Register before reading the replay buffer, so that no event falls in between. Events
+	// received both ways are deduplicated by ID.
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[*Subscription]struct{}{}
+	}
+	b.subs[topic][sub] = struct{}{}
+	b.mu.Unlock()
+
+	var replay []Event
+	if lastID != "" {
+		var err error
+		replay, sub.Reset, err = b.replay(ctx, topic, lastID)
+		if err != nil {
+			sub.Close()
+			return nil, err
+		}
+	}
+
+	out := make(chan Event)
+	sub.C = out
+	go func() {
+		defer close(out)
+		// The subscription ends with the context of the subscriber
+		defer sub.Close()
+
+		last := lastID
+		for _, event := range replay {
+			if !send(ctx, out, event) {
+				return
+			}
+			last = event.ID
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-sub.live:
+				if !ok {
+					return
+				}
+				if last != "" && !After(event.ID, last) {
+					continue
+				}
+				if !send(ctx, out, event) {
+					return
+				}
+				last = event.ID
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+// send delivers an event unless the context is done first
+func send(ctx context.Context, out chan<- Event, event Event) bool {
+	select {
+	case out <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// replay reads the events of a topic published after lastID from its replay buffer, and
+// reports whether some of them were already trimmed from it
+func (b *Broker) replay(ctx context.Context, topic, lastID string) ([]Event, bool, error) {
+	if _, _, err := parseID(lastID); err != nil {
+		return nil, true, nil
+	}
+
+	key := streamKey(topic)
+
+	// The buffer holds every event since lastID as long as its oldest one is lastID or older
+	oldest, err := b.client.XRangeN(ctx, key, "-", "+", 1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read replay buffer: %w", err)
+	}
+	reset := len(oldest) == 0 || After(oldest[0].ID, lastID)
+
+	messages, err := b.client.XRange(ctx, key, "("+lastID, "+").Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read replay buffer: %w", err)
+	}
+
+	events := make([]Event, 0, len(messages))
+	for _, m := range messages {
+		eventType, _ := m.Values["type"].(string)
+		data, _ := m.Values["data"].(string)
+		events = append(events, Event{ID: m.ID, Type: eventType, Data: json.RawMessage(data)})
+	}
+	return events, reset, nil
+}
+
+// Close ends the subscription, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s.topic, s)
+}
+
+// parseID parses an event ID, made of a millisecond timestamp and a sequence number
+func parseID(id string) (uint64, uint64, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	msValue, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	seqValue, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	return msValue, seqValue, nil
+}
+
+// After reports whether the event with ID a was published after the one with ID b. Invalid
+// IDs come before every valid one.
+func After(a, b string) bool {
+	aMs, aSeq, errA := parseID(a)
+	bMs, bSeq, errB := parseID(b)
+	switch {
+	case errA != nil:
+		return false
+	case errB != nil:
+		return true
+	case aMs != bMs:
+		return aMs > bMs
+	default:
+		return aSeq > bSeq
+	}
+}
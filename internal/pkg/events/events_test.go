@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "2-0", b: "1-0", expected: true},
+		{a: "1-0", b: "2-0", expected: false},
+		{a: "1-1", b: "1-0", expected: true},
+		{a: "1-0", b: "1-0", expected: false},
+		{a: "10-0", b: "9-5", expected: true},
+		{a: "1-0", b: "invalid", expected: true},
+		{a: "invalid", b: "1-0", expected: false},
+		{a: "1-x", b: "1-0", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, After(tt.a, tt.b))
+		})
+	}
+}
+
+// receive reads the next event of a subscription, failing the test if none comes
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.C:
+		require.True(t, ok, "subscription closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+// closed reports whether a subscription ends within a second
+func closed(sub *Subscription) bool {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func TestBroker_Dispatch(t *testing.T) {
+	broker := NewBroker(nil, 10, time.Minute)
+
+	first, err := broker.Subscribe(context.Background(), "user:1", "")
+	require.NoError(t, err)
+	second, err := broker.Subscribe(context.Background(), "user:1", "")
+	require.NoError(t, err)
+	other, err := broker.Subscribe(context.Background(), "user:2", "")
+	require.NoError(t, err)
+
+	broker.dispatch("user:1", Event{ID: "1-0", Type: "created"})
+	assert.Equal(t, "1-0", receive(t, first).ID)
+	assert.Equal(t, "1-0", receive(t, second).ID)
+
+	// Events already seen are skipped
+	broker.dispatch("user:1", Event{ID: "1-0", Type: "created"})
+	broker.dispatch("user:1", Event{ID: "2-0", Type: "updated"})
+	assert.Equal(t, "2-0", receive(t, first).ID)
+
+	// Closed subscriptions don't get events anymore
+	second.Close()
+	second.Close()
+	assert.True(t, closed(second))
+	broker.dispatch("user:1", Event{ID: "3-0", Type: "deleted"})
+	assert.Equal(t, "3-0", receive(t, first).ID)
+
+	broker.dispatch("user:2", Event{ID: "4-0", Type: "created"})
+	assert.Equal(t, "4-0", receive(t, other).ID)
+}
+
+func TestBroker_DropsLaggingSubscribers(t *testing.T) {
+	broker := NewBroker(nil, 10, time.Minute)
+
+	sub, err := broker.Subscribe(context.Background(), "user:1", "")
+	require.NoError(t, err)
+
+	// Nothing reads the subscription, its buffer fills up
+	for i := range bufferSize + 2 {
+		broker.dispatch("user:1", Event{ID: fmt.Sprintf("%d-0", i+1), Type: "created"})
+	}
+
+	assert.True(t, closed(sub))
+}
+
+func TestBroker_Close(t *testing.T) {
+	broker := NewBroker(nil, 10, time.Minute)
+
+	sub, err := broker.Subscribe(context.Background(), "user:1", "")
+	require.NoError(t, err)
+
+	// Closing without stopping ends subscriptions, which can be made again
+	broker.close(false)
+	assert.True(t, closed(sub))
+	sub, err = broker.Subscribe(context.Background(), "user:1", "")
+	require.NoError(t, err)
+
+	broker.close(true)
+	assert.True(t, closed(sub))
+	_, err = broker.Subscribe(context.Background(), "user:1", "")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestBroker_SubscriptionContext(t *testing.T) {
+	broker := NewBroker(nil, 10, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := broker.Subscribe(ctx, "user:1", "")
+	require.NoError(t, err)
+
+	// Events pending when the context is done end the subscription
+	cancel()
+	broker.dispatch("user:1", Event{ID: "1-0", Type: "created"})
+	assert.True(t, closed(sub))
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	assert.Empty(t, broker.subs)
+}
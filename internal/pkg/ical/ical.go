@@ -0,0 +1,365 @@
+// Package ical reads and writes the iCalendar format of RFC 5545, as far as todo lists need it.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineLength is the maximum length of a content line in octets, line break excluded
+const maxLineLength = 75
+
+// dateTimeFormat is the layout of UTC DATE-TIME values
+const dateTimeFormat = "20060102T150405Z"
+
+// ErrSyntax is returned when iCalendar content is malformed
+var ErrSyntax = errors.New("invalid iCalendar content")
+
+// Property represents a property of a component, like SUMMARY or DUE. The value is kept
+// as it appears in the content, TEXT values need to be unescaped with Text.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Text returns the value of the property unescaped as a TEXT value
+func (p *Property) Text() string {
+	return Unescape(p.Value)
+}
+
+// Component represents a component, like VCALENDAR or VTODO, with its properties and subcomponents
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// Get returns the first property with the given name, or nil if there is none
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// All returns every property with the given name, for properties that can repeat like CATEGORIES
+func (c *Component) All(name string) []Property {
+	var props []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Writer writes iCalendar content, folding long lines. Errors are sticky: once a write
+// fails, later writes do nothing and Err returns the error.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter creates a writer of iCalendar content to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Begin starts a component
+func (w *Writer) Begin(name string) {
+	w.Property("BEGIN", name)
+}
+
+// End ends a component
+func (w *Writer) End(name string) {
+	w.Property("END", name)
+}
+
+// Property writes a property with a value that is already in its iCalendar form. Params
+// are given as name and value pairs.
+func (w *Writer) Property(name, value string, params ...string) {
+	var line strings.Builder
+	line.WriteString(name)
+	for i := 0; i+1 < len(params); i += 2 {
+		line.WriteString(";" + params[i] + "=" + quoteParam(params[i+1]))
+	}
+	line.WriteString(":" + value)
+
+	w.writeLine(line.String())
+}
+
+// Text writes a property with a TEXT value, escaping it
+func (w *Writer) Text(name, value string) {
+	w.Property(name, Escape(value))
+}
+
+// DateTime writes a property with a DATE-TIME value in UTC
+func (w *Writer) DateTime(name string, t time.Time) {
+	w.Property(name, FormatDateTime(t))
+}
+
+// Err returns the first error that occurred while writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// writeLine writes a content line, folded into lines of at most 75 octets that don't split
+// UTF-8 sequences. Continuation lines start with a space, which counts towards the limit.
+func (w *Writer) writeLine(line string) {
+	if w.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = maxLineLength - 1
+	}
+	b.WriteString(line + "\r\n")
+
+	_, w.err = io.WriteString(w.w, b.String())
+}
+
+// quoteParam quotes a parameter value when it contains characters that delimit parameters
+func quoteParam(value string) string {
+	value = strings.ReplaceAll(value, `"`, "")
+	if strings.ContainsAny(value, ";:,") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// Escape escapes a TEXT value
+func Escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// Unescape unescapes a TEXT value
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// SplitList splits a list value, like the one of CATEGORIES, on the commas that aren't
+// escaped, and unescapes each item
+func SplitList(s string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, Unescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, Unescape(s[start:]))
+}
+
+// FormatDateTime formats a time as a UTC DATE-TIME value
+func FormatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat)
+}
+
+// ParseDateTime parses the DATE or DATE-TIME value of a property. Times in a TZID are
+// converted from that timezone, floating times and dates are taken as UTC.
+func ParseDateTime(p *Property) (time.Time, error) {
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: unknown timezone %q", ErrSyntax, tzid)
+		}
+		loc = l
+	}
+
+	value := p.Value
+	var (
+		t   time.Time
+		err error
+	)
+	switch {
+	case len(value) == 8:
+		t, err = time.ParseInLocation("20060102", value, loc)
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse(dateTimeFormat, value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid %s %q", ErrSyntax, p.Name, value)
+	}
+	return t.UTC(), nil
+}
+
+// Parse reads iCalendar content and returns its top level component, usually a VCALENDAR.
+// Errors give the line they occurred on.
+func Parse(r io.Reader) (*Component, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		stack   []*Component
+		root    *Component
+		line    string
+		lineNo  int
+		startNo int
+	)
+
+	handle := func(content string, no int) error {
+		prop, err := parseLine(content)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", no, err)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return fmt.Errorf("line %d: %w: content after the end of %s", no, ErrSyntax, root.Name)
+			}
+			c := &Component{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return fmt.Errorf("line %d: %w: unexpected END:%s", no, ErrSyntax, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return fmt.Errorf("line %d: %w: property outside of a component", no, ErrSyntax)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, *prop)
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// Lines starting with a space or a tab continue the previous one
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			if line == "" {
+				return nil, fmt.Errorf("line %d: %w: continuation without a line", lineNo, ErrSyntax)
+			}
+			line += text[1:]
+			continue
+		}
+
+		if line != "" {
+			if err := handle(line, startNo); err != nil {
+				return nil, err
+			}
+		}
+		line, startNo = text, lineNo
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line != "" {
+		if err := handle(line, startNo); err != nil {
+			return nil, err
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("%w: no component", ErrSyntax)
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%w: %s is never ended", ErrSyntax, stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// parseLine parses a content line: a name, parameters and a value
+func parseLine(line string) (*Property, error) {
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return nil, fmt.Errorf("%w: %q is not a property", ErrSyntax, line)
+	}
+
+	prop := &Property{Name: strings.ToUpper(line[:i])}
+	rest := line[i:]
+
+	for rest[0] == ';' {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("%w: invalid parameter of %s", ErrSyntax, prop.Name)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated parameter of %s", ErrSyntax, prop.Name)
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: %s has no value", ErrSyntax, prop.Name)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+
+		if prop.Params == nil {
+			prop.Params = map[string]string{}
+		}
+		prop.Params[name] = value
+
+		if rest == "" {
+			return nil, fmt.Errorf("%w: %s has no value", ErrSyntax, prop.Name)
+		}
+	}
+
+	if rest[0] != ':' {
+		return nil, fmt.Errorf("%w: %s has no value", ErrSyntax, prop.Name)
+	}
+	prop.Value = rest[1:]
+	return prop, nil
+}
@@ -0,0 +1,162 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.Begin("VCALENDAR")
+	w.Property("VERSION", "2.0")
+	w.Begin("VTODO")
+	w.Text("SUMMARY", "Buy milk, eggs; bread\nand butter")
+	w.DateTime("DUE", time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("CET", 3600)))
+	w.Property("X-NOTE", "value", "LANGUAGE", "en", "X-LABEL", "a;b")
+	w.End("VTODO")
+	w.End("VCALENDAR")
+	require.NoError(t, w.Err())
+
+	expected := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Buy milk\\, eggs\\; bread\\nand butter\r\n" +
+		"DUE:20240301T083000Z\r\n" +
+		"X-NOTE;LANGUAGE=en;X-LABEL=\"a;b\":value\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriter_Folding(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	value := strings.Repeat("é", 100)
+	w.Text("DESCRIPTION", value)
+	require.NoError(t, w.Err())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	require.Greater(t, len(lines), 1)
+	for i, line := range lines {
+		assert.LessOrEqual(t, len(line), maxLineLength)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(line, " "))
+		}
+	}
+
+	// Folding never splits a character, and unfolding gives the line back
+	root, err := Parse(strings.NewReader("BEGIN:VTODO\r\n" + buf.String() + "END:VTODO\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, value, root.Get("DESCRIPTION").Text())
+}
+
+func TestParse(t *testing.T) {
+	content := "BEGIN:VCALENDAR\n" +
+		"VERSION:2.0\n" +
+		"BEGIN:VTODO\n" +
+		"UID:1@example.com\n" +
+		"SUMMARY:Call\\, then write\n" +
+		"DESCRIPTION:first line\\n\n" +
+		" second line\n" +
+		"CATEGORIES:Work,Urgent\\, really\n" +
+		"CATEGORIES:Home\n" +
+		"DUE;TZID=Europe/Paris:20240301T093000\n" +
+		"X-ALT;X-PARAM=\"a:b;c\":value:with:colons\n" +
+		"END:VTODO\n" +
+		"BEGIN:VTODO\n" +
+		"SUMMARY:Second\n" +
+		"END:VTODO\n" +
+		"END:VCALENDAR\n"
+
+	root, err := Parse(strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, "VCALENDAR", root.Name)
+	assert.Equal(t, "2.0", root.Get("VERSION").Value)
+	require.Len(t, root.Components, 2)
+
+	todo := root.Components[0]
+	assert.Equal(t, "VTODO", todo.Name)
+	assert.Equal(t, "Call, then write", todo.Get("SUMMARY").Text())
+	assert.Equal(t, "first line\nsecond line", todo.Get("DESCRIPTION").Text())
+	assert.Nil(t, todo.Get("LOCATION"))
+
+	categories := todo.All("CATEGORIES")
+	require.Len(t, categories, 2)
+	assert.Equal(t, []string{"Work", "Urgent, really"}, SplitList(categories[0].Value))
+
+	due, err := ParseDateTime(todo.Get("DUE"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC), due)
+
+	alt := todo.Get("X-ALT")
+	assert.Equal(t, "a:b;c", alt.Params["X-PARAM"])
+	assert.Equal(t, "value:with:colons", alt.Value)
+
+	assert.Equal(t, "Second", root.Components[1].Get("SUMMARY").Text())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    string
+	}{
+		{name: "empty", content: ""},
+		{name: "not a property", content: "BEGIN:VCALENDAR\nnonsense\nEND:VCALENDAR\n", line: "line 2"},
+		{name: "unbalanced", content: "BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VCALENDAR\n", line: "line 3"},
+		{name: "never ended", content: "BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VTODO\n"},
+		{name: "outside component", content: "SUMMARY:x\n", line: "line 1"},
+		{name: "unterminated parameter", content: "BEGIN:VTODO\nDUE;TZID=\"x:1\nEND:VTODO\n", line: "line 2"},
+		{name: "continuation first", content: " BEGIN:VTODO\n", line: "line 1"},
+		{name: "trailing content", content: "BEGIN:VTODO\nEND:VTODO\nBEGIN:VTODO\nEND:VTODO\n", line: "line 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.content))
+			require.ErrorIs(t, err, ErrSyntax)
+			assert.Contains(t, err.Error(), tt.line)
+		})
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		prop     Property
+		expected time.Time
+	}{
+		{name: "utc", prop: Property{Value: "20240301T093000Z"}, expected: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "floating", prop: Property{Value: "20240301T093000"}, expected: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "date", prop: Property{Value: "20240301", Params: map[string]string{"VALUE": "DATE"}}, expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "tzid", prop: Property{Value: "20240701T093000", Params: map[string]string{"TZID": "America/New_York"}}, expected: time.Date(2024, 7, 1, 13, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDateTime(&tt.prop)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+
+	_, err := ParseDateTime(&Property{Name: "DUE", Value: "tomorrow"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = ParseDateTime(&Property{Name: "DUE", Value: "20240301T093000", Params: map[string]string{"TZID": "Mars/Olympus"}})
+	assert.ErrorIs(t, err, ErrSyntax)
+}
+
+func TestEscape(t *testing.T) {
+	value := "a\\b;c,d\ne"
+	assert.Equal(t, `a\\b\;c\,d\ne`, Escape(value))
+	assert.Equal(t, value, Unescape(Escape(value)))
+	assert.Equal(t, []string{"a,b", "c"}, SplitList(`a\,b,c`))
+}
@@ -0,0 +1,234 @@
+// Package idempotency makes retried requests safe: a request sent with an Idempotency-Key
+// header is handled once, and retries with the same key get the response of the first one.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/render"
+)
+
+const (
+	// Header is the request header carrying the idempotency key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from a previous request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// maxKeyLength is the maximum length of an idempotency key
+	maxKeyLength = 255
+	// lockTTL is how long a request in flight holds its key, so that the key of a request
+	// whose server went away is freed eventually
+	lockTTL = time.Minute
+	// keyPrefix prefixes the Redis keys of stored requests
+	keyPrefix = "idempotency:"
+)
+
+// record represents a request stored under its idempotency key, in flight until it is done
+// and its response is stored along with it
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Middleware provides Idempotency-Key support, storing requests and their responses in Redis
+type Middleware struct {
+	client *redis.Client
+	ttl    time.Duration
+	scope  func(r *http.Request) string
+}
+
+// NewMiddleware creates a new idempotency middleware keeping responses for the given TTL.
+// Keys are scoped by what scope returns for a request, like its user, so that clients
+// choosing the same key don't share responses.
+func NewMiddleware(client *redis.Client, ttl time.Duration, scope func(r *http.Request) string) *Middleware {
+	return &Middleware{
+		client: client,
+		ttl:    ttl,
+		scope:  scope,
+	}
+}
+
+// Handle handles requests carrying an Idempotency-Key header once per key. Retries get the
+// stored response, a different request with the same key gets 422 and a retry while the
+// first request is still in flight gets 409. Server errors aren't stored, so requests that
+// failed with one can be retried with the same key. Requests without the header are handled
+// as usual, and so are all requests when Redis is unavailable.
+func (m *Middleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": "invalid idempotency key"})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.JSONFromError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		redisKey := keyPrefix + m.scope(r) + ":" + key
+		fingerprint := fingerprint(r, body)
+
+		pending, _ := json.Marshal(record{Fingerprint: fingerprint})
+		locked, err := m.client.SetNX(ctx, redisKey, pending, lockTTL).Result()
+		if err != nil {
+			log.Ctx(ctx).Error().Msgf("failed to lock idempotency key: %s", err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !locked {
+			m.replay(w, r, redisKey, fingerprint)
+			return
+		}
+
+		// Free the key unless the response is stored, like when the handler panics
+		stored := false
+		defer func() {
+			if !stored {
+				if err := m.client.Del(context.WithoutCancel(ctx), redisKey).Err(); err != nil {
+					log.Ctx(ctx).Error().Msgf("failed to unlock idempotency key: %s", err.Error())
+				}
+			}
+		}()
+
+		before := w.Header().Clone()
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		done, _ := json.Marshal(record{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      rec.Status(),
+			Header:      addedHeader(before, w.Header()),
+			Body:        rec.body.Bytes(),
+		})
+		if err := m.client.Set(context.WithoutCancel(ctx), redisKey, done, m.ttl).Err(); err != nil {
+			log.Ctx(ctx).Error().Msgf("failed to store idempotent response: %s", err.Error())
+			return
+		}
+		stored = true
+	})
+}
+
+// replay answers a request whose key is already taken, with the stored response when it is a
+// retry of a request that is done
+func (m *Middleware) replay(w http.ResponseWriter, r *http.Request, redisKey, fingerprint string) {
+	ctx := r.Context()
+
+	data, err := m.client.Get(ctx, redisKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The first request failed and freed its key meanwhile
+		render.JSON(w, http.StatusConflict, map[string]string{"message": "a request with this idempotency key is in progress"})
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to get idempotent response: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var stored record
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to decode idempotent response: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	switch {
+	case stored.Fingerprint != fingerprint:
+		render.JSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "idempotency key was used for a different request"})
+	case !stored.Done:
+		render.JSON(w, http.StatusConflict, map[string]string{"message": "a request with this idempotency key is in progress"})
+	default:
+		for name, values := range stored.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// fingerprint identifies a request by its method, URL and body, so that a key reused for a
+// different request is told apart from a retry
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// addedHeader returns the header fields set after the given snapshot, those set by the
+// handler rather than by the middleware running before it, like the request ID
+func addedHeader(before, after http.Header) http.Header {
+	added := http.Header{}
+	for name, values := range after {
+		if _, ok := before[name]; !ok {
+			added[name] = values
+		}
+	}
+	return added
+}
+
+// recorder wraps an http.ResponseWriter to capture the response status and body while
+// writing them through
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// Status returns the HTTP status code of the response
+func (rec *recorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// WriteHeader captures the status code before writing the header
+func (rec *recorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the response body before writing it
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,54 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	post := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+	a := fingerprint(post, []byte(`{"title":"a"}`))
+
+	assert.Len(t, a, 64)
+	assert.Equal(t, a, fingerprint(post, []byte(`{"title":"a"}`)))
+	assert.NotEqual(t, a, fingerprint(post, []byte(`{"title":"b"}`)))
+	assert.NotEqual(t, a, fingerprint(httptest.NewRequest(http.MethodPost, "/api/todos?project=1", nil), []byte(`{"title":"a"}`)))
+	assert.NotEqual(t, a, fingerprint(httptest.NewRequest(http.MethodPut, "/api/todos", nil), []byte(`{"title":"a"}`)))
+}
+
+func TestAddedHeader(t *testing.T) {
+	before := http.Header{"X-Request-Id": {"abc"}}
+	after := http.Header{
+		"X-Request-Id": {"abc"},
+		"Content-Type": {"application/json"},
+		"Location":     {"/api/todos/1"},
+	}
+
+	assert.Equal(t, http.Header{
+		"Content-Type": {"application/json"},
+		"Location":     {"/api/todos/1"},
+	}, addedHeader(before, after))
+}
+
+func TestRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &recorder{ResponseWriter: w}
+	assert.Equal(t, http.StatusOK, rec.Status())
+
+	rec.WriteHeader(http.StatusCreated)
+	rec.Write([]byte(`{"id":1}`))
+
+	assert.Equal(t, http.StatusCreated, rec.Status())
+	assert.Equal(t, `{"id":1}`, rec.body.String())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"id":1}`, w.Body.String())
+	assert.Same(t, w, rec.Unwrap())
+
+	// Writing the body first implies 200
+	rec = &recorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("ok"))
+	assert.Equal(t, http.StatusOK, rec.Status())
+}
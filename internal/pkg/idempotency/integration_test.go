@@ -0,0 +1,147 @@
+//go:build integration
+
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+// counter is a handler creating a resource on each request it handles, answering with its
+// number, or failing when asked to
+type counter struct {
+	calls   atomic.Int64
+	status  int
+	release chan struct{}
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := c.calls.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+
+	status := c.status
+	if status == 0 {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", "/things/"+strconv.FormatInt(n, 10))
+	w.WriteHeader(status)
+	w.Write([]byte(`{"n":` + strconv.FormatInt(n, 10) + `}`))
+}
+
+func setupTestMiddleware(t *testing.T, scope string) *Middleware {
+	t.Helper()
+
+	// Clean all data before each test
+	sharedContainer.CleanupAll(t)
+
+	return NewMiddleware(sharedContainer.Redis, time.Hour, func(*http.Request) string { return scope })
+}
+
+func serve(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-Id", "request")
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddlewareReplayIntegration(t *testing.T) {
+	m := setupTestMiddleware(t, "user:1")
+	next := &counter{}
+	h := m.Handle(next)
+
+	first := serve(h, "key-1", `{"title":"a"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, `{"n":1}`, first.Body.String())
+	assert.Empty(t, first.Header().Get(ReplayedHeader))
+
+	// Retries get the stored response without handling the request again
+	retry := serve(h, "key-1", `{"title":"a"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, `{"n":1}`, retry.Body.String())
+	assert.Equal(t, "/things/1", retry.Header().Get("Location"))
+	assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, int64(1), next.calls.Load())
+
+	ttl, err := sharedContainer.Redis.TTL(t.Context(), keyPrefix+"user:1:key-1").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour.Seconds(), ttl.Seconds(), 5)
+
+	// The same key for another request is refused
+	reused := serve(h, "key-1", `{"title":"b"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, int64(1), next.calls.Load())
+
+	// Other keys, other scopes and requests without a key are handled
+	assert.Equal(t, `{"n":2}`, serve(h, "key-2", `{"title":"a"}`).Body.String())
+	other := NewMiddleware(sharedContainer.Redis, time.Hour, func(*http.Request) string { return "user:2" })
+	assert.Equal(t, `{"n":3}`, serve(other.Handle(next), "key-1", `{"title":"a"}`).Body.String())
+	assert.Equal(t, `{"n":4}`, serve(h, "", `{"title":"a"}`).Body.String())
+	assert.Equal(t, `{"n":5}`, serve(h, "", `{"title":"a"}`).Body.String())
+
+	tooLong := serve(h, strings.Repeat("k", maxKeyLength+1), `{"title":"a"}`)
+	assert.Equal(t, http.StatusBadRequest, tooLong.Code)
+}
+
+func TestMiddlewareInFlightIntegration(t *testing.T) {
+	m := setupTestMiddleware(t, "user:1")
+	next := &counter{release: make(chan struct{})}
+	h := m.Handle(next)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(h, "key-1", `{"title":"a"}`)
+	}()
+	require.Eventually(t, func() bool { return next.calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// A duplicate sent while the first request is in flight is refused
+	duplicate := serve(h, "key-1", `{"title":"a"}`)
+	assert.Equal(t, http.StatusConflict, duplicate.Code)
+
+	close(next.release)
+	first := <-done
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := serve(h, "key-1", `{"title":"a"}`)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, int64(1), next.calls.Load())
+}
+
+func TestMiddlewareServerErrorIntegration(t *testing.T) {
+	m := setupTestMiddleware(t, "user:1")
+	next := &counter{status: http.StatusInternalServerError}
+	h := m.Handle(next)
+
+	// Server errors aren't stored, the request can be retried with the same key
+	assert.Equal(t, http.StatusInternalServerError, serve(h, "key-1", `{}`).Code)
+	next.status = 0
+	retry := serve(h, "key-1", `{}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, `{"n":2}`, retry.Body.String())
+	assert.Empty(t, retry.Header().Get(ReplayedHeader))
+}
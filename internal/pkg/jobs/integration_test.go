@@ -0,0 +1,302 @@
+//go:build integration
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	// Run standard migrations + Job model
+	sharedContainer.RunStandardMigrations(&testing.T{})
+	if err := sharedContainer.DB.AutoMigrate(&Job{}); err != nil {
+		panic("failed to migrate Job model: " + err.Error())
+	}
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+// testArgs are the arguments of the jobs enqueued by tests
+type testArgs struct {
+	N int `json:"n"`
+}
+
+const testKind Kind[testArgs] = "test.job"
+
+func setupTestQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	// Clean all data before each test
+	sharedContainer.CleanupAll(t)
+
+	return NewQueue(sharedContainer.DB)
+}
+
+// getJob reloads a job from the database
+func getJob(t *testing.T, id int64) *Job {
+	t.Helper()
+
+	var job Job
+	require.NoError(t, sharedContainer.DB.First(&job, id).Error)
+	return &job
+}
+
+// runWorker runs a worker until the test ends
+func runWorker(t *testing.T, w *Worker) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestEnqueueIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	job, err := Enqueue(ctx, q, testKind, testArgs{N: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "test.job", job.Kind)
+	assert.JSONEq(t, `{"n":1}`, string(job.Args))
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, defaultMaxAttempts, job.MaxAttempts)
+
+	// Delayed jobs aren't claimed before they are due
+	delayed, err := Enqueue(ctx, q, testKind, testArgs{N: 2}, After(time.Hour), MaxAttempts(2))
+	require.NoError(t, err)
+	assert.Equal(t, 2, delayed.MaxAttempts)
+
+	claimed, err := q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, job.ID, claimed[0].ID)
+	assert.Equal(t, StatusRunning, claimed[0].Status)
+	assert.Equal(t, 1, claimed[0].Attempts)
+
+	// Jobs of other kinds aren't claimed either
+	claimed, err = q.claim(ctx, "other.job", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func TestEnqueueWithTxIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	// Jobs enqueued in a transaction that is rolled back never exist
+	tx := sharedContainer.DB.Begin()
+	_, err := Enqueue(ctx, q, testKind, testArgs{}, WithTx(tx))
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback().Error)
+
+	var count int64
+	require.NoError(t, sharedContainer.DB.Model(&Job{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestEnqueueUniqueIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	job, err := Enqueue(ctx, q, testKind, testArgs{}, Unique("report"))
+	require.NoError(t, err)
+
+	_, err = Enqueue(ctx, q, testKind, testArgs{}, Unique("report"))
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	// Jobs without a key, or with another one, aren't affected
+	_, err = Enqueue(ctx, q, testKind, testArgs{})
+	require.NoError(t, err)
+	_, err = Enqueue(ctx, q, testKind, testArgs{}, Unique("other"))
+	require.NoError(t, err)
+
+	// The key is free again once the job completed
+	claimed, err := q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	for i := range claimed {
+		if claimed[i].ID == job.ID {
+			require.NoError(t, q.finish(ctx, &claimed[i], nil))
+		}
+	}
+	_, err = Enqueue(ctx, q, testKind, testArgs{}, Unique("report"))
+	require.NoError(t, err)
+}
+
+func TestClaimVisibilityTimeoutIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	job, err := Enqueue(ctx, q, testKind, testArgs{})
+	require.NoError(t, err)
+
+	first, err := q.claim(ctx, string(testKind), 10, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	// A running job isn't claimed again until its visibility timeout expires
+	claimed, err := q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	time.Sleep(150 * time.Millisecond)
+	second, err := q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, 2, second[0].Attempts)
+
+	// The first attempt doesn't own the job anymore, its outcome is ignored
+	require.NoError(t, q.finish(ctx, &first[0], nil))
+	assert.Equal(t, StatusRunning, getJob(t, job.ID).Status)
+
+	require.NoError(t, q.finish(ctx, &second[0], nil))
+	assert.Equal(t, StatusSucceeded, getJob(t, job.ID).Status)
+}
+
+func TestFinishRetryIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	job, err := Enqueue(ctx, q, testKind, testArgs{}, MaxAttempts(2))
+	require.NoError(t, err)
+
+	claimed, err := q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, q.finish(ctx, &claimed[0], errors.New("boom")))
+
+	// Failed attempts are retried with backoff
+	retried := getJob(t, job.ID)
+	assert.Equal(t, StatusPending, retried.Status)
+	assert.Equal(t, "boom", retried.LastError)
+	assert.Nil(t, retried.LockedUntil)
+	assert.WithinDuration(t, time.Now().Add(backoff(1)), retried.RunAt, time.Second)
+
+	require.NoError(t, sharedContainer.DB.Model(&Job{}).Where("id = ?", job.ID).Update("run_at", time.Now()).Error)
+	claimed, err = q.claim(ctx, string(testKind), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, q.finish(ctx, &claimed[0], errors.New("boom again")))
+
+	// Until they run out of attempts
+	failed := getJob(t, job.ID)
+	assert.Equal(t, StatusFailed, failed.Status)
+	assert.Equal(t, "boom again", failed.LastError)
+	assert.NotNil(t, failed.CompletedAt)
+}
+
+func TestWorkerIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	var sum, failures atomic.Int64
+	w := NewWorker(q, 2)
+	Handle(w, testKind, time.Minute, func(ctx context.Context, args testArgs) error {
+		job, ok := FromContext(ctx)
+		if !ok {
+			return errors.New("no job in context")
+		}
+		if args.N < 0 && !job.LastAttempt() {
+			failures.Add(1)
+			return errors.New("not yet")
+		}
+		sum.Add(int64(args.N))
+		return nil
+	})
+
+	var ids []int64
+	for _, n := range []int{1, 2, 3, 4, -10} {
+		job, err := Enqueue(ctx, q, testKind, testArgs{N: n}, MaxAttempts(2))
+		require.NoError(t, err)
+		ids = append(ids, job.ID)
+	}
+	runWorker(t, w)
+
+	require.Eventually(t, func() bool { return sum.Load() == 10 }, 5*time.Second, 10*time.Millisecond)
+	for _, id := range ids[:4] {
+		assert.Equal(t, StatusSucceeded, getJob(t, id).Status)
+	}
+
+	// The failing job is retried once its backoff passed, and succeeds on its last attempt
+	require.Eventually(t, func() bool { return failures.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sharedContainer.DB.Model(&Job{}).Where("id = ?", ids[4]).Update("run_at", time.Now()).Error)
+	require.Eventually(t, func() bool {
+		return getJob(t, ids[4]).Status == StatusSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(0), sum.Load())
+}
+
+func TestWorkerScheduleIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+
+	// Workers running side by side schedule the next run only once
+	for range 2 {
+		w := NewWorker(q, 1)
+		Handle(w, testKind, time.Minute, func(context.Context, testArgs) error { return nil })
+		Schedule(w, testKind, time.Hour)
+		runWorker(t, w)
+	}
+
+	var jobs []Job
+	require.Eventually(t, func() bool {
+		require.NoError(t, sharedContainer.DB.Find(&jobs).Error)
+		return len(jobs) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, sharedContainer.DB.Find(&jobs).Error)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, StatusPending, jobs[0].Status)
+	assert.Equal(t, "schedule:test.job", *jobs[0].UniqueKey)
+	assert.Equal(t, time.Now().Truncate(time.Hour).Add(time.Hour).Unix(), jobs[0].RunAt.Unix())
+}
+
+func TestWorkerShutdownIntegration(t *testing.T) {
+	q := setupTestQueue(t)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	w := NewWorker(q, 1)
+	Handle(w, testKind, time.Minute, func(ctx context.Context, _ testArgs) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return ctx.Err()
+	})
+
+	job, err := Enqueue(ctx, q, testKind, testArgs{})
+	require.NoError(t, err)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(runCtx)
+	}()
+
+	// Stopping the worker waits for the job being run, which isn't canceled
+	<-started
+	cancel()
+	<-done
+	assert.Equal(t, StatusSucceeded, getJob(t, job.ID).Status)
+}
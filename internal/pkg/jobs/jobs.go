@@ -0,0 +1,260 @@
+// Package jobs runs background jobs stored in Postgres. Jobs are typed by their kind, run once
+// due, possibly after a delay or at a given time, and retried with exponential backoff when
+// they fail. Workers claim due jobs with FOR UPDATE SKIP LOCKED, so any number of them can run
+// side by side, and hold them for the visibility timeout of their kind: a job whose worker
+// went away is claimed again once it expires.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultMaxAttempts is how many times a job is attempted unless enqueued with MaxAttempts
+const defaultMaxAttempts = 5
+
+// ErrDuplicate is returned when enqueuing a job with the unique key of a job that hasn't
+// completed yet
+var ErrDuplicate = errors.New("job already enqueued")
+
+// Kind names a type of job whose arguments are of type T
+type Kind[T any] string
+
+// Status is the state of a job
+type Status string
+
+const (
+	// StatusPending jobs are waiting to run, now or later
+	StatusPending Status = "pending"
+	// StatusRunning jobs have been claimed by a worker
+	StatusRunning Status = "running"
+	// StatusSucceeded jobs ran successfully
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed jobs failed every attempt and aren't retried anymore
+	StatusFailed Status = "failed"
+)
+
+// Job represents a job along with the outcome of its last attempt. A unique key is only
+// unique among the jobs that haven't completed yet.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind" gorm:"not null"`
+	Args        json.RawMessage `json:"args" gorm:"type:jsonb;not null"`
+	UniqueKey   *string         `json:"unique_key" gorm:"uniqueIndex:idx_jobs_unique_key,where:completed_at IS NULL"`
+	Status      Status          `json:"status" gorm:"not null;index:idx_jobs_due,priority:1"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at" gorm:"index:idx_jobs_due,priority:2"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	CompletedAt *time.Time      `json:"completed_at" gorm:"index"`
+}
+
+// TableName keeps jobs in the jobs table
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Options represents how a job is enqueued
+type Options struct {
+	Tx          *gorm.DB
+	RunAt       time.Time
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// Option is a function type that modifies Options
+type Option func(*Options)
+
+// WithTx returns an Option that enqueues the job within a database transaction, it then only
+// runs if the transaction is committed
+func WithTx(tx *gorm.DB) Option {
+	return func(o *Options) {
+		o.Tx = tx
+	}
+}
+
+// At returns an Option that runs the job at the given time rather than right away
+func At(t time.Time) Option {
+	return func(o *Options) {
+		o.RunAt = t
+	}
+}
+
+// After returns an Option that runs the job once the given delay has passed
+func After(d time.Duration) Option {
+	return func(o *Options) {
+		o.RunAt = time.Now().Add(d)
+	}
+}
+
+// Unique returns an Option that only enqueues the job if no job with the same key is pending
+// or running, ErrDuplicate is returned otherwise
+func Unique(key string) Option {
+	return func(o *Options) {
+		o.UniqueKey = key
+	}
+}
+
+// MaxAttempts returns an Option that sets how many times the job is attempted before it fails
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = n
+	}
+}
+
+// Queue stores jobs in Postgres
+type Queue struct {
+	dbConn *gorm.DB
+}
+
+// NewQueue creates a queue storing jobs with the provided database connection
+func NewQueue(dbConn *gorm.DB) *Queue {
+	return &Queue{dbConn: dbConn}
+}
+
+// Enqueue adds a job of the given kind with its arguments to the queue
+func Enqueue[T any](ctx context.Context, q *Queue, kind Kind[T], args T, options ...Option) (*Job, error) {
+	opts := &Options{RunAt: time.Now(), MaxAttempts: defaultMaxAttempts}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	dbConn := q.dbConn
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s job arguments: %w", kind, err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		Kind:        string(kind),
+		Args:        data,
+		Status:      StatusPending,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+
+	result := dbConn.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "completed_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(job)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job: %w", kind, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDuplicate
+	}
+
+	return job, nil
+}
+
+// claim marks up to limit due jobs of a kind as running for the given visibility timeout,
+// including running jobs whose timeout expired, and returns them
+func (q *Queue) claim(ctx context.Context, kind string, limit int, timeout time.Duration) ([]Job, error) {
+	now := time.Now()
+
+	var jobs []Job
+	err := q.dbConn.WithContext(ctx).Raw(`
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, locked_until = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind = ? AND (
+				(status = ? AND run_at <= ?) OR
+				(status = ? AND locked_until <= ?)
+			)
+			ORDER BY run_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusRunning, now.Add(timeout), now,
+		kind, StatusPending, now, StatusRunning, now, limit,
+	).Scan(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// finish records the outcome of an attempt at a job, given it still holds it. A job that
+// failed is retried with backoff until it runs out of attempts.
+func (q *Queue) finish(ctx context.Context, job *Job, runErr error) error {
+	now := time.Now()
+	updates := map[string]any{"locked_until": nil, "updated_at": now}
+
+	switch {
+	case runErr == nil:
+		updates["status"] = StatusSucceeded
+		updates["last_error"] = ""
+		updates["completed_at"] = now
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = StatusFailed
+		updates["last_error"] = runErr.Error()
+		updates["completed_at"] = now
+	default:
+		updates["status"] = StatusPending
+		updates["last_error"] = runErr.Error()
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+	}
+
+	// A job whose timeout expired may have been claimed again, the new attempt owns it
+	return q.dbConn.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, StatusRunning, job.Attempts).
+		Updates(updates).Error
+}
+
+// prune removes the jobs that completed before the given time
+func (q *Queue) prune(ctx context.Context, before time.Time) (int64, error) {
+	result := q.dbConn.WithContext(ctx).Where("completed_at < ?", before).Delete(&Job{})
+	return result.RowsAffected, result.Error
+}
+
+// backoff returns how long to wait before retrying a job that failed the given number of
+// attempts, doubling from 10 seconds up to an hour
+func backoff(attempts int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// jobKey is the context key of the job being run
+type jobKey struct{}
+
+// NewContext returns a copy of the parent context carrying a job, like the contexts given to
+// the functions running jobs
+func NewContext(ctx context.Context, job *Job) context.Context {
+	return context.WithValue(ctx, jobKey{}, job)
+}
+
+// FromContext returns the job being run by a handler, so that it can tell its last attempt
+func FromContext(ctx context.Context) (*Job, bool) {
+	job, ok := ctx.Value(jobKey{}).(*Job)
+	return job, ok
+}
+
+// LastAttempt reports whether a failure of the attempt being made fails the job for good
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 10 * time.Second},
+		{attempts: 2, expected: 20 * time.Second},
+		{attempts: 3, expected: 40 * time.Second},
+		{attempts: 9, expected: 2560 * time.Second},
+		{attempts: 10, expected: time.Hour},
+		{attempts: 100, expected: time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, backoff(tt.attempts), "attempts %d", tt.attempts)
+	}
+}
+
+func TestJob_LastAttempt(t *testing.T) {
+	assert.False(t, (&Job{Attempts: 1, MaxAttempts: 3}).LastAttempt())
+	assert.True(t, (&Job{Attempts: 3, MaxAttempts: 3}).LastAttempt())
+	assert.True(t, (&Job{Attempts: 4, MaxAttempts: 3}).LastAttempt())
+}
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	job := &Job{ID: 1}
+	got, ok := FromContext(NewContext(context.Background(), job))
+	require.True(t, ok)
+	assert.Same(t, job, got)
+}
+
+func TestOptions(t *testing.T) {
+	opts := &Options{}
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, opt := range []Option{At(at), Unique("key"), MaxAttempts(2)} {
+		opt(opts)
+	}
+	assert.Equal(t, at, opts.RunAt)
+	assert.Equal(t, "key", opts.UniqueKey)
+	assert.Equal(t, 2, opts.MaxAttempts)
+
+	After(time.Hour)(opts)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), opts.RunAt, time.Second)
+}
+
+func TestHandle(t *testing.T) {
+	type args struct {
+		Name string `json:"name"`
+	}
+	const kind Kind[args] = "test.handle"
+
+	w := NewWorker(NewQueue(nil), 1)
+	var got args
+	Handle(w, kind, time.Minute, func(_ context.Context, a args) error {
+		got = a
+		return nil
+	})
+
+	h := w.handlers[string(kind)]
+	require.NotNil(t, h)
+	assert.Equal(t, time.Minute, h.timeout)
+
+	require.NoError(t, h.run(context.Background(), []byte(`{"name":"report"}`)))
+	assert.Equal(t, "report", got.Name)
+
+	assert.Error(t, h.run(context.Background(), []byte(`not json`)))
+}
+
+func TestWorker_RunHandler(t *testing.T) {
+	w := NewWorker(NewQueue(nil), 1)
+	job := &Job{Args: []byte(`{}`)}
+
+	err := w.runHandler(context.Background(), job, &handler{run: func(context.Context, json.RawMessage) error {
+		return errors.New("boom")
+	}})
+	assert.EqualError(t, err, "boom")
+
+	// A panic fails the attempt rather than the worker
+	err = w.runHandler(context.Background(), job, &handler{run: func(context.Context, json.RawMessage) error {
+		panic("boom")
+	}})
+	assert.EqualError(t, err, "job panicked: boom")
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pollInterval is how often due jobs are looked for when none were found
+	pollInterval = time.Second
+	// scheduleInterval is how often the next runs of scheduled jobs are enqueued
+	scheduleInterval = time.Minute
+	// retention is how long completed jobs are kept
+	retention = 7 * 24 * time.Hour
+)
+
+// errTimedOut is recorded for jobs whose worker went away during their last attempt
+var errTimedOut = errors.New("job timed out")
+
+// handler runs the jobs of a kind
+type handler struct {
+	run     func(ctx context.Context, args json.RawMessage) error
+	timeout time.Duration
+}
+
+// schedule is a kind of job run periodically
+type schedule struct {
+	enqueue  func(ctx context.Context, runAt time.Time) error
+	interval time.Duration
+}
+
+// Worker runs the jobs of the kinds it handles, up to a number of them at once
+type Worker struct {
+	queue       *Queue
+	concurrency int
+	handlers    map[string]*handler
+	schedules   []schedule
+	running     sync.WaitGroup
+	slots       chan struct{}
+}
+
+// NewWorker creates a worker running up to concurrency jobs of the queue at once
+func NewWorker(queue *Queue, concurrency int) *Worker {
+	return &Worker{
+		queue:       queue,
+		concurrency: concurrency,
+		handlers:    map[string]*handler{},
+		slots:       make(chan struct{}, concurrency),
+	}
+}
+
+// Handle registers the function running the jobs of a kind. The visibility timeout is how
+// long an attempt may take: the job is claimed again once it expires, and the context given
+// to the function is canceled then.
+func Handle[T any](w *Worker, kind Kind[T], timeout time.Duration, fn func(ctx context.Context, args T) error) {
+	w.handlers[string(kind)] = &handler{
+		run: func(ctx context.Context, data json.RawMessage) error {
+			var args T
+			if err := json.Unmarshal(data, &args); err != nil {
+				return fmt.Errorf("failed to unmarshal %s job arguments: %w", kind, err)
+			}
+			return fn(ctx, args)
+		},
+		timeout: timeout,
+	}
+}
+
+// Schedule runs a job of a kind every interval, with the zero value of its arguments. Runs are
+// aligned on multiples of the interval and enqueued with a unique key, so that workers running
+// side by side don't run them more than once.
+func Schedule[T any](w *Worker, kind Kind[T], interval time.Duration) {
+	var args T
+	w.schedules = append(w.schedules, schedule{
+		enqueue: func(ctx context.Context, runAt time.Time) error {
+			_, err := Enqueue(ctx, w.queue, kind, args, At(runAt), Unique(fmt.Sprintf("schedule:%s", kind)))
+			if errors.Is(err, ErrDuplicate) {
+				return nil
+			}
+			return err
+		},
+		interval: interval,
+	})
+}
+
+// Run claims and runs due jobs until the context is canceled, then waits for the jobs it is
+// running to finish. Their contexts aren't canceled along with it, only once their visibility
+// timeout expires.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var scheduled time.Time
+	for {
+		if time.Since(scheduled) >= scheduleInterval {
+			w.schedule(ctx)
+			scheduled = time.Now()
+		}
+
+		claimed := 0
+		for _, kind := range kinds {
+			n, err := w.claim(ctx, kind)
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msgf("failed to claim %s jobs", kind)
+			}
+			claimed += n
+		}
+
+		// Look for more right away while there were some, and room to run them
+		if claimed > 0 && len(w.slots) < w.concurrency && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			w.running.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule enqueues the next run of every scheduled job, and prunes old completed jobs
+func (w *Worker) schedule(ctx context.Context) {
+	now := time.Now()
+	for _, s := range w.schedules {
+		if err := s.enqueue(ctx, now.Truncate(s.interval).Add(s.interval)); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to schedule job")
+		}
+	}
+
+	pruned, err := w.queue.prune(ctx, now.Add(-retention))
+	if err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Msg("failed to prune completed jobs")
+	} else if pruned > 0 {
+		log.Info().Msgf("pruned %d completed jobs", pruned)
+	}
+}
+
+// claim claims as many due jobs of a kind as there is room for and starts running them,
+// returning how many were claimed
+func (w *Worker) claim(ctx context.Context, kind string) (int, error) {
+	free := w.concurrency - len(w.slots)
+	if free <= 0 {
+		return 0, nil
+	}
+
+	h := w.handlers[kind]
+	jobs, err := w.queue.claim(ctx, kind, free, h.timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range jobs {
+		w.slots <- struct{}{}
+		w.running.Add(1)
+		go func(job *Job) {
+			defer func() {
+				<-w.slots
+				w.running.Done()
+			}()
+			w.run(job, h)
+		}(&jobs[i])
+	}
+	return len(jobs), nil
+}
+
+// run makes an attempt at a claimed job and records its outcome
+func (w *Worker) run(job *Job, h *handler) {
+	ctx, cancel := context.WithTimeout(NewContext(context.Background(), job), h.timeout)
+	defer cancel()
+
+	logger := log.With().Int64("job_id", job.ID).Str("kind", job.Kind).Int("attempt", job.Attempts).Logger()
+
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// The last attempt was claimed, but never finished
+		err = errTimedOut
+	} else {
+		err = w.runHandler(ctx, job, h)
+	}
+
+	switch {
+	case err == nil:
+	case job.Attempts >= job.MaxAttempts:
+		logger.Error().Err(err).Msg("job failed")
+	default:
+		logger.Warn().Err(err).Msg("job attempt failed, it will be retried")
+	}
+
+	// The outcome is recorded even once the timeout expired
+	if err := w.queue.finish(context.WithoutCancel(ctx), job, err); err != nil {
+		logger.Error().Err(err).Msg("failed to record job outcome")
+	}
+}
+
+// runHandler runs a handler, turning a panic into the failure of the attempt
+func (w *Worker) runHandler(ctx context.Context, job *Job, h *handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h.run(ctx, job.Args)
+}
@@ -0,0 +1,226 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Test cases from RFC 7396 Appendix A
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+		{doc: `["a","b"]`, patch: `["c","d"]`, expected: `["c","d"]`},
+		{doc: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+		{doc: `{"a":"foo"}`, patch: `null`, expected: `null`},
+		{doc: `{"a":"foo"}`, patch: `"bar"`, expected: `"bar"`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, expected: `{"a":1,"e":null}`},
+		{doc: `[1,2]`, patch: `{"a":"b","c":null}`, expected: `{"a":"b"}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			result, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestMergePatch_InvalidPatch(t *testing.T) {
+	_, err := MergePatch([]byte(`{"a":"b"}`), []byte(`{"a":`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestApply(t *testing.T) {
+	// Test cases from RFC 6902 Appendix A
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "add object member",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expected: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:     "add array element",
+			doc:      `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expected: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "append array element",
+			doc:      `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			expected: `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:     "add null value",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":null}]`,
+			expected: `{"baz":null,"foo":"bar"}`,
+		},
+		{
+			name:     "remove object member",
+			doc:      `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			expected: `{"foo":"bar"}`,
+		},
+		{
+			name:     "remove array element",
+			doc:      `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			expected: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "replace value",
+			doc:      `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expected: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "move value",
+			doc:      `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "move array element",
+			doc:      `{"foo":["all","grass","cows","eat"]}`,
+			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			expected: `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:     "copy value",
+			doc:      `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`,
+			expected: `{"foo":{"bar":1},"baz":{"bar":2}}`,
+		},
+		{
+			name:     "test then replace",
+			doc:      `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:    `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2},{"op":"replace","path":"/baz","value":"x"}]`,
+			expected: `{"baz":"x","foo":["a",2,"c"]}`,
+		},
+		{
+			name:     "escaped pointer",
+			doc:      `{"/":9,"~1":10}`,
+			patch:    `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`,
+			expected: `{"~1":10}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected error
+	}{
+		{
+			name:     "not an array of operations",
+			doc:      `{"foo":"bar"}`,
+			patch:    `{"op":"remove","path":"/foo"}`,
+			expected: ErrInvalidPatch,
+		},
+		{
+			name:     "unknown operation",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"upsert","path":"/foo","value":1}]`,
+			expected: ErrInvalidPatch,
+		},
+		{
+			name:     "missing value",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/foo"}]`,
+			expected: ErrInvalidPatch,
+		},
+		{
+			name:     "relative pointer",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"foo"}]`,
+			expected: ErrInvalidPatch,
+		},
+		{
+			name:     "move into own child",
+			doc:      `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`,
+			expected: ErrInvalidPatch,
+		},
+		{
+			name:     "remove missing member",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			expected: ErrPathNotFound,
+		},
+		{
+			name:     "replace missing member",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":1}]`,
+			expected: ErrPathNotFound,
+		},
+		{
+			name:     "add to missing parent",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			expected: ErrPathNotFound,
+		},
+		{
+			name:     "array index out of bounds",
+			doc:      `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/2","value":"qux"}]`,
+			expected: ErrPathNotFound,
+		},
+		{
+			name:     "array index with leading zero",
+			doc:      `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/01"}]`,
+			expected: ErrPathNotFound,
+		},
+		{
+			name:     "failed test",
+			doc:      `{"baz":"qux"}`,
+			patch:    `[{"op":"test","path":"/baz","value":"bar"}]`,
+			expected: ErrTestFailed,
+		},
+		{
+			name:     "test number against string",
+			doc:      `{"baz":"10"}`,
+			patch:    `[{"op":"test","path":"/baz","value":10}]`,
+			expected: ErrTestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// consumeBatch is how many events are read at once
+	consumeBatch = 50
+	// consumeBlock is how long a read waits for new events
+	consumeBlock = 5 * time.Second
+	// claimIdle is how long an event is left to the consumer it was delivered to before another
+	// one of its group takes it over, because it failed or the consumer went away
+	claimIdle = time.Minute
+)
+
+// Handler handles an event read from a stream. Events are handled at least once, a handler
+// returning an error gets the event again later, so handlers must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+// Consumer reads the events of a topic as a member of a consumer group. Each event is handled
+// by a single consumer of the group, and every group gets all the events.
+type Consumer struct {
+	client    *redis.Client
+	stream    string
+	group     string
+	name      string
+	handler   Handler
+	claimIdle time.Duration
+}
+
+// NewConsumer creates a consumer of the events of a topic in the given group, named after the
+// host and process it runs in
+func NewConsumer(client *redis.Client, topic, group string, handler Handler) *Consumer {
+	host, _ := os.Hostname()
+	return &Consumer{
+		client:    client,
+		stream:    Stream(topic),
+		group:     group,
+		name:      fmt.Sprintf("%s-%d", host, os.Getpid()),
+		handler:   handler,
+		claimIdle: claimIdle,
+	}
+}
+
+// Run handles events until the context is canceled or reading them fails. A group created
+// by the first consumer of it starts at the beginning of the stream.
+func (c *Consumer) Run(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s: %w", c.group, err)
+	}
+
+	var claimed time.Time
+	for ctx.Err() == nil {
+		// Take over the events other consumers of the group failed to handle, or left behind
+		if time.Since(claimed) >= c.claimIdle {
+			if err := c.claim(ctx); err != nil {
+				return err
+			}
+			claimed = time.Now()
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.name,
+			Streams:  []string{c.stream, ">"},
+			Count:    consumeBatch,
+			Block:    consumeBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("failed to read %s: %w", c.stream, err)
+		}
+
+		for _, stream := range streams {
+			c.handle(ctx, stream.Messages)
+		}
+	}
+	return ctx.Err()
+}
+
+// claim handles the events of the group that have been pending for too long
+func (c *Consumer) claim(ctx context.Context) error {
+	start := "0-0"
+	for {
+		messages, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.name,
+			MinIdle:  c.claimIdle,
+			Start:    start,
+			Count:    consumeBatch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to claim pending events of %s: %w", c.stream, err)
+		}
+
+		c.handle(ctx, messages)
+
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// handle hands events to the handler, acknowledging those it handled. The others stay
+// pending, to be claimed again once idle for long enough.
+func (c *Consumer) handle(ctx context.Context, messages []redis.XMessage) {
+	for _, msg := range messages {
+		event, err := parseEvent(msg)
+		if err != nil {
+			// It would never be handled, retrying it is pointless
+			log.Error().Err(err).Msgf("skipping event of %s", c.stream)
+		} else if err := c.handler(ctx, event); err != nil {
+			log.Warn().Err(err).Msgf("failed to handle %s event %s, it will be retried", event.Type, event.ID)
+			continue
+		}
+
+		if err := c.client.XAck(ctx, c.stream, c.group, msg.ID).Err(); err != nil {
+			log.Warn().Err(err).Msgf("failed to acknowledge event %s", msg.ID)
+		}
+	}
+}
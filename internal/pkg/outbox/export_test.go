@@ -0,0 +1,11 @@
+//go:build integration
+
+package outbox
+
+import "time"
+
+// SetClaimIdle shortens how long events are left pending before being taken over, so that
+// tests don't wait for a minute
+func (c *Consumer) SetClaimIdle(d time.Duration) {
+	c.claimIdle = d
+}
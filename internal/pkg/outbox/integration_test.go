@@ -0,0 +1,202 @@
+//go:build integration
+
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	// Run standard migrations, they include the outbox
+	sharedContainer.RunStandardMigrations(&testing.T{})
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+// recorder is a handler recording the events it handles, failing the first ones if asked to
+type recorder struct {
+	mu       sync.Mutex
+	events   []outbox.Event
+	failures int
+}
+
+func (r *recorder) handle(_ context.Context, event outbox.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("handler failed")
+	}
+	r.events = append(r.events, event)
+	return nil
+}
+
+// types returns the types of the events handled so far, in order
+func (r *recorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	types := make([]string, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// consume runs a consumer until the test ends
+func consume(t *testing.T, consumer *outbox.Consumer) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestOutboxRelayIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+	ctx := context.Background()
+	box := outbox.New(sharedContainer.DB)
+	relay := outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 100)
+
+	// Events of committed transactions are relayed, those of rolled back ones never exist
+	tx := sharedContainer.DB.Begin()
+	require.NoError(t, box.Add(ctx, "things", "thing.created", map[string]int{"id": 1}, db.WithTx(tx)))
+	require.NoError(t, tx.Commit().Error)
+
+	tx = sharedContainer.DB.Begin()
+	require.NoError(t, box.Add(ctx, "things", "thing.deleted", map[string]int{"id": 1}, db.WithTx(tx)))
+	require.NoError(t, tx.Rollback().Error)
+
+	require.NoError(t, box.Add(ctx, "others", "other.created", map[string]int{"id": 2}))
+
+	relayed, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, relayed)
+
+	// Relayed messages leave the outbox
+	var count int64
+	require.NoError(t, sharedContainer.DB.Model(&outbox.Message{}).Count(&count).Error)
+	assert.Zero(t, count)
+	relayed, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, relayed)
+
+	entries, err := sharedContainer.Redis.XRange(ctx, outbox.Stream("things"), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "thing.created", entries[0].Values["type"])
+	assert.JSONEq(t, `{"id":1}`, entries[0].Values["payload"].(string))
+
+	entries, err = sharedContainer.Redis.XRange(ctx, outbox.Stream("others"), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "other.created", entries[0].Values["type"])
+}
+
+func TestOutboxRelayLockIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+	ctx := context.Background()
+	box := outbox.New(sharedContainer.DB)
+	relay := outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 100)
+	require.NoError(t, box.Add(ctx, "things", "thing.created", map[string]int{"id": 1}))
+
+	// Another instance relaying holds the lock, this one leaves the outbox alone
+	tx := sharedContainer.DB.Begin()
+	require.NoError(t, tx.Exec("SELECT pg_advisory_xact_lock(7340201)").Error)
+	relayed, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, relayed)
+	require.NoError(t, tx.Rollback().Error)
+
+	relayed, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, relayed)
+}
+
+func TestOutboxConsumerGroupsIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+	ctx := context.Background()
+	box := outbox.New(sharedContainer.DB)
+	relay := outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 100)
+
+	// Events written before a group exists are delivered to it too
+	for _, eventType := range []string{"thing.created", "thing.updated"} {
+		require.NoError(t, box.Add(ctx, "things", eventType, map[string]int{"id": 1}))
+	}
+	_, err := relay.Relay(ctx)
+	require.NoError(t, err)
+
+	// Every group gets every event
+	cache, audit := &recorder{}, &recorder{}
+	consume(t, outbox.NewConsumer(sharedContainer.Redis, "things", "cache", cache.handle))
+	consume(t, outbox.NewConsumer(sharedContainer.Redis, "things", "audit", audit.handle))
+
+	require.NoError(t, box.Add(ctx, "things", "thing.deleted", map[string]int{"id": 1}))
+	_, err = relay.Relay(ctx)
+	require.NoError(t, err)
+
+	expected := []string{"thing.created", "thing.updated", "thing.deleted"}
+	require.Eventually(t, func() bool { return len(cache.types()) == 3 && len(audit.types()) == 3 }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, expected, cache.types())
+	assert.Equal(t, expected, audit.types())
+
+	var payload map[string]int
+	require.NoError(t, json.Unmarshal(cache.events[0].Payload, &payload))
+	assert.Equal(t, map[string]int{"id": 1}, payload)
+
+	// Handled events are acknowledged
+	pending, err := sharedContainer.Redis.XPending(ctx, outbox.Stream("things"), "cache").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
+func TestOutboxConsumerRetryIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+	ctx := context.Background()
+	box := outbox.New(sharedContainer.DB)
+	relay := outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 100)
+
+	// Events the handler fails are left pending, and handled again once claimed
+	handler := &recorder{failures: 1}
+	consumer := outbox.NewConsumer(sharedContainer.Redis, "things", "cache", handler.handle)
+	consumer.SetClaimIdle(100 * time.Millisecond)
+	consume(t, consumer)
+
+	require.NoError(t, box.Add(ctx, "things", "thing.created", map[string]int{"id": 1}))
+	_, err := relay.Relay(ctx)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(handler.types()) == 1 }, 15*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []string{"thing.created"}, handler.types())
+
+	require.Eventually(t, func() bool {
+		pending, err := sharedContainer.Redis.XPending(ctx, outbox.Stream("things"), "cache").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,123 @@
+// Package outbox implements the transactional outbox pattern. Domain events are written to the
+// outbox table in the transaction of the change they describe, so that both are committed or
+// neither is, and a relay publishes them to Redis Streams afterwards. Consumer groups read the
+// streams, every event is delivered at least once to each group.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"gorm.io/gorm"
+)
+
+// Message represents a domain event waiting in the outbox to be published on its topic
+type Message struct {
+	ID        int64           `gorm:"primaryKey"`
+	Topic     string          `gorm:"not null"`
+	Type      string          `gorm:"not null"`
+	Payload   json.RawMessage `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time
+}
+
+// TableName keeps outbox messages in the outbox table
+func (Message) TableName() string {
+	return "outbox"
+}
+
+// NewMessage creates a message carrying an event of the given type on a topic
+func NewMessage(topic, eventType string, data any) (*Message, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+
+	return &Message{
+		Topic:     topic,
+		Type:      eventType,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Event represents a domain event as read from the stream of its topic. The ID is the one of
+// the stream entry, events redelivered after a failure keep it.
+type Event struct {
+	ID        string
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Stream returns the name of the Redis stream the events of a topic are published to
+func Stream(topic string) string {
+	return "outbox:" + topic
+}
+
+// values returns the fields of the stream entry of a message
+func (m *Message) values() map[string]any {
+	return map[string]any{
+		"type":       m.Type,
+		"payload":    string(m.Payload),
+		"created_at": strconv.FormatInt(m.CreatedAt.UnixMilli(), 10),
+	}
+}
+
+// parseEvent reads an event back from a stream entry
+func parseEvent(msg redis.XMessage) (Event, error) {
+	eventType, _ := msg.Values["type"].(string)
+	payload, _ := msg.Values["payload"].(string)
+	createdAt, _ := msg.Values["created_at"].(string)
+	if eventType == "" || !json.Valid([]byte(payload)) {
+		return Event{}, fmt.Errorf("malformed outbox event %s", msg.ID)
+	}
+
+	millis, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("malformed outbox event %s: %w", msg.ID, err)
+	}
+
+	return Event{
+		ID:        msg.ID,
+		Type:      eventType,
+		Payload:   json.RawMessage(payload),
+		CreatedAt: time.UnixMilli(millis),
+	}, nil
+}
+
+// Outbox writes domain events to the outbox table
+type Outbox struct {
+	dbConn *gorm.DB
+}
+
+// New creates an outbox writing to the provided database connection
+func New(dbConn *gorm.DB) *Outbox {
+	return &Outbox{dbConn: dbConn}
+}
+
+// Add writes an event to the outbox. It is meant to be given the transaction of the change the
+// event describes with db.WithTx, the event is then only published if the change is committed.
+func (o *Outbox) Add(ctx context.Context, topic, eventType string, data any, options ...db.Option) error {
+	dbConn := o.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	msg, err := NewMessage(topic, eventType, data)
+	if err != nil {
+		return err
+	}
+
+	return dbConn.WithContext(ctx).Create(msg).Error
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMessage(t *testing.T) {
+	msg, err := NewMessage("todos", "todo.created", map[string]any{"id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "todos", msg.Topic)
+	assert.Equal(t, "todo.created", msg.Type)
+	assert.JSONEq(t, `{"id":1}`, string(msg.Payload))
+	assert.WithinDuration(t, time.Now(), msg.CreatedAt, time.Second)
+
+	_, err = NewMessage("todos", "todo.created", make(chan int))
+	assert.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	assert.Equal(t, "outbox:todos", Stream("todos"))
+}
+
+func TestParseEvent(t *testing.T) {
+	msg, err := NewMessage("users", "user.created", map[string]any{"email": "john@example.com"})
+	require.NoError(t, err)
+
+	// Stream entries hold strings
+	values := map[string]any{}
+	for field, value := range msg.values() {
+		values[field] = value
+	}
+
+	event, err := parseEvent(redis.XMessage{ID: "1-0", Values: values})
+	require.NoError(t, err)
+	assert.Equal(t, "1-0", event.ID)
+	assert.Equal(t, "user.created", event.Type)
+	assert.Equal(t, json.RawMessage(`{"email":"john@example.com"}`), event.Payload)
+	assert.Equal(t, msg.CreatedAt.UnixMilli(), event.CreatedAt.UnixMilli())
+}
+
+func TestParseEvent_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+	}{
+		{name: "no type", values: map[string]any{"payload": "{}", "created_at": "1"}},
+		{name: "invalid payload", values: map[string]any{"type": "user.created", "payload": "{", "created_at": "1"}},
+		{name: "no payload", values: map[string]any{"type": "user.created", "created_at": "1"}},
+		{name: "invalid timestamp", values: map[string]any{"type": "user.created", "payload": "{}", "created_at": "now"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEvent(redis.XMessage{ID: "1-0", Values: tt.values})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// relayInterval is how often the outbox is looked at when it was found empty
+	relayInterval = time.Second
+	// relayBatch is how many messages are published at once
+	relayBatch = 100
+	// relayLock is the key of the advisory lock held while relaying, so that a single instance
+	// relays at a time and events are published in the order they were written
+	relayLock = 7_340_201
+)
+
+// Relay publishes the messages of the outbox to the streams of their topics
+type Relay struct {
+	dbConn *gorm.DB
+	client *redis.Client
+	maxLen int64
+}
+
+// NewRelay creates a relay from the outbox of the provided database to Redis, keeping roughly
+// the last maxLen events of each topic in its stream
+func NewRelay(dbConn *gorm.DB, client *redis.Client, maxLen int64) *Relay {
+	return &Relay{
+		dbConn: dbConn,
+		client: client,
+		maxLen: maxLen,
+	}
+}
+
+// Run relays messages until the context is canceled. Every instance may run it, they take
+// turns.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	for {
+		relayed, err := r.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to relay outbox")
+		}
+
+		// A full batch means more are waiting
+		if err == nil && relayed == relayBatch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay publishes a batch of messages and removes them from the outbox, returning how many
+// were published. They are removed once published, so a failure in between publishes them
+// again the next time: events are delivered at least once.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	// Start database transaction
+	tx := r.dbConn.WithContext(ctx).Begin()
+
+	// Another instance relaying holds the lock until its transaction ends
+	var locked bool
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", relayLock).Scan(&locked).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	if !locked {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	var messages []Message
+	if err := tx.Order("id").Limit(relayBatch).Find(&messages).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to get outbox messages: %w", err)
+	}
+	if len(messages) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	pipe := r.client.Pipeline()
+	ids := make([]int64, 0, len(messages))
+	for i := range messages {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: Stream(messages[i].Topic),
+			MaxLen: r.maxLen,
+			Approx: true,
+			Values: messages[i].values(),
+		})
+		ids = append(ids, messages[i].ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to publish outbox messages: %w", err)
+	}
+
+	if err := tx.Delete(&Message{}, ids).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to delete published outbox messages: %w", err)
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return len(messages), nil
+}
@@ -0,0 +1,29 @@
+// Package pagination provides the cursors of lists paged by ID, where the cursor of a page is
+// the ID of the last item of the previous one.
+package pagination
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor returns the cursor of the page after the item with the given ID
+func EncodeCursor(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// DecodeCursor parses a cursor into the ID of the last item of the previous page, returning
+// zero for an empty cursor
+func DecodeCursor(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
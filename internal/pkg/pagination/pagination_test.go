@@ -0,0 +1,23 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	id, err := DecodeCursor("")
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	id, err = DecodeCursor(EncodeCursor(42))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	for _, cursor := range []string{"abc", "0", "-1"} {
+		_, err := DecodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
@@ -0,0 +1,263 @@
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits are the base 62 digits of a key, in byte order
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// First is the key of the first item of an empty list
+const First = "a0"
+
+// MaxLength is the key length past which a list should be rebalanced
+const MaxLength = 32
+
+// smallestInteger is the integer part below which no key can be generated
+const smallestInteger = "A00000000000000000000000000"
+
+var (
+	// ErrInvalidKey is returned when a key is malformed or the bounds of a key are out of order
+	ErrInvalidKey = errors.New("invalid rank key")
+	// ErrExhausted is returned when no key exists past the bounds, which needs a rebalance
+	ErrExhausted = errors.New("rank keys exhausted")
+)
+
+// Between returns a key that sorts strictly between a and b, byte-wise. An empty a means
+// the start of the list and an empty b its end. Keys are made of a variable length integer
+// part, whose length is given by its first character, and a fractional part, so adding at
+// either end of a list only grows keys logarithmically.
+//
+// This is the fractional indexing scheme described in
+// https://observablehq.com/@dgreensp/implementing-fractional-indexing
+func Between(a, b string) (string, error) {
+	if a != "" {
+		if err := validate(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := validate(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrInvalidKey
+	}
+
+	switch {
+	case a == "" && b == "":
+		return First, nil
+	case a == "":
+		ib := integerPart(b)
+		fb := b[len(ib):]
+		if ib == smallestInteger {
+			return ib + midpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		res, ok := decrement(ib)
+		if !ok {
+			return "", ErrExhausted
+		}
+		return res, nil
+	case b == "":
+		ia := integerPart(a)
+		fa := a[len(ia):]
+		if res, ok := increment(ia); ok {
+			return res, nil
+		}
+		return ia + midpoint(fa, ""), nil
+	}
+
+	ia := integerPart(a)
+	fa := a[len(ia):]
+	ib := integerPart(b)
+	fb := b[len(ib):]
+	if ia == ib {
+		return ia + midpoint(fa, fb), nil
+	}
+
+	res, ok := increment(ia)
+	if !ok {
+		return "", ErrExhausted
+	}
+	if res < b {
+		return res, nil
+	}
+	return ia + midpoint(fa, ""), nil
+}
+
+// Sequence returns n increasing keys that are as short as possible, to rebalance a list
+func Sequence(n int) []string {
+	keys := make([]string, 0, n)
+	key := First
+	for range n {
+		keys = append(keys, key)
+		// Integer parts run out long after any list a user could build
+		key, _ = increment(key)
+	}
+	return keys
+}
+
+// midpoint returns the fractional part between fractional parts a and b, where an empty
+// b means past the end. Fractional parts never end with a zero digit, so there is always
+// room below them.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Skip the common prefix, treating a as padded with zero digits
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(digits, a[0])
+	}
+	digitB := len(digits)
+	if b != "" {
+		digitB = strings.IndexByte(digits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(digits[(digitA+digitB+1)/2])
+	}
+
+	// The first digits are consecutive, a longer b still fits its first digit in between
+	if len(b) > 1 {
+		return b[:1]
+	}
+
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[digitA]) + midpoint(rest, "")
+}
+
+// digitAt returns the digit of s at index i, reading past its end as zero
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+// integerLength returns the length of the integer part starting with the given head,
+// or zero for an invalid head. Heads a to z are increasingly long positive integers
+// and heads Z to A increasingly long negative ones.
+func integerLength(head byte) int {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2
+	default:
+		return 0
+	}
+}
+
+// integerPart returns the integer part of a validated key
+func integerPart(key string) string {
+	return key[:integerLength(key[0])]
+}
+
+// validate checks that a key has a complete integer part made of digits and a
+// fractional part that doesn't end with a zero digit
+func validate(key string) error {
+	n := integerLength(key[0])
+	if n == 0 || n > len(key) || key == smallestInteger {
+		return ErrInvalidKey
+	}
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return ErrInvalidKey
+		}
+	}
+	if len(key) > n && key[len(key)-1] == digits[0] {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// increment returns the next integer part, or false past the largest one
+func increment(x string) (string, bool) {
+	head, digs := x[0], []byte(x[1:])
+
+	carry := true
+	for i := len(digs) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) + 1
+		if d == len(digits) {
+			digs[i] = digits[0]
+		} else {
+			digs[i] = digits[d]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digs), true
+	}
+
+	switch head {
+	case 'Z':
+		return "a" + string(digits[0]), true
+	case 'z':
+		return "", false
+	}
+
+	// The next head has one more digit for positive integers and one less for negative ones
+	next := head + 1
+	if next > 'a' {
+		digs = append(digs, digits[0])
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(next) + string(digs), true
+}
+
+// decrement returns the previous integer part, or false below the smallest one
+func decrement(x string) (string, bool) {
+	head, digs := x[0], []byte(x[1:])
+	last := digits[len(digits)-1]
+
+	borrow := true
+	for i := len(digs) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) - 1
+		if d == -1 {
+			digs[i] = last
+		} else {
+			digs[i] = digits[d]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digs), true
+	}
+
+	switch head {
+	case 'a':
+		return "Z" + string(last), true
+	case 'A':
+		return "", false
+	}
+
+	// The previous head has one less digit for positive integers and one more for negative ones
+	prev := head - 1
+	if prev < 'Z' {
+		digs = append(digs, last)
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(prev) + string(digs), true
+}
@@ -0,0 +1,95 @@
+package rank
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{a: "", b: "", expected: "a0"},
+		{a: "", b: "a0", expected: "Zz"},
+		{a: "a0", b: "", expected: "a1"},
+		{a: "a1", b: "a2", expected: "a1V"},
+		{a: "a0V", b: "a1", expected: "a0l"},
+		{a: "Zz", b: "a0", expected: "ZzV"},
+		{a: "a0", b: "a0V", expected: "a0G"},
+		{a: "az", b: "", expected: "b00"},
+		{a: "", b: "a0V", expected: "a0"},
+		{a: "b125", b: "b13", expected: "b12Y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			key, err := Between(tt.a, tt.b)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, key)
+		})
+	}
+}
+
+func TestBetween_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "out of order", a: "a2", b: "a1"},
+		{name: "equal", a: "a1", b: "a1"},
+		{name: "invalid head", a: "!0"},
+		{name: "short integer", b: "b1"},
+		{name: "trailing zero", a: "a10"},
+		{name: "invalid digit", b: "a1-"},
+		{name: "smallest integer", b: smallestInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Between(tt.a, tt.b)
+			assert.ErrorIs(t, err, ErrInvalidKey)
+		})
+	}
+}
+
+func TestBetween_Repeated(t *testing.T) {
+	// Appending and prepending keep keys short
+	first, last := First, First
+	for range 1000 {
+		var err error
+		first, err = Between("", first)
+		require.NoError(t, err)
+		last, err = Between(last, "")
+		require.NoError(t, err)
+	}
+	assert.Less(t, first, last)
+	assert.LessOrEqual(t, len(first), 3)
+	assert.LessOrEqual(t, len(last), 3)
+
+	// Inserting repeatedly at the same place grows keys until a rebalance is due
+	a, b := "a0", "a1"
+	for range 200 {
+		key, err := Between(a, b)
+		require.NoError(t, err)
+		assert.Less(t, a, key)
+		assert.Less(t, key, b)
+		b = key
+	}
+	assert.Greater(t, len(b), MaxLength)
+}
+
+func TestSequence(t *testing.T) {
+	assert.Empty(t, Sequence(0))
+
+	keys := Sequence(100)
+	require.Len(t, keys, 100)
+	assert.Equal(t, First, keys[0])
+	assert.Equal(t, "az", keys[61])
+	assert.Equal(t, "b00", keys[62])
+	for i := 1; i < len(keys); i++ {
+		assert.Less(t, keys[i-1], keys[i])
+	}
+}
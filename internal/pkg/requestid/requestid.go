@@ -0,0 +1,18 @@
+package requestid
+
+import "context"
+
+// contextKey is the context key type for the request ID
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the given request ID
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// FromContext returns the request ID carried by the context, or an empty string
+// when the context doesn't belong to a request
+func FromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,17 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	ctx := NewContext(context.Background(), "req-123")
+	assert.Equal(t, "req-123", FromContext(ctx))
+}
+
+func TestFromContext_Missing(t *testing.T) {
+	assert.Equal(t, "", FromContext(context.Background()))
+}
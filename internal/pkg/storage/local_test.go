@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocal(filepath.Join(t.TempDir(), "blobs"))
+	require.NoError(t, err)
+
+	testBlobStore(t, store)
+}
+
+func TestLocalStore_ShortRead(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocal(root)
+	require.NoError(t, err)
+
+	err = store.Put(context.Background(), "short", strings.NewReader("abc"), 10)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Neither the blob nor the temporary file is left behind
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/config"
+)
+
+var (
+	// ErrNotFound is returned when a blob doesn't exist in the store
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned when a key is empty or would escape the store, like ../x
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore stores opaque blobs of bytes by key. Keys are slash separated paths.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any blob stored there
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get streams the blob stored under key, starting at the given offset
+	Get(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the blob store selected by the configuration
+func New(cfg config.Storage) (BlobStore, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.Dir)
+	case "s3":
+		s3Store, err := NewS3(S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Bucket:          cfg.S3Bucket,
+			Region:          cfg.S3Region,
+			AccessKeyID:     cfg.S3AccessKey,
+			SecretAccessKey: cfg.S3SecretKey,
+		}, &http.Client{Timeout: 5 * time.Minute})
+		if err != nil {
+			return nil, err
+		}
+
+		// Credentials scoped to an existing bucket may not be allowed to create one
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s3Store.CreateBucket(ctx); err != nil {
+			log.Warn().Err(err).Msgf("could not create bucket %s", cfg.S3Bucket)
+		}
+		return s3Store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// validateKey checks that a key is a clean relative path
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// Reader reads a blob of known size from a store, seeking by reopening the blob at the new
+// offset. It satisfies io.ReadSeeker, so blobs can be served with http.ServeContent, which
+// handles Range requests, without reading them upfront.
+type Reader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewReader creates a reader of the blob of the given size stored under key
+func NewReader(ctx context.Context, store BlobStore, key string, size int64) *Reader {
+	return &Reader{ctx: ctx, store: store, key: key, size: size}
+}
+
+// Read reads from the current offset, opening the blob there on first use
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.store.Get(r.ctx, r.key, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the offset of the next read. The blob is only reopened by the next read,
+// so seeking around to find the size, like http.ServeContent does, costs nothing.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the blob if it was opened
+func (r *Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
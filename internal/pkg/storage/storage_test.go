@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{key: "attachments/1/abc", valid: true},
+		{key: "file.txt", valid: true},
+		{key: "", valid: false},
+		{key: "/etc/passwd", valid: false},
+		{key: "..", valid: false},
+		{key: "../secret", valid: false},
+		{key: "a/../../secret", valid: false},
+		{key: "a//b", valid: false},
+		{key: "a/b/", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := validateKey(tt.key)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+// countingStore counts the number of times blobs are opened
+type countingStore struct {
+	BlobStore
+	gets int
+}
+
+func (s *countingStore) Get(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	s.gets++
+	return s.BlobStore.Get(ctx, key, offset)
+}
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	content := "0123456789abcdefghij"
+	require.NoError(t, local.Put(ctx, "blob", strings.NewReader(content), int64(len(content))))
+
+	store := &countingStore{BlobStore: local}
+	r := NewReader(ctx, store, "blob", int64(len(content)))
+	defer r.Close()
+
+	// Finding the size doesn't open the blob
+	size, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, 0, store.gets)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "01234", string(buf))
+
+	// Seeking to the current offset keeps the blob open
+	_, err = r.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", string(buf))
+	assert.Equal(t, 1, store.gets)
+
+	_, err = r.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "fghij", string(rest))
+	assert.Equal(t, 2, store.gets)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
+
+func TestReader_NotFound(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	r := NewReader(context.Background(), local, "missing", 10)
+	_, err = r.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, r.Close())
+}
+
+// testBlobStore runs the behaviour every BlobStore implementation shares
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	content := []byte("hello, attachments")
+
+	require.NoError(t, store.Put(ctx, "todos/1/blob", bytes.NewReader(content), int64(len(content))))
+
+	body, err := store.Get(ctx, "todos/1/blob", 0)
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, content, data)
+
+	body, err = store.Get(ctx, "todos/1/blob", 7)
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "attachments", string(data))
+
+	body, err = store.Get(ctx, "todos/1/blob", int64(len(content)))
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Empty(t, data)
+
+	// Putting again replaces the blob
+	require.NoError(t, store.Put(ctx, "todos/1/blob", strings.NewReader("new"), 3))
+	body, err = store.Get(ctx, "todos/1/blob", 0)
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, "new", string(data))
+
+	require.NoError(t, store.Delete(ctx, "todos/1/blob"))
+	_, err = store.Get(ctx, "todos/1/blob", 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a missing blob isn't an error
+	assert.NoError(t, store.Delete(ctx, "todos/1/blob"))
+
+	assert.ErrorIs(t, store.Put(ctx, "../escape", strings.NewReader("x"), 1), ErrInvalidKey)
+	_, err = store.Get(ctx, "/absolute", 0)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/config"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
 	"github.com/syahidfrd/go-boilerplate/internal/user"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -196,6 +197,6 @@ func SetupTestMain() (*Container, func() int) {
 func (c *Container) RunStandardMigrations(t *testing.T) {
 	t.Helper()
 
-	err := c.DB.AutoMigrate(&user.User{}, &user.Preference{})
+	err := c.DB.AutoMigrate(&user.User{}, &user.Preference{}, &outbox.Message{})
 	require.NoError(t, err)
 }
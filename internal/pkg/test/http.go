@@ -21,6 +21,7 @@ type HTTPRequest struct {
 // HTTPResponse represents an HTTP response for testing
 type HTTPResponse struct {
 	StatusCode int
+	Headers    http.Header
 	Body       map[string]any
 	RawBody    []byte
 }
@@ -55,6 +56,7 @@ func MakeJSONRequest(t *testing.T, handler http.HandlerFunc, req HTTPRequest) *H
 
 	response := &HTTPResponse{
 		StatusCode: w.Code,
+		Headers:    w.Header(),
 		RawBody:    w.Body.Bytes(),
 	}
 
@@ -0,0 +1,65 @@
+//go:build integration
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/idempotency"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+func TestIdempotencyAnonymousIntegration(t *testing.T) {
+	sharedContainer.CleanupAll(t)
+
+	// Like sign ups, each request creates a user and answers with it
+	var users int
+	signup := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":` + strconv.Itoa(users) + `}`))
+	})
+	h := realIPMiddleware(idempotency.NewMiddleware(sharedContainer.Redis, time.Hour, idempotencyScope).Handle(signup))
+
+	serve := func(clientIP, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/signup", strings.NewReader(body))
+		r.Header.Set(idempotency.Header, "signup")
+		r.Header.Set("X-Real-IP", clientIP)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Two clients picking the same key each get their own user
+	alice := serve("203.0.113.7", `{"email":"alice@example.com"}`)
+	assert.Equal(t, http.StatusCreated, alice.Code)
+	assert.Equal(t, `{"id":1}`, alice.Body.String())
+
+	bob := serve("198.51.100.2", `{"email":"bob@example.com"}`)
+	assert.Equal(t, http.StatusCreated, bob.Code)
+	assert.Equal(t, `{"id":2}`, bob.Body.String())
+	assert.Empty(t, bob.Header().Get(idempotency.ReplayedHeader))
+
+	// Retries of a client still get its response back
+	retry := serve("203.0.113.7", `{"email":"alice@example.com"}`)
+	assert.Equal(t, `{"id":1}`, retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(idempotency.ReplayedHeader))
+	assert.Equal(t, 2, users)
+}
@@ -5,17 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/requestid"
 )
 
+// maxLoggedBody is how much of a JSON request body is captured for logging
+const maxLoggedBody = 4 << 10
+
 // Middleware represents a function that wraps an HTTP handler
 type Middleware func(http.Handler) http.Handler
 
@@ -54,6 +61,30 @@ func (rw *responseWriter) WriteHeader(code int) {
 	}
 }
 
+// Write writes the response body, with an implicit 200 status if none was written yet
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, for streamed responses
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, so that http.ResponseController can reach
+// the features of the underlying connection, like write deadlines
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // logSeverity determines the log level based on HTTP status code
 func logSeverity(statusCode int) zerolog.Level {
 	switch {
@@ -108,13 +139,16 @@ func loggerMiddleware(filter func(w http.ResponseWriter, r *http.Request) bool)
 			// Start timer
 			start := time.Now()
 
-			// Read request body
+			// Capture the start of JSON request bodies, the handler reads what was captured
+			// followed by the rest. Other bodies, like uploads and imports, are left alone so
+			// that they aren't buffered before the handler limits them, nor logged.
 			var buf []byte
-			if r.Body != nil {
-				buf, _ = io.ReadAll(r.Body)
-
-				// Restore the io.ReadCloser to its original state
-				r.Body = io.NopCloser(bytes.NewBuffer(buf))
+			if r.Body != nil && isJSON(r) {
+				buf, _ = io.ReadAll(io.LimitReader(r.Body, maxLoggedBody))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
 			}
 
 			// Wraps an http.ResponseWriter, returning a proxy that allows you to
@@ -130,7 +164,7 @@ func loggerMiddleware(filter func(w http.ResponseWriter, r *http.Request) bool)
 				Host:       r.Host,
 				UserAgent:  r.UserAgent(),
 				Method:     r.Method,
-				Path:       r.URL.Path,
+				Path:       redactPath(r.URL.Path),
 				Body:       formatReqBody(r, buf),
 				StatusCode: ww.Status(),
 				Latency:    dur,
@@ -143,6 +177,27 @@ func loggerMiddleware(filter func(w http.ResponseWriter, r *http.Request) bool)
 	}
 }
 
+// redactPath hides the secrets some paths carry, like the token of iCalendar feeds
+func redactPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/feeds/")
+	if !ok {
+		return path
+	}
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		return "/feeds/[REDACTED]" + rest[i:]
+	}
+	return "/feeds/[REDACTED]"
+}
+
+// isJSON reports whether the body of a request is JSON, as told by its content type
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
 // formatReqBody formats request body for logging, compacting JSON if valid
 func formatReqBody(r *http.Request, data []byte) string {
 	// Skip logging body for sensitive endpoints
@@ -245,6 +300,7 @@ func requestIDMiddleware(next http.Handler) http.Handler {
 			Str("request_id", r.Header.Get(requestIDHeader)).
 			Logger().
 			WithContext(r.Context())
+		ctx = requestid.NewContext(ctx, requestID)
 
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
@@ -255,10 +311,11 @@ func requestIDMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, Location")
 
 		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, HEAD, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Last-Event-ID, Idempotency-Key, If-Match, If-None-Match")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, PATCH, POST, HEAD, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Set("Access-Control-Max-Age", "3600")
 			w.WriteHeader(http.StatusNoContent)
@@ -268,3 +325,19 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// idempotencyScope scopes idempotency keys by the authenticated user, or by the client address
+// of anonymous requests like sign ups, so that clients picking the same key don't get each
+// other's responses
+func idempotencyScope(r *http.Request) string {
+	if userID, ok := auth.GetUserIDFromContext(r.Context()); ok {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+
+	// Retries may come from another port of the same client
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anonymous:" + host
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+// Read implements the io.Reader interface
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+// serveLogged serves a request through the logger middleware, returning the response and
+// what was logged
+func serveLogged(t *testing.T, handler http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	var logs bytes.Buffer
+	r = r.WithContext(zerolog.New(&logs).WithContext(r.Context()))
+	w := httptest.NewRecorder()
+	loggerMiddleware(nil)(handler).ServeHTTP(w, r)
+	return w, logs.String()
+}
+
+func TestLoggerMiddlewareUpload(t *testing.T) {
+	const limit = 1 << 10
+
+	// Like attachment uploads, the handler limits the body and refuses it once over the limit
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		if err := r.ParseMultipartForm(limit); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "secret.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(strings.Repeat("top secret ", 100_000)))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	counter := &countingReader{r: bytes.NewReader(body.Bytes())}
+	r := httptest.NewRequest(http.MethodPost, "/api/todos/1/attachments", counter)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	w, logs := serveLogged(t, upload, r)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Less(t, counter.read, 64<<10, "the body was read past the limit")
+	assert.NotContains(t, logs, "top secret")
+	assert.Contains(t, logs, `"status_code":413`)
+}
+
+func TestLoggerMiddlewareJSON(t *testing.T) {
+	var received []byte
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// JSON bodies are logged compacted, and passed on whole
+	r := httptest.NewRequest(http.MethodPost, "/api/todos", strings.NewReader(`{"title": "Buy milk"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	_, logs := serveLogged(t, echo, r)
+	assert.Equal(t, `{"title": "Buy milk"}`, string(received))
+	assert.Contains(t, logs, `"body":"{\"title\":\"Buy milk\"}"`)
+
+	// Only the start of large bodies is captured, the handler still gets all of it
+	large := `{"title": "` + strings.Repeat("a", 3*maxLoggedBody) + `"}`
+	r = httptest.NewRequest(http.MethodPost, "/api/todos", strings.NewReader(large))
+	r.Header.Set("Content-Type", "application/json")
+	_, logs = serveLogged(t, echo, r)
+	assert.Equal(t, large, string(received))
+	assert.NotContains(t, logs, strings.Repeat("a", maxLoggedBody))
+
+	// Imports aren't logged
+	r = httptest.NewRequest(http.MethodPost, "/api/todos/import", strings.NewReader("title\nPrivate todo\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	_, logs = serveLogged(t, echo, r)
+	assert.Equal(t, "title\nPrivate todo\n", string(received))
+	assert.NotContains(t, logs, "Private todo")
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Preflights allow conditional requests
+	w := httptest.NewRecorder()
+	corsMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/todos/1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	allowed := w.Header().Get("Access-Control-Allow-Headers")
+	assert.Contains(t, allowed, "If-Match")
+	assert.Contains(t, allowed, "If-None-Match")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+
+	// Responses let clients read the headers they send back or follow
+	w = httptest.NewRecorder()
+	corsMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/todos", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "ETag, Link, Location", w.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/signup", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	assert.Equal(t, "anonymous:203.0.113.7", idempotencyScope(r))
+
+	// Retries over another connection of the same client share the scope
+	r.RemoteAddr = "203.0.113.7:51235"
+	assert.Equal(t, "anonymous:203.0.113.7", idempotencyScope(r))
+
+	// Addresses set from proxy headers have no port
+	r.RemoteAddr = "198.51.100.2"
+	assert.Equal(t, "anonymous:198.51.100.2", idempotencyScope(r))
+}
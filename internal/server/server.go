@@ -9,21 +9,48 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/app"
 	"github.com/syahidfrd/go-boilerplate/internal/auth"
 	"github.com/syahidfrd/go-boilerplate/internal/health"
-	"github.com/syahidfrd/go-boilerplate/internal/pkg/cache"
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/config"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/idempotency"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/jwt"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
 	"github.com/syahidfrd/go-boilerplate/internal/todo"
 	"github.com/syahidfrd/go-boilerplate/internal/user"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
 )
 
-// Server represents the HTTP server with its router
+const (
+	// outboxStreamSize is roughly how many domain events of each topic are kept in Redis
+	outboxStreamSize = 100_000
+	// todoCacheGroup is the consumer group invalidating cached todo lists from domain events
+	todoCacheGroup = "todo-cache"
+	// todoStreamGroup is the consumer group streaming domain events to the users of todos
+	todoStreamGroup = "todo-stream"
+	// todoWebhookGroup is the consumer group dispatching domain events to the webhooks of
+	// the users of todos
+	todoWebhookGroup = "todo-webhooks"
+	// signupWebhookGroup is the consumer group dispatching sign ups to the operator
+	signupWebhookGroup = "signup-webhooks"
+	// idempotencyTTL is how long responses are replayed to requests retried with the same
+	// Idempotency-Key
+	idempotencyTTL = 24 * time.Hour
+)
+
+// Server represents the HTTP server with its router and background workers
 type Server struct {
-	router *http.ServeMux
+	router         *http.ServeMux
+	broker         *events.Broker
+	relay          *outbox.Relay
+	consumers      map[string]*outbox.Consumer
+	todoService    *todo.Service
+	webhookService *webhook.Service
 }
 
 // NewServer creates and configures a new HTTP server with all dependencies and routes
@@ -31,42 +58,50 @@ func NewServer() *Server {
 	// Load configuration
 	cfg := config.LoadEnv()
 
-	// Initialize database
-	dbConn, err := db.NewPostgres(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to database")
-	}
+	// Initialize the connections and services shared with the worker
+	a := app.New(cfg)
 
 	// Auto migrate models
-	if err := db.AutoMigrate(dbConn, &user.User{}, &user.Preference{}, &todo.Todo{}); err != nil {
+	if err := db.AutoMigrate(a.DB, &user.User{}, &user.Preference{}, &todo.Todo{}, &todo.Label{}, &todo.Project{}, &todo.HistoryEntry{}, &todo.Member{}, &todo.Invitation{}, &todo.Comment{}, &todo.Attachment{}, &todo.FeedToken{}, &webhook.Endpoint{}, &webhook.Delivery{}, &outbox.Message{}, &jobs.Job{}, &todo.ExportFile{}, &todo.Reminder{}, &notification.Notification{}); err != nil {
 		log.Fatal().Err(err).Msg("failed to auto migrate database")
 	}
 
-	// Initialize Redis cache
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: cfg.CacheURL,
-	})
-	redisCache := cache.NewRedis(redisClient)
+	// Initialize the relay of domain events to Redis
+	relay := outbox.NewRelay(a.DB, a.Redis, outboxStreamSize)
+
+	if err := a.Webhooks.ConfigureSystemEndpoint(context.Background(), cfg.Webhook.SignupURL, cfg.Webhook.SignupSecret); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure sign up webhook")
+	}
 
-	// Initialize services
-	userStore := user.NewStore(dbConn)
-	userService := user.NewService(userStore)
 	jwtService := jwt.NewService(cfg.AppSecret)
-	authService := auth.NewService(userService, jwtService)
+	authService := auth.NewService(a.Users, jwtService, a.Webhooks)
+
+	// Give todos created before manual ordering a position, in the worker
+	if err := a.Todos.EnqueueBackfillPositions(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("failed to enqueue todo positions backfill")
+	}
 
-	todoStore := todo.NewStore(dbConn)
-	todoService := todo.NewService(todoStore, redisCache)
+	// Consume domain events, each group gets all the events of its topic
+	consumers := map[string]*outbox.Consumer{
+		"todo cache consumer":     outbox.NewConsumer(a.Redis, todo.OutboxTopic, todoCacheGroup, a.Todos.HandleOutbox),
+		"todo stream consumer":    outbox.NewConsumer(a.Redis, todo.OutboxTopic, todoStreamGroup, a.Todos.HandleStream),
+		"todo webhook consumer":   outbox.NewConsumer(a.Redis, todo.OutboxTopic, todoWebhookGroup, a.Todos.HandleWebhooks),
+		"signup webhook consumer": outbox.NewConsumer(a.Redis, user.OutboxTopic, signupWebhookGroup, authService.HandleOutbox),
+	}
 
-	healthStore := health.NewStore(dbConn, redisClient)
+	healthStore := health.NewStore(a.DB, a.Redis)
 	healthService := health.NewService(healthStore)
 
 	// Initialize handlers
 	authHandler := auth.NewHandler(authService)
-	todoHandler := todo.NewHandler(todoService)
+	todoHandler := todo.NewHandler(a.Todos)
+	webhookHandler := webhook.NewHandler(a.Webhooks)
+	notificationHandler := notification.NewHandler(a.Notifications)
 	healthHandler := health.NewHandler(healthService)
 
 	// Initialize middleware
 	jwtMiddleware := auth.NewJWTMiddleware(jwtService)
+	idempotencyMiddleware := idempotency.NewMiddleware(a.Redis, idempotencyTTL, idempotencyScope)
 
 	// Configure HTTP routes
 	r := http.NewServeMux()
@@ -76,19 +111,101 @@ func NewServer() *Server {
 	r.Handle("GET /health", http.HandlerFunc(healthHandler.Health))
 
 	// Auth routes
-	r.Handle("POST /api/auth/signup", http.HandlerFunc(authHandler.SignUp))
+	r.Handle("POST /api/auth/signup", idempotencyMiddleware.Handle(http.HandlerFunc(authHandler.SignUp)))
 	r.Handle("POST /api/auth/signin", http.HandlerFunc(authHandler.SignIn))
 
 	// Todo routes (protected)
-	r.Handle("POST /api/todos", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Create)))
+	r.Handle("POST /api/todos", jwtMiddleware.Authenticate(idempotencyMiddleware.Handle(http.HandlerFunc(todoHandler.Create))))
 	r.Handle("GET /api/todos", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetByUserID)))
+	r.Handle("GET /api/todos/search", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Search)))
+	r.Handle("GET /api/todos/stream", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Stream)))
+	r.Handle("GET /api/todos/export", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Export)))
+	r.Handle("POST /api/todos/batch", jwtMiddleware.Authenticate(idempotencyMiddleware.Handle(http.HandlerFunc(todoHandler.Batch))))
+	r.Handle("POST /api/todos/import", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Import)))
+	r.Handle("GET /api/todos/trash", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetTrash)))
+	r.Handle("DELETE /api/todos/trash", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.EmptyTrash)))
+	r.Handle("DELETE /api/todos/trash/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Purge)))
 	r.Handle("GET /api/todos/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetByID)))
 	r.Handle("PUT /api/todos/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Update)))
+	r.Handle("PATCH /api/todos/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Patch)))
 	r.Handle("PATCH /api/todos/{id}/toggle", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.ToggleComplete)))
 	r.Handle("DELETE /api/todos/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Delete)))
+	r.Handle("POST /api/todos/{id}/restore", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Restore)))
+	r.Handle("POST /api/todos/{id}/move", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Reorder)))
+	r.Handle("PATCH /api/todos/{id}/project", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.MoveToProject)))
+	r.Handle("GET /api/todos/{id}/history", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetHistory)))
+	r.Handle("POST /api/todos/{id}/comments", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CreateComment)))
+	r.Handle("GET /api/todos/{id}/comments", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetComments)))
+	r.Handle("PATCH /api/todos/{id}/comments/{commentID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.UpdateComment)))
+	r.Handle("DELETE /api/todos/{id}/comments/{commentID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeleteComment)))
+	r.Handle("POST /api/todos/{id}/attachments", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Attach)))
+	r.Handle("GET /api/todos/{id}/attachments", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetAttachments)))
+	r.Handle("GET /api/todos/{id}/attachments/{attachmentID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DownloadAttachment)))
+	r.Handle("DELETE /api/todos/{id}/attachments/{attachmentID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeleteAttachment)))
+	r.Handle("POST /api/todos/{id}/labels/{labelID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.AttachLabel)))
+	r.Handle("DELETE /api/todos/{id}/labels/{labelID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DetachLabel)))
+	r.Handle("POST /api/todos/{id}/reminders", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CreateReminder)))
+	r.Handle("GET /api/todos/{id}/reminders", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetReminders)))
+	r.Handle("DELETE /api/todos/{id}/reminders/{reminderID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeleteReminder)))
+
+	// Export routes (protected), export files are generated by the worker
+	r.Handle("POST /api/exports", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.RequestExport)))
+	r.Handle("GET /api/exports/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetExport)))
+	r.Handle("GET /api/exports/{id}/download", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DownloadExport)))
+
+	// Project routes (protected)
+	r.Handle("POST /api/projects", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CreateProject)))
+	r.Handle("GET /api/projects", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetProjects)))
+	r.Handle("GET /api/projects/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetProject)))
+	r.Handle("GET /api/projects/{id}/todos", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetProjectTodos)))
+	r.Handle("PUT /api/projects/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.UpdateProject)))
+	r.Handle("DELETE /api/projects/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeleteProject)))
+	r.Handle("POST /api/projects/{id}/invitations", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.Invite)))
+	r.Handle("GET /api/projects/{id}/invitations", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetInvitations)))
+	r.Handle("DELETE /api/projects/{id}/invitations/{invitationID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CancelInvitation)))
+	r.Handle("GET /api/projects/{id}/members", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetMembers)))
+	r.Handle("PUT /api/projects/{id}/members/{userID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.UpdateMember)))
+	r.Handle("DELETE /api/projects/{id}/members/{userID}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.RemoveMember)))
+
+	// Invitation routes (protected)
+	r.Handle("GET /api/invitations", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetReceivedInvitations)))
+	r.Handle("POST /api/invitations/{id}/accept", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.AcceptInvitation)))
+	r.Handle("DELETE /api/invitations/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeclineInvitation)))
+
+	// Label routes (protected)
+	r.Handle("POST /api/labels", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CreateLabel)))
+	r.Handle("GET /api/labels", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetLabels)))
+	r.Handle("PUT /api/labels/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.UpdateLabel)))
+	r.Handle("DELETE /api/labels/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.DeleteLabel)))
+
+	// Webhook routes (protected)
+	r.Handle("POST /api/webhooks", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.Create)))
+	r.Handle("GET /api/webhooks", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.GetByUserID)))
+	r.Handle("GET /api/webhooks/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.GetByID)))
+	r.Handle("PUT /api/webhooks/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.Update)))
+	r.Handle("DELETE /api/webhooks/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.Delete)))
+	r.Handle("GET /api/webhooks/{id}/deliveries", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.GetDeliveries)))
+	r.Handle("POST /api/webhooks/{id}/test", jwtMiddleware.Authenticate(http.HandlerFunc(webhookHandler.SendTest)))
+
+	// Notification routes (protected), reminders are sent by the worker
+	r.Handle("GET /api/notifications", jwtMiddleware.Authenticate(http.HandlerFunc(notificationHandler.GetByUserID)))
+	r.Handle("POST /api/notifications/read", jwtMiddleware.Authenticate(http.HandlerFunc(notificationHandler.MarkAllRead)))
+	r.Handle("PATCH /api/notifications/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(notificationHandler.Update)))
+	r.Handle("DELETE /api/notifications/{id}", jwtMiddleware.Authenticate(http.HandlerFunc(notificationHandler.Delete)))
+
+	// Feed routes, the feed itself is authenticated by the token in its path
+	r.Handle("POST /api/feed", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.CreateFeed)))
+	r.Handle("GET /api/feed", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.GetFeed)))
+	r.Handle("DELETE /api/feed", jwtMiddleware.Authenticate(http.HandlerFunc(todoHandler.RevokeFeed)))
+	r.Handle("GET /feeds/{token}/todos.ics", http.HandlerFunc(todoHandler.Feed))
 
 	return &Server{
-		router: r,
+		router:         r,
+		broker:         a.Broker,
+		relay:          relay,
+		consumers:      consumers,
+		todoService:    a.Todos,
+		webhookService: a.Webhooks,
 	}
 }
 
@@ -125,6 +242,16 @@ func (s *Server) Run(port int) {
 		WriteTimeout: 60 * time.Second,
 	}
 
+	// Start background workers, they are stopped on shutdown. Stopping the broker also ends
+	// the event streams, which would otherwise keep the shutdown waiting.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	go s.keepRunning(workerCtx, "event broker", s.broker.Run)
+	go s.webhookService.Run(workerCtx)
+	go s.relay.Run(workerCtx)
+	for name, consumer := range s.consumers {
+		go s.keepRunning(workerCtx, name, consumer.Run)
+	}
+
 	// Setup graceful shutdown channels
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
@@ -134,6 +261,7 @@ func (s *Server) Run(port int) {
 	go func() {
 		<-quit
 		log.Info().Msg("server is shutting down...")
+		stopWorkers()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -155,3 +283,22 @@ func (s *Server) Run(port int) {
 	<-done
 	log.Info().Msg("server stopped")
 }
+
+// keepRunning runs a worker until the context is canceled, restarting it when it stops on
+// an error, like the event broker delivering the events published by every instance to the
+// event streams served by this one
+func (s *Server) keepRunning(ctx context.Context, name string, run func(context.Context) error) {
+	for {
+		err := run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error().Err(err).Msgf("%s stopped, restarting", name)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength is the maximum number of characters kept from the name of an uploaded file
+const maxFilenameLength = 255
+
+var (
+	// ErrAttachmentNotFound is returned when a requested attachment cannot be found
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrFileTooLarge is returned when an uploaded file is larger than the maximum file size
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrQuotaExceeded is returned when an upload would take a user over their storage quota
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// AttachmentLimits represents the limits on the files users upload to their todos
+type AttachmentLimits struct {
+	// MaxFileSize is the maximum size of a single file in bytes
+	MaxFileSize int64
+	// UserQuota is the maximum number of bytes a user can have stored, trash included
+	UserQuota int64
+}
+
+// Attachment represents a file attached to a todo. The content of the file is stored in a
+// blob store under BlobKey, the row only keeps what is needed to serve it back.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	TodoID      int64     `json:"todo_id" gorm:"index"`
+	UserID      int64     `json:"user_id" gorm:"index"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	BlobKey     string    `json:"-" gorm:"uniqueIndex"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewAttachment creates an attachment uploaded by the given user to a todo, with a new
+// random blob key. The checksum and content type are filled in once the content is stored.
+func NewAttachment(todoID, userID int64, filename string, size int64) (*Attachment, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate blob key: %w", err)
+	}
+
+	return &Attachment{
+		TodoID:    todoID,
+		UserID:    userID,
+		Filename:  sanitizeFilename(filename),
+		Size:      size,
+		BlobKey:   fmt.Sprintf("attachments/%d/%s", todoID, hex.EncodeToString(b[:])),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// sanitizeFilename keeps the base name of an uploaded file without control characters, so
+// that it can be sent back in a Content-Disposition header as is
+func sanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if utf8.RuneCountInString(name) > maxFilenameLength {
+		name = string([]rune(name)[:maxFilenameLength])
+	}
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+	return name
+}
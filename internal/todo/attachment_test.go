@@ -0,0 +1,51 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAttachment(t *testing.T) {
+	attachment, err := NewAttachment(7, 3, "../reports/q3.pdf", 1024)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), attachment.TodoID)
+	assert.Equal(t, int64(3), attachment.UserID)
+	assert.Equal(t, "q3.pdf", attachment.Filename)
+	assert.Equal(t, int64(1024), attachment.Size)
+	assert.Regexp(t, `^attachments/7/[0-9a-f]{32}$`, attachment.BlobKey)
+	assert.False(t, attachment.CreatedAt.IsZero())
+
+	other, err := NewAttachment(7, 3, "q3.pdf", 1024)
+	require.NoError(t, err)
+	assert.NotEqual(t, attachment.BlobKey, other.BlobKey)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain", input: "notes.txt", expected: "notes.txt"},
+		{name: "unix path", input: "/home/user/notes.txt", expected: "notes.txt"},
+		{name: "windows path", input: `C:\Users\user\notes.txt`, expected: "notes.txt"},
+		{name: "control characters", input: "no\r\ntes\x00.txt", expected: "notes.txt"},
+		{name: "invalid utf8", input: "n\xffotes.txt", expected: "notes.txt"},
+		{name: "unicode", input: "résumé 2024.pdf", expected: "résumé 2024.pdf"},
+		{name: "spaces", input: "  notes.txt  ", expected: "notes.txt"},
+		{name: "empty", input: "", expected: "file"},
+		{name: "dot dot", input: "..", expected: "file"},
+		{name: "trailing slash", input: "dir/", expected: "dir"},
+		{name: "too long", input: strings.Repeat("é", 300), expected: strings.Repeat("é", maxFilenameLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeFilename(tt.input))
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBatchOperations is the maximum number of operations in a single batch
+	maxBatchOperations = 100
+	// maxBatchSize is the maximum size of a batch request body in bytes
+	maxBatchSize = 1 << 20
+	// batchSavepoint is the savepoint each operation of a batch that isn't atomic runs in
+	batchSavepoint = "batch_operation"
+)
+
+var (
+	// ErrInvalidOperation is returned for a batch operation that cannot be applied as given
+	ErrInvalidOperation = errors.New("invalid operation")
+	// ErrBatchTooLarge is returned when a batch request body is larger than maxBatchSize
+	ErrBatchTooLarge = errors.New("batch too large")
+)
+
+// BatchOp represents the kind of a batch operation
+type BatchOp string
+
+const (
+	// BatchCreate creates a todo from the data of the operation
+	BatchCreate BatchOp = "create"
+	// BatchUpdate updates a todo with the data of the operation
+	BatchUpdate BatchOp = "update"
+	// BatchToggle toggles the completion status of a todo
+	BatchToggle BatchOp = "toggle"
+	// BatchDelete moves a todo to the trash
+	BatchDelete BatchOp = "delete"
+	// BatchMove moves a todo in the manual order, like a reorder request
+	BatchMove BatchOp = "move"
+)
+
+// BatchRequest represents the request payload for applying several operations to todos at once
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" validate:"required,min=1"`
+}
+
+// BatchOperation represents a single operation of a batch. Data holds the payload the matching
+// single-todo endpoint takes, Version the version it would take from If-Match, and Recurrence
+// the completion scope of toggles.
+type BatchOperation struct {
+	Op         BatchOp         `json:"op" validate:"required,oneof=create update toggle delete move"`
+	ID         int64           `json:"id" validate:"required_unless=Op create"`
+	Version    int64           `json:"version" validate:"min=0"`
+	Recurrence string          `json:"recurrence"`
+	Data       json.RawMessage `json:"data"`
+
+	// The decoded payload of the operation, or the reason it couldn't be decoded
+	create *CreateTodoRequest
+	update *UpdateTodoRequest
+	move   *ReorderTodoRequest
+	scope  CompletionScope
+	err    error
+}
+
+// BatchItem represents the outcome of a batch operation: the todo it created or changed, if
+// any, or the error it failed with
+type BatchItem struct {
+	Todo *Todo
+	Err  error
+}
+
+// BatchResult represents the outcome of a batch operation in responses, with the status code
+// the matching single-todo endpoint would have answered with
+type BatchResult struct {
+	Status  int    `json:"status"`
+	Todo    *Todo  `json:"todo,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BatchResponse represents the response of a best-effort batch, one result per operation
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchError is returned when an operation of an atomic batch fails, in which case none of
+// the operations are applied
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// Error implements the error interface
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err.Error())
+}
+
+// Unwrap returns the error the operation failed with
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchChange is a change made to a todo by a batch, along with the users who see the todo
+type batchChange struct {
+	eventType string
+	todo      *Todo
+	userIDs   []int64
+}
+
+// batchEvent is a change made to a todo by a batch in the domain event of the batch
+type batchEvent struct {
+	Type    string  `json:"type"`
+	UserIDs []int64 `json:"user_ids"`
+	Todo    *Todo   `json:"todo"`
+}
+
+// Batch applies operations to todos of the specified user in order, in a single transaction.
+// An atomic batch stops at the first operation that fails and returns a BatchError, leaving
+// everything as it was. Otherwise each operation runs in its own savepoint and its failure is
+// reported in its item without affecting the others. Either way, the changes are described
+// by a single domain event and the todo lists of the affected users are invalidated once for
+// the whole batch.
+func (s *Service) Batch(ctx context.Context, userID int64, ops []BatchOperation, atomic bool) ([]BatchItem, error) {
+	items := make([]BatchItem, len(ops))
+	var changes []batchChange
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	for i := range ops {
+		if !atomic {
+			if err := tx.SavePoint(batchSavepoint).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to create savepoint: %w", err)
+			}
+		}
+
+		var applied []batchChange
+		todo, err := s.applyOperation(ctx, userID, &ops[i], tx, &applied)
+		if err != nil {
+			if atomic {
+				tx.Rollback()
+				return nil, &BatchError{Index: i, Err: err}
+			}
+			if err := tx.RollbackTo(batchSavepoint).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+			items[i].Err = err
+			continue
+		}
+
+		items[i].Todo = todo
+		changes = append(changes, applied...)
+	}
+
+	audience := s.changeAudience(ctx, changes)
+	if len(changes) > 0 {
+		events := make([]batchEvent, len(changes))
+		for i, c := range changes {
+			events[i] = batchEvent{Type: c.eventType, UserIDs: c.userIDs, Todo: c.todo}
+		}
+		if err := s.emit(ctx, tx, EventTodosBatched, audience, events); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	for _, userID := range audience {
+		cacheKey := fmt.Sprintf("todos:user:%d", userID)
+		s.cache.Delete(ctx, cacheKey)
+	}
+
+	return items, nil
+}
+
+// applyOperation applies a batch operation within the given transaction, adding the changes
+// it made to changes. It returns the todo the operation created or changed, nil for deletes.
+func (s *Service) applyOperation(ctx context.Context, userID int64, op *BatchOperation, tx *gorm.DB, changes *[]batchChange) (*Todo, error) {
+	if op.err != nil {
+		return nil, op.err
+	}
+
+	switch op.Op {
+	case BatchCreate:
+		todo, err := s.createTodo(ctx, userID, op.create, tx)
+		if err != nil {
+			return nil, err
+		}
+		*changes = append(*changes, batchChange{eventType: EventTodoCreated, todo: todo})
+		return todo, nil
+	case BatchUpdate:
+		todo, err := s.updateTodo(ctx, userID, op.ID, op.Version, op.update, tx)
+		if err != nil {
+			return nil, err
+		}
+		*changes = append(*changes, batchChange{eventType: EventTodoUpdated, todo: todo})
+		return todo, nil
+	case BatchToggle:
+		todo, next, err := s.toggleTodo(ctx, userID, op.ID, op.Version, op.scope, tx)
+		if err != nil {
+			return nil, err
+		}
+		*changes = append(*changes, batchChange{eventType: EventTodoToggled, todo: todo})
+		if next != nil {
+			*changes = append(*changes, batchChange{eventType: EventTodoCreated, todo: next})
+		}
+		return todo, nil
+	case BatchDelete:
+		todo, err := s.trashTodo(ctx, userID, op.ID, op.Version, tx)
+		if err != nil {
+			return nil, err
+		}
+		*changes = append(*changes, batchChange{eventType: EventTodoDeleted, todo: todo})
+		return nil, nil
+	case BatchMove:
+		todo, err := s.reorderTodo(ctx, userID, op.ID, op.Version, op.move, tx)
+		if err != nil {
+			return nil, err
+		}
+		*changes = append(*changes, batchChange{eventType: EventTodoUpdated, todo: todo})
+		return todo, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidOperation, op.Op)
+	}
+}
+
+// changeAudience sets the users who see each changed todo on its change, looking up the
+// members of each project once, and returns everyone who sees any of them
+func (s *Service) changeAudience(ctx context.Context, changes []batchChange) []int64 {
+	type list struct {
+		ownerID   int64
+		projectID int64
+	}
+
+	var audience []int64
+	seen := map[list][]int64{}
+	for i, c := range changes {
+		key := list{ownerID: c.todo.UserID}
+		if c.todo.ProjectID != nil {
+			key.projectID = *c.todo.ProjectID
+		}
+		userIDs, ok := seen[key]
+		if !ok {
+			userIDs = s.audience(ctx, c.todo.UserID, c.todo.ProjectID)
+			seen[key] = userIDs
+		}
+		changes[i].userIDs = userIDs
+
+		for _, id := range userIDs {
+			if !slices.Contains(audience, id) {
+				audience = append(audience, id)
+			}
+		}
+	}
+	return audience
+}
@@ -0,0 +1,152 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeOperation(t *testing.T) {
+	h := NewHandler(nil)
+
+	tests := []struct {
+		name    string
+		op      BatchOperation
+		wantErr string
+	}{
+		{
+			name: "create",
+			op:   BatchOperation{Op: BatchCreate, Data: json.RawMessage(`{"title":"Buy milk","priority":"high"}`)},
+		},
+		{
+			name: "update",
+			op:   BatchOperation{Op: BatchUpdate, ID: 1, Version: 2, Data: json.RawMessage(`{"title":"Buy milk"}`)},
+		},
+		{
+			name: "toggle",
+			op:   BatchOperation{Op: BatchToggle, ID: 1, Recurrence: "series"},
+		},
+		{
+			name: "delete",
+			op:   BatchOperation{Op: BatchDelete, ID: 1},
+		},
+		{
+			name: "move",
+			op:   BatchOperation{Op: BatchMove, ID: 1, Data: json.RawMessage(`{"before":2}`)},
+		},
+		{
+			name:    "unknown op",
+			op:      BatchOperation{Op: "archive", ID: 1},
+			wantErr: "oneof",
+		},
+		{
+			name:    "missing id",
+			op:      BatchOperation{Op: BatchDelete},
+			wantErr: "required_unless",
+		},
+		{
+			name:    "negative version",
+			op:      BatchOperation{Op: BatchDelete, ID: 1, Version: -1},
+			wantErr: "min",
+		},
+		{
+			name:    "invalid recurrence",
+			op:      BatchOperation{Op: BatchToggle, ID: 1, Recurrence: "forever"},
+			wantErr: "invalid recurrence",
+		},
+		{
+			name:    "missing data",
+			op:      BatchOperation{Op: BatchCreate},
+			wantErr: "invalid data",
+		},
+		{
+			name:    "malformed data",
+			op:      BatchOperation{Op: BatchUpdate, ID: 1, Data: json.RawMessage(`{"title":1}`)},
+			wantErr: "invalid data",
+		},
+		{
+			name:    "invalid data",
+			op:      BatchOperation{Op: BatchMove, ID: 1, Data: json.RawMessage(`{}`)},
+			wantErr: "required_without",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := tt.op
+			h.decodeOperation(&op)
+
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, op.err, ErrInvalidOperation)
+				assert.ErrorContains(t, op.err, tt.wantErr)
+				return
+			}
+			require.NoError(t, op.err)
+
+			switch op.Op {
+			case BatchCreate:
+				assert.Equal(t, "Buy milk", op.create.Title)
+				assert.Equal(t, "high", op.create.Priority)
+			case BatchUpdate:
+				assert.Equal(t, "Buy milk", op.update.Title)
+			case BatchToggle:
+				assert.Equal(t, StopRecurring, op.scope)
+			case BatchMove:
+				assert.Equal(t, int64(2), *op.move.Before)
+			}
+		})
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	h := NewHandler(nil)
+
+	tests := []struct {
+		err     error
+		status  int
+		message string
+	}{
+		{fmt.Errorf("failed to get todo for update: %w", ErrTodoNotFound), http.StatusNotFound, "todo not found"},
+		{ErrProjectNotFound, http.StatusNotFound, "project not found"},
+		{fmt.Errorf("failed to update todo: %w", ErrVersionMismatch), http.StatusPreconditionFailed, "todo has been modified"},
+		{ErrPermissionDenied, http.StatusForbidden, "permission denied"},
+		{fmt.Errorf("%w: invalid recurrence", ErrInvalidOperation), http.StatusBadRequest, "invalid operation: invalid recurrence"},
+		{fmt.Errorf("%w: todo can't be moved next to itself", ErrInvalidAnchor), http.StatusBadRequest, "invalid anchor: todo can't be moved next to itself"},
+		{errors.New("connection refused"), http.StatusInternalServerError, "Something went wrong"},
+	}
+
+	for _, tt := range tests {
+		status, message := h.operationError(context.Background(), tt.err)
+		assert.Equal(t, tt.status, status, tt.err.Error())
+		assert.Equal(t, tt.message, message, tt.err.Error())
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	err := &BatchError{Index: 2, Err: fmt.Errorf("failed to get todo for toggle: %w", ErrTodoNotFound)}
+
+	assert.EqualError(t, err, "operation 2: failed to get todo for toggle: todo not found")
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+}
+
+func TestChangeAudience(t *testing.T) {
+	s := &Service{}
+
+	// Todos outside projects are only seen by their owner
+	changes := []batchChange{
+		{eventType: EventTodoCreated, todo: &Todo{ID: 1, UserID: 1}},
+		{eventType: EventTodoUpdated, todo: &Todo{ID: 1, UserID: 1}},
+		{eventType: EventTodoCreated, todo: &Todo{ID: 2, UserID: 2}},
+		{eventType: EventTodoDeleted, todo: &Todo{ID: 3, UserID: 1}},
+	}
+	assert.Equal(t, []int64{1, 2}, s.changeAudience(context.Background(), changes))
+	assert.Equal(t, []int64{1}, changes[1].userIDs)
+	assert.Equal(t, []int64{2}, changes[2].userIDs)
+	assert.Empty(t, s.changeAudience(context.Background(), nil))
+}
@@ -0,0 +1,164 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// MaxCommentLength is the maximum number of characters in the body of a comment
+const MaxCommentLength = 2000
+
+var (
+	// ErrCommentNotFound is returned when a requested comment cannot be found
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrInvalidComment is returned when the body of a comment is empty or too long once
+	// sanitized, or when it replies to a comment that isn't on the same todo
+	ErrInvalidComment = errors.New("invalid comment")
+)
+
+// commentSort orders the comments of a todo oldest first, so that replies come after their parent
+var commentSort = sortOrder{column: "created_at"}
+
+// htmlEscaper escapes the characters that are markup in HTML text, in a single pass so that
+// escapes aren't escaped again
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// CommentParams represents the pagination parameters for listing the comments of a todo
+type CommentParams struct {
+	Limit  int `validate:"min=1,max=100"`
+	Cursor string
+}
+
+// CommentPage represents a single page of comments along with the cursor of the next page
+type CommentPage struct {
+	Data       []Comment `json:"data"`
+	NextCursor string    `json:"next_cursor"`
+	HasMore    bool      `json:"has_more"`
+}
+
+// Comment represents a comment on a todo, optionally in reply to another comment of the
+// same todo. Deleted comments are kept without their body so that their replies still
+// have a parent.
+type Comment struct {
+	ID        int64  `gorm:"index:idx_comments_todo_created,priority:3"`
+	TodoID    int64  `gorm:"index:idx_comments_todo_created,priority:1"`
+	ParentID  *int64 `gorm:"index"`
+	UserID    int64  `gorm:"index"`
+	Body      string `gorm:"type:text"`
+	EditCount int    `gorm:"not null;default:0"`
+	EditedAt  *time.Time
+	CreatedAt time.Time `gorm:"index:idx_comments_todo_created,priority:2"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// NewComment creates a comment by the given user on a todo, sanitizing its body
+func NewComment(todoID, userID int64, parentID *int64, body string) (*Comment, error) {
+	body, err := sanitizeComment(body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Comment{
+		TodoID:    todoID,
+		ParentID:  parentID,
+		UserID:    userID,
+		Body:      body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Edit replaces the body of the comment and records the edit. Edits that don't change
+// the sanitized body aren't recorded.
+func (c *Comment) Edit(body string) error {
+	body, err := sanitizeComment(body)
+	if err != nil {
+		return err
+	}
+	if body == c.Body {
+		return nil
+	}
+
+	now := time.Now()
+	c.Body = body
+	c.EditCount++
+	c.EditedAt = &now
+	c.UpdatedAt = now
+	return nil
+}
+
+// commentJSON is the JSON representation of a comment
+type commentJSON struct {
+	ID        int64   `json:"id"`
+	TodoID    int64   `json:"todo_id"`
+	ParentID  *int64  `json:"parent_id"`
+	UserID    int64   `json:"user_id"`
+	Body      string  `json:"body"`
+	Edited    bool    `json:"edited"`
+	EditCount int     `json:"edit_count"`
+	EditedAt  *string `json:"edited_at"`
+	Deleted   bool    `json:"deleted"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// MarshalJSON implements the json.Marshaler interface, leaving out the body of deleted comments
+func (c Comment) MarshalJSON() ([]byte, error) {
+	j := commentJSON{
+		ID:        c.ID,
+		TodoID:    c.TodoID,
+		ParentID:  c.ParentID,
+		UserID:    c.UserID,
+		Body:      c.Body,
+		Edited:    c.EditCount > 0,
+		EditCount: c.EditCount,
+		EditedAt:  formatOptionalTime(c.EditedAt),
+		Deleted:   c.DeletedAt.Valid,
+		CreatedAt: c.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: c.UpdatedAt.Format(time.RFC3339),
+	}
+	if j.Deleted {
+		j.Body = ""
+	}
+
+	return json.Marshal(j)
+}
+
+// encodeCommentCursor builds an opaque cursor pointing right after the given comment
+func encodeCommentCursor(comment *Comment) string {
+	value := comment.CreatedAt.UTC().Format(time.RFC3339Nano)
+	return cursor{Sort: commentSort.String(), Value: value, ID: comment.ID}.encode()
+}
+
+// sanitizeComment strips control characters and invalid UTF-8 from the body of a comment and
+// trims it, then checks that it is neither empty nor longer than MaxCommentLength. The body is
+// stored HTML-escaped, so that it is shown as text however clients render it; the limit
+// applies to the text as written.
+func sanitizeComment(body string) (string, error) {
+	body = strings.ToValidUTF8(body, "")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, body)
+	body = strings.TrimSpace(body)
+
+	if body == "" {
+		return "", fmt.Errorf("%w: body is empty", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(body) > MaxCommentLength {
+		return "", fmt.Errorf("%w: body is longer than %d characters", ErrInvalidComment, MaxCommentLength)
+	}
+	return htmlEscaper.Replace(body), nil
+}
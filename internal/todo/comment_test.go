@@ -0,0 +1,134 @@
+package todo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestNewComment(t *testing.T) {
+	parentID := int64(5)
+	comment, err := NewComment(7, 123, &parentID, "  Looks good  ")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), comment.TodoID)
+	assert.Equal(t, int64(123), comment.UserID)
+	assert.Equal(t, &parentID, comment.ParentID)
+	assert.Equal(t, "Looks good", comment.Body)
+	assert.Zero(t, comment.EditCount)
+	assert.Nil(t, comment.EditedAt)
+	assert.WithinDuration(t, time.Now(), comment.CreatedAt, time.Second)
+}
+
+func TestSanitizeComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "plain text", body: "Ship it", expected: "Ship it"},
+		{name: "html tags", body: `<script>alert(1)</script><b>bold</b>`, expected: "&lt;script&gt;alert(1)&lt;/script&gt;&lt;b&gt;bold&lt;/b&gt;"},
+		{name: "nested tags", body: "<<script>script>alert(1)<</script>/script>", expected: "&lt;&lt;script&gt;script&gt;alert(1)&lt;&lt;/script&gt;/script&gt;"},
+		{name: "split tag", body: "<scr<b>ipt>x", expected: "&lt;scr&lt;b&gt;ipt&gt;x"},
+		{name: "unclosed tag", body: "<img src=x onerror=alert(1) //", expected: "&lt;img src=x onerror=alert(1) //"},
+		{name: "comparisons", body: "a < b && c > d", expected: "a &lt; b &amp;&amp; c &gt; d"},
+		{name: "entities", body: "&lt;b&gt;", expected: "&amp;lt;b&amp;gt;"},
+		{name: "control characters", body: "one\x00two\x1b[31m\r\nthree\tfour", expected: "onetwo[31m\nthree\tfour"},
+		{name: "invalid utf-8", body: "caf\xc3 ok", expected: "caf ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := sanitizeComment(tt.body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, body)
+		})
+	}
+}
+
+func TestSanitizeComment_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty", body: ""},
+		{name: "whitespace", body: " \n\t "},
+		{name: "too long", body: strings.Repeat("é", MaxCommentLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sanitizeComment(tt.body)
+			assert.ErrorIs(t, err, ErrInvalidComment)
+		})
+	}
+
+	// The limit is in characters, not bytes, and applies before escaping
+	_, err := sanitizeComment(strings.Repeat("é", MaxCommentLength))
+	assert.NoError(t, err)
+	_, err = sanitizeComment(strings.Repeat("<", MaxCommentLength))
+	assert.NoError(t, err)
+}
+
+func TestComment_Edit(t *testing.T) {
+	comment, err := NewComment(7, 123, nil, "First")
+	require.NoError(t, err)
+
+	// Edits that don't change the sanitized body aren't recorded
+	require.NoError(t, comment.Edit(" First\n"))
+	assert.Zero(t, comment.EditCount)
+	assert.Nil(t, comment.EditedAt)
+
+	require.NoError(t, comment.Edit("<i>Second</i>"))
+	assert.Equal(t, "&lt;i&gt;Second&lt;/i&gt;", comment.Body)
+	assert.Equal(t, 1, comment.EditCount)
+	require.NotNil(t, comment.EditedAt)
+
+	assert.ErrorIs(t, comment.Edit(" "), ErrInvalidComment)
+	assert.Equal(t, "&lt;i&gt;Second&lt;/i&gt;", comment.Body)
+}
+
+func TestComment_MarshalJSON(t *testing.T) {
+	specificTime := time.Date(2023, 12, 25, 15, 30, 45, 0, time.UTC)
+	comment := Comment{
+		ID:        1,
+		TodoID:    7,
+		UserID:    123,
+		Body:      "Hello",
+		EditCount: 1,
+		EditedAt:  &specificTime,
+		CreatedAt: specificTime,
+		UpdatedAt: specificTime,
+	}
+
+	jsonBytes, err := json.Marshal(comment)
+	require.NoError(t, err)
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(jsonBytes, &result))
+
+	assert.Equal(t, float64(1), result["id"])
+	assert.Equal(t, float64(7), result["todo_id"])
+	assert.Nil(t, result["parent_id"])
+	assert.Equal(t, float64(123), result["user_id"])
+	assert.Equal(t, "Hello", result["body"])
+	assert.Equal(t, true, result["edited"])
+	assert.Equal(t, float64(1), result["edit_count"])
+	assert.Equal(t, "2023-12-25T15:30:45Z", result["edited_at"])
+	assert.Equal(t, false, result["deleted"])
+	assert.Equal(t, "2023-12-25T15:30:45Z", result["created_at"])
+
+	// Deleted comments keep their place in the thread without their body
+	comment.DeletedAt = gorm.DeletedAt{Time: specificTime, Valid: true}
+	jsonBytes, err = json.Marshal(comment)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(jsonBytes, &result))
+
+	assert.Equal(t, "", result["body"])
+	assert.Equal(t, true, result["deleted"])
+}
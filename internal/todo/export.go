@@ -0,0 +1,357 @@
+package todo
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/ical"
+)
+
+const (
+	// exportBatchSize is how many todos are read from the database at once while exporting
+	exportBatchSize = 500
+	// exportRetention is how long export files are kept, counted from their request and
+	// again from their generation
+	exportRetention = 24 * time.Hour
+)
+
+var (
+	// ErrExportNotFound is returned when a requested export file cannot be found
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportNotReady is returned when downloading an export file that isn't generated yet
+	ErrExportNotReady = errors.New("export not ready")
+)
+
+// FileFormat represents a file format todos are exported to or imported from
+type FileFormat string
+
+const (
+	// FormatJSON is a JSON array of todos
+	FormatJSON FileFormat = "json"
+	// FormatCSV is a CSV file with a header row naming the columns
+	FormatCSV FileFormat = "csv"
+	// FormatICS is an iCalendar file with a VTODO per todo
+	FormatICS FileFormat = "ics"
+	// FormatTodoist is the CSV format of Todoist project exports, only for imports
+	FormatTodoist FileFormat = "todoist"
+	// FormatTrello is the CSV format of Trello board exports, only for imports
+	FormatTrello FileFormat = "trello"
+)
+
+// ParseExportFormat parses the format of an export, defaulting to FormatJSON
+func ParseExportFormat(s string) (FileFormat, error) {
+	switch format := FileFormat(strings.ToLower(s)); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatICS:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: format", ErrInvalidQueryParam)
+	}
+}
+
+// ContentType returns the media type of files in the format
+func (f FileFormat) ContentType() string {
+	switch f {
+	case FormatCSV, FormatTodoist, FormatTrello:
+		return "text/csv; charset=utf-8"
+	case FormatICS:
+		return "text/calendar; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// ExportStatus is the state of the generation of an export file
+type ExportStatus string
+
+const (
+	// ExportPending files are waiting to be generated by a worker
+	ExportPending ExportStatus = "pending"
+	// ExportReady files are generated and can be downloaded
+	ExportReady ExportStatus = "ready"
+	// ExportFailed files could not be generated
+	ExportFailed ExportStatus = "failed"
+)
+
+// ExportFile represents an export of the todos of a user generated in the background, for
+// accounts too large to be exported within a request. The file is stored in the blob store
+// under BlobKey until it expires.
+type ExportFile struct {
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"-" gorm:"index"`
+	Format      FileFormat   `json:"format"`
+	Status      ExportStatus `json:"status"`
+	Size        int64        `json:"size"`
+	BlobKey     string       `json:"-" gorm:"uniqueIndex"`
+	Error       string       `json:"error"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at"`
+	ExpiresAt   time.Time    `json:"expires_at" gorm:"index"`
+}
+
+// NewExportFile creates the pending export file of a user in the given format, with a new
+// random blob key
+func NewExportFile(userID int64, format FileFormat) (*ExportFile, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate blob key: %w", err)
+	}
+
+	now := time.Now()
+	return &ExportFile{
+		UserID:    userID,
+		Format:    format,
+		Status:    ExportPending,
+		BlobKey:   fmt.Sprintf("exports/%d/%s", userID, hex.EncodeToString(b[:])),
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportRetention),
+	}, nil
+}
+
+// Filename returns the name an export file is downloaded as
+func (f *ExportFile) Filename() string {
+	return "todos." + string(f.Format)
+}
+
+// fileRecord is how a todo is represented in exports and imports. It leaves out anything tied
+// to its owner, like IDs, so that files can move between users and services.
+type fileRecord struct {
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Completed   bool               `json:"completed"`
+	CompletedAt *time.Time         `json:"completed_at"`
+	DueAt       *time.Time         `json:"due_at"`
+	Priority    string             `json:"priority"`
+	Project     string             `json:"project"`
+	Labels      []string           `json:"labels"`
+	Recurrence  *RecurrenceRequest `json:"recurrence"`
+	CreatedAt   *time.Time         `json:"created_at"`
+}
+
+// newFileRecord builds the fileRecord of a todo in the project with the given name
+func newFileRecord(todo *Todo, project string) *fileRecord {
+	r := &fileRecord{
+		Title:       todo.Title,
+		Description: todo.Description,
+		Completed:   todo.Completed,
+		CompletedAt: todo.CompletedAt,
+		DueAt:       todo.DueAt,
+		Priority:    todo.Priority.String(),
+		Project:     project,
+		Labels:      []string{},
+		CreatedAt:   &todo.CreatedAt,
+	}
+	for _, label := range todo.Labels {
+		r.Labels = append(r.Labels, label.Name)
+	}
+	if todo.Recurrence != nil {
+		r.Recurrence = &RecurrenceRequest{
+			Rule:       todo.Recurrence.Rule,
+			Timezone:   todo.Recurrence.Timezone,
+			Exceptions: todo.Recurrence.Exceptions,
+		}
+	}
+	return r
+}
+
+// exporter writes todos to a file as they are read from the database
+type exporter interface {
+	// begin writes what comes before the first todo
+	begin() error
+	// write writes a todo in the project with the given name
+	write(todo *Todo, project string) error
+	// end writes what comes after the last todo
+	end() error
+}
+
+// newExporter creates the exporter of a format writing to w
+func newExporter(format FileFormat, w io.Writer) exporter {
+	switch format {
+	case FormatCSV:
+		return &csvExporter{w: csv.NewWriter(w)}
+	case FormatICS:
+		return &icsExporter{w: ical.NewWriter(w)}
+	default:
+		return &jsonExporter{w: w}
+	}
+}
+
+// jsonExporter writes todos as the elements of a JSON array
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExporter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExporter) write(todo *Todo, project string) error {
+	data, err := json.Marshal(newFileRecord(todo, project))
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "\n"
+	}
+	e.count++
+
+	_, err = io.WriteString(e.w, sep+string(data))
+	return err
+}
+
+func (e *jsonExporter) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// csvColumns are the columns of CSV exports, in order. Labels and recurrence exceptions
+// are comma separated lists.
+var csvColumns = []string{
+	"title", "description", "completed", "completed_at", "due_at", "priority", "project",
+	"labels", "recurrence", "timezone", "exceptions", "created_at",
+}
+
+// csvExporter writes todos as the rows of a CSV file
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvExporter) write(todo *Todo, project string) error {
+	r := newFileRecord(todo, project)
+
+	var rule, timezone string
+	var exceptions []string
+	if r.Recurrence != nil {
+		rule, timezone = r.Recurrence.Rule, r.Recurrence.Timezone
+		for _, exception := range r.Recurrence.Exceptions {
+			exceptions = append(exceptions, exception.UTC().Format(time.RFC3339))
+		}
+	}
+
+	err := e.w.Write([]string{
+		r.Title,
+		r.Description,
+		strconv.FormatBool(r.Completed),
+		formatCSVTime(r.CompletedAt),
+		formatCSVTime(r.DueAt),
+		r.Priority,
+		r.Project,
+		strings.Join(r.Labels, ","),
+		rule,
+		timezone,
+		strings.Join(exceptions, ","),
+		formatCSVTime(r.CreatedAt),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Flush every row, the export is streamed
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// formatCSVTime formats an optional time as RFC3339 in UTC, nil being an empty cell
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// icsPriorities maps priorities to the 1 (highest) to 9 (lowest) scale of iCalendar,
+// where 0 means undefined
+var icsPriorities = map[Priority]int{
+	PriorityNone:   0,
+	PriorityLow:    9,
+	PriorityMedium: 5,
+	PriorityHigh:   2,
+	PriorityUrgent: 1,
+}
+
+// icsExporter writes todos as the VTODO components of a VCALENDAR
+type icsExporter struct {
+	w *ical.Writer
+}
+
+func (e *icsExporter) begin() error {
+	e.w.Begin("VCALENDAR")
+	e.w.Property("VERSION", "2.0")
+	e.w.Property("PRODID", "-//go-boilerplate//todos//EN")
+	return e.w.Err()
+}
+
+func (e *icsExporter) write(todo *Todo, project string) error {
+	e.w.Begin("VTODO")
+	e.w.Property("UID", fmt.Sprintf("todo-%d@go-boilerplate", todo.ID))
+	// Without a METHOD, DTSTAMP is when the todo was last revised, which keeps the output of
+	// unchanged todos identical
+	e.w.DateTime("DTSTAMP", todo.UpdatedAt)
+	e.w.DateTime("CREATED", todo.CreatedAt)
+	e.w.DateTime("LAST-MODIFIED", todo.UpdatedAt)
+	e.w.Text("SUMMARY", todo.Title)
+	if todo.Description != "" {
+		e.w.Text("DESCRIPTION", todo.Description)
+	}
+	if todo.DueAt != nil {
+		e.w.DateTime("DUE", *todo.DueAt)
+	}
+	if todo.Completed {
+		e.w.Property("STATUS", "COMPLETED")
+		if todo.CompletedAt != nil {
+			e.w.DateTime("COMPLETED", *todo.CompletedAt)
+		}
+	} else {
+		e.w.Property("STATUS", "NEEDS-ACTION")
+	}
+	if priority := icsPriorities[todo.Priority]; priority > 0 {
+		e.w.Property("PRIORITY", strconv.Itoa(priority))
+	}
+	if len(todo.Labels) > 0 {
+		names := make([]string, len(todo.Labels))
+		for i, label := range todo.Labels {
+			names[i] = ical.Escape(label.Name)
+		}
+		e.w.Property("CATEGORIES", strings.Join(names, ","))
+	}
+	if project != "" {
+		e.w.Text("X-PROJECT", project)
+	}
+	if todo.Recurrence != nil {
+		// Times are written in UTC, the timezone the rule is expanded in is kept aside
+		e.w.Property("RRULE", todo.Recurrence.Rule)
+		e.w.Property("X-RECURRENCE-TIMEZONE", todo.Recurrence.Timezone)
+		for _, exception := range todo.Recurrence.Exceptions {
+			e.w.DateTime("EXDATE", exception)
+		}
+	}
+	e.w.End("VTODO")
+	return e.w.Err()
+}
+
+func (e *icsExporter) end() error {
+	e.w.End("VCALENDAR")
+	return e.w.Err()
+}
@@ -0,0 +1,211 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/ical"
+)
+
+// exportTodos returns todos covering every exported field
+func exportTodos(t *testing.T) []Todo {
+	t.Helper()
+
+	due := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	completed := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	created := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	recurrence, err := NewRecurrence("FREQ=WEEKLY;BYDAY=FR", "Europe/Paris", due, []time.Time{due.AddDate(0, 0, 7)})
+	require.NoError(t, err)
+
+	return []Todo{
+		{
+			ID:          1,
+			Title:       "Write report, then send it",
+			Description: "Quarterly; with \"numbers\"\nand charts",
+			DueAt:       &due,
+			Priority:    PriorityHigh,
+			Recurrence:  recurrence,
+			Labels:      []Label{{Name: "work"}, {Name: "q1; q2"}},
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		},
+		{
+			ID:          2,
+			Title:       "Buy milk",
+			Completed:   true,
+			CompletedAt: &completed,
+			CreatedAt:   created,
+			UpdatedAt:   completed,
+		},
+	}
+}
+
+// export writes todos in a format, the first one in the Work project
+func export(t *testing.T, format FileFormat, todos []Todo) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	e := newExporter(format, &buf)
+	require.NoError(t, e.begin())
+	for i := range todos {
+		project := ""
+		if i == 0 {
+			project = "Work"
+		}
+		require.NoError(t, e.write(&todos[i], project))
+	}
+	require.NoError(t, e.end())
+	return buf.String()
+}
+
+func TestParseExportFormat(t *testing.T) {
+	format, err := ParseExportFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	format, err = ParseExportFormat("ICS")
+	require.NoError(t, err)
+	assert.Equal(t, FormatICS, format)
+
+	// Todoist and Trello files can only be imported
+	_, err = ParseExportFormat("todoist")
+	assert.ErrorIs(t, err, ErrInvalidQueryParam)
+	_, err = ParseExportFormat("xml")
+	assert.ErrorIs(t, err, ErrInvalidQueryParam)
+}
+
+func TestJSONExporter(t *testing.T) {
+	out := export(t, FormatJSON, exportTodos(t))
+
+	var records []fileRecord
+	require.NoError(t, json.Unmarshal([]byte(out), &records))
+	require.Len(t, records, 2)
+
+	assert.Equal(t, "Write report, then send it", records[0].Title)
+	assert.Equal(t, "Work", records[0].Project)
+	assert.Equal(t, "high", records[0].Priority)
+	assert.Equal(t, []string{"work", "q1; q2"}, records[0].Labels)
+	require.NotNil(t, records[0].Recurrence)
+	assert.Equal(t, "Europe/Paris", records[0].Recurrence.Timezone)
+	assert.Len(t, records[0].Recurrence.Exceptions, 1)
+
+	assert.True(t, records[1].Completed)
+	assert.Equal(t, []string{}, records[1].Labels)
+	assert.Nil(t, records[1].Recurrence)
+
+	// An empty export is still an array
+	out = export(t, FormatJSON, nil)
+	assert.JSONEq(t, "[]", out)
+}
+
+func TestCSVExporter(t *testing.T) {
+	out := export(t, FormatCSV, exportTodos(t))
+
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, csvColumns, rows[0])
+
+	assert.Equal(t, []string{
+		"Write report, then send it",
+		"Quarterly; with \"numbers\"\nand charts",
+		"false",
+		"",
+		"2024-03-01T09:00:00Z",
+		"high",
+		"Work",
+		"work,q1; q2",
+		"FREQ=WEEKLY;BYDAY=FR",
+		"Europe/Paris",
+		"2024-03-08T09:00:00Z",
+		"2024-01-01T08:00:00Z",
+	}, rows[1])
+	assert.Equal(t, "true", rows[2][2])
+	assert.Equal(t, "2024-02-01T12:00:00Z", rows[2][3])
+}
+
+func TestICSExporter(t *testing.T) {
+	out := export(t, FormatICS, exportTodos(t))
+
+	root, err := ical.Parse(strings.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, "VCALENDAR", root.Name)
+	require.Len(t, root.Components, 2)
+
+	first := root.Components[0]
+	assert.Equal(t, "todo-1@go-boilerplate", first.Get("UID").Value)
+	assert.Equal(t, "Write report, then send it", first.Get("SUMMARY").Text())
+	assert.Equal(t, "Quarterly; with \"numbers\"\nand charts", first.Get("DESCRIPTION").Text())
+	assert.Equal(t, "20240301T090000Z", first.Get("DUE").Value)
+	assert.Equal(t, "NEEDS-ACTION", first.Get("STATUS").Value)
+	assert.Equal(t, "2", first.Get("PRIORITY").Value)
+	assert.Equal(t, []string{"work", "q1; q2"}, ical.SplitList(first.Get("CATEGORIES").Value))
+	assert.Equal(t, "Work", first.Get("X-PROJECT").Text())
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=FR", first.Get("RRULE").Value)
+	assert.Equal(t, "Europe/Paris", first.Get("X-RECURRENCE-TIMEZONE").Value)
+	assert.Equal(t, "20240308T090000Z", first.Get("EXDATE").Value)
+
+	second := root.Components[1]
+	assert.Equal(t, "COMPLETED", second.Get("STATUS").Value)
+	assert.Equal(t, "20240201T120000Z", second.Get("COMPLETED").Value)
+	assert.Nil(t, second.Get("PRIORITY"))
+	assert.Nil(t, second.Get("X-PROJECT"))
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	todos := exportTodos(t)
+
+	for _, format := range []FileFormat{FormatJSON, FormatCSV, FormatICS} {
+		t.Run(string(format), func(t *testing.T) {
+			out := export(t, format, todos)
+
+			rows, errs, err := readImport(strings.NewReader(out), &ImportParams{Format: format})
+			require.NoError(t, err)
+			require.Empty(t, errs)
+
+			imported, errs := validateImport(5, rows, nil, "")
+			require.Empty(t, errs)
+			require.Len(t, imported, 2)
+
+			first := imported[0]
+			assert.Equal(t, "Work", first.project)
+			assert.Equal(t, []string{"work", "q1; q2"}, first.labels)
+			assert.Equal(t, int64(5), first.todo.UserID)
+			assert.Equal(t, todos[0].Title, first.todo.Title)
+			assert.Equal(t, todos[0].Description, first.todo.Description)
+			assert.Equal(t, todos[0].Priority, first.todo.Priority)
+			assert.True(t, todos[0].DueAt.Equal(*first.todo.DueAt))
+			assert.True(t, todos[0].CreatedAt.Equal(first.todo.CreatedAt))
+			require.NotNil(t, first.todo.Recurrence)
+			assert.Equal(t, todos[0].Recurrence.Rule, first.todo.Recurrence.Rule)
+			assert.Equal(t, todos[0].Recurrence.Timezone, first.todo.Recurrence.Timezone)
+			assert.Len(t, first.todo.Recurrence.Exceptions, 1)
+
+			second := imported[1]
+			assert.Empty(t, second.project)
+			assert.True(t, second.todo.Completed)
+			assert.True(t, todos[1].CompletedAt.Equal(*second.todo.CompletedAt))
+		})
+	}
+}
+
+func TestNewExportFile(t *testing.T) {
+	file, err := NewExportFile(7, FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), file.UserID)
+	assert.Equal(t, ExportPending, file.Status)
+	assert.Regexp(t, `^exports/7/[0-9a-f]{32}$`, file.BlobKey)
+	assert.Equal(t, "todos.csv", file.Filename())
+	assert.Equal(t, file.CreatedAt.Add(exportRetention), file.ExpiresAt)
+
+	other, err := NewExportFile(7, FormatCSV)
+	require.NoError(t, err)
+	assert.NotEqual(t, file.BlobKey, other.BlobKey)
+}
@@ -0,0 +1,76 @@
+package todo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// feedCacheField is the field of the todo cache of a user holding the entity tag of their feed
+const feedCacheField = "feed:etag"
+
+// ErrFeedNotFound is returned when a user has no feed, or a feed token doesn't match any
+var ErrFeedNotFound = errors.New("feed not found")
+
+// FeedToken represents the secret that gives read-only access to the iCalendar feed of a
+// user's todos. Only a hash of the token is stored, the token itself is shown once when
+// the feed is created, and each user has at most one feed.
+type FeedToken struct {
+	ID        int64     `json:"-"`
+	UserID    int64     `json:"-" gorm:"uniqueIndex"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Feed represents a rendered iCalendar feed along with its entity tag
+type Feed struct {
+	ETag    string
+	Content []byte
+}
+
+// NewFeedToken creates the feed token of a user with a new random token, which is returned
+// along with it
+func NewFeedToken(userID int64) (*FeedToken, string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, "", fmt.Errorf("failed to generate feed token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b[:])
+
+	return &FeedToken{
+		UserID:    userID,
+		TokenHash: hashFeedToken(token),
+		CreatedAt: time.Now(),
+	}, token, nil
+}
+
+// hashFeedToken returns the hash a feed token is stored and looked up by
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FeedPath returns the path of the feed with the given token
+func FeedPath(token string) string {
+	return "/feeds/" + token + "/todos.ics"
+}
+
+// newFeed builds a feed from its content, tagged with the hash of the content
+func newFeed(content []byte) *Feed {
+	sum := sha256.Sum256(content)
+	return &Feed{
+		ETag:    fmt.Sprintf("%q", hex.EncodeToString(sum[:16])),
+		Content: content,
+	}
+}
+
+// FeedResponse represents a newly created feed in API responses, the only time its token is shown
+type FeedResponse struct {
+	Token     string    `json:"token"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package todo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFeedToken(t *testing.T) {
+	feedToken, token, err := NewFeedToken(3)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), feedToken.UserID)
+	assert.Len(t, token, 43)
+	assert.Equal(t, hashFeedToken(token), feedToken.TokenHash)
+	assert.NotContains(t, feedToken.TokenHash, token)
+	assert.False(t, feedToken.CreatedAt.IsZero())
+	assert.Equal(t, "/feeds/"+token+"/todos.ics", FeedPath(token))
+
+	_, other, err := NewFeedToken(3)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestNewFeed(t *testing.T) {
+	feed := newFeed([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, feed.ETag)
+
+	// The tag only depends on the content
+	assert.Equal(t, feed.ETag, newFeed([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")).ETag)
+	assert.NotEqual(t, feed.ETag, newFeed([]byte("BEGIN:VCALENDAR\r\n\r\nEND:VCALENDAR\r\n")).ETag)
+}
+
+func TestICSExporter_Stable(t *testing.T) {
+	// Exporting unchanged todos twice gives the same feed, and so the same tag
+	todos := exportTodos(t)
+	first := export(t, FormatICS, todos)
+	second := export(t, FormatICS, todos)
+	assert.Equal(t, first, second)
+	assert.Contains(t, first, "DTSTAMP:20240101T080000Z")
+}
@@ -1,17 +1,48 @@
 package todo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
 	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jsonpatch"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/render"
 )
 
+const (
+	// mergePatchMediaType is the content type of RFC 7396 JSON Merge Patch documents
+	mergePatchMediaType = "application/merge-patch+json"
+	// jsonPatchMediaType is the content type of RFC 6902 JSON Patch documents
+	jsonPatchMediaType = "application/json-patch+json"
+	// maxPatchSize is the maximum size of a patch document in bytes
+	maxPatchSize = 1 << 20
+	// multipartMemory is how much of an upload is kept in memory, the rest is spooled to disk
+	multipartMemory = 1 << 20
+	// multipartOverhead is room left in an upload for the multipart boundaries and headers
+	multipartOverhead = 64 << 10
+	// streamHeartbeat is how often idle event streams get a comment, which keeps proxies
+	// from closing them and detects clients that went away
+	streamHeartbeat = 15 * time.Second
+	// streamWriteTimeout bounds each write to an event stream, in place of the write
+	// timeout of the server that would otherwise end the stream
+	streamWriteTimeout = 30 * time.Second
+	// streamRetry is how long clients wait before reconnecting to a closed event stream
+	streamRetry = 3 * time.Second
+)
+
 // handler handles HTTP requests for todo endpoints
 type handler struct {
 	svc       *Service
@@ -49,15 +80,25 @@ func (h *handler) Create(w http.ResponseWriter, r *http.Request) {
 
 	todo, err := h.svc.Create(ctx, userID, &req)
 	if err != nil {
-		log.Ctx(ctx).Error().Msgf("failed to create todo: %s", err.Error())
-		render.JSONFromError(w, err)
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrInvalidRecurrence):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to create todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
 		return
 	}
 
+	w.Header().Set("ETag", todo.ETag())
 	render.JSON(w, http.StatusCreated, todo)
 }
 
-// GetByUserID handles requests to retrieve all todos for the authenticated user
+// GetByUserID handles requests to retrieve a page of todos for the authenticated user
 func (h *handler) GetByUserID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -67,122 +108,2574 @@ func (h *handler) GetByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	todos, err := h.svc.GetByUserID(ctx, userID)
+	params, err := parseListParams(r)
 	if err != nil {
-		log.Ctx(ctx).Error().Msgf("failed to get todos: %s", err.Error())
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	if err := h.validator.Struct(params); err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	render.JSON(w, http.StatusOK, map[string]any{"data": todos})
+	page, err := h.svc.GetByUserID(ctx, userID, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidQueryParam):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get todos: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
 }
 
-// GetByID handles requests to retrieve a specific todo by ID
-func (h *handler) GetByID(w http.ResponseWriter, r *http.Request) {
+// Search handles full-text search requests over the authenticated user's todos
+func (h *handler) Search(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	id, err := strconv.Atoi(r.PathValue("id"))
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	limit, err := parseLimit(r)
 	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	params := &SearchParams{
+		Query:  r.URL.Query().Get("q"),
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if err := h.validator.Struct(params); err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	todo, err := h.svc.GetByID(ctx, int64(id))
+	page, err := h.svc.Search(ctx, userID, params)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrTodoNotFound):
-			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidQueryParam):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
 		default:
-			log.Ctx(ctx).Error().Msgf("failed to get todo: %s", err.Error())
+			log.Ctx(ctx).Error().Msgf("failed to search todos: %s", err.Error())
 			render.JSONFromError(w, err)
 		}
 		return
 	}
 
-	render.JSON(w, http.StatusOK, todo)
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
 }
 
-// Update handles requests to update an existing todo
-func (h *handler) Update(w http.ResponseWriter, r *http.Request) {
+// Export handles requests to download the todos of the authenticated user as a JSON, CSV or
+// iCalendar file. The file is streamed as todos are read, so errors past the first todo
+// can only cut it short.
+func (h *handler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	out := &exportWriter{w: w, format: format}
+	if err := h.svc.Export(ctx, userID, format, out); err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to export todos: %s", err.Error())
+		if !out.started {
+			render.JSONFromError(w, err)
+		}
+	}
+}
+
+// exportWriter sends the headers of an export along with its first bytes, so that an error
+// before anything is written can still be answered with a JSON error
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  FileFormat
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.format.ContentType())
+		e.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "todos." + string(e.format)}))
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
+
+// RequestExport handles requests to generate an export of the todos of the authenticated
+// user in the background, responding with 202 Accepted and the pending export file
+func (h *handler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	format, err := ParseExportFormat(req.Format)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	file, err := h.svc.RequestExport(ctx, userID, format)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to request export: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/exports/%d", file.ID))
+	render.JSON(w, http.StatusAccepted, file)
+}
+
+// GetExport handles requests to get the status of an export file of the authenticated user
+func (h *handler) GetExport(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	var req UpdateTodoRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	file, err := h.svc.GetExportFile(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrExportNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrExportNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get export: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, file)
+}
+
+// DownloadExport handles requests to download a generated export file of the authenticated
+// user. Files that aren't generated yet are answered with 409 Conflict.
+func (h *handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
+	file, content, err := h.svc.OpenExportFile(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrExportNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrExportNotFound.Error()})
+		case errors.Is(err, ErrExportNotReady):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": ErrExportNotReady.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to open export: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", file.Format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename()}))
+
+	http.ServeContent(w, r, file.Filename(), *file.CompletedAt, content)
+}
+
+// Import handles uploads of a file of todos for the authenticated user, sent as the raw request
+// body. Invalid rows are reported with 422 Unprocessable Entity and nothing is imported.
+func (h *handler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	params, err := parseImportParams(r)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	result, err := h.svc.Import(ctx, userID, r.Body, params)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"message": ErrFileTooLarge.Error()})
+		case errors.Is(err, ErrImportRejected):
+			render.JSON(w, http.StatusUnprocessableEntity, result)
+		case errors.Is(err, ErrInvalidImport), errors.Is(err, ErrInvalidQueryParam):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to import todos: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if result.DryRun {
+		status = http.StatusOK
+	}
+	render.JSON(w, status, result)
+}
+
+// parseImportParams reads the options of an import from the query parameters. The format
+// falls back to the one of the Content-Type header, and map.<field> parameters name the
+// CSV column a field is read from.
+func parseImportParams(r *http.Request) (*ImportParams, error) {
+	query := r.URL.Query()
+
+	name := query.Get("format")
+	if name == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			name = string(FormatCSV)
+		case "text/calendar":
+			name = string(FormatICS)
+		}
+	}
+	format, err := ParseImportFormat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &ImportParams{
+		Format:  format,
+		Project: query.Get("project"),
+		Columns: map[string]string{},
+	}
+
+	if dryRun := query.Get("dry_run"); dryRun != "" {
+		params.DryRun, err = strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("%w: dry_run", ErrInvalidQueryParam)
+		}
+	}
+
+	for key, values := range query {
+		if field, ok := strings.CutPrefix(key, "map."); ok {
+			params.Columns[field] = values[0]
+		}
+	}
+
+	return params, nil
+}
+
+// parseLimit reads the page size query parameter, falling back to the default one
+func parseLimit(r *http.Request) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return DefaultPageLimit, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil {
+		return 0, fmt.Errorf("%w: limit", ErrInvalidQueryParam)
+	}
+	return n, nil
+}
+
+// parseListParams reads the filtering, sorting and pagination query parameters of a list request
+func parseListParams(r *http.Request) (*ListParams, error) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.URL.Query()
+	params := &ListParams{
+		Due:      query.Get("due"),
+		Timezone: query.Get("tz"),
+		Label:    normalizeName(query.Get("label")),
+		Sort:     query.Get("sort"),
+		Limit:    limit,
+		Cursor:   query.Get("cursor"),
+	}
+
+	if completed := query.Get("completed"); completed != "" {
+		b, err := strconv.ParseBool(completed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: completed", ErrInvalidQueryParam)
+		}
+		params.Completed = &b
+	}
+
+	timeParams := []struct {
+		name string
+		dst  **time.Time
+	}{
+		{name: "created_after", dst: &params.CreatedAfter},
+		{name: "created_before", dst: &params.CreatedBefore},
+		{name: "updated_since", dst: &params.UpdatedSince},
+	}
+	for _, p := range timeParams {
+		if value := query.Get(p.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidQueryParam, p.name)
+			}
+			*p.dst = &t
+		}
+	}
+
+	return params, nil
+}
+
+// nextPageLink builds an RFC 8288 Link header value pointing at the next page
+// of the current request, keeping every other query parameter as is
+func nextPageLink(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
+
+// ifMatch returns the todo version required by the If-Match header of the request, or
+// zero when the request has no precondition. Only a single strong entity tag as returned
+// in ETag can match, ok is false for anything else.
+func ifMatch(r *http.Request) (version int64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// GetByID handles requests to retrieve a specific todo of the authenticated user
+func (h *handler) GetByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	todo, err := h.svc.Update(ctx, int64(id), &req)
+	todo, err := h.svc.GetByID(ctx, userID, int64(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrTodoNotFound):
 			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
 		default:
-			log.Ctx(ctx).Error().Msgf("failed to update todo: %s", err.Error())
+			log.Ctx(ctx).Error().Msgf("failed to get todo: %s", err.Error())
 			render.JSONFromError(w, err)
 		}
 		return
 	}
 
+	w.Header().Set("ETag", todo.ETag())
 	render.JSON(w, http.StatusOK, todo)
 }
 
-// ToggleComplete handles requests to toggle the completion status of a todo
-func (h *handler) ToggleComplete(w http.ResponseWriter, r *http.Request) {
+// Update handles requests to update an existing todo of the authenticated user
+func (h *handler) Update(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	todo, err := h.svc.ToggleComplete(ctx, int64(id))
+	version, ok := ifMatch(r)
+	if !ok {
+		render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		return
+	}
+
+	var req UpdateTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.Update(ctx, userID, int64(id), version, &req)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrTodoNotFound):
 			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrVersionMismatch):
+			render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		case errors.Is(err, ErrInvalidRecurrence):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
 		default:
-			log.Ctx(ctx).Error().Msgf("failed to toggle todo: %s", err.Error())
+			log.Ctx(ctx).Error().Msgf("failed to update todo: %s", err.Error())
 			render.JSONFromError(w, err)
 		}
 		return
 	}
 
+	w.Header().Set("ETag", todo.ETag())
 	render.JSON(w, http.StatusOK, todo)
 }
 
-// Delete handles requests to delete a todo by ID
-func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+// Patch handles partial update requests for a todo of the authenticated user. The body is
+// a JSON Merge Patch or a JSON Patch, applied to the title, description, due_at and priority
+// of the todo, and the patched result is validated like a full update.
+func (h *handler) Patch(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		render.JSONFromError(w, err)
 		return
 	}
 
-	if err := h.svc.Delete(ctx, int64(id)); err != nil {
+	version, ok := ifMatch(r)
+	if !ok {
+		render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchMediaType:
+		apply = jsonpatch.MergePatch
+	case jsonPatchMediaType:
+		apply = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", mergePatchMediaType+", "+jsonPatchMediaType)
+		render.JSON(w, http.StatusUnsupportedMediaType, map[string]string{"message": "unsupported patch content type"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPatchSize)
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"message": ErrPatchTooLarge.Error()})
+			return
+		}
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.GetByID(ctx, userID, int64(id))
+	if err != nil {
 		switch {
 		case errors.Is(err, ErrTodoNotFound):
 			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
 		default:
-			log.Ctx(ctx).Error().Msgf("failed to delete todo: %s", err.Error())
+			log.Ctx(ctx).Error().Msgf("failed to get todo for patch: %s", err.Error())
 			render.JSONFromError(w, err)
 		}
 		return
 	}
 
-	render.JSON(w, http.StatusNoContent, nil)
+	// The patch is applied to the todo just read, so it must not have changed in between
+	if version == 0 {
+		version = todo.Version
+	}
+
+	doc, err := json.Marshal(newUpdateTodoRequest(todo))
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to marshal todo for patch: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	patched, err := apply(doc, patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, jsonpatch.ErrInvalidPatch):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": err.Error()})
+		case errors.Is(err, jsonpatch.ErrPathNotFound):
+			render.JSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to apply todo patch: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	// Only the fields of an update can be patched, anything else is rejected
+	var req UpdateTodoRequest
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err = h.svc.Update(ctx, userID, int64(id), version, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrVersionMismatch):
+			render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		case errors.Is(err, ErrInvalidRecurrence):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to patch todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", todo.ETag())
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// GetHistory handles requests to retrieve the change history of a todo of the authenticated user
+func (h *handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	params := &HistoryParams{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetHistory(ctx, userID, int64(id), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidCursor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get todo history: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// CreateComment handles requests to comment on a todo the authenticated user can see
+func (h *handler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	comment, err := h.svc.CreateComment(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidComment):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to create comment: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, comment)
+}
+
+// GetComments handles requests to retrieve a page of the comments of a todo the authenticated user can see
+func (h *handler) GetComments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	params := &CommentParams{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetComments(ctx, userID, int64(id), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidCursor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get comments: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// UpdateComment handles requests to edit a comment of the authenticated user
+func (h *handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.PathValue("commentID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	comment, err := h.svc.UpdateComment(ctx, userID, int64(id), int64(commentID), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrCommentNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrCommentNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		case errors.Is(err, ErrInvalidComment):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update comment: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, comment)
+}
+
+// DeleteComment handles requests to delete a comment, by its author or the owner of the todo
+func (h *handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.PathValue("commentID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteComment(ctx, userID, int64(id), int64(commentID)); err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrCommentNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrCommentNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete comment: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// Attach handles multipart uploads of a file, in the "file" field, to a todo of the authenticated user
+func (h *handler) Attach(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.svc.limits.MaxFileSize+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"message": ErrFileTooLarge.Error()})
+			return
+		}
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": "invalid multipart form"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": "missing file"})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.svc.Attach(ctx, userID, int64(id), &AttachRequest{
+		Filename: header.Filename,
+		Content:  file,
+		Size:     header.Size,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		case errors.Is(err, ErrFileTooLarge):
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"message": err.Error()})
+		case errors.Is(err, ErrQuotaExceeded):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrQuotaExceeded.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to attach file: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, attachment)
+}
+
+// GetAttachments handles requests to list the attachments of a todo of the authenticated user
+func (h *handler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	attachments, err := h.svc.GetAttachments(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get attachments: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, attachments)
+}
+
+// DownloadAttachment handles requests to download an attachment of a todo of the authenticated user.
+// The content is streamed from the blob store, Range and conditional requests are supported.
+func (h *handler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	attachmentID, err := strconv.Atoi(r.PathValue("attachmentID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	attachment, content, err := h.svc.OpenAttachment(ctx, userID, int64(id), int64(attachmentID))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrAttachmentNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrAttachmentNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to open attachment: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	// The content is never rendered inline nor sniffed, whatever its type
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, content)
+}
+
+// DeleteAttachment handles requests to delete an attachment of a todo of the authenticated user
+func (h *handler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	attachmentID, err := strconv.Atoi(r.PathValue("attachmentID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteAttachment(ctx, userID, int64(id), int64(attachmentID)); err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrAttachmentNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrAttachmentNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete attachment: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// CreateReminder handles requests to set a reminder of the authenticated user on a todo they can see
+func (h *handler) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req CreateReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	reminder, err := h.svc.CreateReminder(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidReminder):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to create reminder: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, reminder)
+}
+
+// GetReminders handles requests to list the reminders the authenticated user set on a todo
+func (h *handler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	reminders, err := h.svc.GetReminders(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get reminders: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, reminders)
+}
+
+// DeleteReminder handles requests to remove a reminder the authenticated user set on a todo
+func (h *handler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	reminderID, err := strconv.Atoi(r.PathValue("reminderID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteReminder(ctx, userID, int64(id), int64(reminderID)); err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrReminderNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrReminderNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete reminder: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// ToggleComplete handles requests to toggle the completion status of a todo of the authenticated user.
+// Completing a recurring todo creates its next occurrence unless recurrence=series is given.
+func (h *handler) ToggleComplete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		return
+	}
+
+	scope, err := ParseCompletionScope(r.URL.Query().Get("recurrence"))
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	todo, err := h.svc.ToggleComplete(ctx, userID, int64(id), version, scope)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrVersionMismatch):
+			render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to toggle todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", todo.ETag())
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// Delete handles requests to delete a todo of the authenticated user by ID
+func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		return
+	}
+
+	if err := h.svc.Delete(ctx, userID, int64(id), version); err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrVersionMismatch):
+			render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// CreateLabel handles label creation requests for authenticated users
+func (h *handler) CreateLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req CreateLabelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	label, err := h.svc.CreateLabel(ctx, userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrLabelAlreadyExists):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": "label already exists"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to create label: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, label)
+}
+
+// GetLabels handles requests to retrieve all labels of the authenticated user
+func (h *handler) GetLabels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	labels, err := h.svc.GetLabels(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to get labels: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, labels)
+}
+
+// UpdateLabel handles requests to rename and recolor a label of the authenticated user
+func (h *handler) UpdateLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateLabelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	label, err := h.svc.UpdateLabel(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrLabelNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "label not found"})
+		case errors.Is(err, ErrLabelAlreadyExists):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": "label already exists"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update label: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, label)
+}
+
+// DeleteLabel handles requests to delete a label of the authenticated user by ID
+func (h *handler) DeleteLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.DeleteLabel(ctx, userID, int64(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrLabelNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "label not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete label: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// AttachLabel handles requests to attach a label to a todo of the authenticated user
+func (h *handler) AttachLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	labelID, err := strconv.Atoi(r.PathValue("labelID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.AttachLabel(ctx, userID, int64(id), int64(labelID))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrLabelNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "label not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to attach label: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// DetachLabel handles requests to detach a label from a todo of the authenticated user
+func (h *handler) DetachLabel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	labelID, err := strconv.Atoi(r.PathValue("labelID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.DetachLabel(ctx, userID, int64(id), int64(labelID))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrLabelNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "label not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to detach label: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// MoveToProject handles requests to move a todo of the authenticated user to another project
+func (h *handler) MoveToProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req MoveTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.MoveToProject(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to move todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// Reorder handles requests to move a todo of the authenticated user in their manual order
+func (h *handler) Reorder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		return
+	}
+
+	var req ReorderTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.Reorder(ctx, userID, int64(id), version, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		case errors.Is(err, ErrInvalidAnchor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		case errors.Is(err, ErrVersionMismatch):
+			render.JSON(w, http.StatusPreconditionFailed, map[string]string{"message": "todo has been modified"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to reorder todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", todo.ETag())
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// Batch handles requests to apply several operations to todos of the authenticated user at
+// once. With atomic=true either all operations are applied or none is, and the response is
+// the one of the failing operation along with its index. Otherwise each operation is applied
+// on its own and the response holds the status code and todo or message of each of them.
+func (h *handler) Batch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	atomic := false
+	if value := r.URL.Query().Get("atomic"); value != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(value); err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("%s: atomic", ErrInvalidQueryParam)})
+			return
+		}
+	}
+
+	var req BatchRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchSize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]string{"message": ErrBatchTooLarge.Error()})
+			return
+		}
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if len(req.Operations) > maxBatchOperations {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("a batch takes at most %d operations", maxBatchOperations)})
+		return
+	}
+
+	// Operations are decoded one by one, so that an invalid one fails on its own
+	for i := range req.Operations {
+		h.decodeOperation(&req.Operations[i])
+	}
+
+	items, err := h.svc.Batch(ctx, userID, req.Operations, atomic)
+	if err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			status, message := h.operationError(ctx, batchErr.Err)
+			render.JSON(w, status, map[string]any{"message": message, "index": batchErr.Index})
+			return
+		}
+		log.Ctx(ctx).Error().Msgf("failed to apply batch: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	results := make([]BatchResult, len(items))
+	for i, item := range items {
+		switch {
+		case item.Err != nil:
+			results[i].Status, results[i].Message = h.operationError(ctx, item.Err)
+		case req.Operations[i].Op == BatchCreate:
+			results[i] = BatchResult{Status: http.StatusCreated, Todo: item.Todo}
+		case req.Operations[i].Op == BatchDelete:
+			results[i] = BatchResult{Status: http.StatusNoContent}
+		default:
+			results[i] = BatchResult{Status: http.StatusOK, Todo: item.Todo}
+		}
+	}
+
+	render.JSON(w, http.StatusOK, BatchResponse{Results: results})
+}
+
+// decodeOperation decodes and validates the data of a batch operation into the request of
+// the matching single-todo endpoint. An invalid operation keeps the reason on it and fails
+// when the batch reaches it.
+func (h *handler) decodeOperation(op *BatchOperation) {
+	if err := h.validator.Struct(op); err != nil {
+		op.err = fmt.Errorf("%w: %s", ErrInvalidOperation, err.Error())
+		return
+	}
+
+	var data any
+	switch op.Op {
+	case BatchCreate:
+		op.create = &CreateTodoRequest{}
+		data = op.create
+	case BatchUpdate:
+		op.update = &UpdateTodoRequest{}
+		data = op.update
+	case BatchMove:
+		op.move = &ReorderTodoRequest{}
+		data = op.move
+	case BatchToggle:
+		scope, err := ParseCompletionScope(op.Recurrence)
+		if err != nil {
+			op.err = fmt.Errorf("%w: invalid recurrence", ErrInvalidOperation)
+		}
+		op.scope = scope
+		return
+	default:
+		return
+	}
+
+	if err := json.Unmarshal(op.Data, data); err != nil {
+		op.err = fmt.Errorf("%w: invalid data: %s", ErrInvalidOperation, err.Error())
+		return
+	}
+	if err := h.validator.Struct(data); err != nil {
+		op.err = fmt.Errorf("%w: %s", ErrInvalidOperation, err.Error())
+	}
+}
+
+// operationError returns the status code and message the single-todo endpoints answer an
+// error of an operation with
+func (h *handler) operationError(ctx context.Context, err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrTodoNotFound):
+		return http.StatusNotFound, "todo not found"
+	case errors.Is(err, ErrProjectNotFound):
+		return http.StatusNotFound, "project not found"
+	case errors.Is(err, ErrVersionMismatch):
+		return http.StatusPreconditionFailed, "todo has been modified"
+	case errors.Is(err, ErrPermissionDenied):
+		return http.StatusForbidden, ErrPermissionDenied.Error()
+	case errors.Is(err, ErrInvalidOperation), errors.Is(err, ErrInvalidRecurrence), errors.Is(err, ErrInvalidAnchor):
+		return http.StatusBadRequest, err.Error()
+	default:
+		log.Ctx(ctx).Error().Msgf("failed to apply batch operation: %s", err.Error())
+		return http.StatusInternalServerError, "Something went wrong"
+	}
+}
+
+// CreateProject handles project creation requests for authenticated users
+func (h *handler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req CreateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	project, err := h.svc.CreateProject(ctx, userID, &req)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to create project: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, project)
+}
+
+// GetProjects handles requests to retrieve the projects of the authenticated user, followed by
+// the projects shared with them
+func (h *handler) GetProjects(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var archived *bool
+	if value := r.URL.Query().Get("archived"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("%s: archived", ErrInvalidQueryParam)})
+			return
+		}
+		archived = &b
+	}
+
+	projects, err := h.svc.GetProjects(ctx, userID, archived)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to get projects: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, projects)
+}
+
+// GetProject handles requests to retrieve a specific project the authenticated user owns or is a member of
+func (h *handler) GetProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	project, err := h.svc.GetProject(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get project: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, project)
+}
+
+// GetProjectTodos handles requests to retrieve a page of the todos in a project of the authenticated user
+func (h *handler) GetProjectTodos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	params, err := parseListParams(r)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetProjectTodos(ctx, userID, int64(id), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidQueryParam):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get project todos: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// UpdateProject handles requests to update an existing project of the authenticated user
+func (h *handler) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	project, err := h.svc.UpdateProject(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrInboxProject):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": ErrInboxProject.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update project: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, project)
+}
+
+// DeleteProject handles requests to delete a project of the authenticated user by ID. Its todos
+// are deleted along with it with ?cascade=true, and moved back to the inbox otherwise.
+func (h *handler) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var cascade bool
+	if value := r.URL.Query().Get("cascade"); value != "" {
+		cascade, err = strconv.ParseBool(value)
+		if err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("%s: cascade", ErrInvalidQueryParam)})
+			return
+		}
+	}
+
+	if err := h.svc.DeleteProject(ctx, userID, int64(id), cascade); err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrInboxProject):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": ErrInboxProject.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete project: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// GetTrash handles requests to retrieve a page of the authenticated user's trashed todos
+func (h *handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	params := &TrashParams{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetTrash(ctx, userID, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCursor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get trash: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		w.Header().Set("Link", nextPageLink(r, page.NextCursor))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// Restore handles requests to take a todo of the authenticated user out of the trash
+func (h *handler) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	todo, err := h.svc.Restore(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to restore todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, todo)
+}
+
+// Purge handles requests to permanently delete a trashed todo of the authenticated user by ID
+func (h *handler) Purge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.Purge(ctx, userID, int64(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrTodoNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "todo not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to purge todo: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// EmptyTrash handles requests to permanently delete all trashed todos of the authenticated user
+func (h *handler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	if err := h.svc.EmptyTrash(ctx, userID); err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to empty trash: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// Invite handles requests to invite a user to a project of the authenticated user by email
+func (h *handler) Invite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	invitation, err := h.svc.Invite(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		case errors.Is(err, ErrInboxProject):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": ErrInboxProject.Error()})
+		case errors.Is(err, ErrAlreadyMember):
+			render.JSON(w, http.StatusConflict, map[string]string{"message": ErrAlreadyMember.Error()})
+		case errors.Is(err, ErrInvalidRole):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to invite to project: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, invitation)
+}
+
+// GetInvitations handles requests to retrieve the pending invitations of a project of the authenticated user
+func (h *handler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	invitations, err := h.svc.GetInvitations(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get invitations: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, invitations)
+}
+
+// CancelInvitation handles requests to cancel a pending invitation of a project of the authenticated user
+func (h *handler) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(r.PathValue("invitationID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.CancelInvitation(ctx, userID, int64(id), int64(invitationID)); err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrInvitationNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrInvitationNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to cancel invitation: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// GetReceivedInvitations handles requests to retrieve the pending invitations addressed to the authenticated user
+func (h *handler) GetReceivedInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	invitations, err := h.svc.GetReceivedInvitations(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to get received invitations: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, invitations)
+}
+
+// AcceptInvitation handles requests to accept an invitation addressed to the authenticated user
+func (h *handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	project, err := h.svc.AcceptInvitation(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvitationNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrInvitationNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to accept invitation: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, project)
+}
+
+// DeclineInvitation handles requests to decline an invitation addressed to the authenticated user
+func (h *handler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.DeclineInvitation(ctx, userID, int64(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrInvitationNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrInvitationNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to decline invitation: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// GetMembers handles requests to retrieve the members of a project the authenticated user can see
+func (h *handler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	members, err := h.svc.GetMembers(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get members: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, members)
+}
+
+// UpdateMember handles requests to change the role of a member of a project of the authenticated user
+func (h *handler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	member, err := h.svc.UpdateMember(ctx, userID, int64(id), int64(memberID), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrMemberNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrMemberNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		case errors.Is(err, ErrInvalidRole):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update member: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, member)
+}
+
+// RemoveMember handles requests to revoke the access of a member to a project of the authenticated
+// user, or to leave a project shared with them
+func (h *handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.RemoveMember(ctx, userID, int64(id), int64(memberID)); err != nil {
+		switch {
+		case errors.Is(err, ErrProjectNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": "project not found"})
+		case errors.Is(err, ErrMemberNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrMemberNotFound.Error()})
+		case errors.Is(err, ErrPermissionDenied):
+			render.JSON(w, http.StatusForbidden, map[string]string{"message": ErrPermissionDenied.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to remove member: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// CreateFeed handles requests to create the iCalendar feed of the authenticated user, or to
+// give it a new token. The token is only returned here.
+func (h *handler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	feedToken, token, err := h.svc.CreateFeed(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to create feed: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, &FeedResponse{
+		Token:     token,
+		Path:      FeedPath(token),
+		CreatedAt: feedToken.CreatedAt,
+	})
+}
+
+// GetFeed handles requests to check whether the authenticated user has an iCalendar feed
+func (h *handler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	feedToken, err := h.svc.GetFeed(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrFeedNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrFeedNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get feed: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, feedToken)
+}
+
+// RevokeFeed handles requests to delete the iCalendar feed of the authenticated user
+func (h *handler) RevokeFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	if err := h.svc.RevokeFeed(ctx, userID); err != nil {
+		switch {
+		case errors.Is(err, ErrFeedNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrFeedNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to revoke feed: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// Feed serves the iCalendar feed of the user the token in the path belongs to. The token is
+// the only credential, so calendar apps can subscribe without an Authorization header.
+// Polling clients sending the ETag back in If-None-Match get 304 Not Modified, from the
+// cache when it still has the tag.
+func (h *handler) Feed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := h.svc.ResolveFeed(ctx, r.PathValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrFeedNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrFeedNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to resolve feed: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	// Clients may keep the feed but must check it is still current before using it
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if etag := h.svc.FeedETag(ctx, userID); etag != "" && noneMatch(r, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	feed, err := h.svc.Feed(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to render feed: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", FormatICS.ContentType())
+	w.Header().Set("ETag", feed.ETag)
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(feed.Content))
+}
+
+// noneMatch reports whether the If-None-Match header of the request matches the given entity
+// tag, with the weak comparison If-None-Match calls for
+func noneMatch(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Stream streams the changes made to the todos the authenticated user sees as Server-Sent
+// Events. Reconnecting clients resume after the event in the Last-Event-ID header, or get a
+// reset event when the events since then aren't kept anymore.
+func (h *handler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	sub, err := h.svc.Subscribe(ctx, userID, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, events.ErrClosed):
+			render.JSON(w, http.StatusServiceUnavailable, map[string]string{"message": "server is shutting down"})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to subscribe to todo events: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Each write extends the deadline, the stream lasts as long as the client keeps reading.
+	// Writers that don't support deadlines are left with the server write timeout, clients
+	// then reconnect and resume.
+	rc := http.NewResponseController(w)
+	write := func(fn func() error) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := fn(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	ok = write(func() error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+		return err
+	})
+	if ok && sub.Reset {
+		ok = write(func() error { return writeEvent(w, events.Event{Type: EventReset}) })
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for ok {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-sub.C:
+			// Subscriptions end when the client falls behind or the server shuts down
+			if !open {
+				return
+			}
+			ok = write(func() error { return writeEvent(w, event) })
+		case <-heartbeat.C:
+			ok = write(func() error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			})
+		}
+	}
 }
@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// historySort orders the history of a todo most recent change first
+var historySort = sortOrder{column: "created_at", desc: true}
+
+// HistoryAction is the kind of change recorded in the history of a todo
+type HistoryAction string
+
+const (
+	HistoryCreate  HistoryAction = "create"
+	HistoryUpdate  HistoryAction = "update"
+	HistoryToggle  HistoryAction = "toggle"
+	HistoryDelete  HistoryAction = "delete"
+	HistoryRestore HistoryAction = "restore"
+	HistoryMove    HistoryAction = "move"
+)
+
+// historyFields are the todo fields, by JSON name, whose changes are recorded
+var historyFields = []string{
+	"project_id",
+	"title",
+	"description",
+	"completed",
+	"completed_at",
+	"due_at",
+	"priority",
+	"recurrence",
+	"position",
+	"deleted_at",
+}
+
+// Change holds the value of a todo field before and after a change
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// HistoryEntry represents a change made to a todo, who made it and as part of which request
+type HistoryEntry struct {
+	ID        int64             `json:"id"`
+	TodoID    int64             `json:"todo_id" gorm:"index:idx_todo_history_todo_created,priority:1"`
+	UserID    int64             `json:"user_id"`
+	Action    HistoryAction     `json:"action"`
+	RequestID string            `json:"request_id"`
+	Changes   map[string]Change `json:"changes" gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time         `json:"created_at" gorm:"index:idx_todo_history_todo_created,priority:2"`
+}
+
+// HistoryParams represents the pagination parameters for listing the history of a todo
+type HistoryParams struct {
+	Limit  int `validate:"min=1,max=100"`
+	Cursor string
+}
+
+// HistoryPage represents a single page of history entries along with the cursor of the next page
+type HistoryPage struct {
+	Data       []HistoryEntry `json:"data"`
+	NextCursor string         `json:"next_cursor"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// encodeHistoryCursor builds an opaque cursor pointing right after the given history entry
+func encodeHistoryCursor(entry *HistoryEntry) string {
+	value := entry.CreatedAt.UTC().Format(time.RFC3339Nano)
+	return cursor{Sort: historySort.String(), Value: value, ID: entry.ID}.encode()
+}
+
+// TableName keeps the history of all todos in a single todo_history table
+func (HistoryEntry) TableName() string {
+	return "todo_history"
+}
+
+// NewHistoryEntry records the change of a todo from before to after made by the given user.
+// Before is nil for a todo that was just created.
+func NewHistoryEntry(userID int64, action HistoryAction, requestID string, before, after *Todo) (*HistoryEntry, error) {
+	changes, err := diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistoryEntry{
+		TodoID:    after.ID,
+		UserID:    userID,
+		Action:    action,
+		RequestID: requestID,
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// snapshot returns the recorded fields of a todo as they appear in its JSON representation
+func snapshot(t *Todo) (map[string]any, error) {
+	fields := map[string]any{}
+	if t == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diff returns the field-level changes between two versions of a todo
+func diff(before, after *Todo) (map[string]Change, error) {
+	b, err := snapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := snapshot(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for _, field := range historyFields {
+		// Fields missing from a snapshot read as null, like every field before a todo is created
+		if !reflect.DeepEqual(b[field], a[field]) {
+			changes[field] = Change{Before: b[field], After: a[field]}
+		}
+	}
+	return changes, nil
+}
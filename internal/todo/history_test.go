@@ -0,0 +1,112 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestNewHistoryEntry_Create(t *testing.T) {
+	todo := NewTodo(123, "Write report", "")
+	todo.ID = 7
+	todo.Position = "a0"
+
+	entry, err := NewHistoryEntry(123, HistoryCreate, "req-1", nil, todo)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), entry.TodoID)
+	assert.Equal(t, int64(123), entry.UserID)
+	assert.Equal(t, HistoryCreate, entry.Action)
+	assert.Equal(t, "req-1", entry.RequestID)
+	assert.WithinDuration(t, time.Now(), entry.CreatedAt, time.Second)
+
+	// Fields that are still null don't show up
+	assert.Equal(t, map[string]Change{
+		"title":       {Before: nil, After: "Write report"},
+		"description": {Before: nil, After: ""},
+		"completed":   {Before: nil, After: false},
+		"priority":    {Before: nil, After: "none"},
+		"position":    {Before: nil, After: "a0"},
+	}, entry.Changes)
+}
+
+func TestNewHistoryEntry_Update(t *testing.T) {
+	dueAt := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+
+	before := NewTodo(123, "Write report", "Draft")
+	before.ID = 7
+	after := *before
+	after.Title = "Write final report"
+	after.DueAt = &dueAt
+	after.Priority = PriorityHigh
+	after.Version = 2
+
+	entry, err := NewHistoryEntry(123, HistoryUpdate, "", before, &after)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Change{
+		"title":    {Before: "Write report", After: "Write final report"},
+		"due_at":   {Before: nil, After: "2026-10-20T09:00:00Z"},
+		"priority": {Before: "none", After: "high"},
+	}, entry.Changes)
+}
+
+func TestNewHistoryEntry_ToggleAndDelete(t *testing.T) {
+	before := NewTodo(123, "Write report", "")
+	before.ID = 7
+	after := *before
+	after.MarkAsCompleted()
+
+	entry, err := NewHistoryEntry(123, HistoryToggle, "", before, &after)
+	require.NoError(t, err)
+	assert.Len(t, entry.Changes, 2)
+	assert.Equal(t, Change{Before: false, After: true}, entry.Changes["completed"])
+	assert.Nil(t, entry.Changes["completed_at"].Before)
+	assert.NotNil(t, entry.Changes["completed_at"].After)
+
+	deleted := after
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+
+	entry, err = NewHistoryEntry(123, HistoryDelete, "", &after, &deleted)
+	require.NoError(t, err)
+	assert.Len(t, entry.Changes, 1)
+	assert.Nil(t, entry.Changes["deleted_at"].Before)
+	assert.NotNil(t, entry.Changes["deleted_at"].After)
+}
+
+func TestNewHistoryEntry_Move(t *testing.T) {
+	before := NewTodo(123, "Write report", "")
+	before.ID = 7
+	before.Position = "a0"
+	after := *before
+	after.Position = "a0V"
+	after.Version = 2
+
+	entry, err := NewHistoryEntry(123, HistoryMove, "", before, &after)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{"position": {Before: "a0", After: "a0V"}}, entry.Changes)
+}
+
+func TestNewHistoryEntry_NoChanges(t *testing.T) {
+	todo := NewTodo(123, "Write report", "")
+
+	entry, err := NewHistoryEntry(123, HistoryUpdate, "", todo, todo)
+	require.NoError(t, err)
+	assert.Empty(t, entry.Changes)
+}
+
+func TestEncodeHistoryCursor(t *testing.T) {
+	entry := &HistoryEntry{ID: 42, CreatedAt: time.Date(2024, 3, 1, 9, 0, 0, 500, time.FixedZone("CET", 3600))}
+
+	c, err := decodeCursor(encodeHistoryCursor(entry), historySort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), c.ID)
+	assert.Equal(t, "2024-03-01T08:00:00.0000005Z", c.Value)
+
+	// Cursors of the oldest first comment order aren't accepted
+	_, err = decodeCursor(encodeHistoryCursor(entry), commentSort)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -0,0 +1,655 @@
+package todo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/ical"
+)
+
+const (
+	// maxImportSize is the maximum size of an imported file in bytes
+	maxImportSize = 10 << 20
+	// maxImportRows is the maximum number of todos in an imported file
+	maxImportRows = 10000
+	// maxLabelNameLength and maxProjectNameLength are the limits of the create endpoints
+	maxLabelNameLength   = 64
+	maxProjectNameLength = 100
+)
+
+var (
+	// ErrInvalidImport is returned when an imported file cannot be read at all
+	ErrInvalidImport = errors.New("invalid import")
+	// ErrImportRejected is returned along with the result of an import when some of its rows
+	// are invalid, in which case nothing is imported
+	ErrImportRejected = errors.New("import rejected")
+)
+
+// ParseImportFormat parses the format of an import, defaulting to FormatJSON
+func ParseImportFormat(s string) (FileFormat, error) {
+	switch format := FileFormat(strings.ToLower(s)); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatICS, FormatTodoist, FormatTrello:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: format", ErrInvalidQueryParam)
+	}
+}
+
+// ImportParams represents the options of an import
+type ImportParams struct {
+	Format FileFormat
+	// DryRun validates the file and reports what would be imported without saving anything
+	DryRun bool
+	// Project is the name of the project todos go to when the file doesn't give one,
+	// the inbox when empty
+	Project string
+	// Columns maps fields to the CSV columns they are read from, overriding the defaults
+	// of the format
+	Columns map[string]string
+}
+
+// ImportError represents an invalid row of an imported file. Rows are numbered from 1 in the
+// order todos appear in the file, the header of CSV files excluded.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// ImportResult represents the outcome of an import
+type ImportResult struct {
+	DryRun          bool          `json:"dry_run"`
+	Imported        int           `json:"imported"`
+	CreatedProjects []string      `json:"created_projects"`
+	CreatedLabels   []string      `json:"created_labels"`
+	Errors          []ImportError `json:"errors"`
+}
+
+// importRow is a todo read from an imported file along with its row number
+type importRow struct {
+	row    int
+	record *fileRecord
+}
+
+// importedTodo is a validated row, ready to be saved
+type importedTodo struct {
+	todo    *Todo
+	project string
+	labels  []string
+}
+
+// readImport reads the todos of an imported file. Rows that can't be read are reported as
+// import errors, files that can't be read at all as ErrInvalidImport.
+func readImport(r io.Reader, params *ImportParams) ([]importRow, []ImportError, error) {
+	switch params.Format {
+	case FormatICS:
+		return readICSImport(r)
+	case FormatCSV, FormatTodoist, FormatTrello:
+		mapping, err := newCSVMapping(params.Format, params.Columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		return readCSVImport(r, mapping)
+	default:
+		return readJSONImport(r)
+	}
+}
+
+// readJSONImport reads a JSON array of todos in the format of JSON exports
+func readJSONImport(r io.Reader) ([]importRow, []ImportError, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	if tok != json.Delim('[') {
+		return nil, nil, fmt.Errorf("%w: expected an array of todos", ErrInvalidImport)
+	}
+
+	var (
+		rows []importRow
+		errs []ImportError
+	)
+	for n := 1; dec.More(); n++ {
+		if n > maxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d todos", ErrInvalidImport, maxImportRows)
+		}
+
+		// Elements are decoded in two steps so that a todo with a field of the wrong type
+		// is reported as an invalid row, only broken JSON rejects the whole file
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+
+		var record fileRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			errs = append(errs, ImportError{Row: n, Message: jsonErrorMessage(err)})
+			continue
+		}
+		rows = append(rows, importRow{row: n, record: &record})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return rows, errs, nil
+}
+
+// jsonErrorMessage describes an error decoding a todo without the Go types involved
+func jsonErrorMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return "expected an object"
+		}
+		return fmt.Sprintf("invalid %s", typeErr.Field)
+	}
+	var timeErr *time.ParseError
+	if errors.As(err, &timeErr) {
+		return fmt.Sprintf("invalid time %q", timeErr.Value)
+	}
+	return err.Error()
+}
+
+// csvMapping describes how the rows of a CSV file are read into todos
+type csvMapping struct {
+	// columns maps fields to the names of the columns they are read from
+	columns map[string]string
+	// filter tells whether a row is a todo, rows that aren't are skipped
+	filter func(get func(field string) string) bool
+	// priority parses the priority column
+	priority func(value string) (string, error)
+	// labels splits the labels column
+	labels func(value string) []string
+	// title cleans the title column up, possibly extracting labels from it
+	title func(value string) (string, []string)
+}
+
+// newCSVMapping creates the mapping of a CSV format, with the given columns overriding
+// its defaults
+func newCSVMapping(format FileFormat, columns map[string]string) (*csvMapping, error) {
+	mapping := &csvMapping{
+		columns:  map[string]string{},
+		filter:   func(func(string) string) bool { return true },
+		priority: func(value string) (string, error) { return strings.ToLower(value), nil },
+		labels:   splitList,
+		title:    func(value string) (string, []string) { return value, nil },
+	}
+
+	switch format {
+	case FormatTodoist:
+		mapping.columns = map[string]string{
+			"title":       "CONTENT",
+			"description": "DESCRIPTION",
+			"priority":    "PRIORITY",
+			"due_at":      "DATE",
+			"timezone":    "TIMEZONE",
+		}
+		// Sections and notes are rows of their own, only tasks are todos
+		mapping.columns["type"] = "TYPE"
+		mapping.filter = func(get func(string) string) bool {
+			return strings.EqualFold(get("type"), "task")
+		}
+		mapping.priority = todoistPriority
+		mapping.title = todoistTitle
+	case FormatTrello:
+		mapping.columns = map[string]string{
+			"title":       "Card Name",
+			"description": "Card Description",
+			"labels":      "Labels",
+			"due_at":      "Due Date",
+			"completed":   "Due Complete",
+			"project":     "Board Name",
+		}
+		mapping.labels = trelloLabels
+	default:
+		for _, field := range csvColumns {
+			mapping.columns[field] = field
+		}
+	}
+
+	for field, column := range columns {
+		if !isCSVField(field) {
+			return nil, fmt.Errorf("%w: map.%s", ErrInvalidQueryParam, field)
+		}
+		mapping.columns[field] = column
+	}
+	return mapping, nil
+}
+
+// isCSVField reports whether a todo field can be mapped to a CSV column
+func isCSVField(field string) bool {
+	for _, f := range csvColumns {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// readCSVImport reads the rows of a CSV file with a header naming its columns
+func readCSVImport(r io.Reader, mapping *csvMapping) ([]importRow, []ImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	// Column names are matched case-insensitively, and spreadsheets like to start files with a BOM
+	indexes := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := indexes[name]; !ok {
+			indexes[name] = i
+		}
+	}
+
+	fields := map[string]int{}
+	for field, column := range mapping.columns {
+		if i, ok := indexes[strings.ToLower(column)]; ok {
+			fields[field] = i
+		}
+	}
+	if _, ok := fields["title"]; !ok {
+		return nil, nil, fmt.Errorf("%w: missing %q column", ErrInvalidImport, mapping.columns["title"])
+	}
+
+	var (
+		rows []importRow
+		errs []ImportError
+	)
+	for n := 1; ; n++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if n > maxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d todos", ErrInvalidImport, maxImportRows)
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, ImportError{Row: n, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		get := func(field string) string {
+			if i, ok := fields[field]; ok && i < len(values) {
+				return strings.TrimSpace(values[i])
+			}
+			return ""
+		}
+		if !mapping.filter(get) {
+			continue
+		}
+
+		record, err := mapping.record(get)
+		if err != nil {
+			errs = append(errs, ImportError{Row: n, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{row: n, record: record})
+	}
+	return rows, errs, nil
+}
+
+// record reads a todo from the columns of a row
+func (m *csvMapping) record(get func(field string) string) (*fileRecord, error) {
+	title, labels := m.title(get("title"))
+	record := &fileRecord{
+		Title:       title,
+		Description: get("description"),
+		Project:     get("project"),
+		Labels:      append(m.labels(get("labels")), labels...),
+	}
+
+	var err error
+	if record.Priority, err = m.priority(get("priority")); err != nil {
+		return nil, err
+	}
+	if value := get("completed"); value != "" {
+		if record.Completed, err = strconv.ParseBool(strings.ToLower(value)); err != nil {
+			return nil, fmt.Errorf("invalid completed %q", value)
+		}
+	}
+
+	// Times without an offset are read in the timezone of the row, if it has one
+	loc := time.UTC
+	if name := get("timezone"); name != "" {
+		if l, err := time.LoadLocation(name); err == nil {
+			loc = l
+		}
+	}
+
+	for field, dst := range map[string]**time.Time{
+		"due_at":       &record.DueAt,
+		"completed_at": &record.CompletedAt,
+		"created_at":   &record.CreatedAt,
+	} {
+		if *dst, err = parseImportTime(field, get(field), loc); err != nil {
+			return nil, err
+		}
+	}
+
+	if rule := get("recurrence"); rule != "" {
+		record.Recurrence = &RecurrenceRequest{Rule: rule, Timezone: get("timezone")}
+		for _, value := range splitList(get("exceptions")) {
+			exception, err := parseImportTime("exceptions", value, loc)
+			if err != nil {
+				return nil, err
+			}
+			record.Recurrence.Exceptions = append(record.Recurrence.Exceptions, *exception)
+		}
+	}
+	return record, nil
+}
+
+// importTimeFormats are the layouts times are read with in CSV files, most precise first
+var importTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseImportTime parses an optional time of a CSV file, an empty cell being nil
+func parseImportTime(field, value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range importTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s %q", field, value)
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// todoistPriorities maps the priorities of Todoist exports, 1 being the highest
+var todoistPriorities = map[string]Priority{
+	"1": PriorityUrgent,
+	"2": PriorityHigh,
+	"3": PriorityMedium,
+	"4": PriorityNone,
+	"":  PriorityNone,
+}
+
+// todoistPriority parses the PRIORITY column of Todoist exports
+func todoistPriority(value string) (string, error) {
+	priority, ok := todoistPriorities[value]
+	if !ok {
+		return "", fmt.Errorf("invalid priority %q", value)
+	}
+	return priority.String(), nil
+}
+
+// todoistLabel matches the @label tokens Todoist keeps in the content of a task
+var todoistLabel = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// todoistTitle extracts the labels from the CONTENT column of Todoist exports
+func todoistTitle(value string) (string, []string) {
+	var labels []string
+	for _, match := range todoistLabel.FindAllStringSubmatch(value, -1) {
+		labels = append(labels, match[2])
+	}
+	title := todoistLabel.ReplaceAllString(value, "$1")
+	return strings.Join(strings.Fields(title), " "), labels
+}
+
+// trelloLabelColor matches the color Trello appends to label names in its exports
+var trelloLabelColor = regexp.MustCompile(`\s*\([^()]*\)$`)
+
+// trelloLabels splits the Labels column of Trello exports, like "Bug (red), Backend (blue)".
+// Labels that only have a color are dropped.
+func trelloLabels(value string) []string {
+	var labels []string
+	for _, item := range splitList(value) {
+		if name := strings.TrimSpace(trelloLabelColor.ReplaceAllString(item, "")); name != "" {
+			labels = append(labels, name)
+		}
+	}
+	return labels
+}
+
+// icsImportPriority maps the 1 (highest) to 9 (lowest) priorities of iCalendar, 0 meaning none
+func icsImportPriority(value int) Priority {
+	switch {
+	case value == 1:
+		return PriorityUrgent
+	case value >= 2 && value <= 4:
+		return PriorityHigh
+	case value == 5:
+		return PriorityMedium
+	case value >= 6 && value <= 9:
+		return PriorityLow
+	default:
+		return PriorityNone
+	}
+}
+
+// readICSImport reads the VTODO components of an iCalendar file
+func readICSImport(r io.Reader) ([]importRow, []ImportError, error) {
+	root, err := ical.Parse(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	components := root.Components
+	if root.Name == "VTODO" {
+		components = []*ical.Component{root}
+	}
+
+	var (
+		rows []importRow
+		errs []ImportError
+		n    int
+	)
+	for _, c := range components {
+		if c.Name != "VTODO" {
+			continue
+		}
+		n++
+		if n > maxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d todos", ErrInvalidImport, maxImportRows)
+		}
+
+		record, err := icsRecord(c)
+		if err != nil {
+			errs = append(errs, ImportError{Row: n, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{row: n, record: record})
+	}
+	return rows, errs, nil
+}
+
+// icsRecord reads a todo from a VTODO component
+func icsRecord(c *ical.Component) (*fileRecord, error) {
+	text := func(name string) string {
+		if p := c.Get(name); p != nil {
+			return strings.TrimSpace(p.Text())
+		}
+		return ""
+	}
+	dateTime := func(name string) (*time.Time, error) {
+		p := c.Get(name)
+		if p == nil {
+			return nil, nil
+		}
+		t, err := ical.ParseDateTime(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", name, p.Value)
+		}
+		return &t, nil
+	}
+
+	record := &fileRecord{
+		Title:       text("SUMMARY"),
+		Description: text("DESCRIPTION"),
+		Project:     text("X-PROJECT"),
+	}
+
+	var err error
+	if record.DueAt, err = dateTime("DUE"); err != nil {
+		return nil, err
+	}
+	if record.CompletedAt, err = dateTime("COMPLETED"); err != nil {
+		return nil, err
+	}
+	if record.CreatedAt, err = dateTime("CREATED"); err != nil {
+		return nil, err
+	}
+	record.Completed = strings.EqualFold(text("STATUS"), "COMPLETED") || record.CompletedAt != nil
+
+	if p := c.Get("PRIORITY"); p != nil {
+		value, err := strconv.Atoi(strings.TrimSpace(p.Value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PRIORITY %q", p.Value)
+		}
+		record.Priority = icsImportPriority(value).String()
+	}
+
+	for _, p := range c.All("CATEGORIES") {
+		for _, name := range ical.SplitList(p.Value) {
+			if name = strings.TrimSpace(name); name != "" {
+				record.Labels = append(record.Labels, name)
+			}
+		}
+	}
+
+	if rrule := c.Get("RRULE"); rrule != nil {
+		// Exports keep the timezone rules are expanded in aside, other calendars only
+		// have the one of the due date
+		timezone := text("X-RECURRENCE-TIMEZONE")
+		if due := c.Get("DUE"); timezone == "" && due != nil {
+			timezone = due.Params["TZID"]
+		}
+		record.Recurrence = &RecurrenceRequest{Rule: rrule.Value, Timezone: timezone}
+
+		for _, p := range c.All("EXDATE") {
+			for _, value := range strings.Split(p.Value, ",") {
+				exdate := ical.Property{Name: p.Name, Params: p.Params, Value: strings.TrimSpace(value)}
+				exception, err := ical.ParseDateTime(&exdate)
+				if err != nil {
+					return nil, fmt.Errorf("invalid EXDATE %q", value)
+				}
+				record.Recurrence.Exceptions = append(record.Recurrence.Exceptions, exception)
+			}
+		}
+	}
+	return record, nil
+}
+
+// newImportedTodo validates an imported todo the way the create endpoint does, and builds
+// it for the given user along with the names of its project and labels
+func newImportedTodo(userID int64, record *fileRecord, defaultProject string) (*importedTodo, error) {
+	title := strings.TrimSpace(record.Title)
+	if title == "" {
+		return nil, errors.New("title is required")
+	}
+
+	priority, err := ParsePriority(strings.ToLower(strings.TrimSpace(record.Priority)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid priority %q", record.Priority)
+	}
+
+	recurrence, err := newRecurrence(record.Recurrence, record.DueAt, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	project := normalizeName(record.Project)
+	if project == "" {
+		project = normalizeName(defaultProject)
+	}
+	if utf8.RuneCountInString(project) > maxProjectNameLength {
+		return nil, fmt.Errorf("project name longer than %d characters", maxProjectNameLength)
+	}
+
+	var labels []string
+	seen := map[string]bool{}
+	for _, name := range record.Labels {
+		name = normalizeName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxLabelNameLength {
+			return nil, fmt.Errorf("label name longer than %d characters", maxLabelNameLength)
+		}
+		seen[name] = true
+		labels = append(labels, name)
+	}
+
+	todo := NewTodo(userID, title, record.Description)
+	todo.Priority = priority
+	todo.Recurrence = recurrence
+	if record.DueAt != nil {
+		dueAt := record.DueAt.UTC()
+		todo.DueAt = &dueAt
+	}
+	if record.Completed {
+		todo.MarkAsCompleted()
+		if record.CompletedAt != nil {
+			completedAt := record.CompletedAt.UTC()
+			todo.CompletedAt = &completedAt
+		}
+	}
+	// Todos keep their creation date, so that moving between services doesn't reset their age
+	if record.CreatedAt != nil && !record.CreatedAt.IsZero() {
+		todo.CreatedAt = record.CreatedAt.UTC()
+	}
+
+	return &importedTodo{todo: todo, project: project, labels: labels}, nil
+}
+
+// validateImport validates the rows of an imported file, returning the todos to save and
+// the errors of the invalid rows, in row order
+func validateImport(userID int64, rows []importRow, errs []ImportError, defaultProject string) ([]*importedTodo, []ImportError) {
+	var todos []*importedTodo
+	for _, row := range rows {
+		todo, err := newImportedTodo(userID, row.record, defaultProject)
+		if err != nil {
+			errs = append(errs, ImportError{Row: row.row, Message: err.Error()})
+			continue
+		}
+		todos = append(todos, todo)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+	return todos, errs
+}
@@ -0,0 +1,246 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importFile reads and validates a file for user 1, failing the test on file errors
+func importFile(t *testing.T, params *ImportParams, content string) ([]*importedTodo, []ImportError) {
+	t.Helper()
+
+	rows, errs, err := readImport(strings.NewReader(content), params)
+	require.NoError(t, err)
+	return validateImport(1, rows, errs, params.Project)
+}
+
+func TestParseImportFormat(t *testing.T) {
+	for _, name := range []string{"json", "csv", "ics", "todoist", "Trello"} {
+		_, err := ParseImportFormat(name)
+		assert.NoError(t, err, name)
+	}
+
+	format, err := ParseImportFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseImportFormat("xlsx")
+	assert.ErrorIs(t, err, ErrInvalidQueryParam)
+}
+
+func TestReadJSONImport(t *testing.T) {
+	content := `[
+		{"title": "Call mom", "priority": "High", "labels": ["family", " family ", ""]},
+		{"title": 42},
+		{"title": "  "},
+		{"title": "Water plants", "due_at": "tomorrow"},
+		{"title": "Pay rent", "recurrence": {"rule": "FREQ=MONTHLY"}},
+		{"title": "Done", "completed": true}
+	]`
+
+	todos, errs := importFile(t, &ImportParams{Format: FormatJSON, Project: "Home"}, content)
+	require.Len(t, todos, 2)
+
+	assert.Equal(t, "Call mom", todos[0].todo.Title)
+	assert.Equal(t, PriorityHigh, todos[0].todo.Priority)
+	assert.Equal(t, "Home", todos[0].project)
+	assert.Equal(t, []string{"family"}, todos[0].labels)
+
+	// Completed todos without a completion time are completed now
+	assert.True(t, todos[1].todo.Completed)
+	assert.NotNil(t, todos[1].todo.CompletedAt)
+
+	assert.Equal(t, []ImportError{
+		{Row: 2, Message: "invalid title"},
+		{Row: 3, Message: "title is required"},
+		{Row: 4, Message: `invalid time "tomorrow"`},
+		{Row: 5, Message: "invalid recurrence: a due date is required"},
+	}, errs)
+}
+
+func TestReadJSONImport_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty", content: ""},
+		{name: "object", content: `{"title": "x"}`},
+		{name: "truncated", content: `[{"title": "x"}, {"title":`},
+		{name: "unterminated", content: `[{"title": "x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readImport(strings.NewReader(tt.content), &ImportParams{Format: FormatJSON})
+			assert.ErrorIs(t, err, ErrInvalidImport)
+		})
+	}
+}
+
+func TestReadCSVImport(t *testing.T) {
+	content := "\ufeffTitle,Priority,Due_At,Labels,Project,Completed\n" +
+		"Call mom,urgent,2024-03-01 09:30,\"family, phone\",Home,\n" +
+		"Water plants,,2024-03-02,,,yes please\n" +
+		"Pay rent,,next week,,,\n" +
+		",low,,,,\n" +
+		"Done,,,,,true\n"
+
+	todos, errs := importFile(t, &ImportParams{Format: FormatCSV}, content)
+	require.Len(t, todos, 2)
+
+	assert.Equal(t, "Call mom", todos[0].todo.Title)
+	assert.Equal(t, PriorityUrgent, todos[0].todo.Priority)
+	assert.Equal(t, time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), *todos[0].todo.DueAt)
+	assert.Equal(t, []string{"family", "phone"}, todos[0].labels)
+	assert.Equal(t, "Home", todos[0].project)
+	assert.True(t, todos[1].todo.Completed)
+
+	assert.Equal(t, []ImportError{
+		{Row: 2, Message: `invalid completed "yes please"`},
+		{Row: 3, Message: `invalid due_at "next week"`},
+		{Row: 4, Message: "title is required"},
+	}, errs)
+}
+
+func TestReadCSVImport_Columns(t *testing.T) {
+	content := "Task,When,Zone\nStandup,2024-03-01 09:30,Europe/Paris\n"
+
+	params := &ImportParams{
+		Format:  FormatCSV,
+		Columns: map[string]string{"title": "task", "due_at": "When", "timezone": "Zone"},
+	}
+	todos, errs := importFile(t, params, content)
+	require.Empty(t, errs)
+	require.Len(t, todos, 1)
+
+	// Times without an offset are read in the timezone of the row
+	assert.Equal(t, "Standup", todos[0].todo.Title)
+	assert.Equal(t, time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC), *todos[0].todo.DueAt)
+
+	_, _, err := readImport(strings.NewReader(content), &ImportParams{Format: FormatCSV})
+	assert.ErrorIs(t, err, ErrInvalidImport)
+
+	params.Columns = map[string]string{"owner": "Owner"}
+	_, _, err = readImport(strings.NewReader(content), params)
+	assert.ErrorIs(t, err, ErrInvalidQueryParam)
+}
+
+func TestReadTodoistImport(t *testing.T) {
+	content := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Buy milk @shopping @urgent-ish,From the corner shop,1,1,Jane,,2024-03-01,en,Europe/Paris\n" +
+		",,,,,,,,,\n" +
+		"task,Plan trip,,4,1,Jane,,,en,\n" +
+		"note,Remember passports,,,,,,,,\n" +
+		"task,Call plumber,,7,1,Jane,,,en,\n" +
+		"task,Renew passport,,2,1,Jane,,every month,en,\n"
+
+	todos, errs := importFile(t, &ImportParams{Format: FormatTodoist, Project: "Todoist"}, content)
+	require.Len(t, todos, 2)
+
+	assert.Equal(t, "Buy milk", todos[0].todo.Title)
+	assert.Equal(t, "From the corner shop", todos[0].todo.Description)
+	assert.Equal(t, PriorityUrgent, todos[0].todo.Priority)
+	assert.Equal(t, []string{"shopping", "urgent-ish"}, todos[0].labels)
+	assert.Equal(t, time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC), *todos[0].todo.DueAt)
+	assert.Equal(t, "Todoist", todos[0].project)
+
+	assert.Equal(t, "Plan trip", todos[1].todo.Title)
+	assert.Equal(t, PriorityNone, todos[1].todo.Priority)
+
+	// Rows are numbered in the file, skipped sections and notes included
+	assert.Equal(t, []ImportError{
+		{Row: 6, Message: `invalid priority "7"`},
+		{Row: 7, Message: `invalid due_at "every month"`},
+	}, errs)
+}
+
+func TestReadTrelloImport(t *testing.T) {
+	content := "Card ID,Card Name,Card URL,Card Description,Labels,Members,Due Date,Due Complete,List Name,Board Name\n" +
+		"abc,Fix login,https://trello.com/c/abc,Users can't log in,\"Bug (red), Backend (blue), (green)\",jane,2024-03-01T17:00:00.000Z,false,Doing,Website\n" +
+		"def,Ship it,https://trello.com/c/def,,,,,true,Done,Website\n"
+
+	todos, errs := importFile(t, &ImportParams{Format: FormatTrello}, content)
+	require.Empty(t, errs)
+	require.Len(t, todos, 2)
+
+	assert.Equal(t, "Fix login", todos[0].todo.Title)
+	assert.Equal(t, "Users can't log in", todos[0].todo.Description)
+	assert.Equal(t, []string{"Bug", "Backend"}, todos[0].labels)
+	assert.Equal(t, time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), *todos[0].todo.DueAt)
+	assert.Equal(t, "Website", todos[0].project)
+	assert.False(t, todos[0].todo.Completed)
+
+	assert.True(t, todos[1].todo.Completed)
+}
+
+func TestReadICSImport(t *testing.T) {
+	content := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//Example//Tasks//EN\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Not a todo\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Weekly review\r\n" +
+		"DUE;TZID=Europe/Paris:20240301T090000\r\n" +
+		"RRULE:FREQ=WEEKLY\r\n" +
+		"EXDATE;TZID=Europe/Paris:20240308T090000,20240315T090000\r\n" +
+		"PRIORITY:3\r\n" +
+		"CATEGORIES:Work,Planning\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Filed taxes\r\n" +
+		"STATUS:COMPLETED\r\n" +
+		"PRIORITY:7\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Broken\r\n" +
+		"DUE:someday\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	todos, errs := importFile(t, &ImportParams{Format: FormatICS}, content)
+	require.Len(t, todos, 2)
+
+	review := todos[0].todo
+	assert.Equal(t, "Weekly review", review.Title)
+	assert.Equal(t, PriorityHigh, review.Priority)
+	assert.Equal(t, []string{"Work", "Planning"}, todos[0].labels)
+	assert.Equal(t, time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), *review.DueAt)
+	require.NotNil(t, review.Recurrence)
+	assert.Equal(t, "Europe/Paris", review.Recurrence.Timezone)
+	assert.Len(t, review.Recurrence.Exceptions, 2)
+
+	assert.True(t, todos[1].todo.Completed)
+	assert.Equal(t, PriorityLow, todos[1].todo.Priority)
+
+	// Rows count todos only, not the other components of the calendar
+	assert.Equal(t, []ImportError{{Row: 3, Message: `invalid DUE "someday"`}}, errs)
+
+	_, _, err := readImport(strings.NewReader("BEGIN:VCALENDAR\r\n"), &ImportParams{Format: FormatICS})
+	assert.ErrorIs(t, err, ErrInvalidImport)
+}
+
+func TestNewImportedTodo(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	todo, err := newImportedTodo(1, &fileRecord{Title: " Old ", CreatedAt: &created}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Old", todo.todo.Title)
+	assert.Equal(t, created, todo.todo.CreatedAt)
+	assert.Empty(t, todo.project)
+
+	_, err = newImportedTodo(1, &fileRecord{Title: "x", Priority: "critical"}, "")
+	assert.EqualError(t, err, `invalid priority "critical"`)
+
+	_, err = newImportedTodo(1, &fileRecord{Title: "x", Labels: []string{strings.Repeat("a", 65)}}, "")
+	assert.EqualError(t, err, "label name longer than 64 characters")
+
+	_, err = newImportedTodo(1, &fileRecord{Title: "x"}, strings.Repeat("p", 101))
+	assert.EqualError(t, err, "project name longer than 100 characters")
+}
@@ -3,17 +3,41 @@
 package todo
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/cache"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/rank"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/requestid"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/storage"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+	"github.com/syahidfrd/go-boilerplate/internal/user"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+	"gorm.io/gorm"
 )
 
 var sharedContainer *test.Container
@@ -22,11 +46,11 @@ func TestMain(m *testing.M) {
 	var cleanup func() int
 	sharedContainer, cleanup = test.SetupTestMain()
 
-	// Run standard migrations + Todo model
+	// Run standard migrations + Todo, Label, Project, HistoryEntry, Member, Invitation, Comment, Attachment, FeedToken, ExportFile, Reminder, webhook, job and notification models
 	sharedContainer.RunStandardMigrations(&testing.T{})
-	err := sharedContainer.DB.AutoMigrate(&Todo{})
+	err := sharedContainer.DB.AutoMigrate(&Todo{}, &Label{}, &Project{}, &HistoryEntry{}, &Member{}, &Invitation{}, &Comment{}, &Attachment{}, &FeedToken{}, &ExportFile{}, &Reminder{}, &webhook.Endpoint{}, &webhook.Delivery{}, &jobs.Job{}, &notification.Notification{})
 	if err != nil {
-		panic("failed to migrate Todo model: " + err.Error())
+		panic("failed to migrate Todo, Label, Project, HistoryEntry, Member, Invitation, Comment, Attachment, FeedToken, ExportFile, Reminder, webhook, job and notification models: " + err.Error())
 	}
 
 	code := m.Run()
@@ -41,12 +65,44 @@ func setupTestServices(t *testing.T) (*Service, *handler, *test.Container) {
 
 	store := NewStore(sharedContainer.DB)
 	redisCache := cache.NewRedis(sharedContainer.Redis)
-	service := NewService(store, redisCache)
+	eventOutbox := outbox.New(sharedContainer.DB)
+	users := user.NewService(user.NewStore(sharedContainer.DB), eventOutbox)
+	blobs, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	broker := events.NewBroker(sharedContainer.Redis, 100, time.Hour)
+	webhooks := webhook.NewService(webhook.NewStore(sharedContainer.DB), webhook.NewClient(5*time.Second, true), 3)
+	notifier := notification.NewService(notification.NewStore(sharedContainer.DB))
+	notifier.Register(notification.ChannelWebhook, notification.NewWebhookNotifier(webhooks))
+	service := NewService(store, redisCache, users, blobs, broker, webhooks, notifier, eventOutbox, jobs.NewQueue(sharedContainer.DB), AttachmentLimits{MaxFileSize: 1 << 20, UserQuota: 2 << 20})
 	handler := NewHandler(service)
 
+	// Deliver events until the test ends, once the broker listens to them
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool {
+		subs, err := sharedContainer.Redis.PubSubNumSub(ctx, "events").Result()
+		return err == nil && subs["events"] > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
 	return service, handler, sharedContainer
 }
 
+func createTestUser(t *testing.T, email string) int64 {
+	t.Helper()
+
+	u, err := user.NewService(user.NewStore(sharedContainer.DB), outbox.New(sharedContainer.DB)).Create(context.Background(), email, "hashed-password")
+	require.NoError(t, err)
+	return u.ID
+}
+
 func createAuthenticatedContext(userID int64) context.Context {
 	return context.WithValue(context.Background(), auth.UserIDKey, userID)
 }
@@ -225,7 +281,7 @@ func TestTodoGetByUserIDCachingIntegration(t *testing.T) {
 	require.True(t, ok)
 	assert.Len(t, data2, 1)
 
-	// Verify core fields match (timestamps might differ due to caching serialization)
+	// Verify cached todos match the ones served from the database
 	todo1 := data1[0].(map[string]any)
 	todo2 := data2[0].(map[string]any)
 
@@ -233,12 +289,281 @@ func TestTodoGetByUserIDCachingIntegration(t *testing.T) {
 	assert.Equal(t, todo1["description"], todo2["description"])
 	assert.Equal(t, todo1["completed"], todo2["completed"])
 	assert.Equal(t, todo1["id"], todo2["id"])
+	assert.Equal(t, todo1["user_id"], todo2["user_id"])
+	assert.Equal(t, todo1["created_at"], todo2["created_at"])
+}
+
+func TestTodoGetByUserIDPaginationIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	// Create five todos, newest last
+	for i := 1; i <= 5; i++ {
+		_, err := service.Create(context.Background(), userID, &CreateTodoRequest{
+			Title: "Todo " + strconv.Itoa(i),
+		})
+		require.NoError(t, err)
+	}
+
+	var titles []string
+	target := "/api/todos?limit=2"
+	for pages := 0; target != ""; pages++ {
+		require.Less(t, pages, 3, "expected exactly three pages")
+
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.GetByUserID(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    target,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		for _, item := range resp.Body["data"].([]any) {
+			titles = append(titles, item.(map[string]any)["title"].(string))
+		}
+
+		target = ""
+		if resp.Body["has_more"].(bool) {
+			nextCursor := resp.Body["next_cursor"].(string)
+			require.NotEmpty(t, nextCursor)
+
+			link := resp.Headers.Get("Link")
+			assert.Contains(t, link, `rel="next"`)
+			assert.Contains(t, link, "cursor="+nextCursor)
+			assert.Contains(t, link, "limit=2")
+
+			target = "/api/todos?limit=2&cursor=" + nextCursor
+		} else {
+			assert.Empty(t, resp.Body["next_cursor"])
+			assert.Empty(t, resp.Headers.Get("Link"))
+		}
+	}
+
+	assert.Equal(t, []string{"Todo 5", "Todo 4", "Todo 3", "Todo 2", "Todo 1"}, titles)
+}
+
+func TestTodoGetByUserIDPaginationCacheInvalidationIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		_, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Todo " + strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+
+	// Populate the cache with both pages
+	first, err := service.GetByUserID(ctx, userID, &ListParams{Limit: 2})
+	require.NoError(t, err)
+	require.True(t, first.HasMore)
+	cursor := first.NextCursor
+
+	second, err := service.GetByUserID(ctx, userID, &ListParams{Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	require.Len(t, second.Data, 1)
+
+	// Deleting a todo on the first page must invalidate the second page too
+	require.NoError(t, service.Delete(ctx, userID, first.Data[0].ID, 0))
+
+	first, err = service.GetByUserID(ctx, userID, &ListParams{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, first.Data, 2)
+	assert.False(t, first.HasMore)
+
+	second, err = service.GetByUserID(ctx, userID, &ListParams{Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Empty(t, second.Data)
+}
+
+func TestTodoGetByUserIDFilterAndSortIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Seed todos with controlled timestamps
+	seed := []Todo{
+		{UserID: userID, Title: "Charlie", Completed: true, CreatedAt: base, UpdatedAt: base.Add(72 * time.Hour)},
+		{UserID: userID, Title: "Alpha", Completed: false, CreatedAt: base.Add(24 * time.Hour), UpdatedAt: base.Add(24 * time.Hour)},
+		{UserID: userID, Title: "Bravo", Completed: true, CreatedAt: base.Add(48 * time.Hour), UpdatedAt: base.Add(48 * time.Hour)},
+		{UserID: 2, Title: "Other user", Completed: true, CreatedAt: base, UpdatedAt: base},
+	}
+	for i := range seed {
+		require.NoError(t, container.DB.Create(&seed[i]).Error)
+	}
+
+	// Seeded todos have no position until the backfill puts them newest first
+	_, err := service.BackfillPositions(context.Background())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedTitles []string
+	}{
+		{
+			name:           "default sort is the manual order",
+			query:          "",
+			expectedTitles: []string{"Bravo", "Alpha", "Charlie"},
+		},
+		{
+			name:           "completed only",
+			query:          "completed=true",
+			expectedTitles: []string{"Bravo", "Charlie"},
+		},
+		{
+			name:           "incomplete only",
+			query:          "completed=false",
+			expectedTitles: []string{"Alpha"},
+		},
+		{
+			name:           "created after",
+			query:          "created_after=2024-05-01T12:00:00Z",
+			expectedTitles: []string{"Bravo", "Alpha"},
+		},
+		{
+			name:           "created before",
+			query:          "created_before=2024-05-03T12:00:00Z",
+			expectedTitles: []string{"Alpha", "Charlie"},
+		},
+		{
+			name:           "updated since",
+			query:          "updated_since=2024-05-03T12:00:00Z",
+			expectedTitles: []string{"Bravo", "Charlie"},
+		},
+		{
+			name:           "sort by created at ascending",
+			query:          "sort=created_at",
+			expectedTitles: []string{"Charlie", "Alpha", "Bravo"},
+		},
+		{
+			name:           "sort by most recently updated",
+			query:          "sort=-updated_at",
+			expectedTitles: []string{"Charlie", "Bravo", "Alpha"},
+		},
+		{
+			name:           "sort by title",
+			query:          "sort=title",
+			expectedTitles: []string{"Alpha", "Bravo", "Charlie"},
+		},
+		{
+			name:           "filter combined with sort",
+			query:          "completed=true&sort=title",
+			expectedTitles: []string{"Bravo", "Charlie"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				handler.GetByUserID(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodGet,
+				URL:    "/api/todos?" + tt.query,
+			})
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var titles []string
+			for _, item := range resp.Body["data"].([]any) {
+				titles = append(titles, item.(map[string]any)["title"].(string))
+			}
+			assert.Equal(t, tt.expectedTitles, titles)
+		})
+	}
+
+	// Paging through a sorted and filtered list must keep both
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Sort: "title", Limit: 1})
+	require.NoError(t, err)
+	require.True(t, page.HasMore)
+	assert.Equal(t, "Alpha", page.Data[0].Title)
+
+	page, err = service.GetByUserID(context.Background(), userID, &ListParams{Sort: "title", Limit: 1, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, "Bravo", page.Data[0].Title)
+
+	// A cursor issued for one sort can't be used with another
+	_, err = service.GetByUserID(context.Background(), userID, &ListParams{Sort: "-created_at", Limit: 1, Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestTodoGetByUserIDFilteredCacheIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Done"})
+	require.NoError(t, err)
+	_, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	_, err = service.Create(ctx, userID, &CreateTodoRequest{Title: "Pending"})
+	require.NoError(t, err)
+
+	// Warm the cache with the unfiltered list
+	all, err := service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	assert.Len(t, all.Data, 2)
+
+	// A filtered request must not be served the unfiltered cached page
+	completed := true
+	done, err := service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit, Completed: &completed})
+	require.NoError(t, err)
+	require.Len(t, done.Data, 1)
+	assert.Equal(t, "Done", done.Data[0].Title)
+
+	// And the filtered page must not leak into the unfiltered one
+	all, err = service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	assert.Len(t, all.Data, 2)
+}
+
+func TestTodoGetByUserIDInvalidParamsIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+
+	ctx := createAuthenticatedContext(1)
+
+	tests := []struct {
+		name            string
+		url             string
+		expectedMessage string
+	}{
+		{name: "non numeric limit", url: "/api/todos?limit=abc"},
+		{name: "zero limit", url: "/api/todos?limit=0"},
+		{name: "limit too large", url: "/api/todos?limit=101"},
+		{name: "malformed cursor", url: "/api/todos?cursor=not-a-cursor", expectedMessage: "invalid cursor"},
+		{name: "non boolean completed", url: "/api/todos?completed=maybe", expectedMessage: "invalid query parameter: completed"},
+		{name: "malformed created after", url: "/api/todos?created_after=yesterday", expectedMessage: "invalid query parameter: created_after"},
+		{name: "malformed created before", url: "/api/todos?created_before=2024-13-01", expectedMessage: "invalid query parameter: created_before"},
+		{name: "malformed updated since", url: "/api/todos?updated_since=now", expectedMessage: "invalid query parameter: updated_since"},
+		{name: "unknown sort", url: "/api/todos?sort=password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				handler.GetByUserID(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodGet,
+				URL:    tt.url,
+			})
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			if tt.expectedMessage != "" {
+				test.AssertErrorResponse(t, resp, http.StatusBadRequest, tt.expectedMessage)
+			}
+		})
+	}
 }
 
 func TestTodoGetByIDIntegration(t *testing.T) {
 	service, handler, _ := setupTestServices(t)
 
 	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
 
 	// Create a test todo
 	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
@@ -250,7 +575,7 @@ func TestTodoGetByIDIntegration(t *testing.T) {
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		// Simulate path value
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.GetByID(w, r)
+		handler.GetByID(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodGet,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10),
@@ -265,10 +590,11 @@ func TestTodoGetByIDIntegration(t *testing.T) {
 
 func TestTodoGetByIDNotFoundIntegration(t *testing.T) {
 	_, handler, _ := setupTestServices(t)
+	ctx := createAuthenticatedContext(1)
 
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", "999")
-		handler.GetByID(w, r)
+		handler.GetByID(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodGet,
 		URL:    "/todos/999",
@@ -281,6 +607,7 @@ func TestTodoUpdateIntegration(t *testing.T) {
 	service, handler, _ := setupTestServices(t)
 
 	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
 
 	// Create a test todo
 	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
@@ -296,7 +623,7 @@ func TestTodoUpdateIntegration(t *testing.T) {
 
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.Update(w, r)
+		handler.Update(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodPut,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10),
@@ -312,6 +639,7 @@ func TestTodoUpdateIntegration(t *testing.T) {
 
 func TestTodoUpdateNotFoundIntegration(t *testing.T) {
 	_, handler, _ := setupTestServices(t)
+	ctx := createAuthenticatedContext(1)
 
 	updateReq := UpdateTodoRequest{
 		Title:       "Updated Title",
@@ -320,7 +648,7 @@ func TestTodoUpdateNotFoundIntegration(t *testing.T) {
 
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", "999")
-		handler.Update(w, r)
+		handler.Update(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodPut,
 		URL:    "/todos/999",
@@ -330,10 +658,288 @@ func TestTodoUpdateNotFoundIntegration(t *testing.T) {
 	test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
 }
 
+func TestTodoPatchIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	dueAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
+		Title:       "Original Title",
+		Description: "Original Description",
+		DueAt:       &dueAt,
+		Priority:    "high",
+	})
+	require.NoError(t, err)
+
+	patch := func(contentType, body string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
+			handler.Patch(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method:  http.MethodPatch,
+			URL:     "/todos/" + strconv.FormatInt(todo.ID, 10),
+			Body:    json.RawMessage(body),
+			Headers: map[string]string{"Content-Type": contentType},
+		})
+	}
+
+	// Merge patch only touches the given fields
+	resp := patch("application/merge-patch+json", `{"title":"Patched Title"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.Body)
+	assert.Equal(t, "Patched Title", resp.Body["title"])
+	assert.Equal(t, "Original Description", resp.Body["description"])
+	assert.Equal(t, "high", resp.Body["priority"])
+	assert.NotNil(t, resp.Body["due_at"])
+
+	// Null removes the due date
+	resp = patch("application/merge-patch+json; charset=utf-8", `{"due_at":null,"priority":"low"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body["due_at"])
+	assert.Equal(t, "low", resp.Body["priority"])
+	assert.Equal(t, "Patched Title", resp.Body["title"])
+
+	// JSON Patch operations are applied in order
+	resp = patch("application/json-patch+json", `[
+		{"op":"test","path":"/title","value":"Patched Title"},
+		{"op":"replace","path":"/description","value":"Replaced Description"}
+	]`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Replaced Description", resp.Body["description"])
+
+	stored, err := service.GetByID(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Patched Title", stored.Title)
+	assert.Equal(t, "Replaced Description", stored.Description)
+	assert.Nil(t, stored.DueAt)
+	assert.Equal(t, PriorityLow, stored.Priority)
+}
+
+func TestTodoPatchErrorsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Original Title"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		userID          int64
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:            "unsupported content type",
+			userID:          userID,
+			contentType:     "application/json",
+			body:            `{"title":"Patched"}`,
+			expectedStatus:  http.StatusUnsupportedMediaType,
+			expectedMessage: "unsupported patch content type",
+		},
+		{
+			name:           "malformed merge patch",
+			userID:         userID,
+			contentType:    "application/merge-patch+json",
+			body:           `{"title":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown field",
+			userID:         userID,
+			contentType:    "application/merge-patch+json",
+			body:           `{"completed":true}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "removed required title",
+			userID:         userID,
+			contentType:    "application/merge-patch+json",
+			body:           `{"title":null}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid priority",
+			userID:         userID,
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"replace","path":"/priority","value":"someday"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failed test operation",
+			userID:         userID,
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"test","path":"/title","value":"Other Title"},{"op":"replace","path":"/title","value":"Patched"}]`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "missing path",
+			userID:         userID,
+			contentType:    "application/json-patch+json",
+			body:           `[{"op":"replace","path":"/notes/0","value":"Patched"}]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "too large",
+			userID:          userID,
+			contentType:     "application/merge-patch+json",
+			body:            `{"description":"` + strings.Repeat("a", maxPatchSize) + `"}`,
+			expectedStatus:  http.StatusRequestEntityTooLarge,
+			expectedMessage: ErrPatchTooLarge.Error(),
+		},
+		{
+			name:            "other user's todo",
+			userID:          2,
+			contentType:     "application/merge-patch+json",
+			body:            `{"title":"Patched"}`,
+			expectedStatus:  http.StatusNotFound,
+			expectedMessage: "todo not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := createAuthenticatedContext(tt.userID)
+
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
+				handler.Patch(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method:  http.MethodPatch,
+				URL:     "/todos/" + strconv.FormatInt(todo.ID, 10),
+				Body:    json.RawMessage(tt.body),
+				Headers: map[string]string{"Content-Type": tt.contentType},
+			})
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedMessage != "" {
+				test.AssertErrorResponse(t, resp, tt.expectedStatus, tt.expectedMessage)
+			}
+		})
+	}
+
+	// Failed patches leave the todo untouched
+	stored, err := service.GetByID(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Original Title", stored.Title)
+}
+
+func TestTodoConditionalRequestsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Original Title"})
+	require.NoError(t, err)
+	id := strconv.FormatInt(todo.ID, 10)
+
+	call := func(handle http.HandlerFunc, method, ifMatch string, body any, headers map[string]string) *test.HTTPResponse {
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		if ifMatch != "" {
+			headers["If-Match"] = ifMatch
+		}
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			handle(w, r.WithContext(ctx))
+		}, test.HTTPRequest{Method: method, URL: "/todos/" + id, Body: body, Headers: headers})
+	}
+
+	resp := call(handler.GetByID, http.MethodGet, "", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Headers.Get("ETag"))
+	assert.Equal(t, float64(1), resp.Body["version"])
+
+	// Matching version updates and returns the new entity tag
+	resp = call(handler.Update, http.MethodPut, `"1"`, UpdateTodoRequest{Title: "First"}, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Headers.Get("ETag"))
+
+	// Stale versions are rejected by every write
+	resp = call(handler.Update, http.MethodPut, `"1"`, UpdateTodoRequest{Title: "Second"}, nil)
+	test.AssertErrorResponse(t, resp, http.StatusPreconditionFailed, "todo has been modified")
+
+	resp = call(handler.Patch, http.MethodPatch, `"1"`, json.RawMessage(`{"title":"Second"}`),
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+	test.AssertErrorResponse(t, resp, http.StatusPreconditionFailed, "todo has been modified")
+
+	resp = call(handler.ToggleComplete, http.MethodPatch, `"1"`, nil, nil)
+	test.AssertErrorResponse(t, resp, http.StatusPreconditionFailed, "todo has been modified")
+
+	resp = call(handler.Delete, http.MethodDelete, `"1"`, nil, nil)
+	test.AssertErrorResponse(t, resp, http.StatusPreconditionFailed, "todo has been modified")
+
+	// Weak and malformed entity tags never match
+	resp = call(handler.Update, http.MethodPut, `W/"2"`, UpdateTodoRequest{Title: "Second"}, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = call(handler.Update, http.MethodPut, `2`, UpdateTodoRequest{Title: "Second"}, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	stored, err := service.GetByID(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First", stored.Title)
+	assert.False(t, stored.Completed)
+	assert.Equal(t, int64(2), stored.Version)
+
+	// Current versions, a wildcard or no precondition at all are accepted
+	resp = call(handler.Patch, http.MethodPatch, `"2"`, json.RawMessage(`{"title":"Second"}`),
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"3"`, resp.Headers.Get("ETag"))
+
+	resp = call(handler.ToggleComplete, http.MethodPatch, "*", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"4"`, resp.Headers.Get("ETag"))
+
+	resp = call(handler.Update, http.MethodPut, "", UpdateTodoRequest{Title: "Third"}, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"5"`, resp.Headers.Get("ETag"))
+
+	resp = call(handler.Delete, http.MethodDelete, `"5"`, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestTodoConcurrentUpdateIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+
+	userID := int64(1)
+
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Original Title"})
+	require.NoError(t, err)
+
+	// Two writers that read the same version, only the first one wins
+	first, err := service.Update(context.Background(), userID, todo.ID, todo.Version, &UpdateTodoRequest{Title: "First"})
+	require.NoError(t, err)
+	assert.Equal(t, todo.Version+1, first.Version)
+
+	_, err = service.Update(context.Background(), userID, todo.ID, todo.Version, &UpdateTodoRequest{Title: "Second"})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	// The store compares against the stored version even when the caller read it first
+	stale := *first
+	require.NoError(t, container.DB.Model(&Todo{}).Where("id = ?", todo.ID).
+		Update("version", gorm.Expr("version + 1")).Error)
+	stale.Title = "Stale"
+	assert.ErrorIs(t, NewStore(container.DB).Save(context.Background(), &stale), ErrVersionMismatch)
+	assert.Equal(t, first.Version, stale.Version)
+
+	stored, err := service.GetByID(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First", stored.Title)
+	assert.Equal(t, first.Version+1, stored.Version)
+}
+
 func TestTodoToggleCompleteIntegration(t *testing.T) {
 	service, handler, _ := setupTestServices(t)
 
 	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
 
 	// Create a test todo
 	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
@@ -346,7 +952,7 @@ func TestTodoToggleCompleteIntegration(t *testing.T) {
 	// Toggle to completed
 	resp1 := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.ToggleComplete(w, r)
+		handler.ToggleComplete(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodPatch,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10) + "/toggle",
@@ -359,7 +965,7 @@ func TestTodoToggleCompleteIntegration(t *testing.T) {
 	// Toggle back to incomplete
 	resp2 := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.ToggleComplete(w, r)
+		handler.ToggleComplete(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodPatch,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10) + "/toggle",
@@ -372,10 +978,11 @@ func TestTodoToggleCompleteIntegration(t *testing.T) {
 
 func TestTodoToggleCompleteNotFoundIntegration(t *testing.T) {
 	_, handler, _ := setupTestServices(t)
+	ctx := createAuthenticatedContext(1)
 
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", "999")
-		handler.ToggleComplete(w, r)
+		handler.ToggleComplete(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodPatch,
 		URL:    "/todos/999/toggle",
@@ -388,6 +995,7 @@ func TestTodoDeleteIntegration(t *testing.T) {
 	service, handler, _ := setupTestServices(t)
 
 	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
 
 	// Create a test todo
 	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
@@ -399,7 +1007,7 @@ func TestTodoDeleteIntegration(t *testing.T) {
 	// Delete the todo
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.Delete(w, r)
+		handler.Delete(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodDelete,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10),
@@ -410,7 +1018,7 @@ func TestTodoDeleteIntegration(t *testing.T) {
 	// Verify todo is deleted
 	getResp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
-		handler.GetByID(w, r)
+		handler.GetByID(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodGet,
 		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10),
@@ -421,10 +1029,11 @@ func TestTodoDeleteIntegration(t *testing.T) {
 
 func TestTodoDeleteNotFoundIntegration(t *testing.T) {
 	_, handler, _ := setupTestServices(t)
+	ctx := createAuthenticatedContext(1)
 
 	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
 		r.SetPathValue("id", "999")
-		handler.Delete(w, r)
+		handler.Delete(w, r.WithContext(ctx))
 	}, test.HTTPRequest{
 		Method: http.MethodDelete,
 		URL:    "/todos/999",
@@ -499,16 +1108,17 @@ func TestTodoServiceDirectCallsIntegration(t *testing.T) {
 	assert.False(t, todo.Completed)
 
 	// Test GetByID
-	foundTodo, err := service.GetByID(ctx, todo.ID)
+	foundTodo, err := service.GetByID(ctx, userID, todo.ID)
 	require.NoError(t, err)
 	assert.Equal(t, todo.ID, foundTodo.ID)
 	assert.Equal(t, todo.Title, foundTodo.Title)
 
 	// Test GetByUserID
-	todos, err := service.GetByUserID(ctx, userID)
+	page, err := service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit})
 	require.NoError(t, err)
-	assert.Len(t, todos, 1)
-	assert.Equal(t, todo.ID, todos[0].ID)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, todo.ID, page.Data[0].ID)
+	assert.False(t, page.HasMore)
 
 	// Test Update
 	updateReq := &UpdateTodoRequest{
@@ -516,27 +1126,27 @@ func TestTodoServiceDirectCallsIntegration(t *testing.T) {
 		Description: "Updated Service Description",
 	}
 
-	updatedTodo, err := service.Update(ctx, todo.ID, updateReq)
+	updatedTodo, err := service.Update(ctx, userID, todo.ID, 0, updateReq)
 	require.NoError(t, err)
 	assert.Equal(t, updateReq.Title, updatedTodo.Title)
 	assert.Equal(t, updateReq.Description, updatedTodo.Description)
 
 	// Test ToggleComplete
-	toggledTodo, err := service.ToggleComplete(ctx, todo.ID)
+	toggledTodo, err := service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
 	require.NoError(t, err)
 	assert.True(t, toggledTodo.Completed)
 
 	// Toggle again
-	toggledTodo, err = service.ToggleComplete(ctx, todo.ID)
+	toggledTodo, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
 	require.NoError(t, err)
 	assert.False(t, toggledTodo.Completed)
 
 	// Test Delete
-	err = service.Delete(ctx, todo.ID)
+	err = service.Delete(ctx, userID, todo.ID, 0)
 	require.NoError(t, err)
 
 	// Verify deletion
-	_, err = service.GetByID(ctx, todo.ID)
+	_, err = service.GetByID(ctx, userID, todo.ID)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrTodoNotFound)
 }
@@ -562,36 +1172,3581 @@ func TestTodoUserIsolationIntegration(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify user 1 only sees their todo
-	user1Todos, err := service.GetByUserID(ctx, user1ID)
+	user1Page, err := service.GetByUserID(ctx, user1ID, &ListParams{Limit: DefaultPageLimit})
 	require.NoError(t, err)
+	user1Todos := user1Page.Data
 	assert.Len(t, user1Todos, 1)
 	assert.Equal(t, todo1.ID, user1Todos[0].ID)
 	assert.Equal(t, user1ID, user1Todos[0].UserID)
 
 	// Verify user 2 only sees their todo
-	user2Todos, err := service.GetByUserID(ctx, user2ID)
+	user2Page, err := service.GetByUserID(ctx, user2ID, &ListParams{Limit: DefaultPageLimit})
 	require.NoError(t, err)
+	user2Todos := user2Page.Data
 	assert.Len(t, user2Todos, 1)
 	assert.Equal(t, todo2.ID, user2Todos[0].ID)
 	assert.Equal(t, user2ID, user2Todos[0].UserID)
 }
 
-func TestTodoJSONMarshalingIntegration(t *testing.T) {
-	service, _, _ := setupTestServices(t)
+func TestTodoCrossUserAccessIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
 
-	userID := int64(1)
-	ctx := context.Background()
+	ownerID := int64(1)
+	otherID := int64(2)
 
-	todo, err := service.Create(ctx, userID, &CreateTodoRequest{
-		Title:       "JSON Test Todo",
-		Description: "JSON Test Description",
+	todo, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{
+		Title:       "Owner Todo",
+		Description: "Owner Description",
 	})
 	require.NoError(t, err)
 
-	// Test JSON marshaling
-	jsonData, err := todo.MarshalJSON()
-	require.NoError(t, err)
-	assert.Contains(t, string(jsonData), "JSON Test Todo")
+	id := strconv.FormatInt(todo.ID, 10)
+	otherCtx := createAuthenticatedContext(otherID)
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    any
+		handler http.HandlerFunc
+	}{
+		{
+			name:    "get by id",
+			method:  http.MethodGet,
+			url:     "/todos/" + id,
+			handler: handler.GetByID,
+		},
+		{
+			name:   "update",
+			method: http.MethodPut,
+			url:    "/todos/" + id,
+			body: UpdateTodoRequest{
+				Title:       "Hijacked Title",
+				Description: "Hijacked Description",
+			},
+			handler: handler.Update,
+		},
+		{
+			name:    "toggle complete",
+			method:  http.MethodPatch,
+			url:     "/todos/" + id + "/toggle",
+			handler: handler.ToggleComplete,
+		},
+		{
+			name:    "delete",
+			method:  http.MethodDelete,
+			url:     "/todos/" + id,
+			handler: handler.Delete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", id)
+				tt.handler(w, r.WithContext(otherCtx))
+			}, test.HTTPRequest{
+				Method: tt.method,
+				URL:    tt.url,
+				Body:   tt.body,
+			})
+
+			test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
+
+			// The owner's todo must be left untouched
+			ownerTodo, err := service.GetByID(context.Background(), ownerID, todo.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Owner Todo", ownerTodo.Title)
+			assert.Equal(t, "Owner Description", ownerTodo.Description)
+			assert.False(t, ownerTodo.Completed)
+		})
+	}
+}
+
+func TestTodoRoutesUnauthorizedIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+
+	for name, h := range map[string]http.HandlerFunc{
+		"get by id":       handler.GetByID,
+		"update":          handler.Update,
+		"toggle complete": handler.ToggleComplete,
+		"delete":          handler.Delete,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", "1")
+				h(w, r)
+			}, test.HTTPRequest{
+				Method: http.MethodGet,
+				URL:    "/todos/1",
+			})
+
+			test.AssertErrorResponse(t, resp, http.StatusUnauthorized, "unauthorized")
+		})
+	}
+}
+
+func TestTodoServiceCrossUserIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	ctx := context.Background()
+	ownerID := int64(1)
+	otherID := int64(2)
+
+	todo, err := service.Create(ctx, ownerID, &CreateTodoRequest{Title: "Owner Todo"})
+	require.NoError(t, err)
+
+	_, err = service.GetByID(ctx, otherID, todo.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	_, err = service.Update(ctx, otherID, todo.ID, 0, &UpdateTodoRequest{Title: "Hijacked"})
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	_, err = service.ToggleComplete(ctx, otherID, todo.ID, 0, CompleteOccurrence)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	err = service.Delete(ctx, otherID, todo.ID, 0)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	ownerTodo, err := service.GetByID(ctx, ownerID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Owner Todo", ownerTodo.Title)
+	assert.False(t, ownerTodo.Completed)
+}
+
+func TestTodoDueDateAndPriorityIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Create(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos",
+		Body: map[string]any{
+			"title":    "File taxes",
+			"due_at":   "2024-04-15T17:00:00-04:00",
+			"priority": "urgent",
+		},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "urgent", resp.Body["priority"])
+	assert.Nil(t, resp.Body["completed_at"])
+
+	dueAt, err := time.Parse(time.RFC3339, resp.Body["due_at"].(string))
+	require.NoError(t, err)
+	assert.True(t, dueAt.Equal(time.Date(2024, 4, 15, 21, 0, 0, 0, time.UTC)))
+
+	id := int64(resp.Body["id"].(float64))
+
+	// Completing sets the completion time, reopening clears it
+	todo, err := service.ToggleComplete(context.Background(), userID, id, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	require.NotNil(t, todo.CompletedAt)
+
+	todo, err = service.GetByID(context.Background(), userID, id)
+	require.NoError(t, err)
+	require.NotNil(t, todo.CompletedAt)
+	assert.WithinDuration(t, time.Now(), *todo.CompletedAt, time.Minute)
+
+	todo, err = service.ToggleComplete(context.Background(), userID, id, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	assert.Nil(t, todo.CompletedAt)
+
+	// Invalid priorities are rejected
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Create(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos",
+		Body:   map[string]any{"title": "Invalid", "priority": "critical"},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTodoDueFiltersIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	now := time.Now()
+	year, month, day := now.In(jakarta).Date()
+	middayToday := time.Date(year, month, day, 12, 0, 0, 0, jakarta)
+	twoDaysAgo := now.Add(-48 * time.Hour)
+	nextMonth := now.Add(30 * 24 * time.Hour)
+
+	create := func(title string, dueAt *time.Time) *Todo {
+		todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: title, DueAt: dueAt})
+		require.NoError(t, err)
+		return todo
+	}
+
+	create("Overdue", &twoDaysAgo)
+	done := create("Overdue but done", &twoDaysAgo)
+	_, err = service.ToggleComplete(context.Background(), userID, done.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	create("Today", &middayToday)
+	create("Later", &nextMonth)
+	create("No due date", nil)
+
+	list := func(query string) []string {
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.GetByUserID(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    "/api/todos?" + query,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var titles []string
+		for _, item := range resp.Body["data"].([]any) {
+			titles = append(titles, item.(map[string]any)["title"].(string))
+		}
+		return titles
+	}
+
+	overdue := list("due=overdue&tz=Asia/Jakarta")
+	assert.Contains(t, overdue, "Overdue")
+	assert.NotContains(t, overdue, "Overdue but done")
+	assert.NotContains(t, overdue, "Later")
+	assert.NotContains(t, overdue, "No due date")
+
+	today := list("due=today&tz=Asia/Jakarta")
+	assert.Equal(t, []string{"Today"}, today)
+
+	week := list("due=week&tz=Asia/Jakarta")
+	assert.Contains(t, week, "Today")
+	assert.NotContains(t, week, "Later")
+	assert.NotContains(t, week, "No due date")
+
+	// Due filters combine with the other filters
+	assert.Empty(t, list("due=overdue&completed=true"))
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.GetByUserID(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/api/todos?due=today&tz=Mars/Olympus_Mons",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.GetByUserID(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/api/todos?due=tomorrow",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTodoSearchIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	seed := []CreateTodoRequest{
+		{Title: "Buy groceries", Description: "Milk, eggs and bread"},
+		{Title: "Grocery budget", Description: "Review monthly spending"},
+		{Title: "Write report", Description: "Quarterly report for the board"},
+	}
+	for _, req := range seed {
+		_, err := service.Create(context.Background(), userID, &req)
+		require.NoError(t, err)
+	}
+
+	// Another user's matching todo must never show up
+	_, err := service.Create(context.Background(), 2, &CreateTodoRequest{Title: "Groceries for user 2"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedTitles []string
+	}{
+		{
+			name:           "prefix match for type-ahead",
+			query:          "groc",
+			expectedTitles: []string{"Buy groceries", "Grocery budget"},
+		},
+		{
+			name:           "matches description",
+			query:          "eggs",
+			expectedTitles: []string{"Buy groceries"},
+		},
+		{
+			name:           "all words must match",
+			query:          "groc milk",
+			expectedTitles: []string{"Buy groceries"},
+		},
+		{
+			name:           "case insensitive",
+			query:          "REPORT",
+			expectedTitles: []string{"Write report"},
+		},
+		{
+			name:           "no match",
+			query:          "vacation",
+			expectedTitles: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				handler.Search(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodGet,
+				URL:    "/api/todos/search?q=" + url.QueryEscape(tt.query),
+			})
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var titles []string
+			for _, item := range resp.Body["data"].([]any) {
+				result := item.(map[string]any)
+				todo := result["todo"].(map[string]any)
+				assert.Equal(t, float64(userID), todo["user_id"])
+				assert.NotNil(t, result["rank"])
+				titles = append(titles, todo["title"].(string))
+			}
+			assert.ElementsMatch(t, tt.expectedTitles, titles)
+		})
+	}
+}
+
+func TestTodoSearchRankingAndHighlightIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	_, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Plan trip", Description: "Book a trip to the coast"})
+	require.NoError(t, err)
+	_, err = service.Create(ctx, userID, &CreateTodoRequest{Title: "Trip trip trip", Description: "Trip checklist for the trip"})
+	require.NoError(t, err)
+
+	page, err := service.Search(ctx, userID, &SearchParams{Query: "trip", Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+
+	// The todo mentioning the term more often ranks first
+	assert.Equal(t, "Trip trip trip", page.Data[0].Todo.Title)
+	assert.GreaterOrEqual(t, page.Data[0].Rank, page.Data[1].Rank)
+
+	// Matching terms are highlighted in both fields
+	assert.Contains(t, page.Data[1].Highlight.Title, "<mark>trip</mark>")
+	assert.Contains(t, page.Data[1].Highlight.Description, "<mark>trip</mark>")
+}
+
+func TestTodoSearchHighlightEscapingIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	_, err := service.Create(ctx, userID, &CreateTodoRequest{
+		Title:       "<script>alert(1)</script> report",
+		Description: "Fix <img src=x onerror=alert(1)> & the report",
+	})
+	require.NoError(t, err)
+
+	page, err := service.Search(ctx, userID, &SearchParams{Query: "report", Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+
+	// Only the <mark> tags are markup, the text itself is escaped
+	assert.Equal(t, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>report</mark>", page.Data[0].Highlight.Title)
+	assert.Contains(t, page.Data[0].Highlight.Description, "&lt;img src=x onerror=alert(1)&gt; &amp; the <mark>report</mark>")
+	assert.NotContains(t, page.Data[0].Highlight.Description, "<img")
+
+	// The todo itself is returned as written
+	assert.Equal(t, "<script>alert(1)</script> report", page.Data[0].Todo.Title)
+}
+
+func TestTodoSearchPaginationIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	for i := 1; i <= 5; i++ {
+		_, err := service.Create(context.Background(), userID, &CreateTodoRequest{
+			Title: "Meeting " + strconv.Itoa(i),
+		})
+		require.NoError(t, err)
+	}
+
+	seen := make(map[float64]bool)
+	target := "/api/todos/search?q=meet&limit=2"
+	for pages := 0; target != ""; pages++ {
+		require.Less(t, pages, 3, "expected exactly three pages")
+
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.Search(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    target,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		for _, item := range resp.Body["data"].([]any) {
+			id := item.(map[string]any)["todo"].(map[string]any)["id"].(float64)
+			assert.False(t, seen[id], "todo %v returned twice", id)
+			seen[id] = true
+		}
+
+		target = ""
+		if resp.Body["has_more"].(bool) {
+			assert.Contains(t, resp.Headers.Get("Link"), `rel="next"`)
+			target = "/api/todos/search?q=meet&limit=2&cursor=" + resp.Body["next_cursor"].(string)
+		}
+	}
+
+	assert.Len(t, seen, 5)
+}
+
+func TestTodoSearchInvalidParamsIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+
+	ctx := createAuthenticatedContext(1)
+
+	for _, target := range []string{
+		"/api/todos/search",
+		"/api/todos/search?q=%26%7C%21",
+		"/api/todos/search?q=milk&limit=0",
+		"/api/todos/search?q=milk&cursor=not-a-cursor",
+	} {
+		t.Run(target, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				handler.Search(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodGet,
+				URL:    target,
+			})
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestTodoJSONMarshalingIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{
+		Title:       "JSON Test Todo",
+		Description: "JSON Test Description",
+	})
+	require.NoError(t, err)
+
+	// Test JSON marshaling
+	jsonData, err := todo.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonData), "JSON Test Todo")
 	assert.Contains(t, string(jsonData), "JSON Test Description")
 	assert.Contains(t, string(jsonData), "\"completed\":false")
 }
+
+func TestTodoLabelsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	// Create a label through the handler
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.CreateLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/labels",
+		Body:   CreateLabelRequest{Name: " work ", Color: "#FF0000"},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "work", resp.Body["name"])
+	assert.Equal(t, "#ff0000", resp.Body["color"])
+	labelIDNum := int64(resp.Body["id"].(float64))
+	labelID := strconv.FormatInt(labelIDNum, 10)
+
+	// Label names are unique per user
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.CreateLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/labels",
+		Body:   CreateLabelRequest{Name: "work"},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusConflict, "label already exists")
+
+	_, err := service.CreateLabel(context.Background(), 2, &CreateLabelRequest{Name: "work"})
+	require.NoError(t, err)
+
+	// Invalid colors are rejected
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.CreateLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/labels",
+		Body:   CreateLabelRequest{Name: "home", Color: "red"},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	labeled, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Labeled"})
+	require.NoError(t, err)
+	_, err = service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Unlabeled"})
+	require.NoError(t, err)
+	todoID := strconv.FormatInt(labeled.ID, 10)
+
+	listTitles := func(t *testing.T, query string) []string {
+		t.Helper()
+
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.GetByUserID(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    "/todos?" + query,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var titles []string
+		for _, item := range resp.Body["data"].([]any) {
+			titles = append(titles, item.(map[string]any)["title"].(string))
+		}
+		return titles
+	}
+
+	// Warm the cache before attaching
+	assert.Equal(t, []string(nil), listTitles(t, "label=work"))
+
+	// Attach the label, attaching it twice is a no-op
+	for range 2 {
+		resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", todoID)
+			r.SetPathValue("labelID", labelID)
+			handler.AttachLabel(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodPost,
+			URL:    "/todos/" + todoID + "/labels/" + labelID,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		labels := resp.Body["labels"].([]any)
+		require.Len(t, labels, 1)
+		assert.Equal(t, "work", labels[0].(map[string]any)["name"])
+	}
+
+	assert.Equal(t, []string{"Labeled"}, listTitles(t, "label=work"))
+	assert.Equal(t, []string(nil), listTitles(t, "label=home"))
+
+	// Todos come back with their labels
+	todo, err := service.GetByID(context.Background(), userID, labeled.ID)
+	require.NoError(t, err)
+	require.Len(t, todo.Labels, 1)
+	assert.Equal(t, "work", todo.Labels[0].Name)
+
+	// Renaming a label is reflected in the filter and in cached lists
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", labelID)
+		handler.UpdateLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPut,
+		URL:    "/labels/" + labelID,
+		Body:   UpdateLabelRequest{Name: "office", Color: "#00ff00"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "office", resp.Body["name"])
+	assert.Equal(t, "#00ff00", resp.Body["color"])
+
+	assert.Equal(t, []string(nil), listTitles(t, "label=work"))
+	assert.Equal(t, []string{"Labeled"}, listTitles(t, "label=office"))
+
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit, Label: "office"})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	require.Len(t, page.Data[0].Labels, 1)
+	assert.Equal(t, "#00ff00", page.Data[0].Labels[0].Color)
+
+	// Detach the label
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", todoID)
+		r.SetPathValue("labelID", labelID)
+		handler.DetachLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/todos/" + todoID + "/labels/" + labelID,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Body["labels"])
+	assert.Equal(t, []string(nil), listTitles(t, "label=office"))
+
+	// Deleting a label detaches it from every todo
+	_, err = service.AttachLabel(context.Background(), userID, labeled.ID, labelIDNum)
+	require.NoError(t, err)
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", labelID)
+		handler.DeleteLabel(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/labels/" + labelID,
+	})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	todo, err = service.GetByID(context.Background(), userID, labeled.ID)
+	require.NoError(t, err)
+	assert.Empty(t, todo.Labels)
+
+	labels, err := service.GetLabels(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+}
+
+func TestTodoLabelsCrossUserIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := int64(1)
+	otherID := int64(2)
+
+	label, err := service.CreateLabel(context.Background(), ownerID, &CreateLabelRequest{Name: "private"})
+	require.NoError(t, err)
+	otherTodo, err := service.Create(context.Background(), otherID, &CreateTodoRequest{Title: "Other Todo"})
+	require.NoError(t, err)
+
+	labelID := strconv.FormatInt(label.ID, 10)
+	todoID := strconv.FormatInt(otherTodo.ID, 10)
+	otherCtx := createAuthenticatedContext(otherID)
+
+	// Another user's label can't be attached, renamed or deleted
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", todoID)
+		r.SetPathValue("labelID", labelID)
+		handler.AttachLabel(w, r.WithContext(otherCtx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos/" + todoID + "/labels/" + labelID,
+	})
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "label not found")
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", labelID)
+		handler.UpdateLabel(w, r.WithContext(otherCtx))
+	}, test.HTTPRequest{
+		Method: http.MethodPut,
+		URL:    "/labels/" + labelID,
+		Body:   UpdateLabelRequest{Name: "hijacked"},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "label not found")
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", labelID)
+		handler.DeleteLabel(w, r.WithContext(otherCtx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/labels/" + labelID,
+	})
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "label not found")
+
+	labels, err := service.GetLabels(context.Background(), otherID)
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	labels, err = service.GetLabels(context.Background(), ownerID)
+	require.NoError(t, err)
+	require.Len(t, labels, 1)
+	assert.Equal(t, "private", labels[0].Name)
+}
+
+func TestTodoProjectsIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	// A todo created before projects existed
+	legacy := Todo{UserID: userID, Title: "Legacy", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, container.DB.Create(&legacy).Error)
+
+	listProjects := func(t *testing.T, query string) []map[string]any {
+		t.Helper()
+
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.GetProjects(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    "/projects?" + query,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var projects []map[string]any
+		require.NoError(t, json.Unmarshal(resp.RawBody, &projects))
+		return projects
+	}
+
+	listProjectTodos := func(t *testing.T, projectID int64) []string {
+		t.Helper()
+
+		id := strconv.FormatInt(projectID, 10)
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			handler.GetProjectTodos(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    "/projects/" + id + "/todos?sort=title",
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var titles []string
+		for _, item := range resp.Body["data"].([]any) {
+			titles = append(titles, item.(map[string]any)["title"].(string))
+		}
+		return titles
+	}
+
+	// The inbox is created on first use and adopts the existing todos
+	projects := listProjects(t, "")
+	require.Len(t, projects, 1)
+	assert.Equal(t, InboxName, projects[0]["name"])
+	assert.Equal(t, true, projects[0]["inbox"])
+	inboxID := int64(projects[0]["id"].(float64))
+	assert.Equal(t, []string{"Legacy"}, listProjectTodos(t, inboxID))
+
+	// Create a project, it goes last
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.CreateProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/projects",
+		Body:   CreateProjectRequest{Name: "Work", Color: "#0000FF"},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "Work", resp.Body["name"])
+	assert.Equal(t, "#0000ff", resp.Body["color"])
+	assert.Equal(t, float64(1), resp.Body["position"])
+	workID := int64(resp.Body["id"].(float64))
+
+	// Todos go to the inbox unless a project is given
+	inboxTodo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Inbox Todo"})
+	require.NoError(t, err)
+	require.NotNil(t, inboxTodo.ProjectID)
+	assert.Equal(t, inboxID, *inboxTodo.ProjectID)
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Create(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos",
+		Body:   CreateTodoRequest{Title: "Work Todo", ProjectID: &workID},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(workID), resp.Body["project_id"])
+	workTodoID := strconv.FormatInt(int64(resp.Body["id"].(float64)), 10)
+
+	missingID := int64(999999)
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Create(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos",
+		Body:   CreateTodoRequest{Title: "Lost Todo", ProjectID: &missingID},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "project not found")
+
+	assert.Equal(t, []string{"Inbox Todo", "Legacy"}, listProjectTodos(t, inboxID))
+	assert.Equal(t, []string{"Work Todo"}, listProjectTodos(t, workID))
+
+	// Move a todo between projects, cached pages of both are refreshed
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", workTodoID)
+		handler.MoveToProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPatch,
+		URL:    "/todos/" + workTodoID + "/project",
+		Body:   MoveTodoRequest{ProjectID: inboxID},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(inboxID), resp.Body["project_id"])
+
+	assert.Equal(t, []string{"Inbox Todo", "Legacy", "Work Todo"}, listProjectTodos(t, inboxID))
+	assert.Equal(t, []string(nil), listProjectTodos(t, workID))
+
+	// The inbox can't be renamed, archived or deleted
+	inbox := strconv.FormatInt(inboxID, 10)
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", inbox)
+		handler.UpdateProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPut,
+		URL:    "/projects/" + inbox,
+		Body:   UpdateProjectRequest{Name: "Renamed"},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusConflict, ErrInboxProject.Error())
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", inbox)
+		handler.DeleteProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/projects/" + inbox,
+	})
+	test.AssertErrorResponse(t, resp, http.StatusConflict, ErrInboxProject.Error())
+
+	// Archived projects can be filtered out
+	work := strconv.FormatInt(workID, 10)
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", work)
+		handler.UpdateProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPut,
+		URL:    "/projects/" + work,
+		Body:   UpdateProjectRequest{Name: "Old Work", Archived: true},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Old Work", resp.Body["name"])
+	assert.Equal(t, true, resp.Body["archived"])
+
+	assert.Len(t, listProjects(t, ""), 2)
+	active := listProjects(t, "archived=false")
+	require.Len(t, active, 1)
+	assert.Equal(t, InboxName, active[0]["name"])
+
+	// Other users can't see the projects
+	_, err = service.GetProject(context.Background(), 2, workID)
+	assert.ErrorIs(t, err, ErrProjectNotFound)
+	_, err = service.Create(context.Background(), 2, &CreateTodoRequest{Title: "Sneaky", ProjectID: &workID})
+	assert.ErrorIs(t, err, ErrProjectNotFound)
+}
+
+func TestTodoProjectDeleteIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedInbox []string
+	}{
+		{
+			name:          "moves todos back to the inbox by default",
+			query:         "",
+			expectedInbox: []string{"Project Todo"},
+		},
+		{
+			name:          "deletes todos with cascade",
+			query:         "cascade=true",
+			expectedInbox: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sharedContainer.CleanupAll(t)
+
+			project, err := service.CreateProject(context.Background(), userID, &CreateProjectRequest{Name: "Doomed"})
+			require.NoError(t, err)
+			todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Project Todo", ProjectID: &project.ID})
+			require.NoError(t, err)
+
+			// Warm the cache before deleting
+			_, err = service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+			require.NoError(t, err)
+
+			id := strconv.FormatInt(project.ID, 10)
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", id)
+				handler.DeleteProject(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodDelete,
+				URL:    "/projects/" + id + "?" + tt.query,
+			})
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			_, err = service.GetProject(context.Background(), userID, project.ID)
+			assert.ErrorIs(t, err, ErrProjectNotFound)
+
+			inbox, err := service.inbox(context.Background(), userID)
+			require.NoError(t, err)
+
+			page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+			require.NoError(t, err)
+
+			var titles []string
+			for _, todo := range page.Data {
+				assert.Equal(t, inbox.ID, *todo.ProjectID)
+				titles = append(titles, todo.Title)
+			}
+			assert.Equal(t, tt.expectedInbox, titles)
+
+			_, err = service.GetByID(context.Background(), userID, todo.ID)
+			if tt.expectedInbox == nil {
+				assert.ErrorIs(t, err, ErrTodoNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Invalid cascade flags are rejected
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", "1")
+		handler.DeleteProject(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/projects/1?cascade=maybe",
+	})
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid query parameter: cascade")
+}
+
+func TestTodoProjectDeleteEventsIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		cascade bool
+		action  HistoryAction
+		events  []string
+	}{
+		{
+			name:    "moved todos are updated for the owner and deleted for members",
+			cascade: false,
+			action:  HistoryUpdate,
+			events:  []string{EventTodoUpdated, EventTodoDeleted},
+		},
+		{
+			name:    "cascaded todos are deleted for everyone",
+			cascade: true,
+			action:  HistoryDelete,
+			events:  []string{EventTodoDeleted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sharedContainer.CleanupAll(t)
+
+			ownerID := createTestUser(t, "owner@example.com")
+			memberID := createTestUser(t, "member@example.com")
+
+			project, err := service.CreateProject(ctx, ownerID, &CreateProjectRequest{Name: "Team"})
+			require.NoError(t, err)
+			invitation, err := service.Invite(ctx, ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "editor"})
+			require.NoError(t, err)
+			_, err = service.AcceptInvitation(ctx, memberID, invitation.ID)
+			require.NoError(t, err)
+			todo, err := service.Create(ctx, ownerID, &CreateTodoRequest{Title: "Shared", ProjectID: &project.ID})
+			require.NoError(t, err)
+
+			var before int64
+			require.NoError(t, container.DB.Model(&outbox.Message{}).Count(&before).Error)
+
+			require.NoError(t, service.DeleteProject(ctx, ownerID, project.ID, tt.cascade))
+
+			// The todos are told one by one, before the project itself
+			var messages []outbox.Message
+			require.NoError(t, container.DB.Order("id").Offset(int(before)).Find(&messages).Error)
+			require.Len(t, messages, 2)
+			assert.Equal(t, EventTodosBatched, messages[0].Type)
+			assert.Equal(t, EventProjectDeleted, messages[1].Type)
+
+			notices, err := notices(outbox.Event{Type: messages[0].Type, Payload: messages[0].Payload})
+			require.NoError(t, err)
+			var types []string
+			for _, n := range notices {
+				types = append(types, n.eventType)
+				if n.eventType == EventTodoDeleted {
+					assert.Contains(t, n.userIDs, memberID)
+					assert.Equal(t, deletedTodo{ID: todo.ID}, n.data)
+				} else {
+					assert.Equal(t, []int64{ownerID}, n.userIDs)
+					assert.Equal(t, todo.Version+1, n.data.(*Todo).Version)
+				}
+			}
+			assert.Equal(t, tt.events, types)
+
+			// Each todo got a history entry in the same transaction
+			var entry HistoryEntry
+			require.NoError(t, container.DB.Where("todo_id = ?", todo.ID).Order("id DESC").First(&entry).Error)
+			assert.Equal(t, tt.action, entry.Action)
+			assert.Equal(t, ownerID, entry.UserID)
+		})
+	}
+}
+
+func TestTodoTrashIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	listTitles := func(t *testing.T, target string, h http.HandlerFunc) []string {
+		t.Helper()
+
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			h(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    target,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var titles []string
+		for _, item := range resp.Body["data"].([]any) {
+			titles = append(titles, item.(map[string]any)["title"].(string))
+		}
+		return titles
+	}
+
+	keep, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Keep groceries"})
+	require.NoError(t, err)
+	oops, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Oops groceries"})
+	require.NoError(t, err)
+	oopsID := strconv.FormatInt(oops.ID, 10)
+
+	// Warm the cache before deleting
+	assert.Equal(t, []string{"Keep groceries", "Oops groceries"}, listTitles(t, "/todos?sort=title", handler.GetByUserID))
+
+	require.NoError(t, service.Delete(context.Background(), userID, oops.ID, 0))
+
+	// Trashed todos disappear from normal queries
+	assert.Equal(t, []string{"Keep groceries"}, listTitles(t, "/todos?sort=title", handler.GetByUserID))
+
+	results, err := service.Search(context.Background(), userID, &SearchParams{Query: "groceries", Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, results.Data, 1)
+	assert.Equal(t, "Keep groceries", results.Data[0].Todo.Title)
+
+	_, err = service.GetByID(context.Background(), userID, oops.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	// They show up in the trash instead
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.GetTrash(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/todos/trash",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	trash := resp.Body["data"].([]any)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "Oops groceries", trash[0].(map[string]any)["title"])
+	assert.NotNil(t, trash[0].(map[string]any)["deleted_at"])
+
+	// Restore it, cached pages are refreshed
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", oopsID)
+		handler.Restore(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos/" + oopsID + "/restore",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Oops groceries", resp.Body["title"])
+	assert.NotContains(t, resp.Body, "deleted_at")
+
+	assert.Equal(t, []string{"Keep groceries", "Oops groceries"}, listTitles(t, "/todos?sort=title", handler.GetByUserID))
+	assert.Equal(t, []string(nil), listTitles(t, "/todos/trash", handler.GetTrash))
+
+	// Only trashed todos can be restored or purged
+	for name, h := range map[string]http.HandlerFunc{"restore": handler.Restore, "purge": handler.Purge} {
+		t.Run(name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", oopsID)
+				h(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodPost,
+				URL:    "/todos/" + oopsID,
+			})
+			test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
+		})
+	}
+
+	// Purge permanently deletes a trashed todo
+	require.NoError(t, service.Delete(context.Background(), userID, oops.ID, 0))
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", oopsID)
+		handler.Purge(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/todos/trash/" + oopsID,
+	})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []string(nil), listTitles(t, "/todos/trash", handler.GetTrash))
+
+	_, err = service.Restore(context.Background(), userID, oops.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	// Emptying the trash purges everything in it, and nothing else
+	require.NoError(t, service.Delete(context.Background(), userID, keep.ID, 0))
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.EmptyTrash(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/todos/trash",
+	})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []string(nil), listTitles(t, "/todos/trash", handler.GetTrash))
+}
+
+func TestTodoTrashPaginationIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+
+	userID := int64(1)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		todo := Todo{UserID: userID, Title: "Trashed " + strconv.Itoa(i), CreatedAt: base, UpdatedAt: base}
+		require.NoError(t, container.DB.Create(&todo).Error)
+		require.NoError(t, container.DB.Model(&todo).Update("deleted_at", base.Add(time.Duration(i)*time.Hour)).Error)
+	}
+
+	var titles []string
+	params := &TrashParams{Limit: 2}
+	for {
+		page, err := service.GetTrash(context.Background(), userID, params)
+		require.NoError(t, err)
+		for _, todo := range page.Data {
+			titles = append(titles, todo.Title)
+		}
+		if !page.HasMore {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, []string{"Trashed 4", "Trashed 3", "Trashed 2", "Trashed 1", "Trashed 0"}, titles)
+
+	_, err := service.GetTrash(context.Background(), userID, &TrashParams{Limit: 2, Cursor: "bogus"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestTodoTrashRetentionIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+
+	userID := int64(1)
+
+	expired, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Expired"})
+	require.NoError(t, err)
+	recent, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Recent"})
+	require.NoError(t, err)
+	active, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Active"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.Delete(context.Background(), userID, expired.ID, 0))
+	require.NoError(t, service.Delete(context.Background(), userID, recent.ID, 0))
+	require.NoError(t, container.DB.Unscoped().Model(&Todo{}).Where("id = ?", expired.ID).
+		Update("deleted_at", time.Now().Add(-31*24*time.Hour)).Error)
+
+	purged, err := service.PurgeExpiredTrash(context.Background(), 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	_, err = service.Restore(context.Background(), userID, expired.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	_, err = service.Restore(context.Background(), userID, recent.ID)
+	assert.NoError(t, err)
+
+	_, err = service.GetByID(context.Background(), userID, active.ID)
+	assert.NoError(t, err)
+}
+
+func TestTodoTrashRestoreProjectIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+
+	userID := int64(1)
+
+	project, err := service.CreateProject(context.Background(), userID, &CreateProjectRequest{Name: "Temporary"})
+	require.NoError(t, err)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Orphan", ProjectID: &project.ID})
+	require.NoError(t, err)
+
+	// Deleting the project moves the trashed todo along with the active ones
+	require.NoError(t, service.Delete(context.Background(), userID, todo.ID, 0))
+	require.NoError(t, service.DeleteProject(context.Background(), userID, project.ID, false))
+
+	inbox, err := service.inbox(context.Background(), userID)
+	require.NoError(t, err)
+
+	restored, err := service.Restore(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restored.ProjectID)
+	assert.Equal(t, inbox.ID, *restored.ProjectID)
+
+	// Other users can't restore someone else's todo
+	require.NoError(t, service.Delete(context.Background(), userID, todo.ID, 0))
+	_, err = service.Restore(context.Background(), 2, todo.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+}
+
+func TestTodoRecurrenceIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	dueAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	label, err := service.CreateLabel(context.Background(), userID, &CreateLabelRequest{Name: "chores"})
+	require.NoError(t, err)
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Create(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos",
+		Body: map[string]any{
+			"title":      "Standup",
+			"due_at":     dueAt,
+			"recurrence": map[string]any{"rule": "RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	recurrence, ok := resp.Body["recurrence"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", recurrence["rule"])
+	assert.Equal(t, "UTC", recurrence["timezone"])
+
+	id := int64(resp.Body["id"].(float64))
+	_, err = service.AttachLabel(context.Background(), userID, id, label.ID)
+	require.NoError(t, err)
+
+	toggle := func(id int64, query string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", strconv.FormatInt(id, 10))
+			handler.ToggleComplete(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodPatch,
+			URL:    "/todos/" + strconv.FormatInt(id, 10) + "/toggle" + query,
+		})
+	}
+
+	// Completing an occurrence creates the next one, on Monday
+	resp = toggle(id, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, resp.Body["completed"])
+	assert.Nil(t, resp.Body["recurrence"])
+
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: 10, Completed: new(bool)})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	next := page.Data[0]
+	assert.NotEqual(t, id, next.ID)
+	assert.Equal(t, "Standup", next.Title)
+	require.NotNil(t, next.DueAt)
+	assert.True(t, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC).Equal(*next.DueAt))
+	require.NotNil(t, next.Recurrence)
+	assert.True(t, dueAt.Equal(next.Recurrence.Start))
+	require.Len(t, next.Labels, 1)
+	assert.Equal(t, "chores", next.Labels[0].Name)
+
+	// Reopening the completed occurrence doesn't bring its recurrence back
+	resp = toggle(id, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, false, resp.Body["completed"])
+	assert.Nil(t, resp.Body["recurrence"])
+
+	// Stopping the series completes the occurrence without a next one
+	resp = toggle(next.ID, "?recurrence=series")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, resp.Body["completed"])
+
+	page, err = service.GetByUserID(context.Background(), userID, &ListParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+
+	resp = toggle(next.ID, "?recurrence=sometimes")
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid query parameter: recurrence")
+}
+
+func TestTodoRecurrenceUpdateIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	dueAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{
+		Title:      "Pay rent",
+		DueAt:      &dueAt,
+		Recurrence: &RecurrenceRequest{Rule: "FREQ=MONTHLY;BYMONTHDAY=1", Timezone: "Europe/Berlin"},
+	})
+	require.NoError(t, err)
+
+	// Skipping November through an exception, the series keeps its start. Occurrences
+	// stay at 10:00 in Berlin, which is an hour later in UTC once DST has ended.
+	secondDue := time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
+		handler.Patch(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method:  http.MethodPatch,
+		URL:     "/todos/" + strconv.FormatInt(todo.ID, 10),
+		Body:    json.RawMessage(`{"recurrence":{"exceptions":["2026-11-01T09:00:00Z"]}}`),
+		Headers: map[string]string{"Content-Type": "application/merge-patch+json"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stored, err := service.GetByID(context.Background(), userID, todo.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Recurrence)
+	assert.True(t, dueAt.Equal(stored.Recurrence.Start))
+	require.Len(t, stored.Recurrence.Exceptions, 1)
+	assert.True(t, secondDue.Equal(stored.Recurrence.Exceptions[0]))
+
+	_, err = service.ToggleComplete(context.Background(), userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: 10, Completed: new(bool)})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	require.NotNil(t, page.Data[0].DueAt)
+	assert.True(t, time.Date(2026, 12, 1, 9, 0, 0, 0, time.UTC).Equal(*page.Data[0].DueAt))
+
+	// Removing the recurrence turns it back into a one-off todo
+	updated, err := service.Update(context.Background(), userID, page.Data[0].ID, 0, &UpdateTodoRequest{
+		Title: "Pay rent",
+		DueAt: page.Data[0].DueAt,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, updated.Recurrence)
+}
+
+func TestTodoRecurrenceInvalidIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+	ctx := createAuthenticatedContext(1)
+
+	dueAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body map[string]any
+	}{
+		{
+			name: "missing due date",
+			body: map[string]any{"title": "Chore", "recurrence": map[string]any{"rule": "FREQ=DAILY"}},
+		},
+		{
+			name: "invalid rule",
+			body: map[string]any{"title": "Chore", "due_at": dueAt, "recurrence": map[string]any{"rule": "FREQ=SOMETIMES"}},
+		},
+		{
+			name: "missing rule",
+			body: map[string]any{"title": "Chore", "due_at": dueAt, "recurrence": map[string]any{"timezone": "UTC"}},
+		},
+		{
+			name: "unknown timezone",
+			body: map[string]any{"title": "Chore", "due_at": dueAt, "recurrence": map[string]any{"rule": "FREQ=DAILY", "timezone": "Nowhere/City"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				handler.Create(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method: http.MethodPost,
+				URL:    "/todos",
+				Body:   tt.body,
+			})
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestTodoHistoryIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := requestid.NewContext(createAuthenticatedContext(userID), "req-history")
+
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Write report"})
+	require.NoError(t, err)
+
+	_, err = service.Update(ctx, userID, todo.ID, 0, &UpdateTodoRequest{Title: "Write final report", Priority: "high"})
+	require.NoError(t, err)
+
+	_, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+
+	// A failed write leaves no trace in the history
+	_, err = service.Update(ctx, userID, todo.ID, 1, &UpdateTodoRequest{Title: "Stale"})
+	require.ErrorIs(t, err, ErrVersionMismatch)
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
+		handler.GetHistory(w, r.WithContext(ctx))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10) + "/history",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var history HistoryPage
+	require.NoError(t, json.Unmarshal(resp.RawBody, &history))
+	assert.False(t, history.HasMore)
+	entries := history.Data
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, HistoryToggle, entries[0].Action)
+	assert.Equal(t, Change{Before: false, After: true}, entries[0].Changes["completed"])
+
+	assert.Equal(t, HistoryUpdate, entries[1].Action)
+	assert.Equal(t, map[string]Change{
+		"title":    {Before: "Write report", After: "Write final report"},
+		"priority": {Before: "none", After: "high"},
+	}, entries[1].Changes)
+
+	assert.Equal(t, HistoryCreate, entries[2].Action)
+	assert.Equal(t, "Write report", entries[2].Changes["title"].After)
+
+	for _, entry := range entries {
+		assert.Equal(t, todo.ID, entry.TodoID)
+		assert.Equal(t, userID, entry.UserID)
+		assert.Equal(t, "req-history", entry.RequestID)
+	}
+
+	// Deleting and restoring are recorded as well, purging removes the history
+	require.NoError(t, service.Delete(ctx, userID, todo.ID, 0))
+	_, err = service.Restore(ctx, userID, todo.ID)
+	require.NoError(t, err)
+
+	page, err := service.GetHistory(ctx, userID, todo.ID, &HistoryParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 5)
+	assert.Equal(t, HistoryRestore, page.Data[0].Action)
+	assert.Equal(t, HistoryDelete, page.Data[1].Action)
+	assert.Contains(t, page.Data[1].Changes, "deleted_at")
+
+	// The history is paginated most recent change first
+	page, err = service.GetHistory(ctx, userID, todo.ID, &HistoryParams{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, HistoryRestore, page.Data[0].Action)
+
+	var actions []HistoryAction
+	for page.HasMore {
+		page, err = service.GetHistory(ctx, userID, todo.ID, &HistoryParams{Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		for _, entry := range page.Data {
+			actions = append(actions, entry.Action)
+		}
+	}
+	assert.Equal(t, []HistoryAction{HistoryToggle, HistoryUpdate, HistoryCreate}, actions)
+
+	_, err = service.GetHistory(ctx, userID, todo.ID, &HistoryParams{Limit: 2, Cursor: encodeCommentCursor(&Comment{ID: 1})})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	require.NoError(t, service.Delete(ctx, userID, todo.ID, 0))
+	require.NoError(t, service.Purge(ctx, userID, todo.ID))
+
+	var count int64
+	require.NoError(t, container.DB.Model(&HistoryEntry{}).Where("todo_id = ?", todo.ID).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestTodoHistoryCrossUserIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	todo, err := service.Create(context.Background(), 1, &CreateTodoRequest{Title: "Private"})
+	require.NoError(t, err)
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(todo.ID, 10))
+		handler.GetHistory(w, r.WithContext(createAuthenticatedContext(2)))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/todos/" + strconv.FormatInt(todo.ID, 10) + "/history",
+	})
+
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
+}
+
+func TestTodoReorderIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	// New todos go first, so create them last to first
+	ids := map[string]int64{}
+	for _, title := range []string{"D", "C", "B", "A"} {
+		todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: title})
+		require.NoError(t, err)
+		ids[title] = todo.ID
+	}
+
+	listTitles := func(t *testing.T) []string {
+		t.Helper()
+
+		page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+		require.NoError(t, err)
+
+		var titles []string
+		for _, todo := range page.Data {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+
+	move := func(t *testing.T, title string, req ReorderTodoRequest) *test.HTTPResponse {
+		t.Helper()
+
+		id := strconv.FormatInt(ids[title], 10)
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			handler.Reorder(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodPost,
+			URL:    "/todos/" + id + "/move",
+			Body:   req,
+		})
+	}
+
+	// Warm the cache, moves must invalidate it
+	assert.Equal(t, []string{"A", "B", "C", "D"}, listTitles(t))
+
+	resp := move(t, "D", ReorderTodoRequest{Before: ptr(ids["A"])})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Headers.Get("ETag"))
+	assert.Equal(t, []string{"D", "A", "B", "C"}, listTitles(t))
+
+	resp = move(t, "A", ReorderTodoRequest{After: ptr(ids["C"])})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"D", "B", "C", "A"}, listTitles(t))
+
+	resp = move(t, "C", ReorderTodoRequest{After: ptr(ids["D"]), Before: ptr(ids["B"])})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"D", "C", "B", "A"}, listTitles(t))
+
+	// Moving a todo next to its own neighbour leaves the order as is
+	resp = move(t, "C", ReorderTodoRequest{Before: ptr(ids["B"])})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"D", "C", "B", "A"}, listTitles(t))
+
+	// A move only rewrites the position of the moved todo
+	b, err := service.GetByID(context.Background(), userID, ids["B"])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), b.Version)
+
+	// Pages of the manual order follow each other
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: 2})
+	require.NoError(t, err)
+	page, err = service.GetByUserID(context.Background(), userID, &ListParams{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "B", page.Data[0].Title)
+	assert.Equal(t, "A", page.Data[1].Title)
+
+	// The reverse order is available too
+	page, err = service.GetByUserID(context.Background(), userID, &ListParams{Sort: "-position", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "A", page.Data[0].Title)
+
+	// Moves are recorded in the history
+	history, err := service.GetHistory(context.Background(), userID, ids["D"], &HistoryParams{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, HistoryMove, history.Data[0].Action)
+	assert.Contains(t, history.Data[0].Changes, "position")
+}
+
+func TestTodoReorderErrorsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := createAuthenticatedContext(userID)
+
+	first, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Second"})
+	require.NoError(t, err)
+	second, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "First"})
+	require.NoError(t, err)
+	other, err := service.Create(context.Background(), 2, &CreateTodoRequest{Title: "Other user"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		id             int64
+		body           any
+		ifMatch        string
+		expectedStatus int
+	}{
+		{name: "no anchor", id: first.ID, body: map[string]any{}, expectedStatus: http.StatusBadRequest},
+		{name: "next to itself", id: first.ID, body: ReorderTodoRequest{Before: ptr(first.ID)}, expectedStatus: http.StatusBadRequest},
+		{name: "missing anchor", id: first.ID, body: ReorderTodoRequest{After: ptr(int64(999999))}, expectedStatus: http.StatusBadRequest},
+		{name: "anchor of another user", id: first.ID, body: ReorderTodoRequest{After: ptr(other.ID)}, expectedStatus: http.StatusBadRequest},
+		{name: "todo of another user", id: other.ID, body: ReorderTodoRequest{After: ptr(first.ID)}, expectedStatus: http.StatusNotFound},
+		{name: "stale version", id: first.ID, body: ReorderTodoRequest{Before: ptr(second.ID)}, ifMatch: `"7"`, expectedStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := strconv.FormatInt(tt.id, 10)
+			headers := map[string]string{}
+			if tt.ifMatch != "" {
+				headers["If-Match"] = tt.ifMatch
+			}
+
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", id)
+				handler.Reorder(w, r.WithContext(ctx))
+			}, test.HTTPRequest{
+				Method:  http.MethodPost,
+				URL:     "/todos/" + id + "/move",
+				Body:    tt.body,
+				Headers: headers,
+			})
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+
+	// Anchors must be given in the order of the list
+	third, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Zeroth"})
+	require.NoError(t, err)
+	_, err = service.Reorder(context.Background(), userID, third.ID, 0, &ReorderTodoRequest{After: ptr(first.ID), Before: ptr(second.ID)})
+	assert.ErrorIs(t, err, ErrInvalidAnchor)
+
+	_, err = service.Reorder(context.Background(), userID, third.ID, 0, &ReorderTodoRequest{After: ptr(second.ID), Before: ptr(first.ID)})
+	assert.NoError(t, err)
+}
+
+func TestTodoReorderRebalanceIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+
+	var ids []int64
+	for _, title := range []string{"C", "B", "A"} {
+		todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: title})
+		require.NoError(t, err)
+		ids = append(ids, todo.ID)
+	}
+	c, b, a := ids[0], ids[1], ids[2]
+
+	// Moving todos back and forth into the same gap grows their positions until a rebalance
+	for i := range 300 {
+		id := b
+		if i%2 == 1 {
+			id = c
+		}
+		_, err := service.Reorder(ctx, userID, id, 0, &ReorderTodoRequest{After: ptr(a)})
+		require.NoError(t, err)
+	}
+
+	var positions []string
+	require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).Order("position ASC, id ASC").Pluck("position", &positions).Error)
+	require.Len(t, positions, 3)
+	for _, position := range positions {
+		assert.LessOrEqual(t, len(position), rank.MaxLength)
+	}
+
+	page, err := service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 3)
+	assert.Equal(t, []int64{a, c, b}, []int64{page.Data[0].ID, page.Data[1].ID, page.Data[2].ID})
+
+	// Tied positions are ordered by ID and spread out before a todo is moved between them
+	require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).UpdateColumn("position", "a0").Error)
+	_, err = service.Reorder(ctx, userID, a, 0, &ReorderTodoRequest{After: ptr(c), Before: ptr(b)})
+	require.NoError(t, err)
+
+	page, err = service.GetByUserID(ctx, userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 3)
+	assert.Equal(t, []int64{c, a, b}, []int64{page.Data[0].ID, page.Data[1].ID, page.Data[2].ID})
+}
+
+func TestTodoBackfillPositionsIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+
+	userID := int64(1)
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// More todos than a rebalance writes per statement, created before manual ordering
+	seed := make([]Todo, rebalanceBatchSize+5)
+	for i := range seed {
+		seed[i] = Todo{UserID: userID, Title: strconv.Itoa(i), CreatedAt: base.Add(time.Duration(i) * time.Minute), UpdatedAt: base}
+	}
+	require.NoError(t, container.DB.CreateInBatches(seed, 500).Error)
+
+	// Servers enqueue the backfill on start, once however many of them start together
+	require.NoError(t, service.EnqueueBackfillPositions(ctx))
+	require.NoError(t, service.EnqueueBackfillPositions(ctx))
+
+	var count int64
+	require.NoError(t, container.DB.Model(&jobs.Job{}).Where("kind = ?", string(JobBackfillPositions)).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	backfilled, err := service.BackfillPositions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backfilled)
+
+	// Todos are put newest first, each with its own position
+	var titles []string
+	require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).Order("position ASC").Pluck("title", &titles).Error)
+	require.Len(t, titles, len(seed))
+	assert.Equal(t, strconv.Itoa(len(seed)-1), titles[0])
+	assert.Equal(t, "0", titles[len(titles)-1])
+
+	var distinct int64
+	require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ? AND position <> ''", userID).Distinct("position").Count(&distinct).Error)
+	assert.Equal(t, int64(len(seed)), distinct)
+
+	// Versions are left as is, the order didn't change for clients
+	var versions []int64
+	require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).Distinct().Pluck("version", &versions).Error)
+	assert.Equal(t, []int64{1}, versions)
+
+	backfilled, err = service.BackfillPositions(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, backfilled)
+}
+
+func TestTodoSharingIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := createTestUser(t, "owner@example.com")
+	editorID := createTestUser(t, "editor@example.com")
+	viewerID := createTestUser(t, "viewer@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	shared, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Shared Todo", ProjectID: &project.ID})
+	require.NoError(t, err)
+	private, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Private Todo"})
+	require.NoError(t, err)
+
+	// The owner invites by email, matched regardless of case
+	id := strconv.FormatInt(project.ID, 10)
+	for _, invite := range []InviteRequest{
+		{Email: "Editor@Example.com", Role: "editor"},
+		{Email: "viewer@example.com", Role: "viewer"},
+	} {
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			handler.Invite(w, r.WithContext(createAuthenticatedContext(ownerID)))
+		}, test.HTTPRequest{
+			Method: http.MethodPost,
+			URL:    "/projects/" + id + "/invitations",
+			Body:   invite,
+		})
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, invite.Role, resp.Body["role"])
+	}
+
+	// Invitees see and accept their invitations
+	for _, userID := range []int64{editorID, viewerID} {
+		invitations, err := service.GetReceivedInvitations(context.Background(), userID)
+		require.NoError(t, err)
+		require.Len(t, invitations, 1)
+
+		invitationID := strconv.FormatInt(invitations[0].ID, 10)
+		resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", invitationID)
+			handler.AcceptInvitation(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: http.MethodPost,
+			URL:    "/invitations/" + invitationID + "/accept",
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Team", resp.Body["name"])
+		assert.Equal(t, string(invitations[0].Role), resp.Body["role"])
+	}
+
+	pending, err := service.GetInvitations(context.Background(), ownerID, project.ID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	members, err := service.GetMembers(context.Background(), viewerID, project.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, "editor@example.com", members[0].Email)
+	assert.Equal(t, RoleEditor, members[0].Role)
+
+	// Members list the shared todos along with their own, but not the other todos of the owner
+	page, err := service.GetByUserID(context.Background(), viewerID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, shared.ID, page.Data[0].ID)
+
+	_, err = service.GetByID(context.Background(), viewerID, private.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	// Shared projects are listed after the member's own, with their role
+	projects, err := service.GetProjects(context.Background(), editorID, nil)
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	assert.True(t, projects[0].Inbox)
+	assert.Equal(t, RoleOwner, projects[0].Role)
+	assert.Equal(t, project.ID, projects[1].ID)
+	assert.Equal(t, RoleEditor, projects[1].Role)
+
+	// Viewers can't change todos
+	todoID := strconv.FormatInt(shared.ID, 10)
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", todoID)
+		handler.Update(w, r.WithContext(createAuthenticatedContext(viewerID)))
+	}, test.HTTPRequest{
+		Method: http.MethodPut,
+		URL:    "/todos/" + todoID,
+		Body:   UpdateTodoRequest{Title: "Viewer Title"},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, "permission denied")
+
+	_, err = service.Create(context.Background(), viewerID, &CreateTodoRequest{Title: "Viewer Todo", ProjectID: &project.ID})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// Editors can, and the todos they create belong to the owner of the project
+	updated, err := service.Update(context.Background(), editorID, shared.ID, 0, &UpdateTodoRequest{Title: "Editor Title"})
+	require.NoError(t, err)
+	assert.Equal(t, "Editor Title", updated.Title)
+
+	created, err := service.Create(context.Background(), editorID, &CreateTodoRequest{Title: "Editor Todo", ProjectID: &project.ID})
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, created.UserID)
+
+	history, err := service.GetHistory(context.Background(), ownerID, created.ID, &HistoryParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, history.Data, 1)
+	assert.Equal(t, editorID, history.Data[0].UserID)
+
+	// Only owners manage the project
+	_, err = service.UpdateProject(context.Background(), editorID, project.ID, &UpdateProjectRequest{Name: "Renamed"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	_, err = service.UpdateMember(context.Background(), ownerID, project.ID, viewerID, &UpdateMemberRequest{Role: "owner"})
+	require.NoError(t, err)
+
+	_, err = service.UpdateProject(context.Background(), viewerID, project.ID, &UpdateProjectRequest{Name: "Renamed"})
+	assert.NoError(t, err)
+
+	// Only the creator deletes it
+	err = service.DeleteProject(context.Background(), viewerID, project.ID, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+}
+
+func TestTodoSharingRevokeIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := createTestUser(t, "owner@example.com")
+	memberID := createTestUser(t, "member@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	todo, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Shared Todo", ProjectID: &project.ID})
+	require.NoError(t, err)
+
+	invitation, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "editor"})
+	require.NoError(t, err)
+	_, err = service.AcceptInvitation(context.Background(), memberID, invitation.ID)
+	require.NoError(t, err)
+
+	// Warm the member's cache
+	page, err := service.GetByUserID(context.Background(), memberID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+
+	// Changes by the owner are seen by members right away
+	_, err = service.Update(context.Background(), ownerID, todo.ID, 0, &UpdateTodoRequest{Title: "Updated"})
+	require.NoError(t, err)
+
+	page, err = service.GetByUserID(context.Background(), memberID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "Updated", page.Data[0].Title)
+
+	id := strconv.FormatInt(project.ID, 10)
+	member := strconv.FormatInt(memberID, 10)
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", id)
+		r.SetPathValue("userID", member)
+		handler.RemoveMember(w, r.WithContext(createAuthenticatedContext(ownerID)))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/projects/" + id + "/members/" + member,
+	})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Revoked access takes effect at once, including cached lists
+	cacheKey := "todos:user:" + member
+	exists, err := sharedContainer.Redis.Exists(context.Background(), cacheKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	page, err = service.GetByUserID(context.Background(), memberID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	assert.Empty(t, page.Data)
+
+	_, err = service.GetByID(context.Background(), memberID, todo.ID)
+	assert.ErrorIs(t, err, ErrTodoNotFound)
+
+	_, err = service.GetProject(context.Background(), memberID, project.ID)
+	assert.ErrorIs(t, err, ErrProjectNotFound)
+
+	projects, err := service.GetProjects(context.Background(), memberID, nil)
+	require.NoError(t, err)
+	assert.Len(t, projects, 1)
+}
+
+func TestTodoInvitationErrorsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := createTestUser(t, "owner@example.com")
+	memberID := createTestUser(t, "member@example.com")
+	otherID := createTestUser(t, "other@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	inbox, err := service.inbox(context.Background(), ownerID)
+	require.NoError(t, err)
+
+	invitation, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "viewer"})
+	require.NoError(t, err)
+
+	// Inviting again replaces the role of the pending invitation
+	again, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "editor"})
+	require.NoError(t, err)
+	assert.Equal(t, invitation.ID, again.ID)
+
+	tests := []struct {
+		name            string
+		userID          int64
+		projectID       int64
+		requestBody     InviteRequest
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:            "invite the owner",
+			userID:          ownerID,
+			projectID:       project.ID,
+			requestBody:     InviteRequest{Email: "OWNER@example.com", Role: "viewer"},
+			expectedStatus:  http.StatusConflict,
+			expectedMessage: "user is already a member",
+		},
+		{
+			name:            "invite to the inbox",
+			userID:          ownerID,
+			projectID:       inbox.ID,
+			requestBody:     InviteRequest{Email: "other@example.com", Role: "viewer"},
+			expectedStatus:  http.StatusConflict,
+			expectedMessage: "inbox project cannot be changed",
+		},
+		{
+			name:            "invite to a project of someone else",
+			userID:          otherID,
+			projectID:       project.ID,
+			requestBody:     InviteRequest{Email: "other@example.com", Role: "viewer"},
+			expectedStatus:  http.StatusNotFound,
+			expectedMessage: "project not found",
+		},
+		{
+			name:           "invalid role",
+			userID:         ownerID,
+			projectID:      project.ID,
+			requestBody:    InviteRequest{Email: "other@example.com", Role: "admin"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid email",
+			userID:         ownerID,
+			projectID:      project.ID,
+			requestBody:    InviteRequest{Email: "other", Role: "viewer"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := strconv.FormatInt(tt.projectID, 10)
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", id)
+				handler.Invite(w, r.WithContext(createAuthenticatedContext(tt.userID)))
+			}, test.HTTPRequest{
+				Method: http.MethodPost,
+				URL:    "/projects/" + id + "/invitations",
+				Body:   tt.requestBody,
+			})
+
+			if tt.expectedMessage != "" {
+				test.AssertErrorResponse(t, resp, tt.expectedStatus, tt.expectedMessage)
+			} else {
+				assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	// Invitations can only be accepted or declined by the user they are addressed to
+	_, err = service.AcceptInvitation(context.Background(), otherID, invitation.ID)
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+	err = service.DeclineInvitation(context.Background(), otherID, invitation.ID)
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+
+	// Members don't manage invitations
+	_, err = service.AcceptInvitation(context.Background(), memberID, invitation.ID)
+	require.NoError(t, err)
+	_, err = service.Invite(context.Background(), memberID, project.ID, &InviteRequest{Email: "other@example.com", Role: "viewer"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "viewer"})
+	assert.ErrorIs(t, err, ErrAlreadyMember)
+
+	// Declined and cancelled invitations are gone
+	declined, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "other@example.com", Role: "viewer"})
+	require.NoError(t, err)
+	require.NoError(t, service.DeclineInvitation(context.Background(), otherID, declined.ID))
+	_, err = service.AcceptInvitation(context.Background(), otherID, declined.ID)
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+
+	cancelled, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "other@example.com", Role: "viewer"})
+	require.NoError(t, err)
+	require.NoError(t, service.CancelInvitation(context.Background(), ownerID, project.ID, cancelled.ID))
+	received, err := service.GetReceivedInvitations(context.Background(), otherID)
+	require.NoError(t, err)
+	assert.Empty(t, received)
+
+	// Members can leave on their own, but not remove others
+	err = service.RemoveMember(context.Background(), otherID, project.ID, memberID)
+	assert.ErrorIs(t, err, ErrProjectNotFound)
+	require.NoError(t, service.RemoveMember(context.Background(), memberID, project.ID, memberID))
+	err = service.RemoveMember(context.Background(), ownerID, project.ID, memberID)
+	assert.ErrorIs(t, err, ErrMemberNotFound)
+}
+
+func TestTodoCommentsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := createTestUser(t, "owner@example.com")
+	memberID := createTestUser(t, "member@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	todo, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Discuss", ProjectID: &project.ID})
+	require.NoError(t, err)
+
+	invitation, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "viewer"})
+	require.NoError(t, err)
+	_, err = service.AcceptInvitation(context.Background(), memberID, invitation.ID)
+	require.NoError(t, err)
+
+	// Warm the cache before commenting
+	_, err = service.GetByUserID(context.Background(), ownerID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+
+	id := strconv.FormatInt(todo.ID, 10)
+	createComment := func(userID int64, body CreateCommentRequest) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			handler.CreateComment(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: http.MethodPost,
+			URL:    "/todos/" + id + "/comments",
+			Body:   body,
+		})
+	}
+
+	// Viewers can comment, and bodies are sanitized
+	resp := createComment(memberID, CreateCommentRequest{Body: " <b>First</b> comment "})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "&lt;b&gt;First&lt;/b&gt; comment", resp.Body["body"])
+	assert.Equal(t, float64(memberID), resp.Body["user_id"])
+	first := int64(resp.Body["id"].(float64))
+
+	resp = createComment(ownerID, CreateCommentRequest{Body: "Reply", ParentID: &first})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, float64(first), resp.Body["parent_id"])
+	reply := int64(resp.Body["id"].(float64))
+
+	// Comment counts show up on todos, cached ones included
+	page, err := service.GetByUserID(context.Background(), ownerID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, int64(2), page.Data[0].CommentCount)
+
+	// Comments are paginated oldest first
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", id)
+		handler.GetComments(w, r.WithContext(createAuthenticatedContext(memberID)))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/todos/" + id + "/comments?limit=1",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, resp.Body["has_more"])
+	assert.Contains(t, resp.Headers.Get("Link"), `rel="next"`)
+	data := resp.Body["data"].([]interface{})
+	require.Len(t, data, 1)
+	assert.Equal(t, float64(first), data[0].(map[string]interface{})["id"])
+
+	next, err := service.GetComments(context.Background(), memberID, todo.ID, &CommentParams{Limit: 1, Cursor: resp.Body["next_cursor"].(string)})
+	require.NoError(t, err)
+	require.Len(t, next.Data, 1)
+	assert.Equal(t, reply, next.Data[0].ID)
+	assert.False(t, next.HasMore)
+
+	// Only authors edit their comments
+	_, err = service.UpdateComment(context.Background(), ownerID, todo.ID, first, &UpdateCommentRequest{Body: "Hijacked"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	edited, err := service.UpdateComment(context.Background(), memberID, todo.ID, first, &UpdateCommentRequest{Body: "First comment, edited"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, edited.EditCount)
+	assert.NotNil(t, edited.EditedAt)
+
+	// Only the author or the owner of the todo delete comments
+	commentID := strconv.FormatInt(reply, 10)
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", id)
+		r.SetPathValue("commentID", commentID)
+		handler.DeleteComment(w, r.WithContext(createAuthenticatedContext(memberID)))
+	}, test.HTTPRequest{
+		Method: http.MethodDelete,
+		URL:    "/todos/" + id + "/comments/" + commentID,
+	})
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, "permission denied")
+
+	require.NoError(t, service.DeleteComment(context.Background(), ownerID, todo.ID, first))
+
+	// Deleted comments stay in the thread without their body
+	comments, err := service.GetComments(context.Background(), memberID, todo.ID, &CommentParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, comments.Data, 2)
+	assert.True(t, comments.Data[0].DeletedAt.Valid)
+	assert.Equal(t, first, *comments.Data[1].ParentID)
+
+	got, err := service.GetByID(context.Background(), memberID, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.CommentCount)
+
+	// Comments don't change the version of the todo
+	assert.Equal(t, todo.Version, got.Version)
+
+	_, err = service.UpdateComment(context.Background(), memberID, todo.ID, first, &UpdateCommentRequest{Body: "Back"})
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+}
+
+func TestTodoCommentsErrorsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Discuss"})
+	require.NoError(t, err)
+	other, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Elsewhere"})
+	require.NoError(t, err)
+	elsewhere, err := service.CreateComment(context.Background(), userID, other.ID, &CreateCommentRequest{Body: "Elsewhere"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		userID          int64
+		todoID          int64
+		requestBody     CreateCommentRequest
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:           "missing body",
+			userID:         userID,
+			todoID:         todo.ID,
+			requestBody:    CreateCommentRequest{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too long",
+			userID:         userID,
+			todoID:         todo.ID,
+			requestBody:    CreateCommentRequest{Body: strings.Repeat("a", MaxCommentLength+1)},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "empty once sanitized",
+			userID:          userID,
+			todoID:          todo.ID,
+			requestBody:     CreateCommentRequest{Body: "\x00\r\n"},
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "invalid comment: body is empty",
+		},
+		{
+			name:            "reply to a comment of another todo",
+			userID:          userID,
+			todoID:          todo.ID,
+			requestBody:     CreateCommentRequest{Body: "Reply", ParentID: &elsewhere.ID},
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: fmt.Sprintf("invalid comment: parent comment %d not found", elsewhere.ID),
+		},
+		{
+			name:            "todo of another user",
+			userID:          2,
+			todoID:          todo.ID,
+			requestBody:     CreateCommentRequest{Body: "Hello"},
+			expectedStatus:  http.StatusNotFound,
+			expectedMessage: "todo not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := strconv.FormatInt(tt.todoID, 10)
+			resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+				r.SetPathValue("id", id)
+				handler.CreateComment(w, r.WithContext(createAuthenticatedContext(tt.userID)))
+			}, test.HTTPRequest{
+				Method: http.MethodPost,
+				URL:    "/todos/" + id + "/comments",
+				Body:   tt.requestBody,
+			})
+
+			if tt.expectedMessage != "" {
+				test.AssertErrorResponse(t, resp, tt.expectedStatus, tt.expectedMessage)
+			} else {
+				assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	// Comments are looked up within their todo
+	err = service.DeleteComment(context.Background(), userID, todo.ID, elsewhere.ID)
+	assert.ErrorIs(t, err, ErrCommentNotFound)
+
+	_, err = service.GetComments(context.Background(), userID, todo.ID, &CommentParams{Limit: 10, Cursor: "garbage"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Comments go along with purged todos
+	require.NoError(t, service.Delete(context.Background(), userID, other.ID, 0))
+	require.NoError(t, service.Purge(context.Background(), userID, other.ID))
+
+	var count int64
+	require.NoError(t, sharedContainer.DB.Model(&Comment{}).Unscoped().Where("todo_id = ?", other.ID).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// uploadAttachment uploads a file to a todo through the Attach handler as the given user
+func uploadAttachment(t *testing.T, handler *handler, userID, todoID int64, filename string, content []byte) *test.HTTPResponse {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	id := strconv.FormatInt(todoID, 10)
+	r := httptest.NewRequest(http.MethodPost, "/todos/"+id+"/attachments", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.SetPathValue("id", id)
+
+	w := httptest.NewRecorder()
+	handler.Attach(w, r.WithContext(createAuthenticatedContext(userID)))
+
+	resp := &test.HTTPResponse{StatusCode: w.Code, Headers: w.Header(), RawBody: w.Body.Bytes()}
+	_ = json.Unmarshal(resp.RawBody, &resp.Body)
+	return resp
+}
+
+// blobExists reports whether the blob of an attachment is still in the store of the service
+func blobExists(t *testing.T, service *Service, key string) bool {
+	t.Helper()
+
+	body, err := service.blobs.Get(context.Background(), key, 0)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	require.NoError(t, err)
+	body.Close()
+	return true
+}
+
+func TestTodoAttachmentsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	ownerID := createTestUser(t, "owner@example.com")
+	viewerID := createTestUser(t, "viewer@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	todo, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Report", ProjectID: &project.ID})
+	require.NoError(t, err)
+
+	invitation, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "viewer@example.com", Role: "viewer"})
+	require.NoError(t, err)
+	_, err = service.AcceptInvitation(context.Background(), viewerID, invitation.ID)
+	require.NoError(t, err)
+
+	// The content type is detected from the content, not from the file name
+	content := []byte("%PDF-1.4\n" + strings.Repeat("quarterly numbers\n", 100))
+	resp := uploadAttachment(t, handler, ownerID, todo.ID, "C:\\reports\\q3.txt", content)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "q3.txt", resp.Body["filename"])
+	assert.Equal(t, "application/pdf", resp.Body["content_type"])
+	assert.Equal(t, float64(len(content)), resp.Body["size"])
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), resp.Body["checksum"])
+	assert.NotContains(t, resp.Body, "blob_key")
+	attachmentID := strconv.FormatInt(int64(resp.Body["id"].(float64)), 10)
+
+	id := strconv.FormatInt(todo.ID, 10)
+	download := func(userID int64, headers map[string]string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			r.SetPathValue("attachmentID", attachmentID)
+			handler.DownloadAttachment(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method:  http.MethodGet,
+			URL:     "/todos/" + id + "/attachments/" + attachmentID,
+			Headers: headers,
+		})
+	}
+
+	// Viewers can list and download
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", id)
+		handler.GetAttachments(w, r.WithContext(createAuthenticatedContext(viewerID)))
+	}, test.HTTPRequest{
+		Method: http.MethodGet,
+		URL:    "/todos/" + id + "/attachments",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var attachments []map[string]any
+	require.NoError(t, json.Unmarshal(resp.RawBody, &attachments))
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "q3.txt", attachments[0]["filename"])
+
+	resp = download(viewerID, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, content, resp.RawBody)
+	assert.Equal(t, "application/pdf", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=q3.txt`, resp.Headers.Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", resp.Headers.Get("X-Content-Type-Options"))
+	assert.Equal(t, "bytes", resp.Headers.Get("Accept-Ranges"))
+	etag := resp.Headers.Get("ETag")
+	assert.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, etag)
+
+	// Ranges are streamed from the requested offset
+	resp = download(viewerID, map[string]string{"Range": "bytes=4-7"})
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, content[4:8], resp.RawBody)
+	assert.Equal(t, fmt.Sprintf("bytes 4-7/%d", len(content)), resp.Headers.Get("Content-Range"))
+
+	resp = download(viewerID, map[string]string{"Range": "bytes=-5"})
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, content[len(content)-5:], resp.RawBody)
+
+	resp = download(viewerID, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// Viewers can't upload nor delete
+	resp = uploadAttachment(t, handler, viewerID, todo.ID, "notes.txt", []byte("notes"))
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, ErrPermissionDenied.Error())
+
+	deleteAttachment := func(userID int64) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			r.SetPathValue("attachmentID", attachmentID)
+			handler.DeleteAttachment(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: http.MethodDelete,
+			URL:    "/todos/" + id + "/attachments/" + attachmentID,
+		})
+	}
+
+	resp = deleteAttachment(viewerID)
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, ErrPermissionDenied.Error())
+
+	// Deleting removes the row and the blob
+	stored, err := service.store.GetAttachments(context.Background(), todo.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.True(t, blobExists(t, service, stored[0].BlobKey))
+
+	resp = deleteAttachment(ownerID)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.False(t, blobExists(t, service, stored[0].BlobKey))
+
+	resp = download(ownerID, nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, ErrAttachmentNotFound.Error())
+
+	// Strangers don't see the todo at all
+	strangerID := createTestUser(t, "stranger@example.com")
+	resp = uploadAttachment(t, handler, strangerID, todo.ID, "notes.txt", []byte("notes"))
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
+}
+
+func TestTodoAttachmentsLimitsIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := createTestUser(t, "owner@example.com")
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Uploads"})
+	require.NoError(t, err)
+
+	// Files over the maximum size are rejected before reaching the store
+	resp := uploadAttachment(t, handler, userID, todo.ID, "big.bin", make([]byte, 2<<20))
+	test.AssertErrorResponse(t, resp, http.StatusRequestEntityTooLarge, ErrFileTooLarge.Error())
+
+	_, err = service.Attach(context.Background(), userID, todo.ID, &AttachRequest{
+		Filename: "big.bin",
+		Content:  bytes.NewReader(make([]byte, (1<<20)+1)),
+		Size:     (1 << 20) + 1,
+	})
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	// Two files of 1 MiB fill the 2 MiB quota
+	for range 2 {
+		resp = uploadAttachment(t, handler, userID, todo.ID, "part.bin", make([]byte, 1<<20))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	resp = uploadAttachment(t, handler, userID, todo.ID, "extra.txt", []byte("x"))
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, ErrQuotaExceeded.Error())
+
+	// Nothing is left behind by rejected uploads
+	stored, err := service.store.GetAttachments(context.Background(), todo.ID)
+	require.NoError(t, err)
+	assert.Len(t, stored, 2)
+
+	// Trashed todos still count, purging them frees the quota
+	require.NoError(t, service.Delete(context.Background(), userID, todo.ID, 0))
+	other, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Other"})
+	require.NoError(t, err)
+	resp = uploadAttachment(t, handler, userID, other.ID, "extra.txt", []byte("x"))
+	test.AssertErrorResponse(t, resp, http.StatusForbidden, ErrQuotaExceeded.Error())
+
+	require.NoError(t, service.Purge(context.Background(), userID, todo.ID))
+	resp = uploadAttachment(t, handler, userID, other.ID, "extra.txt", []byte("x"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Requests without a file are rejected
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(other.ID, 10))
+		handler.Attach(w, r.WithContext(createAuthenticatedContext(userID)))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/todos/1/attachments",
+		Body:   map[string]string{"file": "x"},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid multipart form")
+}
+
+func TestTodoAttachmentsCleanupIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := createTestUser(t, "owner@example.com")
+
+	keys := map[string]string{}
+	for _, title := range []string{"Purged", "Emptied", "Expired", "Kept"} {
+		todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: title})
+		require.NoError(t, err)
+
+		resp := uploadAttachment(t, handler, userID, todo.ID, title+".txt", []byte(title))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		stored, err := service.store.GetAttachments(context.Background(), todo.ID)
+		require.NoError(t, err)
+		require.Len(t, stored, 1)
+		keys[title] = stored[0].BlobKey
+
+		if title != "Kept" {
+			require.NoError(t, service.Delete(context.Background(), userID, todo.ID, 0))
+		}
+	}
+
+	// Trashed todos keep their blobs so that restoring them gives the files back
+	for title, key := range keys {
+		assert.True(t, blobExists(t, service, key), title)
+	}
+
+	var purged, expired Todo
+	require.NoError(t, container.DB.Unscoped().Where("title = ?", "Purged").First(&purged).Error)
+	require.NoError(t, container.DB.Unscoped().Where("title = ?", "Expired").First(&expired).Error)
+
+	require.NoError(t, service.Purge(context.Background(), userID, purged.ID))
+	assert.False(t, blobExists(t, service, keys["Purged"]))
+	assert.True(t, blobExists(t, service, keys["Emptied"]))
+
+	require.NoError(t, container.DB.Unscoped().Model(&Todo{}).Where("id = ?", expired.ID).
+		Update("deleted_at", time.Now().Add(-31*24*time.Hour)).Error)
+	count, err := service.PurgeExpiredTrash(context.Background(), 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.False(t, blobExists(t, service, keys["Expired"]))
+	assert.True(t, blobExists(t, service, keys["Emptied"]))
+
+	require.NoError(t, service.EmptyTrash(context.Background(), userID))
+	assert.False(t, blobExists(t, service, keys["Emptied"]))
+	assert.True(t, blobExists(t, service, keys["Kept"]))
+
+	// The rows went with their todos
+	var remaining int64
+	require.NoError(t, container.DB.Model(&Attachment{}).Count(&remaining).Error)
+	assert.Equal(t, int64(1), remaining)
+}
+
+// postImport sends a file to the import endpoint as the raw request body
+func postImport(t *testing.T, handler *handler, userID int64, query, contentType, content string) *test.HTTPResponse {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/todos/import?"+query, strings.NewReader(content))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	handler.Import(w, r.WithContext(createAuthenticatedContext(userID)))
+
+	resp := &test.HTTPResponse{StatusCode: w.Code, Headers: w.Header(), RawBody: w.Body.Bytes()}
+	_ = json.Unmarshal(resp.RawBody, &resp.Body)
+	return resp
+}
+
+func TestTodoImportIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+	ctx := createAuthenticatedContext(userID)
+
+	existing, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Existing"})
+	require.NoError(t, err)
+	project, err := service.CreateProject(ctx, userID, &CreateProjectRequest{Name: "Work"})
+	require.NoError(t, err)
+	label, err := service.CreateLabel(ctx, userID, &CreateLabelRequest{Name: "urgent"})
+	require.NoError(t, err)
+
+	content := `[
+		{"title": "First", "project": "Work", "labels": ["urgent", "reports"]},
+		{"title": "Second", "project": "Side project", "due_at": "2024-03-01T09:00:00Z", "recurrence": {"rule": "FREQ=DAILY", "timezone": "UTC"}},
+		{"title": "Third", "completed": true, "created_at": "2020-01-01T00:00:00Z"}
+	]`
+
+	countTodos := func() int64 {
+		var count int64
+		require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).Count(&count).Error)
+		return count
+	}
+
+	// A dry run reports what would be created without saving anything
+	resp := postImport(t, handler, userID, "dry_run=true", "", content)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, true, resp.Body["dry_run"])
+	assert.Equal(t, float64(3), resp.Body["imported"])
+	assert.Equal(t, []any{"Side project"}, resp.Body["created_projects"])
+	assert.Equal(t, []any{"reports"}, resp.Body["created_labels"])
+	assert.Equal(t, []any{}, resp.Body["errors"])
+	assert.Equal(t, int64(1), countTodos())
+
+	resp = postImport(t, handler, userID, "", "application/json", content)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, false, resp.Body["dry_run"])
+	assert.Equal(t, float64(3), resp.Body["imported"])
+	assert.Equal(t, int64(4), countTodos())
+
+	// Imported todos come first, in the order of the file
+	page, err := service.GetByUserID(ctx, userID, &ListParams{Sort: "position", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 4)
+	titles := make([]string, len(page.Data))
+	for i, todo := range page.Data {
+		titles[i] = todo.Title
+	}
+	assert.Equal(t, []string{"First", "Second", "Third", "Existing"}, titles)
+	assert.Equal(t, existing.ID, page.Data[3].ID)
+
+	first := page.Data[0]
+	assert.Equal(t, project.ID, *first.ProjectID)
+	require.Len(t, first.Labels, 2)
+	assert.Equal(t, "reports", first.Labels[0].Name)
+	assert.Equal(t, label.ID, first.Labels[1].ID)
+
+	second := page.Data[1]
+	assert.NotEqual(t, project.ID, *second.ProjectID)
+	require.NotNil(t, second.Recurrence)
+
+	third := page.Data[2]
+	assert.True(t, third.Completed)
+	assert.Equal(t, 2020, third.CreatedAt.Year())
+
+	inbox, err := service.store.GetInbox(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, inbox.ID, *third.ProjectID)
+
+	// Imports are recorded in the history of each todo
+	history, err := service.GetHistory(ctx, userID, first.ID, &HistoryParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, history.Data, 1)
+	assert.Equal(t, HistoryCreate, history.Data[0].Action)
+
+	// Importing again reuses the projects and labels created the first time
+	resp = postImport(t, handler, userID, "", "", content)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, []any{}, resp.Body["created_projects"])
+	assert.Equal(t, []any{}, resp.Body["created_labels"])
+}
+
+func TestTodoImportErrorsIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+
+	countTodos := func() int64 {
+		var count int64
+		require.NoError(t, container.DB.Model(&Todo{}).Where("user_id = ?", userID).Count(&count).Error)
+		return count
+	}
+
+	// A single invalid row rejects the whole file, every invalid row is reported
+	content := "title,priority,due_at\nGood,,\nBad priority,critical,\nBad date,,soon\n"
+	resp := postImport(t, handler, userID, "", "text/csv", content)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, float64(0), resp.Body["imported"])
+	assert.Equal(t, []any{
+		map[string]any{"row": float64(2), "message": `invalid priority "critical"`},
+		map[string]any{"row": float64(3), "message": `invalid due_at "soon"`},
+	}, resp.Body["errors"])
+	assert.Equal(t, int64(0), countTodos())
+
+	// Labels are unique per user, an import can't create the same one twice
+	content = `[{"title": "a", "labels": ["x"]}, {"title": "b", "labels": ["x"], "project": "P"}]`
+	resp = postImport(t, handler, userID, "", "", content)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, []any{"x"}, resp.Body["created_labels"])
+	labels, err := service.GetLabels(createAuthenticatedContext(userID), userID)
+	require.NoError(t, err)
+	assert.Len(t, labels, 1)
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		content     string
+		status      int
+		message     string
+	}{
+		{name: "unknown format", query: "format=xlsx", status: http.StatusBadRequest, message: "invalid query parameter: format"},
+		{name: "invalid dry run", query: "dry_run=maybe", status: http.StatusBadRequest, message: "invalid query parameter: dry_run"},
+		{name: "unknown mapped field", query: "format=csv&map.owner=Owner", content: "title\nx\n", status: http.StatusBadRequest, message: "invalid query parameter: map.owner"},
+		{name: "broken json", content: `[{"title": `, status: http.StatusBadRequest},
+		{name: "missing title column", contentType: "text/csv", content: "name\nx\n", status: http.StatusBadRequest, message: `invalid import: missing "title" column`},
+		{name: "broken calendar", contentType: "text/calendar", content: "BEGIN:VCALENDAR\n", status: http.StatusBadRequest},
+		{name: "too large", content: "[" + strings.Repeat(" ", maxImportSize) + "]", status: http.StatusRequestEntityTooLarge, message: "file too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postImport(t, handler, userID, tt.query, tt.contentType, tt.content)
+			require.Equal(t, tt.status, resp.StatusCode, string(resp.RawBody))
+			if tt.message != "" {
+				test.AssertErrorResponse(t, resp, tt.status, tt.message)
+			}
+		})
+	}
+	assert.Equal(t, int64(2), countTodos())
+}
+
+func TestTodoExportIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+	otherID := createTestUser(t, "other@example.com")
+	ctx := createAuthenticatedContext(userID)
+
+	project, err := service.CreateProject(ctx, userID, &CreateProjectRequest{Name: "Work"})
+	require.NoError(t, err)
+	due := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Report", ProjectID: &project.ID, DueAt: &due, Priority: "high"})
+	require.NoError(t, err)
+	label, err := service.CreateLabel(ctx, userID, &CreateLabelRequest{Name: "q1"})
+	require.NoError(t, err)
+	_, err = service.AttachLabel(ctx, userID, todo.ID, label.ID)
+	require.NoError(t, err)
+
+	// Trashed todos and the todos of other users are left out, and batches don't lose any todo
+	trashed, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Trashed"})
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, userID, trashed.ID, 0))
+	_, err = service.Create(createAuthenticatedContext(otherID), otherID, &CreateTodoRequest{Title: "Not mine"})
+	require.NoError(t, err)
+	for i := 0; i < exportBatchSize; i++ {
+		_, err := service.Create(ctx, userID, &CreateTodoRequest{Title: fmt.Sprintf("Bulk %d", i)})
+		require.NoError(t, err)
+	}
+
+	exportTodos := func(format string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			handler.Export(w, r.WithContext(ctx))
+		}, test.HTTPRequest{
+			Method: http.MethodGet,
+			URL:    "/todos/export?format=" + format,
+		})
+	}
+
+	resp := exportTodos("json")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=todos.json", resp.Headers.Get("Content-Disposition"))
+
+	var records []map[string]any
+	require.NoError(t, json.Unmarshal(resp.RawBody, &records))
+	require.Len(t, records, exportBatchSize+1)
+	last := records[len(records)-1]
+	assert.Equal(t, "Report", last["title"])
+	assert.Equal(t, "Work", last["project"])
+	assert.Equal(t, "high", last["priority"])
+	assert.Equal(t, []any{"q1"}, last["labels"])
+	assert.Equal(t, "2024-03-01T09:00:00Z", last["due_at"])
+	assert.Equal(t, "Bulk 499", records[0]["title"])
+
+	resp = exportTodos("csv")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Headers.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(string(resp.RawBody), strings.Join(csvColumns, ",")+"\n"))
+
+	resp = exportTodos("ics")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/calendar; charset=utf-8", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, exportBatchSize+1, strings.Count(string(resp.RawBody), "BEGIN:VTODO"))
+
+	resp = exportTodos("xml")
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid query parameter: format")
+
+	// What is exported can be imported by another user as is
+	resp = exportTodos("ics")
+	resp = postImport(t, handler, otherID, "format=ics", "", string(resp.RawBody))
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, float64(exportBatchSize+1), resp.Body["imported"])
+	assert.Equal(t, []any{"Work"}, resp.Body["created_projects"])
+}
+
+func TestTodoExportJobIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+	otherID := createTestUser(t, "other@example.com")
+	ctx := createAuthenticatedContext(userID)
+
+	_, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Report"})
+	require.NoError(t, err)
+
+	exportRequest := func(fn http.HandlerFunc, userID int64, method, id string, body any) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", id)
+			fn(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: method,
+			URL:    "/exports",
+			Body:   body,
+		})
+	}
+
+	resp := exportRequest(handler.RequestExport, userID, http.MethodPost, "", ExportRequest{Format: "xml"})
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid query parameter: format")
+
+	resp = exportRequest(handler.RequestExport, userID, http.MethodPost, "", ExportRequest{Format: "csv"})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, "pending", resp.Body["status"])
+	id := strconv.FormatInt(int64(resp.Body["id"].(float64)), 10)
+	assert.Equal(t, "/api/exports/"+id, resp.Headers.Get("Location"))
+
+	// The file isn't there until a worker generates it, and only its owner sees it
+	resp = exportRequest(handler.DownloadExport, userID, http.MethodGet, id, nil)
+	test.AssertErrorResponse(t, resp, http.StatusConflict, "export not ready")
+	resp = exportRequest(handler.GetExport, otherID, http.MethodGet, id, nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "export not found")
+
+	worker := jobs.NewWorker(jobs.NewQueue(sharedContainer.DB), 2)
+	service.RegisterJobs(worker, 0)
+	workerCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker.Run(workerCtx)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		resp := exportRequest(handler.GetExport, userID, http.MethodGet, id, nil)
+		return resp.StatusCode == http.StatusOK && resp.Body["status"] == "ready"
+	}, 10*time.Second, 50*time.Millisecond)
+
+	resp = exportRequest(handler.DownloadExport, userID, http.MethodGet, id, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=todos.csv", resp.Headers.Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(string(resp.RawBody), strings.Join(csvColumns, ",")+"\n"))
+	assert.Contains(t, string(resp.RawBody), "Report")
+
+	// Expired files are gone, and purged along with their content
+	fileID, err := strconv.ParseInt(id, 10, 64)
+	require.NoError(t, err)
+	file, err := service.store.GetExportFileByID(context.Background(), userID, fileID)
+	require.NoError(t, err)
+	file.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, service.store.SaveExportFile(context.Background(), file))
+
+	resp = exportRequest(handler.GetExport, userID, http.MethodGet, id, nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "export not found")
+
+	purged, err := service.PurgeExpiredExports(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = service.blobs.Get(context.Background(), file.BlobKey, 0)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// unavailableBlobStore is a blob store that can't be reached
+type unavailableBlobStore struct{}
+
+func (unavailableBlobStore) Put(context.Context, string, io.Reader, int64) error {
+	return errors.New("blob store unavailable")
+}
+
+func (unavailableBlobStore) Get(context.Context, string, int64) (io.ReadCloser, error) {
+	return nil, errors.New("blob store unavailable")
+}
+
+func (unavailableBlobStore) Delete(context.Context, string) error {
+	return errors.New("blob store unavailable")
+}
+
+func TestTodoExportJobFailureIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+	service.blobs = unavailableBlobStore{}
+
+	userID := createTestUser(t, "user@example.com")
+	file, err := service.RequestExport(createAuthenticatedContext(userID), userID, FormatJSON)
+	require.NoError(t, err)
+
+	// Only the last attempt marks the file as failed, earlier ones are retried
+	args := GenerateExportArgs{ExportID: file.ID, UserID: userID}
+	job := &jobs.Job{Attempts: 1, MaxAttempts: 2}
+	require.Error(t, service.GenerateExport(jobs.NewContext(context.Background(), job), args))
+	file, err = service.GetExportFile(context.Background(), userID, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ExportPending, file.Status)
+
+	job.Attempts = 2
+	require.Error(t, service.GenerateExport(jobs.NewContext(context.Background(), job), args))
+	file, err = service.GetExportFile(context.Background(), userID, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ExportFailed, file.Status)
+	assert.NotEmpty(t, file.Error)
+
+	// A failed file isn't generated again
+	require.NoError(t, service.GenerateExport(context.Background(), args))
+}
+
+func TestTodoFeedIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+	ctx := createAuthenticatedContext(userID)
+
+	_, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Report"})
+	require.NoError(t, err)
+
+	feedRequest := func(method string, fn http.HandlerFunc) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			fn(w, r.WithContext(ctx))
+		}, test.HTTPRequest{Method: method, URL: "/api/feed"})
+	}
+	getFeed := func(token string, headers map[string]string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("token", token)
+			handler.Feed(w, r)
+		}, test.HTTPRequest{Method: http.MethodGet, URL: FeedPath(token), Headers: headers})
+	}
+
+	resp := feedRequest(http.MethodGet, handler.GetFeed)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "feed not found")
+
+	resp = feedRequest(http.MethodPost, handler.CreateFeed)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	token := resp.Body["token"].(string)
+	assert.Equal(t, FeedPath(token), resp.Body["path"])
+
+	// Only a hash of the token is stored, and it is never shown again
+	var stored FeedToken
+	require.NoError(t, container.DB.Where("user_id = ?", userID).First(&stored).Error)
+	assert.NotContains(t, stored.TokenHash, token)
+	resp = feedRequest(http.MethodGet, handler.GetFeed)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, resp.Body, "token")
+	assert.Contains(t, resp.Body, "created_at")
+
+	// The feed needs no Authorization header, only the token
+	resp = getFeed(token, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/calendar; charset=utf-8", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, "private, no-cache", resp.Headers.Get("Cache-Control"))
+	assert.Contains(t, string(resp.RawBody), "SUMMARY:Report")
+	etag := resp.Headers.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Polling with the tag is answered from the cache
+	assert.Equal(t, etag, service.FeedETag(context.Background(), userID))
+	resp = getFeed(token, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Headers.Get("ETag"))
+	assert.Empty(t, resp.RawBody)
+
+	// Rendering the unchanged todos again gives the same tag
+	require.NoError(t, container.Redis.FlushAll(context.Background()).Err())
+	resp = getFeed(token, map[string]string{"If-None-Match": "W/" + etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// Any change to the todos changes the feed
+	_, err = service.Create(ctx, userID, &CreateTodoRequest{Title: "Review"})
+	require.NoError(t, err)
+	assert.Empty(t, service.FeedETag(context.Background(), userID))
+	resp = getFeed(token, map[string]string{"If-None-Match": etag})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Headers.Get("ETag"))
+	assert.Contains(t, string(resp.RawBody), "SUMMARY:Review")
+
+	// A new token replaces the previous one
+	resp = feedRequest(http.MethodPost, handler.CreateFeed)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	newToken := resp.Body["token"].(string)
+	assert.NotEqual(t, token, newToken)
+	test.AssertErrorResponse(t, getFeed(token, nil), http.StatusNotFound, "feed not found")
+	assert.Equal(t, http.StatusOK, getFeed(newToken, nil).StatusCode)
+
+	// Revoked feeds stop working at once
+	resp = feedRequest(http.MethodDelete, handler.RevokeFeed)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	test.AssertErrorResponse(t, getFeed(newToken, nil), http.StatusNotFound, "feed not found")
+	resp = feedRequest(http.MethodDelete, handler.RevokeFeed)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "feed not found")
+}
+
+// streamEvent represents an event read from a todo event stream
+type streamEvent struct {
+	ID   string
+	Type string
+	Data map[string]any
+}
+
+// openStream opens the todo event stream of a user, resuming after lastEventID when set
+func openStream(t *testing.T, handler *handler, userID int64, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Stream(w, r.WithContext(context.WithValue(r.Context(), auth.UserIDKey, userID)))
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return bufio.NewReader(resp.Body), func() {
+		resp.Body.Close()
+		srv.Close()
+	}
+}
+
+// nextEvent reads the next event of a stream, skipping comments and retry hints
+func nextEvent(t *testing.T, r *bufio.Reader) streamEvent {
+	t.Helper()
+
+	var event streamEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if event.Type != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Data))
+		}
+	}
+}
+
+// consumeOutbox relays the outbox and runs consumers of the events of todos in the given
+// groups until the test ends, like the server does
+func consumeOutbox(t *testing.T, handlers map[string]outbox.Handler) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		outbox.NewRelay(sharedContainer.DB, sharedContainer.Redis, 1000).Run(ctx)
+	}()
+	for group, handler := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outbox.NewConsumer(sharedContainer.Redis, OutboxTopic, group, handler).Run(ctx)
+		}()
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestTodoStreamIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+	consumeOutbox(t, map[string]outbox.Handler{"todo-stream": service.HandleStream})
+
+	ownerID := createTestUser(t, "owner@example.com")
+	memberID := createTestUser(t, "member@example.com")
+	strangerID := createTestUser(t, "stranger@example.com")
+
+	project, err := service.CreateProject(context.Background(), ownerID, &CreateProjectRequest{Name: "Team"})
+	require.NoError(t, err)
+	invitation, err := service.Invite(context.Background(), ownerID, project.ID, &InviteRequest{Email: "member@example.com", Role: "editor"})
+	require.NoError(t, err)
+	_, err = service.AcceptInvitation(context.Background(), memberID, invitation.ID)
+	require.NoError(t, err)
+
+	ownerStream, closeOwner := openStream(t, handler, ownerID, "")
+	defer closeOwner()
+	memberStream, closeMember := openStream(t, handler, memberID, "")
+	defer closeMember()
+	strangerStream, closeStranger := openStream(t, handler, strangerID, "")
+	defer closeStranger()
+
+	// Changes are streamed to everyone who sees the todo, whoever makes them
+	todo, err := service.Create(context.Background(), ownerID, &CreateTodoRequest{Title: "Shared Todo", ProjectID: &project.ID})
+	require.NoError(t, err)
+	_, err = service.Update(context.Background(), memberID, todo.ID, 0, &UpdateTodoRequest{Title: "Updated"})
+	require.NoError(t, err)
+	_, err = service.ToggleComplete(context.Background(), ownerID, todo.ID, 0, "")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(context.Background(), memberID, todo.ID, 0))
+
+	for _, stream := range []*bufio.Reader{ownerStream, memberStream} {
+		created := nextEvent(t, stream)
+		assert.Equal(t, EventTodoCreated, created.Type)
+		assert.NotEmpty(t, created.ID)
+		assert.Equal(t, "Shared Todo", created.Data["title"])
+		assert.Equal(t, float64(todo.ID), created.Data["id"])
+
+		updated := nextEvent(t, stream)
+		assert.Equal(t, EventTodoUpdated, updated.Type)
+		assert.Equal(t, "Updated", updated.Data["title"])
+
+		toggled := nextEvent(t, stream)
+		assert.Equal(t, EventTodoToggled, toggled.Type)
+		assert.Equal(t, true, toggled.Data["completed"])
+
+		deleted := nextEvent(t, stream)
+		assert.Equal(t, EventTodoDeleted, deleted.Type)
+		assert.Equal(t, map[string]any{"id": float64(todo.ID)}, deleted.Data)
+	}
+
+	// The stranger only gets their own changes
+	other, err := service.Create(context.Background(), strangerID, &CreateTodoRequest{Title: "Private"})
+	require.NoError(t, err)
+	event := nextEvent(t, strangerStream)
+	assert.Equal(t, EventTodoCreated, event.Type)
+	assert.Equal(t, float64(other.ID), event.Data["id"])
+}
+
+func TestTodoStreamResumeIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+	consumeOutbox(t, map[string]outbox.Handler{"todo-stream": service.HandleStream})
+
+	userID := createTestUser(t, "user@example.com")
+
+	stream, closeStream := openStream(t, handler, userID, "")
+	first, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "First"})
+	require.NoError(t, err)
+	event := nextEvent(t, stream)
+	require.Equal(t, float64(first.ID), event.Data["id"])
+	closeStream()
+
+	// Changes made while disconnected are replayed on reconnection, in order
+	second, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "Second"})
+	require.NoError(t, err)
+	_, err = service.Update(context.Background(), userID, second.ID, 0, &UpdateTodoRequest{Title: "Second, updated"})
+	require.NoError(t, err)
+
+	stream, closeStream = openStream(t, handler, userID, event.ID)
+	defer closeStream()
+
+	replayed := nextEvent(t, stream)
+	assert.Equal(t, EventTodoCreated, replayed.Type)
+	assert.Equal(t, float64(second.ID), replayed.Data["id"])
+	updated := nextEvent(t, stream)
+	assert.Equal(t, EventTodoUpdated, updated.Type)
+	assert.Equal(t, "Second, updated", updated.Data["title"])
+
+	// Live events follow the replayed ones
+	require.NoError(t, service.Delete(context.Background(), userID, first.ID, 0))
+	deleted := nextEvent(t, stream)
+	assert.Equal(t, EventTodoDeleted, deleted.Type)
+	assert.Equal(t, float64(first.ID), deleted.Data["id"])
+
+	// Resuming after events that aren't kept anymore asks the client to reload
+	resetStream, closeReset := openStream(t, handler, userID, "1-0")
+	defer closeReset()
+	assert.Equal(t, EventReset, nextEvent(t, resetStream).Type)
+}
+
+func TestTodoWebhookIntegration(t *testing.T) {
+	service, _, _ := setupTestServices(t)
+	ctx := context.Background()
+
+	type received struct {
+		event string
+		data  map[string]any
+	}
+	deliveries := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Data map[string]any `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		deliveries <- received{event: r.Header.Get(webhook.HeaderEvent), data: body.Data}
+	}))
+	defer receiver.Close()
+
+	userID := createTestUser(t, "hooked@example.com")
+	_, err := service.webhooks.Create(ctx, userID, &webhook.CreateEndpointRequest{
+		URL:        receiver.URL,
+		EventTypes: []string{webhook.EventTodoCreated, webhook.EventTodoCompleted, webhook.EventTodoDeleted},
+	})
+	require.NoError(t, err)
+
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Ship it"})
+	require.NoError(t, err)
+	_, err = service.Update(ctx, userID, todo.ID, 0, &UpdateTodoRequest{Title: "Ship it now"})
+	require.NoError(t, err)
+	_, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	_, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, userID, todo.ID, 0))
+
+	// Changes are dispatched once their events are relayed
+	consumeOutbox(t, map[string]outbox.Handler{"todo-webhooks": service.HandleWebhooks})
+	require.Eventually(t, func() bool {
+		var count int64
+		return sharedContainer.DB.Model(&webhook.Delivery{}).Count(&count).Error == nil && count == 3
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, service.webhooks.DeliverDue(ctx))
+
+	// Only subscribed events are delivered, toggles as completions
+	close(deliveries)
+	var got []received
+	for delivery := range deliveries {
+		got = append(got, delivery)
+	}
+	require.Len(t, got, 3)
+	byType := map[string]map[string]any{}
+	for _, delivery := range got {
+		byType[delivery.event] = delivery.data
+	}
+	require.Contains(t, byType, webhook.EventTodoCreated)
+	assert.Equal(t, "Ship it", byType[webhook.EventTodoCreated]["title"])
+	require.Contains(t, byType, webhook.EventTodoCompleted)
+	assert.Equal(t, true, byType[webhook.EventTodoCompleted]["completed"])
+	assert.Equal(t, map[string]any{"id": float64(todo.ID)}, byType[webhook.EventTodoDeleted])
+
+	// An event handled again isn't dispatched twice
+	payload, err := json.Marshal(change{UserIDs: []int64{userID}, Data: todo})
+	require.NoError(t, err)
+	event := outbox.Event{ID: "1-0", Type: EventTodoCreated, Payload: payload}
+	require.NoError(t, service.HandleWebhooks(ctx, event))
+	require.NoError(t, service.HandleWebhooks(ctx, event))
+	var count int64
+	require.NoError(t, sharedContainer.DB.Model(&webhook.Delivery{}).Count(&count).Error)
+	assert.Equal(t, int64(4), count)
+}
+
+func TestTodoOutboxIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+	ctx := context.Background()
+
+	userID := createTestUser(t, "outbox@example.com")
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Write it down"})
+	require.NoError(t, err)
+
+	// A failed change is rolled back along with its event
+	_, err = service.Update(ctx, userID, todo.ID, todo.Version+1, &UpdateTodoRequest{Title: "Stale"})
+	require.ErrorIs(t, err, ErrVersionMismatch)
+
+	require.NoError(t, service.Delete(ctx, userID, todo.ID, 0))
+
+	var messages []outbox.Message
+	require.NoError(t, container.DB.Order("id").Find(&messages).Error)
+	require.Len(t, messages, 3)
+	assert.Equal(t, user.OutboxTopic, messages[0].Topic)
+	assert.Equal(t, user.EventCreated, messages[0].Type)
+	assert.NotContains(t, string(messages[0].Payload), "hashed-password")
+	assert.Equal(t, OutboxTopic, messages[1].Topic)
+	assert.Equal(t, EventTodoCreated, messages[1].Type)
+	assert.Equal(t, EventTodoDeleted, messages[2].Type)
+
+	var payload struct {
+		UserIDs []int64 `json:"user_ids"`
+		Data    Todo    `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(messages[1].Payload, &payload))
+	assert.Equal(t, []int64{userID}, payload.UserIDs)
+	assert.Equal(t, todo.ID, payload.Data.ID)
+
+	// Relayed events invalidate the cache even when the change didn't get to, like after a crash
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	require.NoError(t, container.Redis.Set(ctx, cacheKey, "stale", time.Hour).Err())
+
+	relay := outbox.NewRelay(container.DB, container.Redis, 100)
+	relayed, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, relayed)
+
+	consumerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		outbox.NewConsumer(container.Redis, OutboxTopic, "todo-cache", service.HandleOutbox).Run(consumerCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool {
+		return container.Redis.Exists(ctx, cacheKey).Val() == 0
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestTodoReminderIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := createTestUser(t, "user@example.com")
+	otherID := createTestUser(t, "other@example.com")
+	ctx := createAuthenticatedContext(userID)
+
+	dueAt := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	todo, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Pay rent", DueAt: &dueAt})
+	require.NoError(t, err)
+	undated, err := service.Create(ctx, userID, &CreateTodoRequest{Title: "Someday"})
+	require.NoError(t, err)
+
+	reminderRequest := func(fn http.HandlerFunc, userID int64, method string, todoID int64, reminderID string, body any) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", strconv.FormatInt(todoID, 10))
+			r.SetPathValue("reminderID", reminderID)
+			fn(w, r.WithContext(createAuthenticatedContext(userID)))
+		}, test.HTTPRequest{
+			Method: method,
+			URL:    "/todos/reminders",
+			Body:   body,
+		})
+	}
+
+	minutes := 30
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name           string
+		userID         int64
+		todoID         int64
+		body           map[string]any
+		expectedStatus int
+		expectedMsg    string
+	}{
+		{name: "neither time nor offset", userID: userID, todoID: todo.ID, body: map[string]any{}, expectedStatus: http.StatusBadRequest},
+		{name: "both time and offset", userID: userID, todoID: todo.ID, body: map[string]any{"at": dueAt, "minutes_before": minutes}, expectedStatus: http.StatusBadRequest},
+		{name: "time in the past", userID: userID, todoID: todo.ID, body: map[string]any{"at": past}, expectedStatus: http.StatusBadRequest, expectedMsg: "invalid reminder: the reminder time is in the past"},
+		{name: "offset without due date", userID: userID, todoID: undated.ID, body: map[string]any{"minutes_before": minutes}, expectedStatus: http.StatusBadRequest, expectedMsg: "invalid reminder: the todo has no due date"},
+		{name: "unavailable channel", userID: userID, todoID: todo.ID, body: map[string]any{"minutes_before": minutes, "channel": "email"}, expectedStatus: http.StatusBadRequest, expectedMsg: "invalid reminder: the email channel is not available"},
+		{name: "todo of another user", userID: otherID, todoID: todo.ID, body: map[string]any{"minutes_before": minutes}, expectedStatus: http.StatusNotFound, expectedMsg: "todo not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := reminderRequest(handler.CreateReminder, tt.userID, http.MethodPost, tt.todoID, "", tt.body)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode, string(resp.RawBody))
+			if tt.expectedMsg != "" {
+				assert.Equal(t, tt.expectedMsg, resp.Body["message"])
+			}
+		})
+	}
+
+	// Relative reminders fire the given number of minutes before the todo is due
+	resp := reminderRequest(handler.CreateReminder, userID, http.MethodPost, todo.ID, "", map[string]any{"minutes_before": minutes})
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, "in_app", resp.Body["channel"])
+	fireAt, err := time.Parse(time.RFC3339, resp.Body["fire_at"].(string))
+	require.NoError(t, err)
+	assert.True(t, dueAt.Add(-30*time.Minute).Equal(fireAt))
+	relativeID := int64(resp.Body["id"].(float64))
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	resp = reminderRequest(handler.CreateReminder, userID, http.MethodPost, todo.ID, "", map[string]any{"at": at, "channel": "webhook"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	absoluteID := int64(resp.Body["id"].(float64))
+
+	resp = reminderRequest(handler.GetReminders, userID, http.MethodGet, todo.ID, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reminders []Reminder
+	require.NoError(t, json.Unmarshal(resp.RawBody, &reminders))
+	assert.Len(t, reminders, 2)
+
+	// Reminders are personal
+	resp = reminderRequest(handler.DeleteReminder, otherID, http.MethodDelete, todo.ID, strconv.FormatInt(relativeID, 10), nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "todo not found")
+
+	// Nothing is due yet
+	fired, err := service.FireDueReminders(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, fired)
+
+	// Moving the due date reschedules relative reminders, not absolute ones
+	soon := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	_, err = service.Update(ctx, userID, todo.ID, 0, &UpdateTodoRequest{Title: todo.Title, DueAt: &soon})
+	require.NoError(t, err)
+
+	relative, err := service.store.GetReminderByID(context.Background(), relativeID)
+	require.NoError(t, err)
+	assert.True(t, soon.Add(-30*time.Minute).Equal(*relative.FireAt))
+	absolute, err := service.store.GetReminderByID(context.Background(), absoluteID)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(*absolute.FireAt))
+
+	// Due reminders fire once, however many times they are fired
+	fired, err = service.FireDueReminders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, fired)
+	fired, err = service.FireDueReminders(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, fired)
+
+	var sendJobs []jobs.Job
+	require.NoError(t, sharedContainer.DB.Where("kind = ?", string(JobSendReminder)).Find(&sendJobs).Error)
+	require.Len(t, sendJobs, 1)
+	assert.JSONEq(t, fmt.Sprintf(`{"reminder_id":%d}`, relativeID), string(sendJobs[0].Args))
+
+	// Sending it lands in the inbox of its user
+	require.NoError(t, service.SendReminder(context.Background(), SendReminderArgs{ReminderID: relativeID}))
+	page, err := service.notifier.GetByUserID(context.Background(), userID, &notification.ListParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "todo.reminder", page.Data[0].Type)
+	assert.Equal(t, "Reminder: Pay rent", page.Data[0].Title)
+	assert.Equal(t, int64(1), page.UnreadCount)
+
+	// Reminders of completed or deleted todos are dropped
+	_, err = service.ToggleComplete(ctx, userID, todo.ID, 0, CompleteOccurrence)
+	require.NoError(t, err)
+	require.NoError(t, service.SendReminder(context.Background(), SendReminderArgs{ReminderID: relativeID}))
+	require.NoError(t, service.SendReminder(context.Background(), SendReminderArgs{ReminderID: -1}))
+	page, err = service.notifier.GetByUserID(context.Background(), userID, &notification.ListParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 1)
+
+	resp = reminderRequest(handler.DeleteReminder, userID, http.MethodDelete, todo.ID, strconv.FormatInt(absoluteID, 10), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = reminderRequest(handler.DeleteReminder, userID, http.MethodDelete, todo.ID, strconv.FormatInt(absoluteID, 10), nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "reminder not found")
+}
+
+func batchRequest(t *testing.T, handler *handler, userID int64, url string, ops []map[string]any) *test.HTTPResponse {
+	t.Helper()
+
+	return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		handler.Batch(w, r.WithContext(createAuthenticatedContext(userID)))
+	}, test.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    url,
+		Body:   map[string]any{"operations": ops},
+	})
+}
+
+func TestTodoBatchIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+
+	userID := int64(1)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "A"})
+	require.NoError(t, err)
+	other, err := service.Create(context.Background(), 2, &CreateTodoRequest{Title: "Other"})
+	require.NoError(t, err)
+
+	// Warm the cache, the batch must invalidate it
+	_, err = service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+
+	var before int64
+	require.NoError(t, container.DB.Model(&outbox.Message{}).Count(&before).Error)
+
+	resp := batchRequest(t, handler, userID, "/todos/batch", []map[string]any{
+		{"op": "create", "data": map[string]any{"title": "B"}},
+		{"op": "update", "id": todo.ID, "data": map[string]any{"title": "A2", "priority": "high"}},
+		{"op": "toggle", "id": todo.ID, "version": 2},
+		{"op": "move", "id": todo.ID, "data": map[string]any{"before": todo.ID}},
+		{"op": "toggle", "id": todo.ID, "version": 2},
+		{"op": "delete", "id": other.ID},
+		{"op": "create", "data": map[string]any{"description": "no title"}},
+		{"op": "archive", "id": todo.ID},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body BatchResponse
+	require.NoError(t, json.Unmarshal(resp.RawBody, &body))
+	require.Len(t, body.Results, 8)
+
+	var statuses []int
+	for _, result := range body.Results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []int{
+		http.StatusCreated,
+		http.StatusOK,
+		http.StatusOK,
+		http.StatusBadRequest,
+		http.StatusPreconditionFailed,
+		http.StatusNotFound,
+		http.StatusBadRequest,
+		http.StatusBadRequest,
+	}, statuses)
+
+	assert.Equal(t, "B", body.Results[0].Todo.Title)
+	assert.Equal(t, "A2", body.Results[1].Todo.Title)
+	assert.True(t, body.Results[2].Todo.Completed)
+	assert.Equal(t, int64(3), body.Results[2].Todo.Version)
+	assert.Contains(t, body.Results[3].Message, "invalid anchor")
+	assert.Equal(t, "todo has been modified", body.Results[4].Message)
+	assert.Equal(t, "todo not found", body.Results[5].Message)
+	assert.Contains(t, body.Results[6].Message, "invalid operation")
+	assert.Nil(t, body.Results[6].Todo)
+
+	// The applied operations are described by a single event, failed ones left no change in it
+	var messages []outbox.Message
+	require.NoError(t, container.DB.Order("id").Offset(int(before)).Find(&messages).Error)
+	require.Len(t, messages, 1)
+	assert.Equal(t, EventTodosBatched, messages[0].Type)
+	var payload struct {
+		UserIDs []int64      `json:"user_ids"`
+		Data    []batchEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(messages[0].Payload, &payload))
+	assert.Equal(t, []int64{userID}, payload.UserIDs)
+	require.Len(t, payload.Data, 3)
+	assert.Equal(t, EventTodoCreated, payload.Data[0].Type)
+	assert.Equal(t, "B", payload.Data[0].Todo.Title)
+	assert.Equal(t, EventTodoUpdated, payload.Data[1].Type)
+	assert.Equal(t, EventTodoToggled, payload.Data[2].Type)
+	assert.Equal(t, []int64{userID}, payload.Data[2].UserIDs)
+
+	// Applied operations are visible right away, failed ones left nothing behind
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "B", page.Data[0].Title)
+	assert.Equal(t, "A2", page.Data[1].Title)
+	assert.True(t, page.Data[1].Completed)
+
+	_, err = service.GetByID(context.Background(), 2, other.ID)
+	require.NoError(t, err)
+
+	// Deletes have no todo in their result
+	resp = batchRequest(t, handler, userID, "/todos/batch", []map[string]any{
+		{"op": "delete", "id": todo.ID},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []any{map[string]any{"status": float64(http.StatusNoContent)}}, resp.Body["results"])
+
+	exists, err := container.Redis.Exists(context.Background(), fmt.Sprintf("todos:user:%d", userID)).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
+
+func TestTodoBatchAtomicIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+
+	userID := int64(1)
+	todo, err := service.Create(context.Background(), userID, &CreateTodoRequest{Title: "A"})
+	require.NoError(t, err)
+
+	// A failing operation rolls back the ones before it
+	resp := batchRequest(t, handler, userID, "/todos/batch?atomic=true", []map[string]any{
+		{"op": "create", "data": map[string]any{"title": "B"}},
+		{"op": "update", "id": todo.ID, "data": map[string]any{"title": "A2"}},
+		{"op": "toggle", "id": 999999},
+	})
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "todo not found", resp.Body["message"])
+	assert.Equal(t, float64(2), resp.Body["index"])
+
+	page, err := service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "A", page.Data[0].Title)
+	assert.Equal(t, int64(1), page.Data[0].Version)
+
+	resp = batchRequest(t, handler, userID, "/todos/batch?atomic=true", []map[string]any{
+		{"op": "create", "data": map[string]any{}},
+	})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, float64(0), resp.Body["index"])
+
+	// Later operations see the changes of earlier ones
+	resp = batchRequest(t, handler, userID, "/todos/batch?atomic=true", []map[string]any{
+		{"op": "create", "data": map[string]any{"title": "B"}},
+		{"op": "update", "id": todo.ID, "version": 1, "data": map[string]any{"title": "A2"}},
+		{"op": "toggle", "id": todo.ID, "version": 2},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body BatchResponse
+	require.NoError(t, json.Unmarshal(resp.RawBody, &body))
+	require.Len(t, body.Results, 3)
+	assert.Equal(t, http.StatusCreated, body.Results[0].Status)
+	assert.Equal(t, http.StatusOK, body.Results[2].Status)
+	assert.Equal(t, "A2", body.Results[2].Todo.Title)
+	assert.True(t, body.Results[2].Todo.Completed)
+
+	page, err = service.GetByUserID(context.Background(), userID, &ListParams{Limit: DefaultPageLimit})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+
+	// Invalid batches are refused as a whole
+	resp = batchRequest(t, handler, userID, "/todos/batch?atomic=maybe", []map[string]any{
+		{"op": "delete", "id": todo.ID},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "invalid query parameter: atomic")
+
+	resp = batchRequest(t, handler, userID, "/todos/batch", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	ops := make([]map[string]any, maxBatchOperations+1)
+	for i := range ops {
+		ops[i] = map[string]any{"op": "toggle", "id": todo.ID}
+	}
+	resp = batchRequest(t, handler, userID, "/todos/batch", ops)
+	test.AssertErrorResponse(t, resp, http.StatusBadRequest, "a batch takes at most 100 operations")
+
+	resp = batchRequest(t, handler, userID, "/todos/batch", []map[string]any{
+		{"op": "create", "data": map[string]any{"title": "Huge", "description": strings.Repeat("a", maxBatchSize)}},
+	})
+	test.AssertErrorResponse(t, resp, http.StatusRequestEntityTooLarge, "batch too large")
+}
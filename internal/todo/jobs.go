@@ -0,0 +1,129 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
+)
+
+// Kinds of the background jobs of todos
+const (
+	JobPurgeTrash     jobs.Kind[PurgeTrashArgs]     = "todo.purge_trash"
+	JobPurgeExports   jobs.Kind[PurgeExportsArgs]   = "todo.purge_exports"
+	JobGenerateExport jobs.Kind[GenerateExportArgs] = "todo.generate_export"
+	JobFireReminders  jobs.Kind[FireRemindersArgs]  = "todo.fire_reminders"
+	JobSendReminder   jobs.Kind[SendReminderArgs]   = "todo.send_reminder"
+	// JobBackfillPositions is a one-off job, enqueued by the server on start
+	JobBackfillPositions jobs.Kind[BackfillPositionsArgs] = "todo.backfill_positions"
+)
+
+const (
+	// purgeInterval is how often expired trash and export files are purged
+	purgeInterval = time.Hour
+	// purgeTimeout is how long a purge may take before it is attempted again
+	purgeTimeout = 10 * time.Minute
+	// exportTimeout is how long generating an export file may take before it is attempted again
+	exportTimeout = 10 * time.Minute
+	// reminderInterval is how often due reminders are fired, the precision of reminders
+	reminderInterval = time.Minute
+	// reminderTimeout is how long firing or sending reminders may take before it is attempted again
+	reminderTimeout = time.Minute
+	// reminderBatchSize is how many due reminders are fired per transaction
+	reminderBatchSize = 100
+	// backfillTimeout is how long giving positions to todos may take before it is attempted again
+	backfillTimeout = 30 * time.Minute
+)
+
+// PurgeTrashArgs represents the arguments of the job purging expired trash, which has none
+type PurgeTrashArgs struct{}
+
+// PurgeExportsArgs represents the arguments of the job purging expired export files, which
+// has none
+type PurgeExportsArgs struct{}
+
+// GenerateExportArgs represents the arguments of the job generating a requested export file
+type GenerateExportArgs struct {
+	ExportID int64 `json:"export_id"`
+	UserID   int64 `json:"user_id"`
+}
+
+// FireRemindersArgs represents the arguments of the job firing due reminders, which has none
+type FireRemindersArgs struct{}
+
+// SendReminderArgs represents the arguments of the job sending a fired reminder
+type SendReminderArgs struct {
+	ReminderID int64 `json:"reminder_id"`
+}
+
+// BackfillPositionsArgs represents the arguments of the job giving a position to the todos
+// created before manual ordering, which has none
+type BackfillPositionsArgs struct{}
+
+// EnqueueBackfillPositions enqueues the job giving a position to the todos created before
+// manual ordering, unless it is already pending or running. Every server enqueues it on start,
+// so that upgraded databases are backfilled without holding up the start of the servers.
+func (s *Service) EnqueueBackfillPositions(ctx context.Context) error {
+	_, err := jobs.Enqueue(ctx, s.jobs, JobBackfillPositions, BackfillPositionsArgs{}, jobs.Unique(string(JobBackfillPositions)))
+	if err != nil && !errors.Is(err, jobs.ErrDuplicate) {
+		return err
+	}
+	return nil
+}
+
+// RegisterJobs registers the background jobs of todos with a worker, and schedules the
+// periodic ones. Todos are purged from the trash once they have been there for longer than
+// the retention period, unless it is zero.
+func (s *Service) RegisterJobs(w *jobs.Worker, trashRetention time.Duration) {
+	jobs.Handle(w, JobPurgeTrash, purgeTimeout, func(ctx context.Context, _ PurgeTrashArgs) error {
+		if trashRetention <= 0 {
+			return nil
+		}
+		purged, err := s.PurgeExpiredTrash(ctx, trashRetention)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Info().Msgf("purged %d expired todos from trash", purged)
+		}
+		return nil
+	})
+
+	jobs.Handle(w, JobPurgeExports, purgeTimeout, func(ctx context.Context, _ PurgeExportsArgs) error {
+		purged, err := s.PurgeExpiredExports(ctx)
+		if purged > 0 {
+			log.Info().Msgf("purged %d expired export files", purged)
+		}
+		return err
+	})
+
+	jobs.Handle(w, JobGenerateExport, exportTimeout, s.GenerateExport)
+
+	jobs.Handle(w, JobFireReminders, reminderTimeout, func(ctx context.Context, _ FireRemindersArgs) error {
+		fired, err := s.FireDueReminders(ctx)
+		if fired > 0 {
+			log.Info().Msgf("fired %d due reminders", fired)
+		}
+		return err
+	})
+
+	jobs.Handle(w, JobSendReminder, reminderTimeout, s.SendReminder)
+
+	jobs.Handle(w, JobBackfillPositions, backfillTimeout, func(ctx context.Context, _ BackfillPositionsArgs) error {
+		backfilled, err := s.BackfillPositions(ctx)
+		if backfilled > 0 {
+			log.Info().Msgf("gave a position to the todos of %d users", backfilled)
+		}
+		return err
+	})
+
+	if trashRetention > 0 {
+		jobs.Schedule(w, JobPurgeTrash, purgeInterval)
+	} else {
+		log.Info().Msg("trash retention is disabled, trashed todos are kept until purged")
+	}
+	jobs.Schedule(w, JobPurgeExports, purgeInterval)
+	jobs.Schedule(w, JobFireReminders, reminderInterval)
+}
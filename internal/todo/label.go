@@ -0,0 +1,56 @@
+package todo
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLabelNotFound is returned when a requested label cannot be found
+	ErrLabelNotFound = errors.New("label not found")
+	// ErrLabelAlreadyExists is returned when a user already has a label with the same name
+	ErrLabelAlreadyExists = errors.New("label already exists")
+)
+
+// Label represents a free-form user label that can be attached to todos
+type Label struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id" gorm:"uniqueIndex:idx_labels_user_name,priority:1"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_labels_user_name,priority:2"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewLabel creates a new label with the given name and color
+func NewLabel(userID int64, name, color string) *Label {
+	now := time.Now()
+	return &Label{
+		UserID:    userID,
+		Name:      normalizeName(name),
+		Color:     normalizeColor(color),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Rename changes the name of the label
+func (l *Label) Rename(name string) {
+	l.Name = normalizeName(name)
+}
+
+// SetColor changes the color of the label
+func (l *Label) SetColor(color string) {
+	l.Color = normalizeColor(color)
+}
+
+// normalizeName trims the surrounding whitespace of a label or project name
+func normalizeName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// normalizeColor lowercases a hex color so that equal colors compare equal
+func normalizeColor(color string) string {
+	return strings.ToLower(color)
+}
@@ -0,0 +1,30 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLabel(t *testing.T) {
+	userID := int64(123)
+
+	label := NewLabel(userID, "  Work  ", "#FFAA00")
+
+	assert.Equal(t, userID, label.UserID)
+	assert.Equal(t, "Work", label.Name)
+	assert.Equal(t, "#ffaa00", label.Color)
+	assert.WithinDuration(t, time.Now(), label.CreatedAt, time.Second)
+	assert.WithinDuration(t, time.Now(), label.UpdatedAt, time.Second)
+}
+
+func TestLabel_RenameAndSetColor(t *testing.T) {
+	label := NewLabel(123, "Work", "")
+
+	label.Rename(" Office ")
+	label.SetColor("#ABCDEF")
+
+	assert.Equal(t, "Office", label.Name)
+	assert.Equal(t, "#abcdef", label.Color)
+}
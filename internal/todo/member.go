@@ -0,0 +1,128 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPermissionDenied is returned when a user can see a todo or project but their role doesn't allow the operation
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvalidRole is returned when a role cannot be parsed
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrMemberNotFound is returned when a user isn't a member of the project
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrAlreadyMember is returned when inviting the owner or a member of the project
+	ErrAlreadyMember = errors.New("user is already a member")
+	// ErrInvitationNotFound is returned when a requested invitation cannot be found
+	ErrInvitationNotFound = errors.New("invitation not found")
+)
+
+// Role is the access level of a user to a project and its todos
+type Role string
+
+const (
+	// RoleViewer can read the project and its todos
+	RoleViewer Role = "viewer"
+	// RoleEditor can also create, change and delete todos of the project
+	RoleEditor Role = "editor"
+	// RoleOwner can also change the project and manage who it is shared with
+	RoleOwner Role = "owner"
+)
+
+// ParseRole parses a role from its name
+func ParseRole(s string) (Role, error) {
+	switch role := Role(strings.ToLower(s)); role {
+	case RoleViewer, RoleEditor, RoleOwner:
+		return role, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, s)
+	}
+}
+
+// level orders roles from the least to the most privileged, unknown roles have none
+func (r Role) level() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether the role grants at least the access of the required one
+func (r Role) Allows(required Role) bool {
+	return r.level() > 0 && r.level() >= required.level()
+}
+
+// Member represents a user a project is shared with. The user that created the project
+// owns it without being a member.
+type Member struct {
+	ProjectID int64     `json:"project_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    int64     `json:"user_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName keeps the members of all projects in a project_members table
+func (Member) TableName() string {
+	return "project_members"
+}
+
+// Invitation represents a pending invitation to a project, addressed to an email address.
+// It is accepted by the user whose account has that email.
+type Invitation struct {
+	ID        int64     `json:"id"`
+	ProjectID int64     `json:"project_id" gorm:"uniqueIndex:idx_project_invitations_project_email,priority:1"`
+	Email     string    `json:"email" gorm:"uniqueIndex:idx_project_invitations_project_email,priority:2;index"`
+	Role      Role      `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName keeps the invitations of all projects in a project_invitations table
+func (Invitation) TableName() string {
+	return "project_invitations"
+}
+
+// NewInvitation creates an invitation to a project with the given role
+func NewInvitation(projectID int64, email string, role Role, invitedBy int64) *Invitation {
+	return &Invitation{
+		ProjectID: projectID,
+		Email:     normalizeEmail(email),
+		Role:      role,
+		InvitedBy: invitedBy,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Addressed reports whether the invitation is addressed to the given email
+func (i *Invitation) Addressed(email string) bool {
+	return i.Email == normalizeEmail(email)
+}
+
+// Accept turns the invitation into the membership of the given user
+func (i *Invitation) Accept(userID int64) *Member {
+	now := time.Now()
+	return &Member{
+		ProjectID: i.ProjectID,
+		UserID:    userID,
+		Email:     i.Email,
+		Role:      i.Role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// normalizeEmail trims and lowercases an email so that invitations match regardless of case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,69 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Role
+		wantErr  bool
+	}{
+		{input: "viewer", expected: RoleViewer},
+		{input: "Editor", expected: RoleEditor},
+		{input: "OWNER", expected: RoleOwner},
+		{input: "admin", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			role, err := ParseRole(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRole)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, role)
+		})
+	}
+}
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, RoleViewer.Allows(RoleViewer))
+	assert.False(t, RoleViewer.Allows(RoleEditor))
+	assert.True(t, RoleEditor.Allows(RoleViewer))
+	assert.False(t, RoleEditor.Allows(RoleOwner))
+	assert.True(t, RoleOwner.Allows(RoleEditor))
+	assert.True(t, RoleOwner.Allows(RoleOwner))
+	assert.False(t, Role("").Allows(RoleViewer))
+	assert.False(t, Role("admin").Allows(Role("admin")))
+}
+
+func TestNewInvitation(t *testing.T) {
+	invitation := NewInvitation(7, "  Alice@Example.COM ", RoleEditor, 123)
+
+	assert.Equal(t, int64(7), invitation.ProjectID)
+	assert.Equal(t, "alice@example.com", invitation.Email)
+	assert.Equal(t, RoleEditor, invitation.Role)
+	assert.Equal(t, int64(123), invitation.InvitedBy)
+	assert.WithinDuration(t, time.Now(), invitation.CreatedAt, time.Second)
+
+	assert.True(t, invitation.Addressed("ALICE@example.com"))
+	assert.False(t, invitation.Addressed("bob@example.com"))
+}
+
+func TestInvitation_Accept(t *testing.T) {
+	invitation := NewInvitation(7, "alice@example.com", RoleViewer, 123)
+
+	member := invitation.Accept(456)
+
+	assert.Equal(t, int64(7), member.ProjectID)
+	assert.Equal(t, int64(456), member.UserID)
+	assert.Equal(t, "alice@example.com", member.Email)
+	assert.Equal(t, RoleViewer, member.Role)
+}
@@ -0,0 +1,73 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"gorm.io/gorm"
+)
+
+// OutboxTopic is the outbox topic the domain events of todos are published on
+const OutboxTopic = "todos"
+
+// Types of the domain events written to the outbox besides those streamed to users
+const (
+	EventTodoRestored   = "todo.restored"
+	EventTodoMoved      = "todo.moved"
+	EventTodosImported  = "todos.imported"
+	EventTodosBatched   = "todos.batched"
+	EventCommentCreated = "comment.created"
+	EventCommentDeleted = "comment.deleted"
+	EventLabelUpdated   = "label.updated"
+	EventLabelDeleted   = "label.deleted"
+	EventProjectUpdated = "project.updated"
+	EventProjectDeleted = "project.deleted"
+	EventMemberJoined   = "member.joined"
+	EventMemberRemoved  = "member.removed"
+)
+
+// change is the payload of the domain events of todos, what changed along with the users
+// whose todo lists it affects. Left are those among them who don't see a moved todo anymore.
+type change struct {
+	UserIDs []int64 `json:"user_ids"`
+	Left    []int64 `json:"left_user_ids,omitempty"`
+	Data    any     `json:"data"`
+}
+
+// emit writes a domain event to the outbox within the transaction of the change it describes,
+// so that the event is published if and only if the change is committed
+func (s *Service) emit(ctx context.Context, tx *gorm.DB, eventType string, userIDs []int64, data any) error {
+	return s.emitChange(ctx, tx, eventType, change{UserIDs: userIDs, Data: data})
+}
+
+// emitChange writes a domain event describing the given change to the outbox, like emit
+func (s *Service) emitChange(ctx context.Context, tx *gorm.DB, eventType string, c change) error {
+	if err := s.outbox.Add(ctx, OutboxTopic, eventType, c, db.WithTx(tx)); err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+// HandleOutbox handles a domain event of todos relayed from the outbox by invalidating the
+// cached todo lists of the users it affects. Changes already invalidate them once committed,
+// this catches up when that didn't happen, like when the instance crashed in between.
+func (s *Service) HandleOutbox(ctx context.Context, event outbox.Event) error {
+	var c change
+	if err := json.Unmarshal(event.Payload, &c); err != nil {
+		// Retrying wouldn't make it any less malformed
+		log.Error().Err(err).Msgf("skipping malformed %s event %s", event.Type, event.ID)
+		return nil
+	}
+
+	for _, userID := range c.UserIDs {
+		cacheKey := fmt.Sprintf("todos:user:%d", userID)
+		if err := s.cache.Delete(ctx, cacheKey); err != nil {
+			return fmt.Errorf("failed to invalidate todo cache: %w", err)
+		}
+	}
+	return nil
+}
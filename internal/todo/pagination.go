@@ -0,0 +1,64 @@
+package todo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// DefaultPageLimit is the number of todos returned when no limit is requested
+const DefaultPageLimit = 20
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// TodoPage represents a single page of todos along with the cursor of the next page
+type TodoPage struct {
+	Data       []Todo `json:"data"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// cursor represents the keyset position of the last todo of a page. The sort
+// is recorded so a cursor can't be replayed against a differently ordered list.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+// encode returns the opaque string representation of the cursor
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// encodeCursor builds an opaque cursor pointing right after the given todo
+func encodeCursor(sort sortOrder, todo *Todo) string {
+	return cursor{Sort: sort.String(), Value: sort.value(todo), ID: todo.ID}.encode()
+}
+
+// decodeCursor parses an opaque cursor issued for the given sort, returning nil for an empty one
+func decodeCursor(s string, sort sortOrder) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 || c.Sort != sort.String() {
+		return nil, ErrInvalidCursor
+	}
+
+	if _, err := sort.parseValue(c.Value); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
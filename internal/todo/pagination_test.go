@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC)
+	todo := &Todo{ID: 42, Title: "Write docs", Position: "a0V", CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	tests := []struct {
+		sort          string
+		expectedValue string
+	}{
+		{sort: "-created_at", expectedValue: "2024-05-01T10:30:00.123456Z"},
+		{sort: "updated_at", expectedValue: "2024-05-01T10:30:00.123456Z"},
+		{sort: "title", expectedValue: "Write docs"},
+		{sort: "position", expectedValue: "a0V"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			sort := parseSort(tt.sort)
+
+			encoded := encodeCursor(sort, todo)
+			assert.NotEmpty(t, encoded)
+
+			decoded, err := decodeCursor(encoded, sort)
+			require.NoError(t, err)
+			assert.Equal(t, int64(42), decoded.ID)
+			assert.Equal(t, tt.sort, decoded.Sort)
+			assert.Equal(t, tt.expectedValue, decoded.Value)
+		})
+	}
+}
+
+func TestTrashCursor_RoundTrip(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC)
+	todo := &Todo{ID: 42, DeletedAt: gorm.DeletedAt{Time: deletedAt, Valid: true}}
+
+	encoded := encodeCursor(trashSort, todo)
+
+	decoded, err := decodeCursor(encoded, trashSort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), decoded.ID)
+	assert.Equal(t, "2024-05-01T10:30:00.123456Z", decoded.Value)
+
+	// Trash cursors can't be replayed against the todo list
+	_, err = decodeCursor(encoded, parseSort(DefaultSort))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestDecodeCursor_Empty(t *testing.T) {
+	decoded, err := decodeCursor("", parseSort(DefaultSort))
+
+	assert.NoError(t, err)
+	assert.Nil(t, decoded)
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not json", cursor: encode("not-json")},
+		{name: "missing id", cursor: encode(`{"s":"-created_at","v":"2024-05-01T10:30:00Z"}`)},
+		{name: "different sort", cursor: encode(`{"s":"title","v":"Write docs","i":1}`)},
+		{name: "malformed time value", cursor: encode(`{"s":"-created_at","v":"yesterday","i":1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor, parseSort("-created_at"))
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package todo
+
+import "errors"
+
+var (
+	// ErrInvalidPriority is returned when a priority name is not recognized
+	ErrInvalidPriority = errors.New("invalid priority")
+)
+
+// Priority represents how important a todo is
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+// priorityNames holds the string representation of each Priority, indexed by value
+var priorityNames = [...]string{"none", "low", "medium", "high", "urgent"}
+
+// String returns the string representation of the Priority enum
+func (p Priority) String() string {
+	if p < PriorityNone || int(p) >= len(priorityNames) {
+		return priorityNames[PriorityNone]
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority returns the Priority with the given name, an empty name meaning none
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return PriorityNone, nil
+	}
+
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+
+	return PriorityNone, ErrInvalidPriority
+}
@@ -0,0 +1,46 @@
+package todo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority_String(t *testing.T) {
+	assert.Equal(t, "none", PriorityNone.String())
+	assert.Equal(t, "low", PriorityLow.String())
+	assert.Equal(t, "medium", PriorityMedium.String())
+	assert.Equal(t, "high", PriorityHigh.String())
+	assert.Equal(t, "urgent", PriorityUrgent.String())
+	assert.Equal(t, "none", Priority(42).String())
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Priority
+		wantErr  bool
+	}{
+		{name: "", expected: PriorityNone},
+		{name: "none", expected: PriorityNone},
+		{name: "low", expected: PriorityLow},
+		{name: "medium", expected: PriorityMedium},
+		{name: "high", expected: PriorityHigh},
+		{name: "urgent", expected: PriorityUrgent},
+		{name: "URGENT", wantErr: true},
+		{name: "critical", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priority, err := ParsePriority(tt.name)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPriority)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, priority)
+		})
+	}
+}
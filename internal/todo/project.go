@@ -0,0 +1,64 @@
+package todo
+
+import (
+	"errors"
+	"time"
+)
+
+// InboxName is the name of the project todos go to when no other one is given
+const InboxName = "Inbox"
+
+var (
+	// ErrProjectNotFound is returned when a requested project cannot be found
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrInboxProject is returned when attempting to rename, archive or delete the inbox
+	ErrInboxProject = errors.New("inbox project cannot be changed")
+)
+
+// Project represents a user list that groups todos together
+type Project struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id" gorm:"index:idx_projects_user_position,priority:1;uniqueIndex:idx_projects_user_inbox,where:inbox"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Archived  bool      `json:"archived"`
+	Position  int       `json:"position" gorm:"index:idx_projects_user_position,priority:2"`
+	Inbox     bool      `json:"inbox"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Role is the role of the user the project was loaded for, it isn't stored
+	Role        Role         `json:"role" gorm:"-"`
+	Members     []Member     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Invitations []Invitation `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// NewProject creates a new project with the given details
+func NewProject(userID int64, name, color string, position int) *Project {
+	now := time.Now()
+	return &Project{
+		UserID:    userID,
+		Name:      normalizeName(name),
+		Color:     normalizeColor(color),
+		Position:  position,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Rename changes the name of the project
+func (p *Project) Rename(name string) {
+	p.Name = normalizeName(name)
+}
+
+// SetColor changes the color of the project
+func (p *Project) SetColor(color string) {
+	p.Color = normalizeColor(color)
+}
+
+// NewInbox creates the default project of a user, which always comes first
+func NewInbox(userID int64) *Project {
+	inbox := NewProject(userID, InboxName, "", 0)
+	inbox.Inbox = true
+	return inbox
+}
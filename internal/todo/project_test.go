@@ -0,0 +1,42 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProject(t *testing.T) {
+	userID := int64(123)
+
+	project := NewProject(userID, "  Groceries ", "#00AA00", 3)
+
+	assert.Equal(t, userID, project.UserID)
+	assert.Equal(t, "Groceries", project.Name)
+	assert.Equal(t, "#00aa00", project.Color)
+	assert.Equal(t, 3, project.Position)
+	assert.False(t, project.Archived)
+	assert.False(t, project.Inbox)
+	assert.WithinDuration(t, time.Now(), project.CreatedAt, time.Second)
+	assert.WithinDuration(t, time.Now(), project.UpdatedAt, time.Second)
+}
+
+func TestNewInbox(t *testing.T) {
+	inbox := NewInbox(123)
+
+	assert.Equal(t, int64(123), inbox.UserID)
+	assert.Equal(t, InboxName, inbox.Name)
+	assert.Equal(t, 0, inbox.Position)
+	assert.True(t, inbox.Inbox)
+}
+
+func TestProject_RenameAndSetColor(t *testing.T) {
+	project := NewProject(123, "Work", "", 1)
+
+	project.Rename(" Office ")
+	project.SetColor("#ABCDEF")
+
+	assert.Equal(t, "Office", project.Name)
+	assert.Equal(t, "#abcdef", project.Color)
+}
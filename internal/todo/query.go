@@ -0,0 +1,193 @@
+package todo
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSort is the order applied when a list request doesn't ask for one,
+// the manual order of the user's todos
+const DefaultSort = "position"
+
+var (
+	// ErrInvalidQueryParam is returned when a list query parameter cannot be parsed
+	ErrInvalidQueryParam = errors.New("invalid query parameter")
+)
+
+// ListParams represents the filtering, sorting and pagination parameters for listing todos
+type ListParams struct {
+	ProjectID     *int64
+	Completed     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedSince  *time.Time
+	Due           string `validate:"omitempty,oneof=overdue today week"`
+	Timezone      string `validate:"omitempty,timezone"`
+	Label         string `validate:"omitempty,max=64"`
+	Sort          string `validate:"omitempty,oneof=position -position created_at -created_at updated_at -updated_at title -title"`
+	Limit         int    `validate:"min=1,max=100"`
+	Cursor        string
+}
+
+// location returns the timezone due filters are computed in, UTC by default
+func (p *ListParams) location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(p.Timezone)
+}
+
+// cacheField returns a canonical representation of the parameters, so that
+// every distinct combination of filters, sort and page is cached separately.
+// The due filter is part of it as its resolved range, which moves with time.
+func (p *ListParams) cacheField(due *dueRange) string {
+	values := url.Values{}
+	if p.ProjectID != nil {
+		values.Set("project", strconv.FormatInt(*p.ProjectID, 10))
+	}
+	if p.Completed != nil {
+		values.Set("completed", strconv.FormatBool(*p.Completed))
+	}
+	if p.CreatedAfter != nil {
+		values.Set("created_after", p.CreatedAfter.UTC().Format(time.RFC3339Nano))
+	}
+	if p.CreatedBefore != nil {
+		values.Set("created_before", p.CreatedBefore.UTC().Format(time.RFC3339Nano))
+	}
+	if p.UpdatedSince != nil {
+		values.Set("updated_since", p.UpdatedSince.UTC().Format(time.RFC3339Nano))
+	}
+	if due != nil {
+		values.Set("due", p.Due)
+		if due.From != nil {
+			values.Set("due_from", due.From.UTC().Format(time.RFC3339Nano))
+		}
+		values.Set("due_before", due.Before.UTC().Format(time.RFC3339Nano))
+	}
+	if p.Label != "" {
+		values.Set("label", p.Label)
+	}
+	values.Set("sort", p.sort().String())
+	values.Set("limit", strconv.Itoa(p.Limit))
+	values.Set("cursor", p.Cursor)
+
+	// Encode sorts the keys, which makes the result independent of insertion order
+	return values.Encode()
+}
+
+// sort returns the parsed sort order of the parameters
+func (p *ListParams) sort() sortOrder {
+	if p.Sort == "" {
+		return parseSort(DefaultSort)
+	}
+	return parseSort(p.Sort)
+}
+
+// sortOrder represents the column a todo list is ordered by and its direction.
+// The todo ID is always used as a tie-breaker so the order is total.
+type sortOrder struct {
+	column string
+	desc   bool
+}
+
+// parseSort parses a sort parameter such as "title" or "-updated_at"
+func parseSort(s string) sortOrder {
+	if column, ok := strings.CutPrefix(s, "-"); ok {
+		return sortOrder{column: column, desc: true}
+	}
+	return sortOrder{column: s}
+}
+
+// valid reports whether the todo list can be ordered by the sort column
+func (o sortOrder) valid() bool {
+	switch o.column {
+	case "position", "created_at", "updated_at", "title":
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the sort parameter representation of the order
+func (o sortOrder) String() string {
+	if o.desc {
+		return "-" + o.column
+	}
+	return o.column
+}
+
+// value returns the sort column value of a todo, as stored in a cursor
+func (o sortOrder) value(todo *Todo) string {
+	switch o.column {
+	case "updated_at":
+		return todo.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "title":
+		return todo.Title
+	case "position":
+		return todo.Position
+	case "deleted_at":
+		return todo.DeletedAt.Time.UTC().Format(time.RFC3339Nano)
+	default:
+		return todo.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// parseValue converts a cursor value back to the type of the sort column
+func (o sortOrder) parseValue(v string) (any, error) {
+	switch o.column {
+	case "title", "position":
+		return v, nil
+	case "rank":
+		return strconv.ParseFloat(v, 32)
+	default:
+		return time.Parse(time.RFC3339Nano, v)
+	}
+}
+
+// dueRange is a due filter resolved to absolute time bounds
+type dueRange struct {
+	From    *time.Time
+	Before  time.Time
+	Overdue bool
+}
+
+// resolveDueRange computes the bounds of a due filter at the given time in the
+// user's timezone. Days and weeks start at local midnight, so they may last
+// 23 or 25 hours around DST changes. Weeks start on Monday.
+func resolveDueRange(due string, now time.Time, loc *time.Location) *dueRange {
+	now = now.In(loc)
+	year, month, day := now.Date()
+	startOfToday := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	switch due {
+	case "overdue":
+		// Truncated so that cached pages are reused within the same minute
+		return &dueRange{Before: now.Truncate(time.Minute), Overdue: true}
+	case "today":
+		return &dueRange{From: &startOfToday, Before: time.Date(year, month, day+1, 0, 0, 0, 0, loc)}
+	case "week":
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		startOfWeek := time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, loc)
+		return &dueRange{From: &startOfWeek, Before: time.Date(year, month, day-daysSinceMonday+7, 0, 0, 0, 0, loc)}
+	default:
+		return nil
+	}
+}
+
+// listQuery is the typed query the store runs to list a user's todos
+type listQuery struct {
+	UserID        int64
+	ProjectID     *int64
+	Completed     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedSince  *time.Time
+	Due           *dueRange
+	Label         string
+	Sort          sortOrder
+	After         *cursor
+	Limit         int
+}
@@ -0,0 +1,178 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected sortOrder
+		valid    bool
+	}{
+		{input: "created_at", expected: sortOrder{column: "created_at"}, valid: true},
+		{input: "-updated_at", expected: sortOrder{column: "updated_at", desc: true}, valid: true},
+		{input: "title", expected: sortOrder{column: "title"}, valid: true},
+		{input: "position", expected: sortOrder{column: "position"}, valid: true},
+		{input: "-password", expected: sortOrder{column: "password", desc: true}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			sort := parseSort(tt.input)
+
+			assert.Equal(t, tt.expected, sort)
+			assert.Equal(t, tt.valid, sort.valid())
+			assert.Equal(t, tt.input, sort.String())
+		})
+	}
+}
+
+func TestListParams_DefaultSort(t *testing.T) {
+	params := &ListParams{Limit: DefaultPageLimit}
+
+	assert.Equal(t, sortOrder{column: "position"}, params.sort())
+}
+
+func TestListParams_CacheField(t *testing.T) {
+	completed := true
+	notCompleted := false
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sinceOtherZone := since.In(time.FixedZone("UTC+7", 7*60*60))
+
+	unfiltered := &ListParams{Limit: 20}
+	filtered := &ListParams{Limit: 20, Completed: &completed}
+	filteredOpposite := &ListParams{Limit: 20, Completed: &notCompleted}
+	sorted := &ListParams{Limit: 20, Sort: "title"}
+	explicitDefaultSort := &ListParams{Limit: 20, Sort: DefaultSort}
+	updatedSince := &ListParams{Limit: 20, UpdatedSince: &since}
+	updatedSinceOtherZone := &ListParams{Limit: 20, UpdatedSince: &sinceOtherZone}
+	labeled := &ListParams{Limit: 20, Label: "work"}
+	otherLabel := &ListParams{Limit: 20, Label: "home"}
+	inProject := &ListParams{Limit: 20, ProjectID: ptr(int64(1))}
+	inOtherProject := &ListParams{Limit: 20, ProjectID: ptr(int64(2))}
+
+	// Different filters and sorts must never share a cache entry
+	assert.NotEqual(t, unfiltered.cacheField(nil), filtered.cacheField(nil))
+	assert.NotEqual(t, filtered.cacheField(nil), filteredOpposite.cacheField(nil))
+	assert.NotEqual(t, unfiltered.cacheField(nil), sorted.cacheField(nil))
+	assert.NotEqual(t, unfiltered.cacheField(nil), updatedSince.cacheField(nil))
+	assert.NotEqual(t, unfiltered.cacheField(nil), labeled.cacheField(nil))
+	assert.NotEqual(t, labeled.cacheField(nil), otherLabel.cacheField(nil))
+	assert.NotEqual(t, unfiltered.cacheField(nil), inProject.cacheField(nil))
+	assert.NotEqual(t, inProject.cacheField(nil), inOtherProject.cacheField(nil))
+
+	// Equivalent parameters must share the same cache entry
+	assert.Equal(t, unfiltered.cacheField(nil), explicitDefaultSort.cacheField(nil))
+	assert.Equal(t, updatedSince.cacheField(nil), updatedSinceOtherZone.cacheField(nil))
+}
+
+func TestListParams_CacheFieldDueRange(t *testing.T) {
+	params := &ListParams{Limit: 20, Due: "today"}
+	loc := time.UTC
+
+	monday := resolveDueRange("today", time.Date(2024, 5, 6, 9, 0, 0, 0, loc), loc)
+	mondayLater := resolveDueRange("today", time.Date(2024, 5, 6, 18, 0, 0, 0, loc), loc)
+	tuesday := resolveDueRange("today", time.Date(2024, 5, 7, 9, 0, 0, 0, loc), loc)
+
+	// The same day shares a cache entry, a new day doesn't
+	assert.Equal(t, params.cacheField(monday), params.cacheField(mondayLater))
+	assert.NotEqual(t, params.cacheField(monday), params.cacheField(tuesday))
+	assert.NotEqual(t, params.cacheField(nil), params.cacheField(monday))
+}
+
+func TestResolveDueRange(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		due             string
+		now             time.Time
+		loc             *time.Location
+		expectedFrom    *time.Time
+		expectedBefore  time.Time
+		expectedOverdue bool
+	}{
+		{
+			name:            "overdue is truncated to the minute",
+			due:             "overdue",
+			now:             time.Date(2024, 5, 8, 10, 15, 42, 0, time.UTC),
+			loc:             time.UTC,
+			expectedBefore:  time.Date(2024, 5, 8, 10, 15, 0, 0, time.UTC),
+			expectedOverdue: true,
+		},
+		{
+			name:           "today in utc",
+			due:            "today",
+			now:            time.Date(2024, 5, 8, 10, 15, 0, 0, time.UTC),
+			loc:            time.UTC,
+			expectedFrom:   ptr(time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)),
+			expectedBefore: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:           "today follows the user's timezone",
+			due:            "today",
+			now:            time.Date(2024, 5, 8, 20, 0, 0, 0, time.UTC), // already May 9th in Jakarta
+			loc:            jakarta,
+			expectedFrom:   ptr(time.Date(2024, 5, 9, 0, 0, 0, 0, jakarta)),
+			expectedBefore: time.Date(2024, 5, 10, 0, 0, 0, 0, jakarta),
+		},
+		{
+			name:           "today lasts 23 hours when DST starts",
+			due:            "today",
+			now:            time.Date(2024, 3, 10, 12, 0, 0, 0, newYork),
+			loc:            newYork,
+			expectedFrom:   ptr(time.Date(2024, 3, 10, 0, 0, 0, 0, newYork)),
+			expectedBefore: time.Date(2024, 3, 11, 0, 0, 0, 0, newYork),
+		},
+		{
+			name:           "week starts on monday",
+			due:            "week",
+			now:            time.Date(2024, 5, 8, 10, 0, 0, 0, time.UTC), // Wednesday
+			loc:            time.UTC,
+			expectedFrom:   ptr(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)),
+			expectedBefore: time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:           "week on a sunday",
+			due:            "week",
+			now:            time.Date(2024, 5, 12, 23, 0, 0, 0, time.UTC),
+			loc:            time.UTC,
+			expectedFrom:   ptr(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)),
+			expectedBefore: time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := resolveDueRange(tt.due, tt.now, tt.loc)
+			require.NotNil(t, r)
+
+			if tt.expectedFrom == nil {
+				assert.Nil(t, r.From)
+			} else {
+				require.NotNil(t, r.From)
+				assert.True(t, tt.expectedFrom.Equal(*r.From), "from: expected %s, got %s", tt.expectedFrom, r.From)
+			}
+			assert.True(t, tt.expectedBefore.Equal(r.Before), "before: expected %s, got %s", tt.expectedBefore, r.Before)
+			assert.Equal(t, tt.expectedOverdue, r.Overdue)
+		})
+	}
+
+	// DST check: the day really is 23 hours long
+	r := resolveDueRange("today", time.Date(2024, 3, 10, 12, 0, 0, 0, newYork), newYork)
+	assert.Equal(t, 23*time.Hour, r.Before.Sub(*r.From))
+
+	assert.Nil(t, resolveDueRange("", time.Now(), time.UTC))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,144 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// ErrInvalidRecurrence is returned when a recurrence rule, its timezone or its todo is invalid
+var ErrInvalidRecurrence = errors.New("invalid recurrence")
+
+// CompletionScope tells what completing an occurrence of a recurring todo does to its series
+type CompletionScope string
+
+const (
+	// CompleteOccurrence completes the occurrence and creates the next one
+	CompleteOccurrence CompletionScope = "occurrence"
+	// StopRecurring completes the occurrence and ends the series
+	StopRecurring CompletionScope = "series"
+)
+
+// ParseCompletionScope parses a completion scope, defaulting to CompleteOccurrence
+func ParseCompletionScope(s string) (CompletionScope, error) {
+	switch scope := CompletionScope(strings.ToLower(s)); scope {
+	case "":
+		return CompleteOccurrence, nil
+	case CompleteOccurrence, StopRecurring:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("%w: recurrence", ErrInvalidQueryParam)
+	}
+}
+
+// Recurrence describes how a todo repeats. The rule is an RFC 5545 RRULE expanded from
+// start in the given timezone, so occurrences keep their wall clock time across DST
+// changes. Exceptions are occurrences that are skipped, like EXDATE.
+type Recurrence struct {
+	Rule       string      `json:"rule"`
+	Timezone   string      `json:"timezone"`
+	Start      time.Time   `json:"start"`
+	Exceptions []time.Time `json:"exceptions"`
+}
+
+// NewRecurrence validates and normalizes a recurrence rule starting at the given time. The
+// rule may be prefixed with "RRULE:" but can't carry its own DTSTART, and an empty timezone
+// means UTC.
+func NewRecurrence(rule, timezone string, start time.Time, exceptions []time.Time) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	r := &Recurrence{
+		Rule:       rule,
+		Timezone:   timezone,
+		Start:      start.Truncate(time.Second),
+		Exceptions: []time.Time{},
+	}
+	for _, exception := range exceptions {
+		r.Exceptions = append(r.Exceptions, exception.Truncate(time.Second))
+	}
+	slices.SortFunc(r.Exceptions, func(a, b time.Time) int { return a.Compare(b) })
+
+	if _, err := r.set(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// set builds the rrule set of the recurrence in its timezone
+func (r *Recurrence) set() (*rrule.Set, error) {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidRecurrence, r.Timezone)
+	}
+
+	if strings.ContainsAny(r.Rule, "\r\n") || strings.Contains(r.Rule, "DTSTART") {
+		return nil, fmt.Errorf("%w: rule can't set its own start", ErrInvalidRecurrence)
+	}
+
+	opt, err := rrule.StrToROptionInLocation(r.Rule, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRecurrence, err.Error())
+	}
+
+	// A todo every minute or second is never what anyone wants
+	if opt.Freq == rrule.MINUTELY || opt.Freq == rrule.SECONDLY {
+		return nil, fmt.Errorf("%w: frequency must be at least hourly", ErrInvalidRecurrence)
+	}
+
+	opt.Dtstart = r.Start.In(loc)
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRecurrence, err.Error())
+	}
+
+	set := &rrule.Set{}
+	set.RRule(rule)
+	set.SetExDates(r.Exceptions)
+	return set, nil
+}
+
+// Next returns the first occurrence strictly after the given time that isn't an
+// exception, or false when the series has ended
+func (r *Recurrence) Next(after time.Time) (time.Time, bool) {
+	set, err := r.set()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	next := set.After(after, false)
+	if next.IsZero() {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// NextOccurrence returns a new todo for the occurrence of a recurring todo that follows
+// its due date, carrying over its details and recurrence, or nil when the series has ended
+func (t *Todo) NextOccurrence() *Todo {
+	if t.Recurrence == nil || t.DueAt == nil {
+		return nil
+	}
+
+	dueAt, ok := t.Recurrence.Next(*t.DueAt)
+	if !ok {
+		return nil
+	}
+	dueAt = dueAt.UTC()
+
+	recurrence := *t.Recurrence
+	recurrence.Exceptions = slices.Clone(t.Recurrence.Exceptions)
+
+	next := NewTodo(t.UserID, t.Title, t.Description)
+	next.ProjectID = t.ProjectID
+	next.Priority = t.Priority
+	next.DueAt = &dueAt
+	next.Recurrence = &recurrence
+	return next
+}
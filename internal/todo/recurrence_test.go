@@ -0,0 +1,182 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompletionScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CompletionScope
+		wantErr  bool
+	}{
+		{input: "", expected: CompleteOccurrence},
+		{input: "occurrence", expected: CompleteOccurrence},
+		{input: "SERIES", expected: StopRecurring},
+		{input: "forever", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			scope, err := ParseCompletionScope(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidQueryParam)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, scope)
+		})
+	}
+}
+
+func TestNewRecurrence(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	later := start.Add(72 * time.Hour)
+
+	r, err := NewRecurrence(" rrule:freq=weekly;byday=mo,we ", "", start, []time.Time{later, start.Add(500 * time.Millisecond)})
+	require.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,WE", r.Rule)
+	assert.Equal(t, "UTC", r.Timezone)
+	assert.Equal(t, start, r.Start)
+	assert.Equal(t, []time.Time{start, later}, r.Exceptions)
+
+	r, err = NewRecurrence("FREQ=DAILY", "Asia/Jakarta", start, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{}, r.Exceptions)
+}
+
+func TestNewRecurrence_Invalid(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		rule     string
+		timezone string
+	}{
+		{name: "missing frequency", rule: "BYDAY=MO"},
+		{name: "unknown property", rule: "FREQ=DAILY;SOMETIMES=1"},
+		{name: "out of range", rule: "FREQ=MONTHLY;BYMONTHDAY=40"},
+		{name: "own start", rule: "DTSTART:20261016T090000Z\nRRULE:FREQ=DAILY"},
+		{name: "too frequent", rule: "FREQ=MINUTELY"},
+		{name: "unknown timezone", rule: "FREQ=DAILY", timezone: "Mars/Olympus_Mons"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRecurrence(tt.rule, tt.timezone, start, nil)
+			assert.ErrorIs(t, err, ErrInvalidRecurrence)
+		})
+	}
+}
+
+func TestRecurrence_Next(t *testing.T) {
+	friday := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		rule       string
+		exceptions []time.Time
+		after      time.Time
+		expected   time.Time
+	}{
+		{
+			name:     "every weekday skips the weekend",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+			after:    friday,
+			expected: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "first of each month",
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=1",
+			after:    friday,
+			expected: time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "exceptions are skipped",
+			rule:       "FREQ=DAILY",
+			exceptions: []time.Time{time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+			after:      friday,
+			expected:   time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "interval counts from the start",
+			rule:     "FREQ=DAILY;INTERVAL=3",
+			after:    friday.Add(24 * time.Hour),
+			expected: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRecurrence(tt.rule, "", friday, tt.exceptions)
+			require.NoError(t, err)
+
+			next, ok := r.Next(tt.after)
+			assert.True(t, ok)
+			assert.True(t, tt.expected.Equal(next), "expected %s, got %s", tt.expected, next)
+		})
+	}
+}
+
+func TestRecurrence_Next_DST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// Daylight saving time ends in Berlin on 25 October 2026
+	start := time.Date(2026, 10, 24, 9, 0, 0, 0, berlin)
+	r, err := NewRecurrence("FREQ=DAILY", "Europe/Berlin", start.UTC(), nil)
+	require.NoError(t, err)
+
+	next, ok := r.Next(start)
+	require.True(t, ok)
+	assert.Equal(t, 9, next.In(berlin).Hour())
+	assert.Equal(t, 25*time.Hour, next.Sub(start))
+}
+
+func TestRecurrence_Next_Ended(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	r, err := NewRecurrence("FREQ=DAILY;COUNT=2", "", start, nil)
+	require.NoError(t, err)
+
+	next, ok := r.Next(start)
+	require.True(t, ok)
+
+	_, ok = r.Next(next)
+	assert.False(t, ok)
+}
+
+func TestTodo_NextOccurrence(t *testing.T) {
+	dueAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	projectID := int64(7)
+
+	todo := NewTodo(123, "Standup", "Daily sync")
+	todo.ID = 1
+	todo.ProjectID = &projectID
+	todo.Priority = PriorityHigh
+	todo.DueAt = &dueAt
+
+	assert.Nil(t, todo.NextOccurrence())
+
+	recurrence, err := NewRecurrence("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "", dueAt, nil)
+	require.NoError(t, err)
+	todo.Recurrence = recurrence
+
+	next := todo.NextOccurrence()
+	require.NotNil(t, next)
+	assert.Zero(t, next.ID)
+	assert.Equal(t, todo.UserID, next.UserID)
+	assert.Equal(t, &projectID, next.ProjectID)
+	assert.Equal(t, "Standup", next.Title)
+	assert.Equal(t, "Daily sync", next.Description)
+	assert.Equal(t, PriorityHigh, next.Priority)
+	assert.False(t, next.Completed)
+	require.NotNil(t, next.DueAt)
+	assert.True(t, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC).Equal(*next.DueAt))
+	assert.Equal(t, *recurrence, *next.Recurrence)
+	assert.NotSame(t, todo.Recurrence, next.Recurrence)
+}
@@ -0,0 +1,123 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+)
+
+// maxReminders is the maximum number of reminders a user can set on a single todo
+const maxReminders = 10
+
+var (
+	// ErrReminderNotFound is returned when a requested reminder cannot be found
+	ErrReminderNotFound = errors.New("reminder not found")
+	// ErrInvalidReminder is returned when a reminder can't be set as requested
+	ErrInvalidReminder = errors.New("invalid reminder")
+)
+
+// Reminder represents a reminder a user set on a todo they see, either at a given time or a
+// number of minutes before the todo is due. Relative reminders follow the due date: they are
+// rescheduled when it changes, and don't fire while the todo has none. A reminder fires once,
+// through the notification channel it was set for.
+type Reminder struct {
+	ID            int64                `json:"id"`
+	TodoID        int64                `json:"todo_id" gorm:"index"`
+	UserID        int64                `json:"-" gorm:"index"`
+	At            *time.Time           `json:"at"`
+	MinutesBefore *int                 `json:"minutes_before"`
+	Channel       notification.Channel `json:"channel"`
+	FireAt        *time.Time           `json:"fire_at" gorm:"index:idx_reminders_due,where:fired_at IS NULL"`
+	FiredAt       *time.Time           `json:"fired_at"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+// CreateReminderRequest represents the request payload for setting a reminder on a todo,
+// either at a given time or a number of minutes before it is due
+type CreateReminderRequest struct {
+	At            *time.Time `json:"at" validate:"required_without=MinutesBefore,excluded_with=MinutesBefore"`
+	MinutesBefore *int       `json:"minutes_before" validate:"omitempty,min=0,max=525600"`
+	Channel       string     `json:"channel" validate:"omitempty,oneof=in_app email webhook"`
+}
+
+// NewReminder creates a reminder of the given user on a todo from a request. Reminders at a
+// given time must be in the future, relative ones need the todo to be due.
+func NewReminder(todo *Todo, userID int64, req *CreateReminderRequest) (*Reminder, error) {
+	reminder := &Reminder{
+		TodoID:        todo.ID,
+		UserID:        userID,
+		At:            req.At,
+		MinutesBefore: req.MinutesBefore,
+		Channel:       notification.ChannelInApp,
+		CreatedAt:     time.Now(),
+	}
+	if req.Channel != "" {
+		reminder.Channel = notification.Channel(req.Channel)
+	}
+
+	switch {
+	case req.At != nil && !req.At.After(reminder.CreatedAt):
+		return nil, fmt.Errorf("%w: the reminder time is in the past", ErrInvalidReminder)
+	case req.At == nil && todo.DueAt == nil:
+		return nil, fmt.Errorf("%w: the todo has no due date", ErrInvalidReminder)
+	}
+
+	reminder.schedule(todo.DueAt)
+	return reminder, nil
+}
+
+// schedule sets when a reminder fires, given the due date of its todo. A relative reminder
+// whose time changes is due to fire again, even if it already fired for the previous due date.
+func (r *Reminder) schedule(dueAt *time.Time) {
+	if r.MinutesBefore == nil {
+		r.FireAt = r.At
+		return
+	}
+
+	var fireAt *time.Time
+	if dueAt != nil {
+		t := dueAt.Add(-time.Duration(*r.MinutesBefore) * time.Minute)
+		fireAt = &t
+	}
+
+	if !equalTimes(r.FireAt, fireAt) {
+		r.FireAt = fireAt
+		r.FiredAt = nil
+	}
+}
+
+// equalTimes reports whether two optional times are both unset or the same instant
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// reminderData is the data of reminder notifications, the reminder along with its todo
+type reminderData struct {
+	Reminder *Reminder `json:"reminder"`
+	Todo     *Todo     `json:"todo"`
+}
+
+// newReminderMessage builds the notification a reminder of a todo fires
+func newReminderMessage(reminder *Reminder, todo *Todo) *notification.Message {
+	body := todo.Title
+	if todo.DueAt != nil {
+		body = fmt.Sprintf("%s is due %s.", todo.Title, todo.DueAt.UTC().Format("Mon, 02 Jan 2006 15:04 MST"))
+	}
+	if todo.Description != "" {
+		body += "\n\n" + todo.Description
+	}
+
+	return &notification.Message{
+		UserID: reminder.UserID,
+		Type:   webhook.EventTodoReminder,
+		Title:  "Reminder: " + todo.Title,
+		Body:   body,
+		Data:   reminderData{Reminder: reminder, Todo: todo},
+	}
+}
@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
+)
+
+func TestNewReminder(t *testing.T) {
+	dueAt := time.Now().Add(2 * time.Hour)
+	todo := &Todo{ID: 7, Title: "Pay rent", DueAt: &dueAt}
+
+	at := time.Now().Add(time.Hour)
+	reminder, err := NewReminder(todo, 123, &CreateReminderRequest{At: &at, Channel: "email"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), reminder.TodoID)
+	assert.Equal(t, int64(123), reminder.UserID)
+	assert.Equal(t, notification.ChannelEmail, reminder.Channel)
+	assert.Equal(t, &at, reminder.FireAt)
+	assert.Nil(t, reminder.FiredAt)
+
+	minutes := 30
+	reminder, err = NewReminder(todo, 123, &CreateReminderRequest{MinutesBefore: &minutes})
+	require.NoError(t, err)
+	assert.Equal(t, notification.ChannelInApp, reminder.Channel)
+	require.NotNil(t, reminder.FireAt)
+	assert.True(t, dueAt.Add(-30*time.Minute).Equal(*reminder.FireAt))
+}
+
+func TestNewReminder_Invalid(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	minutes := 30
+
+	_, err := NewReminder(&Todo{ID: 7}, 123, &CreateReminderRequest{At: &past})
+	assert.ErrorIs(t, err, ErrInvalidReminder)
+
+	_, err = NewReminder(&Todo{ID: 7}, 123, &CreateReminderRequest{MinutesBefore: &minutes})
+	assert.ErrorIs(t, err, ErrInvalidReminder)
+}
+
+func TestReminder_Schedule(t *testing.T) {
+	minutes := 15
+	dueAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	firedAt := dueAt.Add(-15 * time.Minute)
+	reminder := &Reminder{MinutesBefore: &minutes}
+
+	reminder.schedule(&dueAt)
+	require.NotNil(t, reminder.FireAt)
+	assert.Equal(t, firedAt, *reminder.FireAt)
+
+	// The same time doesn't fire again
+	reminder.FiredAt = &firedAt
+	sameDueAt := dueAt.In(time.FixedZone("CET", 3600))
+	reminder.schedule(&sameDueAt)
+	assert.NotNil(t, reminder.FiredAt)
+
+	// Another time does
+	later := dueAt.Add(24 * time.Hour)
+	reminder.schedule(&later)
+	assert.Equal(t, later.Add(-15*time.Minute), *reminder.FireAt)
+	assert.Nil(t, reminder.FiredAt)
+
+	// Without a due date it doesn't fire at all
+	reminder.schedule(nil)
+	assert.Nil(t, reminder.FireAt)
+
+	// Absolute reminders ignore the due date
+	at := dueAt.Add(time.Hour)
+	absolute := &Reminder{At: &at}
+	absolute.schedule(&later)
+	assert.Equal(t, &at, absolute.FireAt)
+}
+
+func TestNewReminderMessage(t *testing.T) {
+	dueAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	todo := &Todo{ID: 7, Title: "Pay rent", Description: "Landlord's account", DueAt: &dueAt}
+	reminder := &Reminder{ID: 3, TodoID: 7, UserID: 123}
+
+	msg := newReminderMessage(reminder, todo)
+	assert.Equal(t, int64(123), msg.UserID)
+	assert.Equal(t, "todo.reminder", msg.Type)
+	assert.Equal(t, "Reminder: Pay rent", msg.Title)
+	assert.Equal(t, "Pay rent is due Fri, 01 Mar 2024 09:00 UTC.\n\nLandlord's account", msg.Body)
+	assert.Equal(t, reminderData{Reminder: reminder, Todo: todo}, msg.Data)
+}
@@ -0,0 +1,75 @@
+package todo
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// rankSort is the order of search results, from most to least relevant
+var rankSort = sortOrder{column: "rank", desc: true}
+
+// SearchParams represents the query and pagination parameters for searching todos
+type SearchParams struct {
+	Query  string `validate:"required,max=256"`
+	Limit  int    `validate:"min=1,max=100"`
+	Cursor string
+}
+
+// Highlight holds the todo fields as HTML, escaped, with matching terms wrapped in <mark> tags
+type Highlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// SearchResult represents a todo matching a search query along with its relevance
+type SearchResult struct {
+	Todo      Todo      `json:"todo"`
+	Rank      float32   `json:"rank"`
+	Highlight Highlight `json:"highlight"`
+}
+
+// SearchPage represents a single page of search results along with the cursor of the next page
+type SearchPage struct {
+	Data       []SearchResult `json:"data"`
+	NextCursor string         `json:"next_cursor"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// searchRow is the row shape returned by the store when searching todos
+type searchRow struct {
+	Todo
+	Rank                 float32
+	TitleHighlight       string
+	DescriptionHighlight string
+}
+
+// searchQuery is the typed query the store runs to search a user's todos
+type searchQuery struct {
+	UserID  int64
+	TSQuery string
+	After   *cursor
+	Limit   int
+}
+
+// encodeSearchCursor builds an opaque cursor pointing right after the given search result
+func encodeSearchCursor(result *SearchResult) string {
+	value := strconv.FormatFloat(float64(result.Rank), 'g', -1, 32)
+	return cursor{Sort: rankSort.String(), Value: value, ID: result.Todo.ID}.encode()
+}
+
+// buildPrefixQuery turns free text into a tsquery matching todos containing every
+// word as a prefix, so partially typed words already match. Only letters and
+// digits are kept, so the result is always a valid tsquery.
+func buildPrefixQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = word + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
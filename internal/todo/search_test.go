@@ -0,0 +1,44 @@
+package todo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "single word", input: "groc", expected: "groc:*"},
+		{name: "multiple words", input: "Buy groc", expected: "buy:* & groc:*"},
+		{name: "extra whitespace", input: "  buy   milk  ", expected: "buy:* & milk:*"},
+		{name: "tsquery operators are dropped", input: "milk & !eggs | (bread:*)", expected: "milk:* & eggs:* & bread:*"},
+		{name: "unicode letters", input: "café naïve", expected: "café:* & naïve:*"},
+		{name: "digits", input: "q3 report", expected: "q3:* & report:*"},
+		{name: "only punctuation", input: "&|!()", expected: ""},
+		{name: "empty", input: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, buildPrefixQuery(tt.input))
+		})
+	}
+}
+
+func TestSearchCursor_RoundTrip(t *testing.T) {
+	result := &SearchResult{Todo: Todo{ID: 7}, Rank: 0.0607927}
+
+	decoded, err := decodeCursor(encodeSearchCursor(result), rankSort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), decoded.ID)
+	assert.Equal(t, "0.0607927", decoded.Value)
+
+	// Search cursors can't be used to page through the todo list and vice versa
+	_, err = decodeCursor(encodeSearchCursor(result), parseSort(DefaultSort))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -1,150 +1,2700 @@
 package todo
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
 	"time"
 
+	"github.com/syahidfrd/go-boilerplate/internal/notification"
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/cache"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/rank"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/requestid"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/storage"
+	"github.com/syahidfrd/go-boilerplate/internal/user"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+	"gorm.io/gorm"
 )
 
 // Service provides todo business logic operations with caching support
 type Service struct {
-	store *store
-	cache *cache.RedisCache
+	store    *store
+	cache    *cache.RedisCache
+	users    *user.Service
+	blobs    storage.BlobStore
+	events   *events.Broker
+	webhooks *webhook.Service
+	notifier *notification.Service
+	outbox   *outbox.Outbox
+	jobs     *jobs.Queue
+	limits   AttachmentLimits
 }
 
 // CreateTodoRequest represents the request payload for creating a todo
 type CreateTodoRequest struct {
-	Title       string `json:"title" validate:"required"`
-	Description string `json:"description"`
+	ProjectID   *int64             `json:"project_id"`
+	Title       string             `json:"title" validate:"required"`
+	Description string             `json:"description"`
+	DueAt       *time.Time         `json:"due_at"`
+	Priority    string             `json:"priority" validate:"omitempty,oneof=none low medium high urgent"`
+	Recurrence  *RecurrenceRequest `json:"recurrence"`
 }
 
 // UpdateTodoRequest represents the request payload for updating a todo
 type UpdateTodoRequest struct {
-	Title       string `json:"title" validate:"required"`
-	Description string `json:"description"`
+	Title       string             `json:"title" validate:"required"`
+	Description string             `json:"description"`
+	DueAt       *time.Time         `json:"due_at"`
+	Priority    string             `json:"priority" validate:"omitempty,oneof=none low medium high urgent"`
+	Recurrence  *RecurrenceRequest `json:"recurrence"`
+}
+
+// RecurrenceRequest represents the recurrence of a todo in create and update requests
+type RecurrenceRequest struct {
+	Rule       string      `json:"rule" validate:"required,max=255"`
+	Timezone   string      `json:"timezone" validate:"omitempty,timezone"`
+	Exceptions []time.Time `json:"exceptions" validate:"max=366"`
+}
+
+// CreateLabelRequest represents the request payload for creating a label
+type CreateLabelRequest struct {
+	Name  string `json:"name" validate:"required,max=64"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+// UpdateLabelRequest represents the request payload for renaming and recoloring a label
+type UpdateLabelRequest struct {
+	Name  string `json:"name" validate:"required,max=64"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+// newUpdateTodoRequest builds the update request that would leave a todo unchanged,
+// which is the document partial updates are applied to
+func newUpdateTodoRequest(todo *Todo) *UpdateTodoRequest {
+	req := &UpdateTodoRequest{
+		Title:       todo.Title,
+		Description: todo.Description,
+		DueAt:       todo.DueAt,
+		Priority:    todo.Priority.String(),
+	}
+	if todo.Recurrence != nil {
+		req.Recurrence = &RecurrenceRequest{
+			Rule:       todo.Recurrence.Rule,
+			Timezone:   todo.Recurrence.Timezone,
+			Exceptions: todo.Recurrence.Exceptions,
+		}
+	}
+	return req
+}
+
+// newRecurrence builds the recurrence of a todo due at dueAt from a request, if any. The
+// series keeps its start while the rule and timezone stay the same, so that COUNT and
+// INTERVAL keep counting from the first occurrence.
+func newRecurrence(req *RecurrenceRequest, dueAt *time.Time, current *Recurrence) (*Recurrence, error) {
+	if req == nil {
+		return nil, nil
+	}
+	if dueAt == nil {
+		return nil, fmt.Errorf("%w: a due date is required", ErrInvalidRecurrence)
+	}
+
+	recurrence, err := NewRecurrence(req.Rule, req.Timezone, *dueAt, req.Exceptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && current.Rule == recurrence.Rule && current.Timezone == recurrence.Timezone {
+		recurrence.Start = current.Start
+	}
+	return recurrence, nil
+}
+
+// MoveTodoRequest represents the request payload for moving a todo to another project
+type MoveTodoRequest struct {
+	ProjectID int64 `json:"project_id" validate:"required"`
+}
+
+// ReorderTodoRequest represents the request payload for moving a todo in the manual order,
+// right before or right after another todo, or between two of them
+type ReorderTodoRequest struct {
+	Before *int64 `json:"before" validate:"required_without=After"`
+	After  *int64 `json:"after" validate:"required_without=Before"`
+}
+
+// CreateCommentRequest represents the request payload for commenting on a todo, optionally
+// in reply to another of its comments
+type CreateCommentRequest struct {
+	ParentID *int64 `json:"parent_id"`
+	Body     string `json:"body" validate:"required,max=2000"`
+}
+
+// UpdateCommentRequest represents the request payload for editing a comment
+type UpdateCommentRequest struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+// CreateProjectRequest represents the request payload for creating a project
+type CreateProjectRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Color    string `json:"color" validate:"omitempty,hexcolor"`
+	Position *int   `json:"position" validate:"omitempty,min=0"`
+}
+
+// UpdateProjectRequest represents the request payload for updating a project
+type UpdateProjectRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Color    string `json:"color" validate:"omitempty,hexcolor"`
+	Archived bool   `json:"archived"`
+	Position *int   `json:"position" validate:"omitempty,min=0"`
+}
+
+// InviteRequest represents the request payload for inviting a user to a project by email
+type InviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=viewer editor owner"`
+}
+
+// AttachRequest represents a file uploaded to a todo. The content is read twice, once to
+// detect its type and once to store it, hence the io.ReadSeeker.
+type AttachRequest struct {
+	Filename string
+	Content  io.ReadSeeker
+	Size     int64
+}
+
+// UpdateMemberRequest represents the request payload for changing the role of a project member
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=viewer editor owner"`
+}
+
+// ExportRequest represents the request payload for generating an export file in the background
+type ExportRequest struct {
+	Format string `json:"format"`
 }
 
 // NewService creates a new todo service with the provided dependencies
-func NewService(store *store, cache *cache.RedisCache) *Service {
+func NewService(store *store, cache *cache.RedisCache, users *user.Service, blobs storage.BlobStore, broker *events.Broker, webhooks *webhook.Service, notifier *notification.Service, outbox *outbox.Outbox, queue *jobs.Queue, limits AttachmentLimits) *Service {
 	return &Service{
-		store: store,
-		cache: cache,
+		store:    store,
+		cache:    cache,
+		users:    users,
+		blobs:    blobs,
+		events:   broker,
+		webhooks: webhooks,
+		notifier: notifier,
+		outbox:   outbox,
+		jobs:     queue,
+		limits:   limits,
 	}
 }
 
-// Create creates a new todo item for the specified user
+// Create creates a new todo item for the specified user. A todo created in a project shared
+// with the user belongs to the owner of the project, like the rest of its todos.
 func (s *Service) Create(ctx context.Context, userID int64, req *CreateTodoRequest) (*Todo, error) {
-	todo := NewTodo(userID, req.Title, req.Description)
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	todo, err := s.createTodo(ctx, userID, req, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.emit(ctx, tx, EventTodoCreated, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
+}
+
+// createTodo creates a new todo item for the specified user within the given transaction
+func (s *Service) createTodo(ctx context.Context, userID int64, req *CreateTodoRequest, tx *gorm.DB) (*Todo, error) {
+	priority, err := ParsePriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence, err := newRecurrence(req.Recurrence, req.DueAt, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := s.resolveProject(ctx, userID, req.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	todo := NewTodo(project.UserID, req.Title, req.Description)
+	todo.ProjectID = &project.ID
+	todo.DueAt = req.DueAt
+	todo.Priority = priority
+	todo.Recurrence = recurrence
+
+	// New todos go first in the manual order, like they did when todos were listed newest first
+	todo.Position, err = s.positionBetween(ctx, todo.UserID, tx, func() (string, string, error) {
+		first, err := s.store.FirstPosition(ctx, todo.UserID, db.WithTx(tx))
+		return "", first, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to position todo: %w", err)
+	}
 
-	if err := s.store.Save(ctx, todo); err != nil {
+	if err := s.store.Save(ctx, todo, db.WithTx(tx)); err != nil {
 		return nil, fmt.Errorf("failed to create todo: %w", err)
 	}
 
-	// Invalidate user's todo cache
-	cacheKey := fmt.Sprintf("todos:user:%d", userID)
-	s.cache.Delete(ctx, cacheKey)
+	if err := s.record(ctx, userID, HistoryCreate, nil, todo, tx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// authorize loads a todo on behalf of the given user and checks that their role allows the
+// required access. Todos the user can't see at all, owned by someone else and not shared
+// with them, are reported as ErrTodoNotFound so their existence isn't leaked.
+func (s *Service) authorize(ctx context.Context, userID, id int64, required Role, options ...db.Option) (*Todo, error) {
+	todo, err := s.store.GetAccessibleByID(ctx, userID, id, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	role := RoleOwner
+	if todo.UserID != userID {
+		member, err := s.store.GetMember(ctx, *todo.ProjectID, userID)
+		if errors.Is(err, ErrMemberNotFound) {
+			// Access was revoked since the todo was loaded
+			return nil, ErrTodoNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		role = member.Role
+	}
 
+	if !role.Allows(required) {
+		return nil, ErrPermissionDenied
+	}
 	return todo, nil
 }
 
-// GetByID retrieves a todo by its ID
-func (s *Service) GetByID(ctx context.Context, id int64) (*Todo, error) {
-	todo, err := s.store.GetByID(ctx, id)
+// authorizeProject loads a project on behalf of the given user, along with their role on it,
+// and checks that the role allows the required access. Projects the user can't see at all
+// are reported as ErrProjectNotFound.
+func (s *Service) authorizeProject(ctx context.Context, userID, id int64, required Role) (*Project, error) {
+	project, err := s.store.GetAccessibleProjectByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	project.Role = RoleOwner
+	if project.UserID != userID {
+		member, err := s.store.GetMember(ctx, project.ID, userID)
+		if errors.Is(err, ErrMemberNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		project.Role = member.Role
+	}
+
+	if !project.Role.Allows(required) {
+		return nil, ErrPermissionDenied
+	}
+	return project, nil
+}
+
+// invalidate deletes the cached todo lists of the owner of a project and of everyone it is
+// shared with, as they all see its todos
+func (s *Service) invalidate(ctx context.Context, ownerID int64, projectID *int64) {
+	// Cache invalidation is best effort, like the deletes themselves
+	for _, userID := range s.audience(ctx, ownerID, projectID) {
+		cacheKey := fmt.Sprintf("todos:user:%d", userID)
+		s.cache.Delete(ctx, cacheKey)
+	}
+}
+
+// expectVersion makes the next write of the todo conditional on the version the caller
+// last saw instead of the one just read. A zero version keeps the one just read, so the
+// write still fails if the todo changes concurrently.
+func expectVersion(todo *Todo, version int64) {
+	if version != 0 {
+		todo.Version = version
+	}
+}
+
+// record writes the history entry of a change made to a todo by the specified user,
+// within the transaction of the change itself
+func (s *Service) record(ctx context.Context, userID int64, action HistoryAction, before, after *Todo, tx *gorm.DB) error {
+	entry, err := NewHistoryEntry(userID, action, requestid.FromContext(ctx), before, after)
+	if err != nil {
+		return fmt.Errorf("failed to build history entry: %w", err)
+	}
+
+	if err := s.store.SaveHistory(ctx, entry, db.WithTx(tx)); err != nil {
+		return fmt.Errorf("failed to save history entry: %w", err)
+	}
+	return nil
+}
+
+// GetHistory retrieves a page of the history of a todo of the specified user, most recent
+// change first
+func (s *Service) GetHistory(ctx context.Context, userID, id int64, params *HistoryParams) (*HistoryPage, error) {
+	after, err := decodeCursor(params.Cursor, historySort)
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for history: %w", err)
+	}
+
+	// One extra row tells whether a next page exists
+	entries, err := s.store.GetHistory(ctx, todo.ID, after, params.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo history: %w", err)
+	}
+
+	page := &HistoryPage{Data: entries}
+	if len(entries) > params.Limit {
+		page.Data = entries[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeHistoryCursor(&page.Data[params.Limit-1])
+	}
+
+	return page, nil
+}
+
+// CreateComment adds a comment by the specified user to a todo they can see. Replies must be
+// to a comment of the same todo that isn't deleted.
+func (s *Service) CreateComment(ctx context.Context, userID, id int64, req *CreateCommentRequest) (*Comment, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for comment: %w", err)
+	}
+
+	if req.ParentID != nil {
+		_, err := s.store.GetCommentByID(ctx, todo.ID, *req.ParentID)
+		if errors.Is(err, ErrCommentNotFound) {
+			return nil, fmt.Errorf("%w: parent comment %d not found", ErrInvalidComment, *req.ParentID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent comment: %w", err)
+		}
+	}
+
+	comment, err := NewComment(todo.ID, userID, req.ParentID, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.SaveComment(ctx, comment, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	if err := s.store.AddCommentCount(ctx, todo, 1, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update comment count: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventCommentCreated, s.audience(ctx, todo.UserID, todo.ProjectID), comment); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Cached todos carry their comment count
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return comment, nil
+}
+
+// GetComments retrieves a page of the comments of a todo the specified user can see, oldest first
+func (s *Service) GetComments(ctx context.Context, userID, id int64, params *CommentParams) (*CommentPage, error) {
+	after, err := decodeCursor(params.Cursor, commentSort)
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for comments: %w", err)
+	}
+
+	// One extra row tells whether a next page exists
+	comments, err := s.store.GetComments(ctx, todo.ID, after, params.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments by todo id: %w", err)
+	}
+
+	page := &CommentPage{Data: comments}
+	if len(comments) > params.Limit {
+		page.Data = comments[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeCommentCursor(&page.Data[params.Limit-1])
+	}
+
+	return page, nil
+}
+
+// UpdateComment edits a comment of the specified user on a todo they can still see
+func (s *Service) UpdateComment(ctx context.Context, userID, id, commentID int64, req *UpdateCommentRequest) (*Comment, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for comment update: %w", err)
+	}
+
+	comment, err := s.store.GetCommentByID(ctx, todo.ID, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment for update: %w", err)
+	}
+
+	if comment.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	if err := comment.Edit(req.Body); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.SaveComment(ctx, comment); err != nil {
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// DeleteComment deletes a comment on a todo the specified user can see. Only the author of
+// the comment and the owner of the todo can delete it.
+func (s *Service) DeleteComment(ctx context.Context, userID, id, commentID int64) error {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return fmt.Errorf("failed to get todo for comment delete: %w", err)
+	}
+
+	comment, err := s.store.GetCommentByID(ctx, todo.ID, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to get comment for delete: %w", err)
+	}
+
+	if comment.UserID != userID && todo.UserID != userID {
+		return ErrPermissionDenied
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.DeleteComment(ctx, comment, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	if err := s.store.AddCommentCount(ctx, todo, -1, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update comment count: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventCommentDeleted, s.audience(ctx, todo.UserID, todo.ProjectID), comment); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Cached todos carry their comment count
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return nil
+}
+
+// GetByID retrieves a todo by its ID for the specified user
+func (s *Service) GetByID(ctx context.Context, userID, id int64) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer, db.WithPreload())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get todo by id: %w", err)
 	}
 	return todo, nil
 }
 
-// GetByUserID retrieves all todos for a specific user with caching support
-func (s *Service) GetByUserID(ctx context.Context, userID int64) ([]Todo, error) {
-	// Try cache first
+// GetByUserID retrieves a filtered and sorted page of the todos a specific user owns or that
+// are shared with them, with caching support
+func (s *Service) GetByUserID(ctx context.Context, userID int64, params *ListParams) (*TodoPage, error) {
+	sort := params.sort()
+	if !sort.valid() {
+		return nil, fmt.Errorf("%w: sort", ErrInvalidQueryParam)
+	}
+
+	after, err := decodeCursor(params.Cursor, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := params.location()
+	if err != nil {
+		return nil, fmt.Errorf("%w: tz", ErrInvalidQueryParam)
+	}
+	due := resolveDueRange(params.Due, time.Now(), loc)
+
+	// Try cache first, every page and filter combination of the list lives in
+	// the same hash so that a single delete invalidates all of them
 	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	cacheField := params.cacheField(due)
 
-	if cached, err := s.cache.Get(ctx, cacheKey); err == nil {
-		var todos []Todo
-		if json.Unmarshal([]byte(cached), &todos) == nil {
-			return todos, nil
+	if cached, err := s.cache.HGet(ctx, cacheKey, cacheField); err == nil {
+		var page TodoPage
+		if json.Unmarshal([]byte(cached), &page) == nil {
+			return &page, nil
 		}
 	}
 
-	// Cache miss, get from database
-	todos, err := s.store.GetByUserID(ctx, userID)
+	// Cache miss, get from database. One extra row tells whether a next page exists.
+	todos, err := s.store.GetByUserID(ctx, &listQuery{
+		UserID:        userID,
+		Completed:     params.Completed,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		UpdatedSince:  params.UpdatedSince,
+		Due:           due,
+		Label:         params.Label,
+		Sort:          sort,
+		After:         after,
+		Limit:         params.Limit + 1,
+	}, db.WithPreload())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get todos by user id: %w", err)
 	}
 
+	page := &TodoPage{Data: todos}
+	if len(todos) > params.Limit {
+		page.Data = todos[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(sort, &page.Data[params.Limit-1])
+	}
+
 	// Cache the result
-	if data, err := json.Marshal(todos); err == nil {
-		s.cache.Set(ctx, cacheKey, string(data), 10*time.Minute)
+	if data, err := json.Marshal(page); err == nil {
+		s.cache.HSet(ctx, cacheKey, cacheField, string(data), 10*time.Minute)
+	}
+
+	return page, nil
+}
+
+// Search retrieves a page of the todos a user owns or that are shared with them matching a
+// full-text query, ranked by relevance
+func (s *Service) Search(ctx context.Context, userID int64, params *SearchParams) (*SearchPage, error) {
+	tsQuery := buildPrefixQuery(params.Query)
+	if tsQuery == "" {
+		return nil, fmt.Errorf("%w: q", ErrInvalidQueryParam)
+	}
+
+	after, err := decodeCursor(params.Cursor, rankSort)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether a next page exists
+	rows, err := s.store.Search(ctx, &searchQuery{
+		UserID:  userID,
+		TSQuery: tsQuery,
+		After:   after,
+		Limit:   params.Limit + 1,
+	}, db.WithPreload())
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+
+	page := &SearchPage{Data: make([]SearchResult, 0, len(rows))}
+	for _, row := range rows {
+		page.Data = append(page.Data, SearchResult{
+			Todo: row.Todo,
+			Rank: row.Rank,
+			Highlight: Highlight{
+				Title:       row.TitleHighlight,
+				Description: row.DescriptionHighlight,
+			},
+		})
+	}
+
+	if len(page.Data) > params.Limit {
+		page.Data = page.Data[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeSearchCursor(&page.Data[params.Limit-1])
+	}
+
+	return page, nil
+}
+
+// Update updates an existing todo of the specified user with new title and description.
+// A non-zero version fails the update with ErrVersionMismatch unless the todo is still at it.
+func (s *Service) Update(ctx context.Context, userID, id, version int64, req *UpdateTodoRequest) (*Todo, error) {
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	todo, err := s.updateTodo(ctx, userID, id, version, req, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.emit(ctx, tx, EventTodoUpdated, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
 	}
 
-	return todos, nil
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
 }
 
-// Update updates an existing todo with new title and description
-func (s *Service) Update(ctx context.Context, id int64, req *UpdateTodoRequest) (*Todo, error) {
-	todo, err := s.store.GetByID(ctx, id)
+// updateTodo updates a todo of the specified user within the given transaction
+func (s *Service) updateTodo(ctx context.Context, userID, id, version int64, req *UpdateTodoRequest, tx *gorm.DB) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor, db.WithPreload(), db.WithTx(tx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get todo for update: %w", err)
 	}
+	expectVersion(todo, version)
+
+	priority, err := ParsePriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
 
+	recurrence, err := newRecurrence(req.Recurrence, req.DueAt, todo.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *todo
 	todo.Title = req.Title
 	todo.Description = req.Description
+	todo.DueAt = req.DueAt
+	todo.Priority = priority
+	todo.Recurrence = recurrence
 
-	if err := s.store.Save(ctx, todo); err != nil {
+	if err := s.store.Save(ctx, todo, db.WithTx(tx)); err != nil {
 		return nil, fmt.Errorf("failed to update todo: %w", err)
 	}
 
-	// Invalidate user's todo cache
-	cacheKey := fmt.Sprintf("todos:user:%d", todo.UserID)
-	s.cache.Delete(ctx, cacheKey)
+	if err := s.record(ctx, userID, HistoryUpdate, &before, todo, tx); err != nil {
+		return nil, err
+	}
+
+	if !equalTimes(before.DueAt, todo.DueAt) {
+		if err := s.rescheduleReminders(ctx, todo, tx); err != nil {
+			return nil, err
+		}
+	}
 
 	return todo, nil
 }
 
-// ToggleComplete toggles the completion status of a todo
-func (s *Service) ToggleComplete(ctx context.Context, id int64) (*Todo, error) {
-	todo, err := s.store.GetByID(ctx, id)
+// ToggleComplete toggles the completion status of a todo of the specified user.
+// A non-zero version fails the toggle with ErrVersionMismatch unless the todo is still at it.
+// Completing a recurring todo ends its own recurrence and, unless the scope is StopRecurring,
+// creates the next occurrence of the series.
+func (s *Service) ToggleComplete(ctx context.Context, userID, id, version int64, scope CompletionScope) (*Todo, error) {
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	todo, next, err := s.toggleTodo(ctx, userID, id, version, scope, tx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get todo for toggle: %w", err)
+		tx.Rollback()
+		return nil, err
 	}
 
-	if todo.Completed {
-		todo.MarkAsIncomplete()
-	} else {
-		todo.MarkAsCompleted()
+	audience := s.audience(ctx, todo.UserID, todo.ProjectID)
+	if err := s.emit(ctx, tx, EventTodoToggled, audience, todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if next != nil {
+		if err := s.emit(ctx, tx, EventTodoCreated, audience, next); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
-	if err := s.store.Save(ctx, todo); err != nil {
-		return nil, fmt.Errorf("failed to toggle todo completion: %w", err)
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
 	}
 
-	// Invalidate user's todo cache
-	cacheKey := fmt.Sprintf("todos:user:%d", todo.UserID)
-	s.cache.Delete(ctx, cacheKey)
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
 
 	return todo, nil
 }
 
-// Delete removes a todo by its ID
-func (s *Service) Delete(ctx context.Context, id int64) error {
-	// Get todo first to get UserID for cache invalidation
-	todo, err := s.store.GetByID(ctx, id)
+// toggleTodo toggles the completion status of a todo of the specified user within the given
+// transaction, returning the next occurrence it created if any
+func (s *Service) toggleTodo(ctx context.Context, userID, id, version int64, scope CompletionScope, tx *gorm.DB) (*Todo, *Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor, db.WithPreload(), db.WithTx(tx))
 	if err != nil {
-		return fmt.Errorf("failed to get todo for delete: %w", err)
+		return nil, nil, fmt.Errorf("failed to get todo for toggle: %w", err)
+	}
+	expectVersion(todo, version)
+
+	before := *todo
+	var next *Todo
+	if todo.Completed {
+		todo.MarkAsIncomplete()
+	} else {
+		todo.MarkAsCompleted()
+		// The series moves on with the next occurrence, the completed one stays behind as history
+		if todo.Recurrence != nil {
+			if scope != StopRecurring {
+				next = todo.NextOccurrence()
+			}
+			todo.Recurrence = nil
+		}
 	}
 
-	if err := s.store.Delete(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete todo: %w", err)
+	if err := s.store.Save(ctx, todo, db.WithTx(tx)); err != nil {
+		return nil, nil, fmt.Errorf("failed to toggle todo completion: %w", err)
 	}
 
-	// Invalidate user's todo cache
-	cacheKey := fmt.Sprintf("todos:user:%d", todo.UserID)
-	s.cache.Delete(ctx, cacheKey)
+	if err := s.record(ctx, userID, HistoryToggle, &before, todo, tx); err != nil {
+		return nil, nil, err
+	}
 
-	return nil
+	if next != nil {
+		// The next occurrence takes the place of the completed one in the manual order
+		next.Position, err = s.positionBetween(ctx, todo.UserID, tx, s.nextTo(ctx, todo.UserID, todo.ID, 0, false, tx))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to position next occurrence: %w", err)
+		}
+
+		if err := s.store.Save(ctx, next, db.WithTx(tx)); err != nil {
+			return nil, nil, fmt.Errorf("failed to create next occurrence: %w", err)
+		}
+
+		if err := s.record(ctx, userID, HistoryCreate, nil, next, tx); err != nil {
+			return nil, nil, err
+		}
+
+		for i := range todo.Labels {
+			if err := s.store.AttachLabel(ctx, next, &todo.Labels[i], db.WithTx(tx)); err != nil {
+				return nil, nil, fmt.Errorf("failed to attach label to next occurrence: %w", err)
+			}
+		}
+	}
+
+	return todo, next, nil
+}
+
+// Delete moves a todo of the specified user to the trash by its ID. Shared todos go to the
+// trash of the owner of their project.
+// A non-zero version fails the delete with ErrVersionMismatch unless the todo is still at it.
+func (s *Service) Delete(ctx context.Context, userID, id, version int64) error {
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	todo, err := s.trashTodo(ctx, userID, id, version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.emit(ctx, tx, EventTodoDeleted, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return nil
+}
+
+// trashTodo moves a todo of the specified user to the trash within the given transaction,
+// returning the todo as it was before
+func (s *Service) trashTodo(ctx context.Context, userID, id, version int64, tx *gorm.DB) (*Todo, error) {
+	// Get todo first to get UserID for cache invalidation
+	todo, err := s.authorize(ctx, userID, id, RoleEditor, db.WithTx(tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for delete: %w", err)
+	}
+	expectVersion(todo, version)
+
+	if err := s.store.Delete(ctx, todo.UserID, id, todo.Version, db.WithTx(tx)); err != nil {
+		return nil, fmt.Errorf("failed to delete todo: %w", err)
+	}
+
+	deleted := *todo
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	if err := s.record(ctx, userID, HistoryDelete, todo, &deleted, tx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// GetTrash retrieves a page of the trashed todos of the specified user, most recently deleted first
+func (s *Service) GetTrash(ctx context.Context, userID int64, params *TrashParams) (*TodoPage, error) {
+	after, err := decodeCursor(params.Cursor, trashSort)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether a next page exists
+	todos, err := s.store.GetTrashByUserID(ctx, userID, after, params.Limit+1, db.WithPreload())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed todos by user id: %w", err)
+	}
+
+	page := &TodoPage{Data: todos}
+	if len(todos) > params.Limit {
+		page.Data = todos[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(trashSort, &page.Data[params.Limit-1])
+	}
+
+	return page, nil
+}
+
+// Restore takes a todo of the specified user out of the trash. It goes back to its
+// project, or to the inbox when that project has been deleted in the meantime.
+func (s *Service) Restore(ctx context.Context, userID, id int64) (*Todo, error) {
+	todo, err := s.store.GetTrashedByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for restore: %w", err)
+	}
+
+	project, err := s.resolveProject(ctx, userID, todo.ProjectID)
+	if errors.Is(err, ErrProjectNotFound) {
+		project, err = s.resolveProject(ctx, userID, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.Restore(ctx, userID, todo.ID, project.ID, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to restore todo: %w", err)
+	}
+
+	restored, err := s.store.GetAccessibleByID(ctx, userID, id, db.WithPreload(), db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get restored todo: %w", err)
+	}
+	if err := s.record(ctx, userID, HistoryRestore, todo, restored, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.emit(ctx, tx, EventTodoRestored, s.audience(ctx, userID, &project.ID), restored); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, userID, &project.ID)
+
+	return restored, nil
+}
+
+// Purge permanently removes a trashed todo of the specified user by its ID, along with the
+// files attached to it
+func (s *Service) Purge(ctx context.Context, userID, id int64) error {
+	todo, err := s.store.GetTrashedByID(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to get todo for purge: %w", err)
+	}
+
+	keys, err := s.store.GetTrashAttachmentKeys(ctx, userID, &todo.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments for purge: %w", err)
+	}
+	if err := s.deleteBlobs(ctx, keys); err != nil {
+		return err
+	}
+
+	if err := s.store.Purge(ctx, userID, todo.ID); err != nil {
+		return fmt.Errorf("failed to purge todo: %w", err)
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently removes every trashed todo of the specified user, along with the
+// files attached to them
+func (s *Service) EmptyTrash(ctx context.Context, userID int64) error {
+	keys, err := s.store.GetTrashAttachmentKeys(ctx, userID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments for empty trash: %w", err)
+	}
+	if err := s.deleteBlobs(ctx, keys); err != nil {
+		return err
+	}
+
+	if _, err := s.store.EmptyTrash(ctx, userID); err != nil {
+		return fmt.Errorf("failed to empty trash: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredTrash permanently removes the todos of all users that have been in the
+// trash for longer than the retention period, along with the files attached to them,
+// returning how many todos were removed
+func (s *Service) PurgeExpiredTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	before := time.Now().Add(-retention)
+
+	keys, err := s.store.GetExpiredAttachmentKeys(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get attachments of expired trash: %w", err)
+	}
+	if err := s.deleteBlobs(ctx, keys); err != nil {
+		return 0, err
+	}
+
+	purged, err := s.store.PurgeDeletedBefore(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired trash: %w", err)
+	}
+	return purged, nil
+}
+
+// deleteBlobs deletes the blobs of attachments that are about to be removed. Blobs go first
+// and any failure stops the removal, so that no blob is ever left without a row pointing
+// to it; the removal can simply be retried, deleting a missing blob isn't an error.
+func (s *Service) deleteBlobs(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete attachment blob: %w", err)
+		}
+	}
+	return nil
+}
+
+// Attach stores a file uploaded by the specified user to a todo they can edit. The type of
+// the file is detected from its content, and its size is charged to the storage quota of
+// the uploader.
+func (s *Service) Attach(ctx context.Context, userID, id int64, req *AttachRequest) (*Attachment, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for attachment: %w", err)
+	}
+
+	if req.Size > s.limits.MaxFileSize {
+		return nil, fmt.Errorf("%w: the maximum is %d bytes", ErrFileTooLarge, s.limits.MaxFileSize)
+	}
+
+	// Check the quota before uploading anything, it is checked again once the file is stored
+	usage, err := s.store.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	if usage+req.Size > s.limits.UserQuota {
+		return nil, ErrQuotaExceeded
+	}
+
+	attachment, err := NewAttachment(todo.ID, userID, req.Filename, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// The type is detected from the first 512 bytes, like browsers do
+	head := make([]byte, 512)
+	n, err := io.ReadFull(req.Content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	attachment.ContentType = http.DetectContentType(head[:n])
+
+	if _, err := req.Content.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind attachment: %w", err)
+	}
+
+	hash := sha256.New()
+	if err := s.blobs.Put(ctx, attachment.BlobKey, io.TeeReader(req.Content, hash), req.Size); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	attachment.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.saveAttachment(ctx, attachment); err != nil {
+		// The row was never created, the blob would be an orphan
+		if deleteErr := s.blobs.Delete(ctx, attachment.BlobKey); deleteErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete attachment blob: %w", deleteErr))
+		}
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// saveAttachment creates the row of a stored attachment, checking the quota of its uploader
+// again under a lock so that concurrent uploads can't go over it together
+func (s *Service) saveAttachment(ctx context.Context, attachment *Attachment) error {
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.LockStorageUsage(ctx, attachment.UserID, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to lock storage usage: %w", err)
+	}
+
+	usage, err := s.store.GetStorageUsage(ctx, attachment.UserID, db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	if usage+attachment.Size > s.limits.UserQuota {
+		tx.Rollback()
+		return ErrQuotaExceeded
+	}
+
+	if err := s.store.SaveAttachment(ctx, attachment, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetAttachments retrieves the attachments of a todo the specified user can see, oldest first
+func (s *Service) GetAttachments(ctx context.Context, userID, id int64) ([]Attachment, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for attachments: %w", err)
+	}
+
+	attachments, err := s.store.GetAttachments(ctx, todo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments by todo id: %w", err)
+	}
+	return attachments, nil
+}
+
+// OpenAttachment retrieves an attachment of a todo the specified user can see along with a
+// reader of its content. The content is only fetched once read, from wherever the reader
+// was seeked to, and the reader must be closed.
+func (s *Service) OpenAttachment(ctx context.Context, userID, id, attachmentID int64) (*Attachment, *storage.Reader, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get todo for attachment: %w", err)
+	}
+
+	attachment, err := s.store.GetAttachmentByID(ctx, todo.ID, attachmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	return attachment, storage.NewReader(ctx, s.blobs, attachment.BlobKey, attachment.Size), nil
+}
+
+// DeleteAttachment removes an attachment of a todo the specified user can edit, and its content
+func (s *Service) DeleteAttachment(ctx context.Context, userID, id, attachmentID int64) error {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor)
+	if err != nil {
+		return fmt.Errorf("failed to get todo for attachment delete: %w", err)
+	}
+
+	attachment, err := s.store.GetAttachmentByID(ctx, todo.ID, attachmentID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachment for delete: %w", err)
+	}
+
+	if err := s.deleteBlobs(ctx, []string{attachment.BlobKey}); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteAttachment(ctx, attachment.ID); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+
+	return nil
+}
+
+// CreateReminder sets a reminder of the specified user on a todo they can see. Each user
+// can set a limited number of reminders per todo, through the notification channels the
+// server supports.
+func (s *Service) CreateReminder(ctx context.Context, userID, id int64, req *CreateReminderRequest) (*Reminder, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for reminder: %w", err)
+	}
+
+	reminder, err := NewReminder(todo, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.notifier.Supports(reminder.Channel) {
+		return nil, fmt.Errorf("%w: the %s channel is not available", ErrInvalidReminder, reminder.Channel)
+	}
+
+	reminders, err := s.store.GetReminders(ctx, todo.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reminders by todo id: %w", err)
+	}
+	if len(reminders) >= maxReminders {
+		return nil, fmt.Errorf("%w: a todo can have at most %d reminders", ErrInvalidReminder, maxReminders)
+	}
+
+	if err := s.store.SaveReminder(ctx, reminder); err != nil {
+		return nil, fmt.Errorf("failed to create reminder: %w", err)
+	}
+
+	return reminder, nil
+}
+
+// GetReminders retrieves the reminders the specified user set on a todo they can see, oldest first
+func (s *Service) GetReminders(ctx context.Context, userID, id int64) ([]Reminder, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for reminders: %w", err)
+	}
+
+	reminders, err := s.store.GetReminders(ctx, todo.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reminders by todo id: %w", err)
+	}
+	return reminders, nil
+}
+
+// DeleteReminder removes a reminder the specified user set on a todo they can see
+func (s *Service) DeleteReminder(ctx context.Context, userID, id, reminderID int64) error {
+	todo, err := s.authorize(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return fmt.Errorf("failed to get todo for reminder delete: %w", err)
+	}
+
+	if err := s.store.DeleteReminder(ctx, todo.ID, userID, reminderID); err != nil {
+		return fmt.Errorf("failed to delete reminder: %w", err)
+	}
+	return nil
+}
+
+// rescheduleReminders reschedules the reminders of every user that are relative to the due
+// date of a todo, after it changed
+func (s *Service) rescheduleReminders(ctx context.Context, todo *Todo, tx *gorm.DB) error {
+	reminders, err := s.store.GetRelativeReminders(ctx, todo.ID, db.WithTx(tx))
+	if err != nil {
+		return fmt.Errorf("failed to get reminders for reschedule: %w", err)
+	}
+
+	for i := range reminders {
+		reminders[i].schedule(todo.DueAt)
+		if err := s.store.SaveReminder(ctx, &reminders[i], db.WithTx(tx)); err != nil {
+			return fmt.Errorf("failed to reschedule reminder: %w", err)
+		}
+	}
+	return nil
+}
+
+// FireDueReminders fires the reminders of all users that are due, returning how many fired.
+// Each reminder is marked as fired in the same transaction as the job sending it is
+// enqueued, so it is sent once however many workers fire reminders at the same time.
+func (s *Service) FireDueReminders(ctx context.Context) (int, error) {
+	fired := 0
+	for {
+		// Start database transaction
+		tx := s.store.dbConn.Begin()
+
+		reminders, err := s.store.ClaimDueReminders(ctx, time.Now(), reminderBatchSize, db.WithTx(tx))
+		if err != nil {
+			tx.Rollback()
+			return fired, fmt.Errorf("failed to claim due reminders: %w", err)
+		}
+
+		for _, reminder := range reminders {
+			if _, err := jobs.Enqueue(ctx, s.jobs, JobSendReminder, SendReminderArgs{ReminderID: reminder.ID}, jobs.WithTx(tx)); err != nil {
+				tx.Rollback()
+				return fired, fmt.Errorf("failed to enqueue reminder: %w", err)
+			}
+		}
+
+		// Commit transaction if all operations succeed
+		if err := tx.Commit().Error; err != nil {
+			return fired, fmt.Errorf("failed to commit db transaction: %w", err)
+		}
+
+		fired += len(reminders)
+		if len(reminders) < reminderBatchSize {
+			return fired, nil
+		}
+	}
+}
+
+// SendReminder sends a fired reminder through its notification channel. Reminders that were
+// deleted, on todos their user can't see anymore or that were completed meanwhile, are dropped.
+func (s *Service) SendReminder(ctx context.Context, args SendReminderArgs) error {
+	reminder, err := s.store.GetReminderByID(ctx, args.ReminderID)
+	if err != nil {
+		if errors.Is(err, ErrReminderNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get reminder: %w", err)
+	}
+
+	todo, err := s.store.GetAccessibleByID(ctx, reminder.UserID, reminder.TodoID)
+	if err != nil {
+		if errors.Is(err, ErrTodoNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get todo for reminder: %w", err)
+	}
+	if todo.Completed {
+		return nil
+	}
+
+	if err := s.notifier.Send(ctx, reminder.Channel, newReminderMessage(reminder, todo)); err != nil {
+		return fmt.Errorf("failed to send reminder: %w", err)
+	}
+	return nil
+}
+
+// Export writes the todos the specified user owns to w in the given format, in manual order.
+// Todos are read and written in batches, so exports of any size are streamed.
+func (s *Service) Export(ctx context.Context, userID int64, format FileFormat, w io.Writer) error {
+	projects, err := s.store.GetProjectsByUserID(ctx, userID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get projects by user id: %w", err)
+	}
+	names := make(map[int64]string, len(projects))
+	for _, project := range projects {
+		names[project.ID] = project.Name
+	}
+
+	exporter := newExporter(format, w)
+	if err := exporter.begin(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	err = s.store.EachByUserID(ctx, userID, exportBatchSize, func(todos []Todo) error {
+		for i := range todos {
+			var project string
+			if todos[i].ProjectID != nil {
+				project = names[*todos[i].ProjectID]
+			}
+			if err := exporter.write(&todos[i], project); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export todos: %w", err)
+	}
+
+	if err := exporter.end(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// RequestExport requests an export of the todos of the specified user, generated in the
+// background by a worker. The export file is saved along with its job, so that neither
+// exists without the other.
+func (s *Service) RequestExport(ctx context.Context, userID int64, format FileFormat) (*ExportFile, error) {
+	file, err := NewExportFile(userID, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.SaveExportFile(ctx, file, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to save export file: %w", err)
+	}
+
+	args := GenerateExportArgs{ExportID: file.ID, UserID: userID}
+	if _, err := jobs.Enqueue(ctx, s.jobs, JobGenerateExport, args, jobs.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return file, nil
+}
+
+// GetExportFile retrieves an export file of the specified user. Expired files are gone, even
+// before they are purged.
+func (s *Service) GetExportFile(ctx context.Context, userID, id int64) (*ExportFile, error) {
+	file, err := s.store.GetExportFileByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export file: %w", err)
+	}
+	if file.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("failed to get export file: %w", ErrExportNotFound)
+	}
+	return file, nil
+}
+
+// OpenExportFile retrieves a generated export file of the specified user along with a reader
+// of its content. The reader is seekable, so that downloads can be resumed.
+func (s *Service) OpenExportFile(ctx context.Context, userID, id int64) (*ExportFile, *storage.Reader, error) {
+	file, err := s.GetExportFile(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.Status != ExportReady {
+		return nil, nil, ErrExportNotReady
+	}
+
+	return file, storage.NewReader(ctx, s.blobs, file.BlobKey, file.Size), nil
+}
+
+// GenerateExport generates a requested export file and stores it in the blob store. The file
+// is written to a temporary file first, as the blob store needs its size upfront. When the
+// last attempt fails the export file is marked as failed, earlier failures are retried.
+func (s *Service) GenerateExport(ctx context.Context, args GenerateExportArgs) error {
+	file, err := s.store.GetExportFileByID(ctx, args.UserID, args.ExportID)
+	if err != nil {
+		if errors.Is(err, ErrExportNotFound) {
+			// Expired and purged before it could be generated
+			return nil
+		}
+		return fmt.Errorf("failed to get export file: %w", err)
+	}
+	if file.Status != ExportPending {
+		return nil
+	}
+
+	size, err := s.writeExport(ctx, file)
+	if err != nil {
+		if job, ok := jobs.FromContext(ctx); ok && job.LastAttempt() {
+			file.Status = ExportFailed
+			file.Error = "the export could not be generated"
+			if saveErr := s.store.SaveExportFile(context.WithoutCancel(ctx), file); saveErr != nil {
+				return fmt.Errorf("failed to save failed export file: %w", saveErr)
+			}
+		}
+		return err
+	}
+
+	now := time.Now()
+	file.Status = ExportReady
+	file.Size = size
+	file.CompletedAt = &now
+	file.ExpiresAt = now.Add(exportRetention)
+	if err := s.store.SaveExportFile(ctx, file); err != nil {
+		return fmt.Errorf("failed to save export file: %w", err)
+	}
+	return nil
+}
+
+// writeExport writes the todos of the owner of an export file to the blob store, returning
+// the size of the file
+func (s *Service) writeExport(ctx context.Context, file *ExportFile) (int64, error) {
+	tmp, err := os.CreateTemp("", "todos-export-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := s.Export(ctx, file.UserID, file.Format, tmp); err != nil {
+		return 0, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temporary export file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read temporary export file: %w", err)
+	}
+
+	if err := s.blobs.Put(ctx, file.BlobKey, tmp, size); err != nil {
+		return 0, fmt.Errorf("failed to store export file: %w", err)
+	}
+	return size, nil
+}
+
+// PurgeExpiredExports removes the export files of all users that expired, along with their
+// content, returning how many were removed
+func (s *Service) PurgeExpiredExports(ctx context.Context) (int64, error) {
+	files, err := s.store.GetExpiredExportFiles(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired export files: %w", err)
+	}
+
+	var purged int64
+	for _, file := range files {
+		// The content goes first, so that it is never left without a row pointing to it
+		if err := s.blobs.Delete(ctx, file.BlobKey); err != nil {
+			return purged, fmt.Errorf("failed to delete export blob: %w", err)
+		}
+		if err := s.store.DeleteExportFile(ctx, file.ID); err != nil {
+			return purged, fmt.Errorf("failed to delete export file: %w", err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Import creates the todos of a file for the specified user, first in the manual order and in
+// the order of the file. Projects and labels are matched by name and created when missing.
+// The import is all or nothing: when a row is invalid nothing is saved and the result lists
+// every invalid row along with ErrImportRejected. A dry run goes as far as saving the todos
+// in a transaction that is rolled back, so the result is exactly what a real import would give.
+func (s *Service) Import(ctx context.Context, userID int64, r io.Reader, params *ImportParams) (*ImportResult, error) {
+	rows, errs, err := readImport(r, params)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, errs := validateImport(userID, rows, errs, params.Project)
+	result := &ImportResult{
+		DryRun:          params.DryRun,
+		CreatedProjects: []string{},
+		CreatedLabels:   []string{},
+		Errors:          errs,
+	}
+	if result.Errors == nil {
+		result.Errors = []ImportError{}
+	}
+	if len(errs) > 0 {
+		return result, ErrImportRejected
+	}
+	if len(todos) == 0 {
+		return result, nil
+	}
+
+	inbox, err := s.inbox(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inbox: %w", err)
+	}
+
+	projects := map[string]*Project{}
+	owned, err := s.store.GetProjectsByUserID(ctx, userID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects by user id: %w", err)
+	}
+	for i := range owned {
+		if _, ok := projects[owned[i].Name]; !ok {
+			projects[owned[i].Name] = &owned[i]
+		}
+	}
+
+	labels := map[string]*Label{}
+	existing, err := s.store.GetLabelsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get labels by user id: %w", err)
+	}
+	for i := range existing {
+		labels[existing[i].Name] = &existing[i]
+	}
+
+	projectPosition, err := s.store.NextProjectPosition(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next project position: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	positions, err := s.importPositions(ctx, userID, len(todos), tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to position todos: %w", err)
+	}
+
+	touched := map[int64]bool{}
+	for i, item := range todos {
+		project := inbox
+		if item.project != "" {
+			p, ok := projects[item.project]
+			if !ok {
+				p = NewProject(userID, item.project, "", projectPosition)
+				if err := s.store.SaveProject(ctx, p, db.WithTx(tx)); err != nil {
+					tx.Rollback()
+					return nil, fmt.Errorf("failed to create project: %w", err)
+				}
+				projectPosition++
+				projects[p.Name] = p
+				result.CreatedProjects = append(result.CreatedProjects, p.Name)
+			}
+			project = p
+		}
+		touched[project.ID] = true
+
+		todo := item.todo
+		todo.ProjectID = &project.ID
+		todo.Position = positions[i]
+		if err := s.store.Save(ctx, todo, db.WithTx(tx)); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to create todo: %w", err)
+		}
+
+		for _, name := range item.labels {
+			label, ok := labels[name]
+			if !ok {
+				label = NewLabel(userID, name, "")
+				if err := s.store.SaveLabel(ctx, label, db.WithTx(tx)); err != nil {
+					tx.Rollback()
+					return nil, fmt.Errorf("failed to create label: %w", err)
+				}
+				labels[name] = label
+				result.CreatedLabels = append(result.CreatedLabels, name)
+			}
+			if err := s.store.AttachLabel(ctx, todo, label, db.WithTx(tx)); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to attach label: %w", err)
+			}
+		}
+
+		if err := s.record(ctx, userID, HistoryCreate, nil, todo, tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	result.Imported = len(todos)
+
+	if params.DryRun {
+		tx.Rollback()
+		return result, nil
+	}
+
+	var audience []int64
+	for projectID := range touched {
+		for _, id := range s.audience(ctx, userID, &projectID) {
+			if !slices.Contains(audience, id) {
+				audience = append(audience, id)
+			}
+		}
+	}
+	if err := s.emit(ctx, tx, EventTodosImported, audience, result); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	for projectID := range touched {
+		s.invalidate(ctx, userID, &projectID)
+	}
+
+	return result, nil
+}
+
+// importPositions returns the positions of n imported todos, in order, before the first todo
+// of the specified user
+func (s *Service) importPositions(ctx context.Context, userID int64, n int, tx *gorm.DB) ([]string, error) {
+	positions := make([]string, n)
+	if n == 0 {
+		return positions, nil
+	}
+
+	// The last todo goes right before the current first one, which may need a rebalance,
+	// and the others before it in turn
+	next, err := s.positionBetween(ctx, userID, tx, func() (string, string, error) {
+		first, err := s.store.FirstPosition(ctx, userID, db.WithTx(tx))
+		return "", first, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	positions[n-1] = next
+
+	for i := n - 2; i >= 0; i-- {
+		if next, err = rank.Between("", next); err != nil {
+			return nil, err
+		}
+		positions[i] = next
+	}
+	return positions, nil
+}
+
+// CreateLabel creates a new label for the specified user
+func (s *Service) CreateLabel(ctx context.Context, userID int64, req *CreateLabelRequest) (*Label, error) {
+	label := NewLabel(userID, req.Name, req.Color)
+
+	if err := s.store.SaveLabel(ctx, label); err != nil {
+		return nil, fmt.Errorf("failed to create label: %w", err)
+	}
+
+	return label, nil
+}
+
+// GetLabels retrieves all labels of the specified user
+func (s *Service) GetLabels(ctx context.Context, userID int64) ([]Label, error) {
+	labels, err := s.store.GetLabelsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get labels by user id: %w", err)
+	}
+	return labels, nil
+}
+
+// UpdateLabel renames and recolors an existing label of the specified user
+func (s *Service) UpdateLabel(ctx context.Context, userID, id int64, req *UpdateLabelRequest) (*Label, error) {
+	label, err := s.store.GetLabelByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get label for update: %w", err)
+	}
+
+	label.Rename(req.Name)
+	label.SetColor(req.Color)
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.SaveLabel(ctx, label, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update label: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventLabelUpdated, []int64{userID}, label); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache, cached todos embed their labels
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.Delete(ctx, cacheKey)
+
+	return label, nil
+}
+
+// DeleteLabel removes a label of the specified user and detaches it from all todos
+func (s *Service) DeleteLabel(ctx context.Context, userID, id int64) error {
+	label, err := s.store.GetLabelByID(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to get label for delete: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.DeleteLabel(ctx, userID, label.ID, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete label: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventLabelDeleted, []int64{userID}, label); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache, cached todos embed their labels
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.Delete(ctx, cacheKey)
+
+	return nil
+}
+
+// AttachLabel attaches a label to a todo the specified user can edit. Labels belong to the
+// owner of the todo, so members of a shared project use the labels of its owner.
+func (s *Service) AttachLabel(ctx context.Context, userID, id, labelID int64) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for label attach: %w", err)
+	}
+
+	label, err := s.store.GetLabelByID(ctx, todo.UserID, labelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get label for attach: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.AttachLabel(ctx, todo, label, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to attach label: %w", err)
+	}
+
+	// Events carry the todo with its labels
+	todo, err = s.store.GetAccessibleByID(ctx, userID, id, db.WithPreload(), db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get todo after label attach: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventTodoUpdated, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
+}
+
+// DetachLabel detaches a label of the owner of a todo from it, on behalf of the specified user
+func (s *Service) DetachLabel(ctx context.Context, userID, id, labelID int64) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for label detach: %w", err)
+	}
+
+	label, err := s.store.GetLabelByID(ctx, todo.UserID, labelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get label for detach: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.DetachLabel(ctx, todo, label, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to detach label: %w", err)
+	}
+
+	// Events carry the todo with its labels
+	todo, err = s.store.GetAccessibleByID(ctx, userID, id, db.WithPreload(), db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get todo after label detach: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventTodoUpdated, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
+}
+
+// MoveToProject moves a todo the specified user can edit to another project they can edit.
+// Todos can't change owner, so the project must belong to the owner of the todo.
+func (s *Service) MoveToProject(ctx context.Context, userID, id int64, req *MoveTodoRequest) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor, db.WithPreload())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for move: %w", err)
+	}
+
+	project, err := s.authorizeProject(ctx, userID, req.ProjectID, RoleEditor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for move: %w", err)
+	}
+	if project.UserID != todo.UserID {
+		return nil, fmt.Errorf("failed to get project for move: %w", ErrProjectNotFound)
+	}
+
+	from := todo.ProjectID
+	before := *todo
+	todo.ProjectID = &project.ID
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.Save(ctx, todo, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to move todo: %w", err)
+	}
+
+	if err := s.record(ctx, userID, HistoryUpdate, &before, todo, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Members of the project it left who can't see it anymore are told apart
+	audience := s.audience(ctx, todo.UserID, todo.ProjectID)
+	var left []int64
+	for _, id := range s.audience(ctx, todo.UserID, from) {
+		if !slices.Contains(audience, id) {
+			left = append(left, id)
+		}
+	}
+	audience = append(audience, left...)
+	if err := s.emitChange(ctx, tx, EventTodoMoved, change{UserIDs: audience, Left: left, Data: todo}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Members of both projects see the todo come or go
+	s.invalidate(ctx, todo.UserID, from)
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
+}
+
+// Reorder moves a todo the specified user can edit in the manual order of its owner, next to
+// the given anchors. Only the moved todo gets a new position, unless the positions around the
+// anchors have grown too long, in which case all the todos of the owner are rebalanced first.
+// A non-zero version fails the move with ErrVersionMismatch unless the todo is still at it.
+func (s *Service) Reorder(ctx context.Context, userID, id, version int64, req *ReorderTodoRequest) (*Todo, error) {
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	todo, err := s.reorderTodo(ctx, userID, id, version, req, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.emit(ctx, tx, EventTodoUpdated, s.audience(ctx, todo.UserID, todo.ProjectID), todo); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	s.invalidate(ctx, todo.UserID, todo.ProjectID)
+
+	return todo, nil
+}
+
+// reorderTodo moves a todo of the specified user in the manual order within the given transaction
+func (s *Service) reorderTodo(ctx context.Context, userID, id, version int64, req *ReorderTodoRequest, tx *gorm.DB) (*Todo, error) {
+	todo, err := s.authorize(ctx, userID, id, RoleEditor, db.WithPreload(), db.WithTx(tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo for reorder: %w", err)
+	}
+	expectVersion(todo, version)
+
+	if (req.Before != nil && *req.Before == id) || (req.After != nil && *req.After == id) {
+		return nil, fmt.Errorf("%w: todo can't be moved next to itself", ErrInvalidAnchor)
+	}
+
+	before := *todo
+
+	var neighbours func() (string, string, error)
+	switch {
+	case req.Before != nil && req.After != nil:
+		neighbours = func() (string, string, error) {
+			prev, err := s.anchor(ctx, todo.UserID, *req.After, tx)
+			if err != nil {
+				return "", "", err
+			}
+			next, err := s.anchor(ctx, todo.UserID, *req.Before, tx)
+			if err != nil {
+				return "", "", err
+			}
+			if prev.Position > next.Position || (prev.Position == next.Position && prev.ID > next.ID) {
+				return "", "", fmt.Errorf("%w: anchors are out of order", ErrInvalidAnchor)
+			}
+			return prev.Position, next.Position, nil
+		}
+	case req.Before != nil:
+		neighbours = s.nextTo(ctx, todo.UserID, *req.Before, id, true, tx)
+	default:
+		neighbours = s.nextTo(ctx, todo.UserID, *req.After, id, false, tx)
+	}
+
+	// Anchor errors are returned as is, their message is meant for the caller
+	position, err := s.positionBetween(ctx, todo.UserID, tx, neighbours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.SavePosition(ctx, todo, position, db.WithTx(tx)); err != nil {
+		return nil, fmt.Errorf("failed to reorder todo: %w", err)
+	}
+
+	if err := s.record(ctx, userID, HistoryMove, &before, todo, tx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// anchor loads a todo of the specified user that another one is moved next to, within the
+// transaction of the move so that its position reflects a rebalance
+func (s *Service) anchor(ctx context.Context, userID, id int64, tx *gorm.DB) (*Todo, error) {
+	anchor, err := s.store.GetByID(ctx, userID, id, db.WithTx(tx))
+	if errors.Is(err, ErrTodoNotFound) {
+		return nil, fmt.Errorf("%w: todo %d not found", ErrInvalidAnchor, id)
+	}
+	return anchor, err
+}
+
+// nextTo returns the neighbours of the gap right before or right after the anchor todo,
+// ignoring the todo being moved
+func (s *Service) nextTo(ctx context.Context, userID, anchorID, movingID int64, before bool, tx *gorm.DB) func() (string, string, error) {
+	return func() (string, string, error) {
+		anchor, err := s.anchor(ctx, userID, anchorID, tx)
+		if err != nil {
+			return "", "", err
+		}
+
+		adjacent, err := s.store.AdjacentPosition(ctx, anchor, movingID, before, db.WithTx(tx))
+		if err != nil {
+			return "", "", err
+		}
+
+		if before {
+			return adjacent, anchor.Position, nil
+		}
+		return anchor.Position, adjacent, nil
+	}
+}
+
+// positionBetween returns a position between the neighbours returned by the given function.
+// When the neighbours are tied or the position would be too long, the todos of the user are
+// rebalanced first and the neighbours, whose positions have changed, are looked up again.
+func (s *Service) positionBetween(ctx context.Context, userID int64, tx *gorm.DB, neighbours func() (string, string, error)) (string, error) {
+	after, before, err := neighbours()
+	if err != nil {
+		return "", err
+	}
+
+	position, err := rank.Between(after, before)
+	if err == nil && len(position) <= rank.MaxLength {
+		return position, nil
+	}
+
+	if err := s.store.Rebalance(ctx, userID, db.WithTx(tx)); err != nil {
+		return "", fmt.Errorf("failed to rebalance todo positions: %w", err)
+	}
+
+	after, before, err = neighbours()
+	if err != nil {
+		return "", err
+	}
+
+	position, err = rank.Between(after, before)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute todo position: %w", err)
+	}
+	return position, nil
+}
+
+// BackfillPositions gives a position to the todos created before todos could be ordered
+// manually, keeping their former newest first order, and returns the number of users whose
+// todos were rebalanced
+func (s *Service) BackfillPositions(ctx context.Context) (int, error) {
+	userIDs, err := s.store.GetUnpositionedUserIDs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get users with unpositioned todos: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		// Start database transaction
+		tx := s.store.dbConn.Begin()
+
+		if err := s.store.Rebalance(ctx, userID, db.WithTx(tx)); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to rebalance todo positions: %w", err)
+		}
+
+		// Commit transaction if all operations succeed
+		if err := tx.Commit().Error; err != nil {
+			return 0, fmt.Errorf("failed to commit db transaction: %w", err)
+		}
+
+		// Invalidate user's todo cache
+		cacheKey := fmt.Sprintf("todos:user:%d", userID)
+		s.cache.Delete(ctx, cacheKey)
+	}
+	return len(userIDs), nil
+}
+
+// inbox retrieves the inbox project of the specified user, creating it on first use
+func (s *Service) inbox(ctx context.Context, userID int64) (*Project, error) {
+	inbox, err := s.store.GetInbox(ctx, userID)
+	if !errors.Is(err, ErrProjectNotFound) {
+		return inbox, err
+	}
+
+	inbox = NewInbox(userID)
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	err = s.store.SaveProject(ctx, inbox, db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		// The inbox was created by a concurrent request in the meantime
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return s.store.GetInbox(ctx, userID)
+		}
+		return nil, fmt.Errorf("failed to save inbox: %w", err)
+	}
+
+	// Todos created before projects existed don't belong to any, they go to the inbox
+	err = s.store.MoveTodos(ctx, userID, nil, inbox.ID, db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to move todos to inbox: %w", err)
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.Delete(ctx, cacheKey)
+
+	return inbox, nil
+}
+
+// resolveProject retrieves the given project the specified user can add todos to, or their
+// inbox when none is given
+func (s *Service) resolveProject(ctx context.Context, userID int64, projectID *int64) (*Project, error) {
+	if projectID == nil {
+		inbox, err := s.inbox(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inbox: %w", err)
+		}
+		return inbox, nil
+	}
+
+	project, err := s.authorizeProject(ctx, userID, *projectID, RoleEditor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return project, nil
+}
+
+// CreateProject creates a new project for the specified user, last in order unless a position is given
+func (s *Service) CreateProject(ctx context.Context, userID int64, req *CreateProjectRequest) (*Project, error) {
+	// Make sure the inbox exists first, so it keeps the first position
+	if _, err := s.inbox(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to get inbox: %w", err)
+	}
+
+	var position int
+	if req.Position != nil {
+		position = *req.Position
+	} else {
+		next, err := s.store.NextProjectPosition(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next project position: %w", err)
+		}
+		position = next
+	}
+
+	project := NewProject(userID, req.Name, req.Color, position)
+
+	if err := s.store.SaveProject(ctx, project); err != nil {
+		return nil, fmt.Errorf("failed to create project: %w", err)
+	}
+
+	return project, nil
+}
+
+// GetProjects retrieves the projects of the specified user in display order, followed by the
+// projects shared with them by name, optionally filtered by their archived flag. The inbox is
+// created on first use.
+func (s *Service) GetProjects(ctx context.Context, userID int64, archived *bool) ([]Project, error) {
+	if _, err := s.inbox(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to get inbox: %w", err)
+	}
+
+	projects, err := s.store.GetProjectsByUserID(ctx, userID, archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects by user id: %w", err)
+	}
+	for i := range projects {
+		projects[i].Role = RoleOwner
+	}
+
+	shared, err := s.store.GetSharedProjectsByUserID(ctx, userID, archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared projects by user id: %w", err)
+	}
+	return append(projects, shared...), nil
+}
+
+// GetProject retrieves a project by its ID for the specified user, who owns it or is a member of it
+func (s *Service) GetProject(ctx context.Context, userID, id int64) (*Project, error) {
+	project, err := s.authorizeProject(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project by id: %w", err)
+	}
+	return project, nil
+}
+
+// GetProjectTodos retrieves a filtered and sorted page of the todos in a project the specified user can see
+func (s *Service) GetProjectTodos(ctx context.Context, userID, id int64, params *ListParams) (*TodoPage, error) {
+	project, err := s.authorizeProject(ctx, userID, id, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for todos: %w", err)
+	}
+
+	params.ProjectID = &project.ID
+	return s.GetByUserID(ctx, userID, params)
+}
+
+// UpdateProject updates an existing project the specified user owns. The inbox can be
+// recolored and reordered but never renamed or archived.
+func (s *Service) UpdateProject(ctx context.Context, userID, id int64, req *UpdateProjectRequest) (*Project, error) {
+	project, err := s.authorizeProject(ctx, userID, id, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for update: %w", err)
+	}
+
+	if project.Inbox && (normalizeName(req.Name) != project.Name || req.Archived) {
+		return nil, ErrInboxProject
+	}
+
+	renamed := normalizeName(req.Name) != project.Name
+	project.Rename(req.Name)
+	project.SetColor(req.Color)
+	project.Archived = req.Archived
+	if req.Position != nil {
+		project.Position = *req.Position
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.SaveProject(ctx, project, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update project: %w", err)
+	}
+
+	// Only a new name changes the todo lists
+	var audience []int64
+	if renamed {
+		audience = []int64{project.UserID}
+	}
+	if err := s.emit(ctx, tx, EventProjectUpdated, audience, project); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache, the feed embeds project names
+	if renamed {
+		cacheKey := fmt.Sprintf("todos:user:%d", project.UserID)
+		s.cache.Delete(ctx, cacheKey)
+	}
+
+	return project, nil
+}
+
+// DeleteProject removes a project of the specified user. Its todos are moved to the
+// trash along with it when cascade is set, and moved back to the inbox otherwise.
+// Only the user that created the project can delete it, its members lose access at once.
+func (s *Service) DeleteProject(ctx context.Context, userID, id int64, cascade bool) error {
+	project, err := s.authorizeProject(ctx, userID, id, RoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to get project for delete: %w", err)
+	}
+	if project.UserID != userID {
+		return ErrPermissionDenied
+	}
+
+	if project.Inbox {
+		return ErrInboxProject
+	}
+
+	// Members are deleted along with the project, gather them first to invalidate their cache
+	members, err := s.store.GetMembers(ctx, project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get project members: %w", err)
+	}
+
+	var inbox *Project
+	if !cascade {
+		inbox, err = s.inbox(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get inbox: %w", err)
+		}
+	}
+
+	audience := []int64{userID}
+	for _, member := range members {
+		audience = append(audience, member.UserID)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	// The todos are released one by one in history and events, like a batch
+	todos, err := s.store.GetByProjectID(ctx, userID, project.ID, db.WithPreload(), db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to get project todos: %w", err)
+	}
+
+	if cascade {
+		err = s.store.DeleteTodosByProjectID(ctx, userID, project.ID, db.WithTx(tx))
+	} else {
+		err = s.store.MoveTodos(ctx, userID, &project.ID, inbox.ID, db.WithTx(tx))
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to release project todos: %w", err)
+	}
+
+	events, err := s.releaseTodos(ctx, userID, todos, audience, inbox, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(events) > 0 {
+		if err := s.emit(ctx, tx, EventTodosBatched, audience, events); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = s.store.DeleteProject(ctx, userID, project.ID, db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventProjectDeleted, audience, project); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.Delete(ctx, cacheKey)
+	for _, member := range members {
+		cacheKey := fmt.Sprintf("todos:user:%d", member.UserID)
+		s.cache.Delete(ctx, cacheKey)
+	}
+
+	return nil
+}
+
+// releaseTodos records in history the todos of a deleted project, which were trashed, or moved
+// to the given inbox when there is one, and returns the changes the audience of the project is
+// told about. Members who can't see a moved todo anymore get it deleted.
+func (s *Service) releaseTodos(ctx context.Context, userID int64, todos []Todo, audience []int64, inbox *Project, tx *gorm.DB) ([]batchEvent, error) {
+	if inbox == nil {
+		events := make([]batchEvent, 0, len(todos))
+		for i := range todos {
+			deleted := todos[i]
+			deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			if err := s.record(ctx, userID, HistoryDelete, &todos[i], &deleted, tx); err != nil {
+				return nil, err
+			}
+			events = append(events, batchEvent{Type: EventTodoDeleted, UserIDs: audience, Todo: &todos[i]})
+		}
+		return events, nil
+	}
+
+	to := s.audience(ctx, userID, &inbox.ID)
+	left := slices.DeleteFunc(slices.Clone(audience), func(id int64) bool {
+		return slices.Contains(to, id)
+	})
+
+	events := make([]batchEvent, 0, 2*len(todos))
+	for i := range todos {
+		moved := todos[i]
+		moved.ProjectID = &inbox.ID
+		moved.Version++
+		moved.UpdatedAt = time.Now()
+		if err := s.record(ctx, userID, HistoryUpdate, &todos[i], &moved, tx); err != nil {
+			return nil, err
+		}
+		events = append(events, batchEvent{Type: EventTodoUpdated, UserIDs: to, Todo: &moved})
+		if len(left) > 0 {
+			events = append(events, batchEvent{Type: EventTodoDeleted, UserIDs: left, Todo: &moved})
+		}
+	}
+	return events, nil
+}
+
+// Invite invites a user to a project the specified user owns by email, with the given role.
+// Inviting an email that already has a pending invitation replaces its role.
+func (s *Service) Invite(ctx context.Context, userID, projectID int64, req *InviteRequest) (*Invitation, error) {
+	project, err := s.authorizeProject(ctx, userID, projectID, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for invitation: %w", err)
+	}
+
+	if project.Inbox {
+		return nil, ErrInboxProject
+	}
+
+	role, err := ParseRole(req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := NewInvitation(project.ID, req.Email, role, userID)
+
+	// The creator of the project and its members already have access
+	owner, err := s.users.GetByID(ctx, project.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project owner: %w", err)
+	}
+	if invitation.Addressed(owner.Email) {
+		return nil, ErrAlreadyMember
+	}
+
+	members, err := s.store.GetMembers(ctx, project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project members: %w", err)
+	}
+	for _, member := range members {
+		if invitation.Addressed(member.Email) {
+			return nil, ErrAlreadyMember
+		}
+	}
+
+	if err := s.store.SaveInvitation(ctx, invitation); err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// GetInvitations retrieves the pending invitations of a project the specified user owns
+func (s *Service) GetInvitations(ctx context.Context, userID, projectID int64) ([]Invitation, error) {
+	project, err := s.authorizeProject(ctx, userID, projectID, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for invitations: %w", err)
+	}
+
+	invitations, err := s.store.GetInvitationsByProjectID(ctx, project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitations by project id: %w", err)
+	}
+	return invitations, nil
+}
+
+// CancelInvitation removes a pending invitation of a project the specified user owns
+func (s *Service) CancelInvitation(ctx context.Context, userID, projectID, id int64) error {
+	project, err := s.authorizeProject(ctx, userID, projectID, RoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to get project for invitation: %w", err)
+	}
+
+	invitation, err := s.store.GetInvitationByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get invitation for cancel: %w", err)
+	}
+	if invitation.ProjectID != project.ID {
+		return ErrInvitationNotFound
+	}
+
+	if err := s.store.DeleteInvitation(ctx, invitation.ID); err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+	return nil
+}
+
+// GetReceivedInvitations retrieves the pending invitations addressed to the email of the specified user
+func (s *Service) GetReceivedInvitations(ctx context.Context, userID int64) ([]Invitation, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for invitations: %w", err)
+	}
+
+	invitations, err := s.store.GetInvitationsByEmail(ctx, u.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitations by email: %w", err)
+	}
+	return invitations, nil
+}
+
+// received loads an invitation addressed to the email of the specified user. Invitations
+// addressed to someone else are reported as ErrInvitationNotFound.
+func (s *Service) received(ctx context.Context, userID, id int64) (*Invitation, error) {
+	invitation, err := s.store.GetInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for invitation: %w", err)
+	}
+	if !invitation.Addressed(u.Email) {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation makes the specified user a member of the project they were invited to
+// and returns that project
+func (s *Service) AcceptInvitation(ctx context.Context, userID, id int64) (*Project, error) {
+	invitation, err := s.received(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation for accept: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	member := invitation.Accept(userID)
+	if err := s.store.SaveMember(ctx, member, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create member: %w", err)
+	}
+
+	if err := s.store.DeleteInvitation(ctx, invitation.ID, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventMemberJoined, []int64{userID}, member); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate user's todo cache, the todos of the project are now listed
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.Delete(ctx, cacheKey)
+
+	return s.GetProject(ctx, userID, invitation.ProjectID)
+}
+
+// DeclineInvitation removes a pending invitation addressed to the specified user
+func (s *Service) DeclineInvitation(ctx context.Context, userID, id int64) error {
+	invitation, err := s.received(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to get invitation for decline: %w", err)
+	}
+
+	if err := s.store.DeleteInvitation(ctx, invitation.ID); err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+	return nil
+}
+
+// GetMembers retrieves the members of a project the specified user can see
+func (s *Service) GetMembers(ctx context.Context, userID, projectID int64) ([]Member, error) {
+	project, err := s.authorizeProject(ctx, userID, projectID, RoleViewer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for members: %w", err)
+	}
+
+	members, err := s.store.GetMembers(ctx, project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project members: %w", err)
+	}
+	return members, nil
+}
+
+// UpdateMember changes the role of a member of a project the specified user owns
+func (s *Service) UpdateMember(ctx context.Context, userID, projectID, memberID int64, req *UpdateMemberRequest) (*Member, error) {
+	project, err := s.authorizeProject(ctx, userID, projectID, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project for member update: %w", err)
+	}
+
+	role, err := ParseRole(req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.store.GetMember(ctx, project.ID, memberID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member for update: %w", err)
+	}
+
+	member.Role = role
+	member.UpdatedAt = time.Now()
+
+	if err := s.store.SaveMember(ctx, member); err != nil {
+		return nil, fmt.Errorf("failed to update member: %w", err)
+	}
+	return member, nil
+}
+
+// RemoveMember revokes the access of a member to a project the specified user owns, or lets
+// the specified user leave a project shared with them. Access is checked on every request,
+// so the member loses it at once, and their cached todos are invalidated.
+func (s *Service) RemoveMember(ctx context.Context, userID, projectID, memberID int64) error {
+	required := RoleOwner
+	if memberID == userID {
+		required = RoleViewer
+	}
+
+	project, err := s.authorizeProject(ctx, userID, projectID, required)
+	if err != nil {
+		return fmt.Errorf("failed to get project for member removal: %w", err)
+	}
+
+	member, err := s.store.GetMember(ctx, project.ID, memberID)
+	if err != nil {
+		return fmt.Errorf("failed to get member for removal: %w", err)
+	}
+
+	// Start database transaction
+	tx := s.store.dbConn.Begin()
+
+	if err := s.store.DeleteMember(ctx, project.ID, member.UserID, db.WithTx(tx)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete member: %w", err)
+	}
+
+	if err := s.emit(ctx, tx, EventMemberRemoved, []int64{member.UserID}, member); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction if all operations succeed
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	// Invalidate member's todo cache, the todos of the project are no longer listed
+	cacheKey := fmt.Sprintf("todos:user:%d", member.UserID)
+	s.cache.Delete(ctx, cacheKey)
+
+	return nil
+}
+
+// CreateFeed creates the iCalendar feed of the specified user and returns its secret token.
+// Creating the feed again gives it a new token, the previous one stops working at once.
+func (s *Service) CreateFeed(ctx context.Context, userID int64) (*FeedToken, string, error) {
+	feedToken, token, err := NewFeedToken(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.store.SaveFeedToken(ctx, feedToken); err != nil {
+		return nil, "", fmt.Errorf("failed to save feed token: %w", err)
+	}
+
+	return feedToken, token, nil
+}
+
+// GetFeed retrieves the feed token of the specified user, without the token itself
+func (s *Service) GetFeed(ctx context.Context, userID int64) (*FeedToken, error) {
+	feedToken, err := s.store.GetFeedToken(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed token: %w", err)
+	}
+	return feedToken, nil
+}
+
+// RevokeFeed deletes the feed of the specified user, its token stops working at once
+func (s *Service) RevokeFeed(ctx context.Context, userID int64) error {
+	deleted, err := s.store.DeleteFeedToken(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete feed token: %w", err)
+	}
+	if !deleted {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// ResolveFeed returns the user the feed with the given token belongs to
+func (s *Service) ResolveFeed(ctx context.Context, token string) (int64, error) {
+	feedToken, err := s.store.GetFeedTokenByHash(ctx, hashFeedToken(token))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get feed token: %w", err)
+	}
+	return feedToken.UserID, nil
+}
+
+// FeedETag returns the entity tag of the current feed of the specified user if it is cached,
+// so that polling clients can be answered without reading their todos. The tag is kept
+// with the cached todo lists of the user, and invalidated along with them.
+func (s *Service) FeedETag(ctx context.Context, userID int64) string {
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	etag, err := s.cache.HGet(ctx, cacheKey, feedCacheField)
+	if err != nil {
+		return ""
+	}
+	return etag
+}
+
+// Feed renders the iCalendar feed of the todos the specified user owns and caches its entity tag
+func (s *Service) Feed(ctx context.Context, userID int64) (*Feed, error) {
+	var buf bytes.Buffer
+	if err := s.Export(ctx, userID, FormatICS, &buf); err != nil {
+		return nil, err
+	}
+	feed := newFeed(buf.Bytes())
+
+	// Cache the entity tag of the feed
+	cacheKey := fmt.Sprintf("todos:user:%d", userID)
+	s.cache.HSet(ctx, cacheKey, feedCacheField, feed.ETag, 10*time.Minute)
+
+	return feed, nil
 }
@@ -2,11 +2,21 @@ package todo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/rank"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// rebalanceBatchSize is how many positions a rebalance writes per statement, well below the
+// number of bind parameters Postgres accepts
+const rebalanceBatchSize = 1000
+
 // store implements todo data persistence using GORM
 type store struct {
 	dbConn *gorm.DB
@@ -17,7 +27,12 @@ func NewStore(dbConn *gorm.DB) *store {
 	return &store{dbConn: dbConn}
 }
 
-// Save persists a todo to the database (create or update)
+// Save persists a todo to the database (create or update). Labels are left
+// untouched, they are attached and detached with AttachLabel and DetachLabel,
+// and so is the position of an existing todo, which is changed with SavePosition,
+// and its comment count, which is maintained along with its comments.
+// Updates are a compare-and-swap on the version of the todo, which is incremented
+// on success, and fail with ErrVersionMismatch if the stored version differs.
 func (s *store) Save(ctx context.Context, todo *Todo, options ...db.Option) error {
 	dbConn := s.dbConn
 
@@ -30,13 +45,57 @@ func (s *store) Save(ctx context.Context, todo *Todo, options ...db.Option) erro
 		dbConn = opts.Tx
 	}
 
-	return dbConn.WithContext(ctx).Save(todo).Error
+	if todo.ID == 0 {
+		return dbConn.WithContext(ctx).Omit(clause.Associations).Create(todo).Error
+	}
+
+	version := todo.Version
+	todo.Version++
+
+	result := dbConn.WithContext(ctx).
+		Model(todo).
+		Select("*").
+		Omit(clause.Associations, "position", "comment_count").
+		Where("version = ?", version).
+		Updates(todo)
+	if result.Error != nil {
+		todo.Version = version
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		todo.Version = version
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// preloadLabels loads the labels of the queried todos, ordered by name
+func preloadLabels(dbConn *gorm.DB) *gorm.DB {
+	return dbConn.Preload("Labels", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("labels.name ASC")
+	})
 }
 
-// GetByID retrieves a todo by its ID from the database
-func (s *store) GetByID(ctx context.Context, id int64) (*Todo, error) {
+// GetByID retrieves a todo by its ID from the database, scoped to the owning user
+func (s *store) GetByID(ctx context.Context, userID, id int64, options ...db.Option) (*Todo, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	query := dbConn.WithContext(ctx).Where("user_id = ?", userID)
+	if opts.Preload {
+		query = preloadLabels(query)
+	}
+
 	var todo Todo
-	if err := s.dbConn.WithContext(ctx).First(&todo, id).Error; err != nil {
+	if err := query.First(&todo, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, ErrTodoNotFound
 		}
@@ -45,16 +104,1332 @@ func (s *store) GetByID(ctx context.Context, id int64) (*Todo, error) {
 	return &todo, nil
 }
 
-// GetByUserID retrieves all todos for a specific user from the database
-func (s *store) GetByUserID(ctx context.Context, userID int64) ([]Todo, error) {
+// GetByUserID retrieves the todos of a specific user, owned or shared with them, matching the
+// given query from the database
+func (s *store) GetByUserID(ctx context.Context, q *listQuery, options ...db.Option) ([]Todo, error) {
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	query := s.dbConn.WithContext(ctx).Scopes(accessibleTo(q.UserID))
+	if opts.Preload {
+		query = preloadLabels(query)
+	}
+
+	if q.ProjectID != nil {
+		query = query.Where("project_id = ?", *q.ProjectID)
+	}
+	if q.Completed != nil {
+		query = query.Where("completed = ?", *q.Completed)
+	}
+	if q.CreatedAfter != nil {
+		query = query.Where("created_at > ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *q.CreatedBefore)
+	}
+	if q.UpdatedSince != nil {
+		query = query.Where("updated_at >= ?", *q.UpdatedSince)
+	}
+	if q.Due != nil {
+		if q.Due.From != nil {
+			query = query.Where("due_at >= ?", *q.Due.From)
+		}
+		query = query.Where("due_at < ?", q.Due.Before)
+		if q.Due.Overdue {
+			query = query.Where("completed = ?", false)
+		}
+	}
+	if q.Label != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM todo_labels JOIN labels ON labels.id = todo_labels.label_id "+
+			"WHERE todo_labels.todo_id = todos.id AND labels.user_id = ? AND labels.name = ?)", q.UserID, q.Label)
+	}
+
+	// The sort column comes from a fixed set, so it is safe to inline
+	direction, comparison := "ASC", ">"
+	if q.Sort.desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.After != nil {
+		value, err := q.Sort.parseValue(q.After.Value)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", q.Sort.column, comparison), value, q.After.ID)
+	}
+
+	var todos []Todo
+	order := fmt.Sprintf("%s %s, id %s", q.Sort.column, direction, direction)
+	if err := query.Order(order).Limit(q.Limit).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// Search retrieves the todos of a specific user, owned or shared with them, matching a
+// full-text query from the database, ordered by relevance and with the matching terms
+// highlighted. Trashed todos are filtered out explicitly as GORM doesn't scope raw table queries.
+func (s *store) Search(ctx context.Context, q *searchQuery, options ...db.Option) ([]searchRow, error) {
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	const highlightOptions = "StartSel=<mark>, StopSel=</mark>"
+	const rank = "ts_rank(todos.search_vector, query)"
+
+	// Highlights are HTML, so the text is escaped before the <mark> tags are added
+	const escapeHTML = "replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+
+	query := s.dbConn.WithContext(ctx).
+		Table("todos, to_tsquery('simple', ?) AS query", q.TSQuery).
+		Select("todos.*, "+rank+" AS rank, "+
+			"ts_headline('simple', "+fmt.Sprintf(escapeHTML, "todos.title")+", query, ?) AS title_highlight, "+
+			"ts_headline('simple', "+fmt.Sprintf(escapeHTML, "todos.description")+", query, ?) AS description_highlight",
+			highlightOptions+", HighlightAll=true", highlightOptions+", MaxFragments=2").
+		Scopes(accessibleTo(q.UserID)).
+		Where("todos.deleted_at IS NULL AND todos.search_vector @@ query")
+
+	if q.After != nil {
+		query = query.Where("("+rank+", todos.id) < (?::real, ?)", q.After.Value, q.After.ID)
+	}
+
+	var rows []searchRow
+	if err := query.Order("rank DESC, todos.id DESC").Limit(q.Limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// Preload doesn't apply to scanned rows, so their labels are loaded separately
+	if opts.Preload && len(rows) > 0 {
+		todos := make([]*Todo, len(rows))
+		for i := range rows {
+			todos[i] = &rows[i].Todo
+		}
+		if err := s.loadLabels(ctx, todos); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// loadLabels fills in the labels of the given todos, ordered by name
+func (s *store) loadLabels(ctx context.Context, todos []*Todo) error {
+	ids := make([]int64, len(todos))
+	byID := make(map[int64]*Todo, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+		byID[todo.ID] = todo
+		todo.Labels = []Label{}
+	}
+
+	var rows []struct {
+		TodoID int64
+		Label
+	}
+	err := s.dbConn.WithContext(ctx).
+		Table("labels").
+		Select("labels.*, todo_labels.todo_id").
+		Joins("JOIN todo_labels ON todo_labels.label_id = labels.id").
+		Where("todo_labels.todo_id IN ?", ids).
+		Order("labels.name ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		todo := byID[row.TodoID]
+		todo.Labels = append(todo.Labels, row.Label)
+	}
+	return nil
+}
+
+// EachByUserID calls fn with the todos owned by a specific user in manual order, labels
+// included, reading them in batches of the given size so they are never all in memory.
+// Iteration stops at the first error fn returns.
+func (s *store) EachByUserID(ctx context.Context, userID int64, batchSize int, fn func([]Todo) error) error {
+	var lastPosition string
+	var lastID int64
+	for {
+		query := s.dbConn.WithContext(ctx).Where("user_id = ?", userID)
+		if lastID != 0 {
+			query = query.Where("(position, id) > (?, ?)", lastPosition, lastID)
+		}
+
+		var todos []Todo
+		if err := query.Order("position ASC, id ASC").Limit(batchSize).Find(&todos).Error; err != nil {
+			return err
+		}
+		if len(todos) == 0 {
+			return nil
+		}
+
+		ptrs := make([]*Todo, len(todos))
+		for i := range todos {
+			ptrs[i] = &todos[i]
+		}
+		if err := s.loadLabels(ctx, ptrs); err != nil {
+			return err
+		}
+
+		if err := fn(todos); err != nil {
+			return err
+		}
+		if len(todos) < batchSize {
+			return nil
+		}
+
+		last := todos[len(todos)-1]
+		lastPosition, lastID = last.Position, last.ID
+	}
+}
+
+// Delete moves a todo to the trash by its ID, scoped to the owning user, as long as it is
+// still at the given version
+func (s *store) Delete(ctx context.Context, userID, id, version int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	result := dbConn.WithContext(ctx).
+		Model(&Todo{}).
+		Where("user_id = ? AND id = ? AND version = ?", userID, id, version).
+		Updates(map[string]any{"deleted_at": time.Now(), "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// GetTrashByUserID retrieves a page of the trashed todos of a specific user from the
+// database, most recently deleted first
+func (s *store) GetTrashByUserID(ctx context.Context, userID int64, after *cursor, limit int, options ...db.Option) ([]Todo, error) {
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	query := s.dbConn.WithContext(ctx).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	if opts.Preload {
+		query = preloadLabels(query)
+	}
+
+	if after != nil {
+		value, err := trashSort.parseValue(after.Value)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(deleted_at, id) < (?, ?)", value, after.ID)
+	}
+
 	var todos []Todo
-	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).Find(&todos).Error; err != nil {
+	if err := query.Order("deleted_at DESC, id DESC").Limit(limit).Find(&todos).Error; err != nil {
 		return nil, err
 	}
 	return todos, nil
 }
 
-// Delete removes a todo from the database by its ID
-func (s *store) Delete(ctx context.Context, id int64) error {
-	return s.dbConn.WithContext(ctx).Delete(&Todo{}, id).Error
+// GetTrashedByID retrieves a trashed todo by its ID from the database, scoped to the owning user
+func (s *store) GetTrashedByID(ctx context.Context, userID, id int64) (*Todo, error) {
+	var todo Todo
+	err := s.dbConn.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		First(&todo, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTodoNotFound
+		}
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// Restore takes a todo out of the trash into the given project, scoped to the owning user
+func (s *store) Restore(ctx context.Context, userID, id, projectID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Unscoped().
+		Model(&Todo{}).
+		Where("user_id = ? AND id = ?", userID, id).
+		Updates(map[string]any{"deleted_at": nil, "project_id": projectID, "version": gorm.Expr("version + 1"), "updated_at": time.Now()}).Error
+}
+
+// Purge permanently removes a trashed todo from the database by its ID, scoped to the owning user
+func (s *store) Purge(ctx context.Context, userID, id int64) error {
+	return s.dbConn.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Delete(&Todo{}, id).Error
+}
+
+// EmptyTrash permanently removes every trashed todo of a specific user from the database
+func (s *store) EmptyTrash(ctx context.Context, userID int64) (int64, error) {
+	result := s.dbConn.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Delete(&Todo{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeDeletedBefore permanently removes the todos of all users trashed before the given time from the database
+func (s *store) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := s.dbConn.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", before).
+		Delete(&Todo{})
+	return result.RowsAffected, result.Error
+}
+
+// SaveHistory persists a history entry of a todo to the database
+func (s *store) SaveHistory(ctx context.Context, entry *HistoryEntry, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Create(entry).Error
+}
+
+// GetHistory retrieves up to limit history entries of a todo from the database, most recent
+// change first, starting right after the given cursor if any
+func (s *store) GetHistory(ctx context.Context, todoID int64, after *cursor, limit int) ([]HistoryEntry, error) {
+	query := s.dbConn.WithContext(ctx).Where("todo_id = ?", todoID)
+
+	if after != nil {
+		value, err := historySort.parseValue(after.Value)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", value, after.ID)
+	}
+
+	var entries []HistoryEntry
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SaveComment persists a comment to the database (create or update)
+func (s *store) SaveComment(ctx context.Context, comment *Comment, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(comment).Error
+}
+
+// GetCommentByID retrieves a comment of a todo by its ID from the database. Deleted
+// comments are reported as ErrCommentNotFound.
+func (s *store) GetCommentByID(ctx context.Context, todoID, id int64) (*Comment, error) {
+	var comment Comment
+	err := s.dbConn.WithContext(ctx).
+		Where("todo_id = ?", todoID).
+		First(&comment, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetComments retrieves a page of the comments of a todo from the database, oldest first.
+// Deleted comments are included so that the replies to them keep their place in the thread.
+func (s *store) GetComments(ctx context.Context, todoID int64, after *cursor, limit int) ([]Comment, error) {
+	query := s.dbConn.WithContext(ctx).Unscoped().Where("todo_id = ?", todoID)
+
+	if after != nil {
+		value, err := commentSort.parseValue(after.Value)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at, id) > (?, ?)", value, after.ID)
+	}
+
+	var comments []Comment
+	if err := query.Order("created_at ASC, id ASC").Limit(limit).Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// DeleteComment soft deletes a comment from the database
+func (s *store) DeleteComment(ctx context.Context, comment *Comment, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Delete(comment).Error
+}
+
+// AddCommentCount adds delta to the comment count of a todo. The version of the todo is left
+// as is, comments aren't changes to the todo that concurrent writers need to know about.
+func (s *store) AddCommentCount(ctx context.Context, todo *Todo, delta int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	err := dbConn.WithContext(ctx).
+		Model(&Todo{}).
+		Where("id = ?", todo.ID).
+		UpdateColumn("comment_count", gorm.Expr("comment_count + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+
+	todo.CommentCount += delta
+	return nil
+}
+
+// SaveAttachment persists an attachment to the database
+func (s *store) SaveAttachment(ctx context.Context, attachment *Attachment, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Create(attachment).Error
+}
+
+// GetAttachmentByID retrieves an attachment of a todo by its ID from the database
+func (s *store) GetAttachmentByID(ctx context.Context, todoID, id int64) (*Attachment, error) {
+	var attachment Attachment
+	err := s.dbConn.WithContext(ctx).
+		Where("todo_id = ?", todoID).
+		First(&attachment, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetAttachments retrieves the attachments of a todo from the database, oldest first
+func (s *store) GetAttachments(ctx context.Context, todoID int64) ([]Attachment, error) {
+	var attachments []Attachment
+	err := s.dbConn.WithContext(ctx).
+		Where("todo_id = ?", todoID).
+		Order("created_at ASC, id ASC").
+		Find(&attachments).Error
+	return attachments, err
+}
+
+// DeleteAttachment removes an attachment from the database by its ID
+func (s *store) DeleteAttachment(ctx context.Context, id int64) error {
+	return s.dbConn.WithContext(ctx).Delete(&Attachment{}, id).Error
+}
+
+// LockStorageUsage takes a transaction level advisory lock on the storage usage of a specific
+// user, so that concurrent uploads can't all pass the quota check. It only makes sense
+// within a transaction.
+func (s *store) LockStorageUsage(ctx context.Context, userID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(?)", userID).Error
+}
+
+// GetStorageUsage returns the total size in bytes of the attachments uploaded by a specific
+// user, including the ones of todos in the trash
+func (s *store) GetStorageUsage(ctx context.Context, userID int64, options ...db.Option) (int64, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	var usage int64
+	err := dbConn.WithContext(ctx).
+		Model(&Attachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&usage).Error
+	return usage, err
+}
+
+// GetTrashAttachmentKeys returns the blob keys of the attachments of the trashed todos of
+// a specific user, or of a single one of them when id is set
+func (s *store) GetTrashAttachmentKeys(ctx context.Context, userID int64, id *int64) ([]string, error) {
+	todoIDs := s.dbConn.Unscoped().Model(&Todo{}).Select("id").
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	if id != nil {
+		todoIDs = todoIDs.Where("id = ?", *id)
+	}
+	return s.attachmentKeys(ctx, todoIDs)
+}
+
+// GetExpiredAttachmentKeys returns the blob keys of the attachments of the todos of all users
+// trashed before the given time
+func (s *store) GetExpiredAttachmentKeys(ctx context.Context, before time.Time) ([]string, error) {
+	todoIDs := s.dbConn.Unscoped().Model(&Todo{}).Select("id").Where("deleted_at < ?", before)
+	return s.attachmentKeys(ctx, todoIDs)
+}
+
+// attachmentKeys returns the blob keys of the attachments of the todos selected by a subquery
+func (s *store) attachmentKeys(ctx context.Context, todoIDs *gorm.DB) ([]string, error) {
+	var keys []string
+	err := s.dbConn.WithContext(ctx).
+		Model(&Attachment{}).
+		Where("todo_id IN (?)", todoIDs).
+		Pluck("blob_key", &keys).Error
+	return keys, err
+}
+
+// FirstPosition returns the position of the first todo in the manual order of a specific
+// user, or an empty string if the user has no positioned todo
+func (s *store) FirstPosition(ctx context.Context, userID int64, options ...db.Option) (string, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	var positions []string
+	err := dbConn.WithContext(ctx).
+		Model(&Todo{}).
+		Where("user_id = ? AND position <> ''", userID).
+		Order("position ASC").
+		Limit(1).
+		Pluck("position", &positions).Error
+	if err != nil || len(positions) == 0 {
+		return "", err
+	}
+	return positions[0], nil
+}
+
+// AdjacentPosition returns the position of the todo right before, or right after, the given
+// todo in the manual order of a specific user, or an empty string at either end of the list.
+// The todo being moved is skipped, so that moving it next to its own neighbour is a no-op.
+func (s *store) AdjacentPosition(ctx context.Context, anchor *Todo, movingID int64, before bool, options ...db.Option) (string, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	comparison, direction := ">", "ASC"
+	if before {
+		comparison, direction = "<", "DESC"
+	}
+
+	var positions []string
+	err := dbConn.WithContext(ctx).
+		Model(&Todo{}).
+		Where("user_id = ? AND id <> ?", anchor.UserID, movingID).
+		Where(fmt.Sprintf("(position, id) %s (?, ?)", comparison), anchor.Position, anchor.ID).
+		Order(fmt.Sprintf("position %s, id %s", direction, direction)).
+		Limit(1).
+		Pluck("position", &positions).Error
+	if err != nil || len(positions) == 0 {
+		return "", err
+	}
+	return positions[0], nil
+}
+
+// SavePosition moves a todo to the given position, as a compare-and-swap on its version
+// like Save
+func (s *store) SavePosition(ctx context.Context, todo *Todo, position string, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	now := time.Now()
+	result := dbConn.WithContext(ctx).
+		Model(&Todo{}).
+		Where("user_id = ? AND id = ? AND version = ?", todo.UserID, todo.ID, todo.Version).
+		Updates(map[string]any{"position": position, "version": todo.Version + 1, "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionMismatch
+	}
+
+	todo.Position = position
+	todo.Version++
+	todo.UpdatedAt = now
+	return nil
+}
+
+// Rebalance rewrites the positions of every todo of a specific user, trashed ones included,
+// with the shortest keys that keep their manual order, ties included. Todos without a position
+// yet are put first, newest first, which was the order of the list before manual ordering.
+// As the order itself doesn't change, neither do the versions of the todos.
+func (s *store) Rebalance(ctx context.Context, userID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	var ids []int64
+	err := dbConn.WithContext(ctx).Unscoped().
+		Model(&Todo{}).
+		Where("user_id = ?", userID).
+		Order("position ASC, CASE WHEN position = '' THEN created_at END DESC, id ASC").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	// Positions are written in bulk, a single statement per batch rather than one per todo
+	positions := rank.Sequence(len(ids))
+	for start := 0; start < len(ids); start += rebalanceBatchSize {
+		end := min(start+rebalanceBatchSize, len(ids))
+
+		values := make([]string, 0, end-start)
+		args := make([]any, 0, 2*(end-start))
+		for i := start; i < end; i++ {
+			values = append(values, "(?::bigint, ?::text)")
+			args = append(args, ids[i], positions[i])
+		}
+
+		err := dbConn.WithContext(ctx).Exec(
+			"UPDATE todos SET position = v.position FROM (VALUES "+strings.Join(values, ", ")+") AS v(id, position) WHERE todos.id = v.id",
+			args...,
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnpositionedUserIDs returns the users that have todos without a position, created
+// before todos could be ordered manually
+func (s *store) GetUnpositionedUserIDs(ctx context.Context) ([]int64, error) {
+	var userIDs []int64
+	err := s.dbConn.WithContext(ctx).Unscoped().
+		Model(&Todo{}).
+		Where("position = ''").
+		Distinct().
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// SaveLabel persists a label to the database (create or update)
+func (s *store) SaveLabel(ctx context.Context, label *Label, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	if err := dbConn.WithContext(ctx).Save(label).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrLabelAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+// GetLabelByID retrieves a label by its ID from the database, scoped to the owning user
+func (s *store) GetLabelByID(ctx context.Context, userID, id int64) (*Label, error) {
+	var label Label
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).First(&label, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrLabelNotFound
+		}
+		return nil, err
+	}
+	return &label, nil
+}
+
+// GetLabelsByUserID retrieves all labels of a specific user from the database, ordered by name
+func (s *store) GetLabelsByUserID(ctx context.Context, userID int64) ([]Label, error) {
+	var labels []Label
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).Order("name ASC").Find(&labels).Error; err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// DeleteLabel removes a label from the database by its ID, scoped to the owning user.
+// The label is detached from its todos by the cascading foreign key of the join table.
+func (s *store) DeleteLabel(ctx context.Context, userID, id int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Where("user_id = ?", userID).Delete(&Label{}, id).Error
+}
+
+// AttachLabel attaches a label to a todo, attaching an already attached label is a no-op
+func (s *store) AttachLabel(ctx context.Context, todo *Todo, label *Label, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Model(todo).Association("Labels").Append(label)
+}
+
+// DetachLabel detaches a label from a todo, detaching a label that isn't attached is a no-op
+func (s *store) DetachLabel(ctx context.Context, todo *Todo, label *Label, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Model(todo).Association("Labels").Delete(label)
+}
+
+// SaveProject persists a project to the database (create or update)
+func (s *store) SaveProject(ctx context.Context, project *Project, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(project).Error
+}
+
+// GetProjectByID retrieves a project by its ID from the database, scoped to the owning user
+func (s *store) GetProjectByID(ctx context.Context, userID, id int64) (*Project, error) {
+	var project Project
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).First(&project, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetInbox retrieves the inbox project of a specific user from the database
+func (s *store) GetInbox(ctx context.Context, userID int64) (*Project, error) {
+	var project Project
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ? AND inbox", userID).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetProjectsByUserID retrieves the projects of a specific user from the database in
+// display order, optionally filtered by their archived flag
+func (s *store) GetProjectsByUserID(ctx context.Context, userID int64, archived *bool) ([]Project, error) {
+	query := s.dbConn.WithContext(ctx).Where("user_id = ?", userID)
+	if archived != nil {
+		query = query.Where("archived = ?", *archived)
+	}
+
+	var projects []Project
+	if err := query.Order("position ASC, id ASC").Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// NextProjectPosition returns the position that puts a new project last for a specific user
+func (s *store) NextProjectPosition(ctx context.Context, userID int64) (int, error) {
+	var position int
+	err := s.dbConn.WithContext(ctx).
+		Model(&Project{}).
+		Select("COALESCE(MAX(position), 0) + 1").
+		Where("user_id = ?", userID).
+		Scan(&position).Error
+	return position, err
+}
+
+// DeleteProject removes a project from the database by its ID, scoped to the owning user
+func (s *store) DeleteProject(ctx context.Context, userID, id int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Where("user_id = ?", userID).Delete(&Project{}, id).Error
+}
+
+// MoveTodos moves every todo of a specific user from one project to another, trashed
+// ones included. A nil source project moves the todos that don't belong to any project yet.
+func (s *store) MoveTodos(ctx context.Context, userID int64, fromProjectID *int64, toProjectID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	query := dbConn.WithContext(ctx).Unscoped().Model(&Todo{}).Where("user_id = ?", userID)
+	if fromProjectID != nil {
+		query = query.Where("project_id = ?", *fromProjectID)
+	} else {
+		query = query.Where("project_id IS NULL")
+	}
+
+	return query.Updates(map[string]any{"project_id": toProjectID, "version": gorm.Expr("version + 1"), "updated_at": time.Now()}).Error
+}
+
+// GetByProjectID retrieves the todos of a specific user in the given project from the database
+func (s *store) GetByProjectID(ctx context.Context, userID, projectID int64, options ...db.Option) ([]Todo, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	query := dbConn.WithContext(ctx).Where("user_id = ? AND project_id = ?", userID, projectID)
+	if opts.Preload {
+		query = preloadLabels(query)
+	}
+
+	var todos []Todo
+	if err := query.Order("id ASC").Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// DeleteTodosByProjectID moves every todo of a specific user in the given project to the trash
+func (s *store) DeleteTodosByProjectID(ctx context.Context, userID, projectID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Where("user_id = ? AND project_id = ?", userID, projectID).Delete(&Todo{}).Error
+}
+
+// accessibleTo scopes a todo query to the todos a specific user owns or that are in a
+// project shared with them
+func accessibleTo(userID int64) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("todos.user_id = ? OR todos.project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID, userID)
+	}
+}
+
+// GetAccessibleByID retrieves a todo by its ID from the database, provided the given user
+// owns it or it is in a project shared with them
+func (s *store) GetAccessibleByID(ctx context.Context, userID, id int64, options ...db.Option) (*Todo, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	query := dbConn.WithContext(ctx).Scopes(accessibleTo(userID))
+	if opts.Preload {
+		query = preloadLabels(query)
+	}
+
+	var todo Todo
+	if err := query.First(&todo, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTodoNotFound
+		}
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// GetAccessibleProjectByID retrieves a project by its ID from the database, provided the
+// given user owns it or it is shared with them
+func (s *store) GetAccessibleProjectByID(ctx context.Context, userID, id int64) (*Project, error) {
+	var project Project
+	err := s.dbConn.WithContext(ctx).
+		Where("user_id = ? OR id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID, userID).
+		First(&project, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return &project, nil
+}
+
+// sharedProjectRow is the row shape returned by the store when listing shared projects
+type sharedProjectRow struct {
+	Project
+	MemberRole Role
+}
+
+// GetSharedProjectsByUserID retrieves the projects shared with a specific user from the database,
+// along with their role, ordered by name. A nil archived flag returns all projects.
+func (s *store) GetSharedProjectsByUserID(ctx context.Context, userID int64, archived *bool) ([]Project, error) {
+	query := s.dbConn.WithContext(ctx).
+		Table("projects").
+		Select("projects.*, project_members.role AS member_role").
+		Joins("JOIN project_members ON project_members.project_id = projects.id").
+		Where("project_members.user_id = ?", userID)
+	if archived != nil {
+		query = query.Where("projects.archived = ?", *archived)
+	}
+
+	var rows []sharedProjectRow
+	if err := query.Order("projects.name ASC, projects.id ASC").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	projects := make([]Project, 0, len(rows))
+	for _, row := range rows {
+		row.Project.Role = row.MemberRole
+		projects = append(projects, row.Project)
+	}
+	return projects, nil
+}
+
+// SaveMember persists a project member to the database (create or update)
+func (s *store) SaveMember(ctx context.Context, member *Member, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(member).Error
+}
+
+// GetMember retrieves the membership of a user in a project from the database
+func (s *store) GetMember(ctx context.Context, projectID, userID int64) (*Member, error) {
+	var member Member
+	err := s.dbConn.WithContext(ctx).
+		Where("project_id = ? AND user_id = ?", projectID, userID).
+		First(&member).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetMembers retrieves the members of a project from the database, oldest first
+func (s *store) GetMembers(ctx context.Context, projectID int64) ([]Member, error) {
+	var members []Member
+	err := s.dbConn.WithContext(ctx).
+		Where("project_id = ?", projectID).
+		Order("created_at ASC, user_id ASC").
+		Find(&members).Error
+	return members, err
+}
+
+// DeleteMember removes the membership of a user in a project from the database
+func (s *store) DeleteMember(ctx context.Context, projectID, userID int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).
+		Where("project_id = ? AND user_id = ?", projectID, userID).
+		Delete(&Member{}).Error
+}
+
+// SaveInvitation persists an invitation to the database. Inviting the same email to the
+// same project again replaces the role of the pending invitation.
+func (s *store) SaveInvitation(ctx context.Context, invitation *Invitation) error {
+	return s.dbConn.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_id"}, {Name: "email"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "invited_by"}),
+		}).
+		Create(invitation).Error
+}
+
+// GetInvitationByID retrieves an invitation by its ID from the database
+func (s *store) GetInvitationByID(ctx context.Context, id int64) (*Invitation, error) {
+	var invitation Invitation
+	if err := s.dbConn.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetInvitationsByProjectID retrieves the pending invitations of a project from the database, oldest first
+func (s *store) GetInvitationsByProjectID(ctx context.Context, projectID int64) ([]Invitation, error) {
+	var invitations []Invitation
+	err := s.dbConn.WithContext(ctx).
+		Where("project_id = ?", projectID).
+		Order("created_at ASC, id ASC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// GetInvitationsByEmail retrieves the pending invitations addressed to an email from the database, oldest first
+func (s *store) GetInvitationsByEmail(ctx context.Context, email string) ([]Invitation, error) {
+	var invitations []Invitation
+	err := s.dbConn.WithContext(ctx).
+		Where("email = ?", normalizeEmail(email)).
+		Order("created_at ASC, id ASC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// DeleteInvitation removes an invitation from the database by its ID
+func (s *store) DeleteInvitation(ctx context.Context, id int64, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Delete(&Invitation{}, id).Error
+}
+
+// SaveFeedToken persists the feed token of a user, replacing the one they had, which stops working
+func (s *store) SaveFeedToken(ctx context.Context, token *FeedToken) error {
+	return s.dbConn.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+		}).
+		Create(token).Error
+}
+
+// GetFeedToken retrieves the feed token of a specific user from the database
+func (s *store) GetFeedToken(ctx context.Context, userID int64) (*FeedToken, error) {
+	var token FeedToken
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrFeedNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetFeedTokenByHash retrieves the feed token with the given hash from the database
+func (s *store) GetFeedTokenByHash(ctx context.Context, hash string) (*FeedToken, error) {
+	var token FeedToken
+	if err := s.dbConn.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrFeedNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteFeedToken removes the feed token of a specific user from the database and reports
+// whether they had one
+func (s *store) DeleteFeedToken(ctx context.Context, userID int64) (bool, error) {
+	result := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).Delete(&FeedToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SaveExportFile persists an export file to the database (create or update)
+func (s *store) SaveExportFile(ctx context.Context, file *ExportFile, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(file).Error
+}
+
+// GetExportFileByID retrieves an export file of a specific user by its ID from the database
+func (s *store) GetExportFileByID(ctx context.Context, userID, id int64) (*ExportFile, error) {
+	var file ExportFile
+	err := s.dbConn.WithContext(ctx).
+		Where("user_id = ?", userID).
+		First(&file, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetExpiredExportFiles retrieves the export files of all users that expired before the
+// given time from the database
+func (s *store) GetExpiredExportFiles(ctx context.Context, before time.Time) ([]ExportFile, error) {
+	var files []ExportFile
+	err := s.dbConn.WithContext(ctx).
+		Where("expires_at < ?", before).
+		Find(&files).Error
+	return files, err
+}
+
+// DeleteExportFile removes an export file from the database by its ID
+func (s *store) DeleteExportFile(ctx context.Context, id int64) error {
+	return s.dbConn.WithContext(ctx).Delete(&ExportFile{}, id).Error
+}
+
+// SaveReminder persists a reminder to the database (create or update)
+func (s *store) SaveReminder(ctx context.Context, reminder *Reminder, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(reminder).Error
+}
+
+// GetReminderByID retrieves a reminder by its ID from the database
+func (s *store) GetReminderByID(ctx context.Context, id int64) (*Reminder, error) {
+	var reminder Reminder
+	if err := s.dbConn.WithContext(ctx).First(&reminder, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrReminderNotFound
+		}
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// GetReminders retrieves the reminders a specific user set on a todo from the database,
+// oldest first
+func (s *store) GetReminders(ctx context.Context, todoID, userID int64) ([]Reminder, error) {
+	var reminders []Reminder
+	err := s.dbConn.WithContext(ctx).
+		Where("todo_id = ? AND user_id = ?", todoID, userID).
+		Order("created_at ASC, id ASC").
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// GetRelativeReminders retrieves the reminders of every user on a todo that are relative to
+// its due date from the database
+func (s *store) GetRelativeReminders(ctx context.Context, todoID int64, options ...db.Option) ([]Reminder, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	var reminders []Reminder
+	err := dbConn.WithContext(ctx).
+		Where("todo_id = ? AND minutes_before IS NOT NULL", todoID).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// DeleteReminder removes a reminder a specific user set on a todo from the database
+func (s *store) DeleteReminder(ctx context.Context, todoID, userID, id int64) error {
+	result := s.dbConn.WithContext(ctx).
+		Where("todo_id = ? AND user_id = ?", todoID, userID).
+		Delete(&Reminder{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+// ClaimDueReminders marks up to limit reminders of all users that are due at the given time
+// as fired, and returns them. Reminders locked by another transaction are skipped, so that
+// concurrent claims never return the same reminder.
+func (s *store) ClaimDueReminders(ctx context.Context, now time.Time, limit int, options ...db.Option) ([]Reminder, error) {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	var reminders []Reminder
+	err := dbConn.WithContext(ctx).Raw(`
+		UPDATE reminders
+		SET fired_at = ?
+		WHERE id IN (
+			SELECT id FROM reminders
+			WHERE fired_at IS NULL AND fire_at <= ?
+			ORDER BY fire_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now, now, limit,
+	).Scan(&reminders).Error
+	if err != nil {
+		return nil, err
+	}
+	return reminders, nil
 }
@@ -0,0 +1,208 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+)
+
+// Types of the events streamed to the users who see a todo
+const (
+	EventTodoCreated = "todo.created"
+	EventTodoUpdated = "todo.updated"
+	EventTodoToggled = "todo.toggled"
+	EventTodoDeleted = "todo.deleted"
+	// EventReset tells a client resuming a stream that events were missed, and that it
+	// should reload its todos instead
+	EventReset = "reset"
+)
+
+// deletedTodo represents a deleted todo in events, its ID is enough to remove it from lists
+type deletedTodo struct {
+	ID int64 `json:"id"`
+}
+
+// streamTopic returns the topic the events of the todos a user sees are published on
+func streamTopic(userID int64) string {
+	return fmt.Sprintf("todos:user:%d", userID)
+}
+
+// audience returns the users who see the todos of a project, its owner and everyone it is
+// shared with. Like cache invalidation it is best effort, only the owner is returned when
+// members can't be loaded.
+func (s *Service) audience(ctx context.Context, ownerID int64, projectID *int64) []int64 {
+	userIDs := []int64{ownerID}
+	if projectID == nil {
+		return userIDs
+	}
+
+	members, err := s.store.GetMembers(ctx, *projectID)
+	if err != nil {
+		return userIDs
+	}
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+	return userIDs
+}
+
+// notice is an event told to users about a todo they see, on their streams and webhooks
+type notice struct {
+	userIDs   []int64
+	eventType string
+	data      any
+}
+
+// notices returns what the users who see a todo are told about a domain event of todos,
+// nothing for events that aren't about todos one by one
+func notices(event outbox.Event) ([]notice, error) {
+	switch event.Type {
+	case EventTodoCreated, EventTodoUpdated, EventTodoToggled, EventTodoDeleted, EventTodoRestored, EventTodoMoved, EventTodosBatched:
+	default:
+		return nil, nil
+	}
+
+	var c struct {
+		UserIDs []int64         `json:"user_ids"`
+		Left    []int64         `json:"left_user_ids"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(event.Payload, &c); err != nil {
+		return nil, err
+	}
+
+	// The changes of a batch are told one by one, each to the users who see its todo
+	if event.Type == EventTodosBatched {
+		var changes []batchEvent
+		if err := json.Unmarshal(c.Data, &changes); err != nil {
+			return nil, err
+		}
+		notices := make([]notice, 0, len(changes))
+		for _, change := range changes {
+			notices = append(notices, todoNotice(change.UserIDs, change.Type, change.Todo))
+		}
+		return notices, nil
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(c.Data, &todo); err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case EventTodoRestored:
+		// Restored todos come back to lists like new ones
+		return []notice{todoNotice(c.UserIDs, EventTodoCreated, &todo)}, nil
+	case EventTodoMoved:
+		// Members of the project it left who can't see it anymore get it deleted, everyone
+		// who sees it now gets it updated
+		to := slices.DeleteFunc(slices.Clone(c.UserIDs), func(userID int64) bool {
+			return slices.Contains(c.Left, userID)
+		})
+		return []notice{
+			todoNotice(c.Left, EventTodoDeleted, &todo),
+			todoNotice(to, EventTodoUpdated, &todo),
+		}, nil
+	default:
+		return []notice{todoNotice(c.UserIDs, event.Type, &todo)}, nil
+	}
+}
+
+// todoNotice returns the notice of a change to a todo, deleted todos are only identified
+func todoNotice(userIDs []int64, eventType string, todo *Todo) notice {
+	if eventType == EventTodoDeleted {
+		return notice{userIDs, eventType, deletedTodo{ID: todo.ID}}
+	}
+	return notice{userIDs, eventType, todo}
+}
+
+// HandleStream handles a domain event of todos relayed from the outbox by streaming it to
+// the users who see the todo. Like the event, it may be streamed more than once.
+func (s *Service) HandleStream(ctx context.Context, event outbox.Event) error {
+	notices, err := notices(event)
+	if err != nil {
+		// Retrying wouldn't make it any less malformed
+		log.Error().Err(err).Msgf("skipping malformed %s event %s", event.Type, event.ID)
+		return nil
+	}
+
+	for _, n := range notices {
+		for _, userID := range n.userIDs {
+			if err := s.events.Publish(ctx, streamTopic(userID), n.eventType, n.data); err != nil {
+				return fmt.Errorf("failed to publish %s event: %w", n.eventType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// HandleWebhooks handles a domain event of todos relayed from the outbox by dispatching it
+// to the webhooks of the users who see the todo. Dispatches are keyed by the event, so one
+// handled again isn't delivered twice.
+func (s *Service) HandleWebhooks(ctx context.Context, event outbox.Event) error {
+	notices, err := notices(event)
+	if err != nil {
+		// Retrying wouldn't make it any less malformed
+		log.Error().Err(err).Msgf("skipping malformed %s event %s", event.Type, event.ID)
+		return nil
+	}
+
+	for i, n := range notices {
+		hookType := webhookType(n.eventType, n.data)
+		key := fmt.Sprintf("%s/%d", event.ID, i)
+		for _, userID := range n.userIDs {
+			if err := s.webhooks.DispatchOnce(ctx, key, userID, hookType, n.data); err != nil {
+				return fmt.Errorf("failed to dispatch %s webhook: %w", hookType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// webhookType returns the type of the webhook event matching a streamed event. Webhooks
+// subscribe to completions rather than toggles.
+func webhookType(eventType string, data any) string {
+	todo, ok := data.(*Todo)
+	if !ok || eventType != EventTodoToggled {
+		return eventType
+	}
+	if todo.Completed {
+		return webhook.EventTodoCompleted
+	}
+	return webhook.EventTodoUncompleted
+}
+
+// Subscribe subscribes to the events of the todos the specified user sees. When lastEventID
+// is set, the events since then are delivered first, as far as they are still kept.
+func (s *Service) Subscribe(ctx context.Context, userID int64, lastEventID string) (*events.Subscription, error) {
+	sub, err := s.events.Subscribe(ctx, streamTopic(userID), lastEventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to todo events: %w", err)
+	}
+	return sub, nil
+}
+
+// writeEvent writes an event in the Server-Sent Events format. Event data is compact JSON,
+// so it always fits on a single data line.
+func writeEvent(w io.Writer, event events.Event) error {
+	data := event.Data
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	var err error
+	if event.ID != "" {
+		_, err = fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/events"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
+	"github.com/syahidfrd/go-boilerplate/internal/webhook"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    events.Event
+		expected string
+	}{
+		{
+			name:     "event with id",
+			event:    events.Event{ID: "1700000000000-0", Type: EventTodoDeleted, Data: json.RawMessage(`{"id":1}`)},
+			expected: "id: 1700000000000-0\nevent: todo.deleted\ndata: {\"id\":1}\n\n",
+		},
+		{
+			name:     "event without id or data",
+			event:    events.Event{Type: EventReset},
+			expected: "event: reset\ndata: {}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeEvent(&buf, tt.event))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestStreamTopic(t *testing.T) {
+	assert.Equal(t, "todos:user:42", streamTopic(42))
+}
+
+func TestNotices(t *testing.T) {
+	todo := &Todo{ID: 7, UserID: 1, Title: "Ship it", Completed: true}
+	event := func(eventType string, c change) outbox.Event {
+		payload, err := json.Marshal(c)
+		require.NoError(t, err)
+		return outbox.Event{ID: "1-0", Type: eventType, Payload: payload}
+	}
+
+	// Changes are told to everyone who sees the todo
+	got, err := notices(event(EventTodoToggled, change{UserIDs: []int64{1, 2}, Data: todo}))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, []int64{1, 2}, got[0].userIDs)
+	assert.Equal(t, EventTodoToggled, got[0].eventType)
+	assert.Equal(t, "Ship it", got[0].data.(*Todo).Title)
+
+	// Deleted todos are only identified
+	got, err = notices(event(EventTodoDeleted, change{UserIDs: []int64{1}, Data: todo}))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, deletedTodo{ID: 7}, got[0].data)
+
+	// Restored todos come back like new ones
+	got, err = notices(event(EventTodoRestored, change{UserIDs: []int64{1}, Data: todo}))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, EventTodoCreated, got[0].eventType)
+
+	// Moved todos are deleted for those who left and updated for the others
+	got, err = notices(event(EventTodoMoved, change{UserIDs: []int64{1, 3, 2}, Left: []int64{2}, Data: todo}))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, notice{userIDs: []int64{2}, eventType: EventTodoDeleted, data: deletedTodo{ID: 7}}, got[0])
+	assert.Equal(t, []int64{1, 3}, got[1].userIDs)
+	assert.Equal(t, EventTodoUpdated, got[1].eventType)
+
+	// The changes of a batch are told one by one
+	got, err = notices(event(EventTodosBatched, change{UserIDs: []int64{1, 2}, Data: []batchEvent{
+		{Type: EventTodoCreated, UserIDs: []int64{1}, Todo: &Todo{ID: 8, UserID: 1}},
+		{Type: EventTodoDeleted, UserIDs: []int64{2}, Todo: todo},
+	}}))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, []int64{1}, got[0].userIDs)
+	assert.Equal(t, EventTodoCreated, got[0].eventType)
+	assert.Equal(t, int64(8), got[0].data.(*Todo).ID)
+	assert.Equal(t, notice{userIDs: []int64{2}, eventType: EventTodoDeleted, data: deletedTodo{ID: 7}}, got[1])
+
+	// Events about anything else aren't told
+	got, err = notices(event(EventCommentCreated, change{UserIDs: []int64{1}, Data: map[string]any{"id": 1}}))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = notices(outbox.Event{Type: EventTodoCreated, Payload: json.RawMessage(`{`)})
+	assert.Error(t, err)
+}
+
+func TestWebhookType(t *testing.T) {
+	assert.Equal(t, webhook.EventTodoCompleted, webhookType(EventTodoToggled, &Todo{Completed: true}))
+	assert.Equal(t, webhook.EventTodoUncompleted, webhookType(EventTodoToggled, &Todo{}))
+	assert.Equal(t, EventTodoUpdated, webhookType(EventTodoUpdated, &Todo{Completed: true}))
+	assert.Equal(t, EventTodoDeleted, webhookType(EventTodoDeleted, deletedTodo{ID: 1}))
+}
@@ -3,23 +3,52 @@ package todo
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 var (
 	// ErrTodoNotFound is returned when a requested todo cannot be found
 	ErrTodoNotFound = errors.New("todo not found")
+	// ErrVersionMismatch is returned when a todo was changed since the version the caller expected
+	ErrVersionMismatch = errors.New("todo version mismatch")
+	// ErrInvalidAnchor is returned when a todo is moved next to itself, to a missing todo or between
+	// todos that aren't in order
+	ErrInvalidAnchor = errors.New("invalid anchor")
+	// ErrPatchTooLarge is returned when a patch document is larger than maxPatchSize
+	ErrPatchTooLarge = errors.New("patch too large")
 )
 
 // Todo represents a todo item with user association and completion status
 type Todo struct {
-	ID          int64
-	UserID      int64 `gorm:"index"`
-	Title       string
-	Description string
-	Completed   bool
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID           int64  `gorm:"index:idx_todos_user_created,priority:3;index:idx_todos_user_updated,priority:3;index:idx_todos_user_title,priority:3;index:idx_todos_user_completed_created,priority:4;index:idx_todos_user_position,priority:3"`
+	UserID       int64  `gorm:"index:idx_todos_user_created,priority:1;index:idx_todos_user_updated,priority:1;index:idx_todos_user_title,priority:1;index:idx_todos_user_completed_created,priority:1;index:idx_todos_user_due,priority:1;index:idx_todos_user_project,priority:1;index:idx_todos_user_deleted,priority:1;index:idx_todos_user_position,priority:1"`
+	ProjectID    *int64 `gorm:"index:idx_todos_user_project,priority:2"`
+	Title        string `gorm:"index:idx_todos_user_title,priority:2"`
+	Description  string
+	Completed    bool `gorm:"index:idx_todos_user_completed_created,priority:2"`
+	CompletedAt  *time.Time
+	DueAt        *time.Time `gorm:"index:idx_todos_user_due,priority:2"`
+	Priority     Priority
+	Recurrence   *Recurrence    `gorm:"type:jsonb;serializer:json"`
+	Position     string         `gorm:"type:text COLLATE \"C\";not null;default:'';index:idx_todos_user_position,priority:2;index:idx_todos_unpositioned,where:position = ''"`
+	Version      int64          `gorm:"not null;default:1"`
+	CommentCount int64          `gorm:"not null;default:0"`
+	CreatedAt    time.Time      `gorm:"index:idx_todos_user_created,priority:2;index:idx_todos_user_completed_created,priority:3"`
+	UpdatedAt    time.Time      `gorm:"index:idx_todos_user_updated,priority:2"`
+	DeletedAt    gorm.DeletedAt `gorm:"index;index:idx_todos_user_deleted,priority:2"`
+	Labels       []Label        `gorm:"many2many:todo_labels;constraint:OnDelete:CASCADE"`
+	History      []HistoryEntry `gorm:"constraint:OnDelete:CASCADE"`
+	Comments     []Comment      `gorm:"constraint:OnDelete:CASCADE"`
+	Attachments  []Attachment   `gorm:"constraint:OnDelete:CASCADE"`
+	Reminders    []Reminder     `gorm:"constraint:OnDelete:CASCADE"`
+
+	// SearchVector is maintained by PostgreSQL from the title and description
+	// and is never read or written by the application
+	SearchVector string `gorm:"->:false;<-:false;type:tsvector GENERATED ALWAYS AS (to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(description, ''))) STORED;index:idx_todos_search,type:gin"`
 }
 
 // NewTodo creates a new todo item with the given details
@@ -30,40 +59,167 @@ func NewTodo(userID int64, title, description string) *Todo {
 		Title:       title,
 		Description: description,
 		Completed:   false,
+		Version:     1,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 }
 
-// MarkAsCompleted marks the todo as completed
+// MarkAsCompleted marks the todo as completed and records when it happened
 func (t *Todo) MarkAsCompleted() {
+	if !t.Completed || t.CompletedAt == nil {
+		now := time.Now()
+		t.CompletedAt = &now
+	}
 	t.Completed = true
 }
 
-// MarkAsIncomplete marks the todo as incomplete
+// MarkAsIncomplete marks the todo as incomplete and clears its completion time
 func (t *Todo) MarkAsIncomplete() {
 	t.Completed = false
+	t.CompletedAt = nil
+}
+
+// IsOverdue reports whether the todo is still incomplete past its due time
+func (t *Todo) IsOverdue(now time.Time) bool {
+	return !t.Completed && t.DueAt != nil && t.DueAt.Before(now)
+}
+
+// ETag returns the strong entity tag of the current version of the todo
+func (t *Todo) ETag() string {
+	return fmt.Sprintf("%q", strconv.FormatInt(t.Version, 10))
+}
+
+// todoJSON is the JSON representation of a todo
+type todoJSON struct {
+	ID           int64       `json:"id"`
+	UserID       int64       `json:"user_id"`
+	ProjectID    *int64      `json:"project_id"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description"`
+	Completed    bool        `json:"completed"`
+	CompletedAt  *string     `json:"completed_at"`
+	DueAt        *string     `json:"due_at"`
+	Priority     string      `json:"priority"`
+	Recurrence   *Recurrence `json:"recurrence"`
+	Position     string      `json:"position"`
+	Labels       []Label     `json:"labels"`
+	CommentCount int64       `json:"comment_count"`
+	Version      int64       `json:"version"`
+	CreatedAt    string      `json:"created_at"`
+	UpdatedAt    string      `json:"updated_at"`
+	DeletedAt    *string     `json:"deleted_at,omitempty"`
+}
+
+// formatOptionalTime formats an optional timestamp as RFC3339, keeping nil as is
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// parseOptionalTime parses an optional RFC3339 timestamp, keeping nil as is
+func parseOptionalTime(s *string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 // MarshalJSON implements the json.Marshaler interface for custom JSON serialization
 func (t Todo) MarshalJSON() ([]byte, error) {
-	var j struct {
-		ID          int64  `json:"id"`
-		UserID      int64  `json:"user_id"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Completed   bool   `json:"completed"`
-		CreatedAt   string `json:"created_at"`
-		UpdatedAt   string `json:"updated_at"`
-	}
+	var j todoJSON
 
 	j.ID = t.ID
 	j.UserID = t.UserID
+	j.ProjectID = t.ProjectID
 	j.Title = t.Title
 	j.Description = t.Description
 	j.Completed = t.Completed
+	j.CompletedAt = formatOptionalTime(t.CompletedAt)
+	j.DueAt = formatOptionalTime(t.DueAt)
+	j.Priority = t.Priority.String()
+	j.Recurrence = t.Recurrence
+	j.Position = t.Position
+	j.Labels = t.Labels
+	if j.Labels == nil {
+		j.Labels = []Label{}
+	}
+	j.CommentCount = t.CommentCount
+	j.Version = t.Version
 	j.CreatedAt = t.CreatedAt.Format(time.RFC3339)
 	j.UpdatedAt = t.UpdatedAt.Format(time.RFC3339)
+	if t.DeletedAt.Valid {
+		j.DeletedAt = formatOptionalTime(&t.DeletedAt.Time)
+	}
 
 	return json.Marshal(j)
 }
+
+// UnmarshalJSON implements the json.Unmarshaler interface so that cached todos
+// can be restored from the representation produced by MarshalJSON
+func (t *Todo) UnmarshalJSON(data []byte) error {
+	var j todoJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, j.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339, j.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	completedAt, err := parseOptionalTime(j.CompletedAt)
+	if err != nil {
+		return err
+	}
+
+	dueAt, err := parseOptionalTime(j.DueAt)
+	if err != nil {
+		return err
+	}
+
+	priority, err := ParsePriority(j.Priority)
+	if err != nil {
+		return err
+	}
+
+	deletedAt, err := parseOptionalTime(j.DeletedAt)
+	if err != nil {
+		return err
+	}
+
+	t.ID = j.ID
+	t.UserID = j.UserID
+	t.ProjectID = j.ProjectID
+	t.Title = j.Title
+	t.Description = j.Description
+	t.Completed = j.Completed
+	t.CompletedAt = completedAt
+	t.DueAt = dueAt
+	t.Priority = priority
+	t.Recurrence = j.Recurrence
+	t.Position = j.Position
+	t.Labels = j.Labels
+	t.CommentCount = j.CommentCount
+	t.Version = j.Version
+	t.CreatedAt = createdAt
+	t.UpdatedAt = updatedAt
+	t.DeletedAt = gorm.DeletedAt{}
+	if deletedAt != nil {
+		t.DeletedAt = gorm.DeletedAt{Time: *deletedAt, Valid: true}
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestNewTodo(t *testing.T) {
@@ -19,6 +20,7 @@ func TestNewTodo(t *testing.T) {
 	assert.Equal(t, title, todo.Title)
 	assert.Equal(t, description, todo.Description)
 	assert.False(t, todo.Completed)
+	assert.Equal(t, int64(1), todo.Version)
 	assert.WithinDuration(t, time.Now(), todo.CreatedAt, time.Second)
 	assert.WithinDuration(t, time.Now(), todo.UpdatedAt, time.Second)
 }
@@ -29,24 +31,50 @@ func TestTodo_MarkAsCompleted(t *testing.T) {
 	todo.MarkAsCompleted()
 
 	assert.True(t, todo.Completed)
+	assert.NotNil(t, todo.CompletedAt)
+	assert.WithinDuration(t, time.Now(), *todo.CompletedAt, time.Second)
 }
 
 func TestTodo_MarkAsIncomplete(t *testing.T) {
 	todo := NewTodo(123, "Test", "Description")
-	todo.Completed = true
+	todo.MarkAsCompleted()
 
 	todo.MarkAsIncomplete()
 
 	assert.False(t, todo.Completed)
+	assert.Nil(t, todo.CompletedAt)
 }
 
 func TestTodo_MarkAsCompleted_AlreadyCompleted(t *testing.T) {
 	todo := NewTodo(123, "Test", "Description")
+	completedAt := time.Now().Add(-time.Hour)
 	todo.Completed = true
+	todo.CompletedAt = &completedAt
 
 	todo.MarkAsCompleted()
 
 	assert.True(t, todo.Completed)
+	assert.Equal(t, completedAt, *todo.CompletedAt)
+}
+
+func TestTodo_IsOverdue(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	noDueDate := NewTodo(123, "Test", "")
+	assert.False(t, noDueDate.IsOverdue(now))
+
+	dueInFuture := NewTodo(123, "Test", "")
+	dueInFuture.DueAt = &future
+	assert.False(t, dueInFuture.IsOverdue(now))
+
+	dueInPast := NewTodo(123, "Test", "")
+	dueInPast.DueAt = &past
+	assert.True(t, dueInPast.IsOverdue(now))
+
+	dueInPast.MarkAsCompleted()
+	assert.False(t, dueInPast.IsOverdue(now))
 }
 
 func TestTodo_MarkAsIncomplete_AlreadyIncomplete(t *testing.T) {
@@ -58,16 +86,27 @@ func TestTodo_MarkAsIncomplete_AlreadyIncomplete(t *testing.T) {
 	assert.False(t, todo.Completed)
 }
 
+func TestTodo_ETag(t *testing.T) {
+	todo := NewTodo(123, "Test", "Description")
+	assert.Equal(t, `"1"`, todo.ETag())
+
+	todo.Version = 42
+	assert.Equal(t, `"42"`, todo.ETag())
+}
+
 func TestTodo_MarshalJSON(t *testing.T) {
 	now := time.Now()
 	todo := &Todo{
-		ID:          1,
-		UserID:      123,
-		Title:       "Test Todo",
-		Description: "Test Description",
-		Completed:   true,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:           1,
+		UserID:       123,
+		Title:        "Test Todo",
+		Description:  "Test Description",
+		Completed:    true,
+		Position:     "a1",
+		Version:      3,
+		CommentCount: 2,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
 
 	jsonBytes, err := json.Marshal(todo)
@@ -82,8 +121,53 @@ func TestTodo_MarshalJSON(t *testing.T) {
 	assert.Equal(t, "Test Todo", result["title"])
 	assert.Equal(t, "Test Description", result["description"])
 	assert.Equal(t, true, result["completed"])
+	assert.Equal(t, "a1", result["position"])
+	assert.Equal(t, float64(3), result["version"])
+	assert.Equal(t, float64(2), result["comment_count"])
 	assert.Equal(t, now.Format(time.RFC3339), result["created_at"])
 	assert.Equal(t, now.Format(time.RFC3339), result["updated_at"])
+	assert.Equal(t, "none", result["priority"])
+	assert.Nil(t, result["due_at"])
+	assert.Nil(t, result["completed_at"])
+	assert.Equal(t, []interface{}{}, result["labels"])
+	assert.Nil(t, result["project_id"])
+	assert.Nil(t, result["recurrence"])
+	assert.NotContains(t, result, "deleted_at")
+}
+
+func TestTodo_MarshalJSON_DueDateAndPriority(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	dueAt := time.Date(2024, 5, 8, 17, 0, 0, 0, jakarta)
+	completedAt := time.Date(2024, 5, 8, 9, 30, 0, 0, time.UTC)
+	todo := &Todo{
+		ID:          1,
+		UserID:      123,
+		Title:       "Test",
+		Completed:   true,
+		CompletedAt: &completedAt,
+		DueAt:       &dueAt,
+		Priority:    PriorityHigh,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	jsonBytes, err := json.Marshal(todo)
+	assert.NoError(t, err)
+
+	var result map[string]interface{}
+	err = json.Unmarshal(jsonBytes, &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2024-05-08T17:00:00+07:00", result["due_at"])
+	assert.Equal(t, "2024-05-08T09:30:00Z", result["completed_at"])
+	assert.Equal(t, "high", result["priority"])
+
+	var decoded Todo
+	err = json.Unmarshal(jsonBytes, &decoded)
+	assert.NoError(t, err)
+	assert.True(t, dueAt.Equal(*decoded.DueAt))
+	assert.True(t, completedAt.Equal(*decoded.CompletedAt))
+	assert.Equal(t, PriorityHigh, decoded.Priority)
 }
 
 func TestTodo_MarshalJSON_EmptyDescription(t *testing.T) {
@@ -130,3 +214,120 @@ func TestTodo_MarshalJSON_TimeFormatting(t *testing.T) {
 	assert.Equal(t, expectedTime, result["created_at"])
 	assert.Equal(t, expectedTime, result["updated_at"])
 }
+
+func TestTodo_UnmarshalJSON_RoundTrip(t *testing.T) {
+	specificTime := time.Date(2023, 12, 25, 15, 30, 45, 0, time.UTC)
+	todo := Todo{
+		ID:           1,
+		UserID:       123,
+		Title:        "Test Todo",
+		Description:  "Test Description",
+		Completed:    true,
+		Position:     "a0V",
+		Version:      2,
+		CommentCount: 5,
+		CreatedAt:    specificTime,
+		UpdatedAt:    specificTime.Add(time.Hour),
+	}
+
+	jsonBytes, err := json.Marshal(todo)
+	assert.NoError(t, err)
+
+	var result Todo
+	err = json.Unmarshal(jsonBytes, &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, todo.ID, result.ID)
+	assert.Equal(t, todo.UserID, result.UserID)
+	assert.Equal(t, todo.Title, result.Title)
+	assert.Equal(t, todo.Description, result.Description)
+	assert.Equal(t, todo.Completed, result.Completed)
+	assert.Equal(t, todo.Position, result.Position)
+	assert.Equal(t, todo.Version, result.Version)
+	assert.Equal(t, todo.CommentCount, result.CommentCount)
+	assert.True(t, todo.CreatedAt.Equal(result.CreatedAt))
+	assert.True(t, todo.UpdatedAt.Equal(result.UpdatedAt))
+}
+
+func TestTodo_UnmarshalJSON_RoundTripProjectAndLabels(t *testing.T) {
+	specificTime := time.Date(2023, 12, 25, 15, 30, 45, 0, time.UTC)
+	projectID := int64(9)
+	todo := Todo{
+		ID:        1,
+		UserID:    123,
+		ProjectID: &projectID,
+		Title:     "Test Todo",
+		Labels: []Label{
+			{ID: 7, UserID: 123, Name: "work", Color: "#ff0000", CreatedAt: specificTime, UpdatedAt: specificTime},
+		},
+		CreatedAt: specificTime,
+		UpdatedAt: specificTime,
+	}
+
+	jsonBytes, err := json.Marshal(todo)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonBytes), `"labels":[{"id":7,"user_id":123,"name":"work","color":"#ff0000"`)
+
+	var result Todo
+	err = json.Unmarshal(jsonBytes, &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, todo.ProjectID, result.ProjectID)
+	assert.Len(t, result.Labels, 1)
+	assert.Equal(t, todo.Labels[0].ID, result.Labels[0].ID)
+	assert.Equal(t, todo.Labels[0].Name, result.Labels[0].Name)
+	assert.Equal(t, todo.Labels[0].Color, result.Labels[0].Color)
+	assert.True(t, todo.Labels[0].CreatedAt.Equal(result.Labels[0].CreatedAt))
+}
+
+func TestTodo_UnmarshalJSON_RoundTripRecurrence(t *testing.T) {
+	dueAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	recurrence, err := NewRecurrence("FREQ=MONTHLY;BYMONTHDAY=1", "Europe/Berlin", dueAt, []time.Time{dueAt.AddDate(0, 1, 0)})
+	assert.NoError(t, err)
+
+	todo := Todo{
+		ID:         1,
+		UserID:     123,
+		Title:      "Pay rent",
+		DueAt:      &dueAt,
+		Recurrence: recurrence,
+		CreatedAt:  dueAt,
+		UpdatedAt:  dueAt,
+	}
+
+	jsonBytes, err := json.Marshal(todo)
+	assert.NoError(t, err)
+
+	var result Todo
+	err = json.Unmarshal(jsonBytes, &result)
+	assert.NoError(t, err)
+
+	if assert.NotNil(t, result.Recurrence) {
+		assert.Equal(t, recurrence.Rule, result.Recurrence.Rule)
+		assert.Equal(t, recurrence.Timezone, result.Recurrence.Timezone)
+		assert.True(t, recurrence.Start.Equal(result.Recurrence.Start))
+		assert.Len(t, result.Recurrence.Exceptions, 1)
+	}
+}
+
+func TestTodo_MarshalJSON_Trashed(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 8, 9, 30, 0, 0, time.UTC)
+	todo := Todo{
+		ID:        1,
+		UserID:    123,
+		Title:     "Trashed",
+		CreatedAt: deletedAt.Add(-time.Hour),
+		UpdatedAt: deletedAt.Add(-time.Hour),
+		DeletedAt: gorm.DeletedAt{Time: deletedAt, Valid: true},
+	}
+
+	jsonBytes, err := json.Marshal(todo)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonBytes), `"deleted_at":"2024-05-08T09:30:00Z"`)
+
+	var decoded Todo
+	err = json.Unmarshal(jsonBytes, &decoded)
+	assert.NoError(t, err)
+	assert.True(t, decoded.DeletedAt.Valid)
+	assert.True(t, deletedAt.Equal(decoded.DeletedAt.Time))
+}
@@ -0,0 +1,10 @@
+package todo
+
+// trashSort orders the trash by deletion time, most recently deleted first
+var trashSort = sortOrder{column: "deleted_at", desc: true}
+
+// TrashParams represents the pagination parameters for listing trashed todos
+type TrashParams struct {
+	Limit  int `validate:"min=1,max=100"`
+	Cursor string
+}
@@ -4,11 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/outbox"
 	"gorm.io/gorm"
 )
 
+const (
+	// OutboxTopic is the outbox topic the domain events of users are published on
+	OutboxTopic = "users"
+	// EventCreated is written to the outbox when a user is created
+	EventCreated = "user.created"
+)
+
 var (
 	// ErrUserNotFound is returned when a requested user cannot be found
 	ErrUserNotFound = errors.New("user not found")
@@ -16,13 +25,23 @@ var (
 
 // Service provides user business logic operations
 type Service struct {
-	store *store
+	store  *store
+	outbox *outbox.Outbox
 }
 
-// NewService creates a new user service with the provided store
-func NewService(store *store) *Service {
+// Created is the payload of the event of a new user, it leaves their password out
+type Created struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewService creates a new user service with the provided store, writing its domain events
+// to the outbox
+func NewService(store *store, outbox *outbox.Outbox) *Service {
 	return &Service{
-		store: store,
+		store:  store,
+		outbox: outbox,
 	}
 }
 
@@ -48,6 +67,13 @@ func (s *Service) Create(ctx context.Context, email, hashedPassword string) (*Us
 		return nil, fmt.Errorf("failed to save user preferences: %w", err)
 	}
 
+	created := Created{ID: user.ID, Email: user.Email, CreatedAt: user.CreatedAt}
+	err = s.outbox.Add(ctx, OutboxTopic, EventCreated, created, db.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to write user event to outbox: %w", err)
+	}
+
 	// Commit transaction if all operations succeed
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
@@ -68,3 +94,16 @@ func (s *Service) GetByEmail(ctx context.Context, email string) (*User, error) {
 
 	return user, nil
 }
+
+// GetByID retrieves a user by their ID
+func (s *Service) GetByID(ctx context.Context, id int64) (*User, error) {
+	user, err := s.store.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to find user by id: %w", err)
+	}
+
+	return user, nil
+}
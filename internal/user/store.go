@@ -44,6 +44,17 @@ func (s *store) FindByEmail(ctx context.Context, email string) (*User, error) {
 	return &user, nil
 }
 
+// FindByID retrieves a user by their ID from the database
+func (s *store) FindByID(ctx context.Context, id int64) (*User, error) {
+	var user User
+	err := s.dbConn.WithContext(ctx).First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 // SavePreference persists a user preference to the database (create or update)
 func (s *store) SavePreference(ctx context.Context, preference *Preference, options ...db.Option) error {
 	dbConn := s.dbConn
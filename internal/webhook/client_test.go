@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{ip: "93.184.216.34", expected: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", expected: true},
+		{ip: "127.0.0.1", expected: false},
+		{ip: "::1", expected: false},
+		{ip: "10.0.0.1", expected: false},
+		{ip: "172.16.0.1", expected: false},
+		{ip: "192.168.1.1", expected: false},
+		{ip: "169.254.169.254", expected: false},
+		{ip: "fd00::1", expected: false},
+		{ip: "0.0.0.0", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.expected, publicIP(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// Internal addresses are refused by default
+	_, err := NewClient(time.Second, false).Get(srv.URL)
+	assert.ErrorIs(t, err, errForbiddenAddress)
+
+	resp, err := NewClient(time.Second, true).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Redirects aren't followed
+	resp, err = NewClient(time.Second, true).Get(srv.URL + "/redirect")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
+
+func TestService_Send(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom\x00\xff"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	service := NewService(nil, NewClient(time.Second, true), 3)
+	endpoint, err := NewEndpoint(1, srv.URL, "", []string{EventTodoCreated})
+	require.NoError(t, err)
+	delivery, err := NewDelivery(endpoint.ID, EventTodoCreated, map[string]int{"id": 1})
+	require.NoError(t, err)
+
+	status, response, err := service.send(context.Background(), endpoint, delivery)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", response)
+
+	// The delivery is signed with the timestamp it carries
+	assert.Equal(t, []byte(delivery.Payload), body)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, delivery.EventID, received.Header.Get(HeaderID))
+	assert.Equal(t, EventTodoCreated, received.Header.Get(HeaderEvent))
+	timestamp, err := strconv.ParseInt(received.Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign(endpoint.Secret, time.Unix(timestamp, 0), body), received.Header.Get(HeaderSignature))
+
+	// Responses other than 2xx fail the delivery, their body is kept as text
+	endpoint.URL = srv.URL + "/fail"
+	status, response, err = service.send(context.Background(), endpoint, delivery)
+	assert.EqualError(t, err, "unexpected response status 500")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, "boom�", response)
+
+	// Inactive endpoints only get test events
+	endpoint.URL = srv.URL
+	endpoint.Active = false
+	_, _, err = service.send(context.Background(), endpoint, delivery)
+	assert.EqualError(t, err, "webhook is inactive")
+
+	test, err := NewDelivery(endpoint.ID, EventTest, nil)
+	require.NoError(t, err)
+	_, _, err = service.send(context.Background(), endpoint, test)
+	assert.NoError(t, err)
+}
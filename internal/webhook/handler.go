@@ -0,0 +1,284 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/pagination"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/render"
+)
+
+// defaultPageLimit is the number of deliveries returned when no limit is requested
+const defaultPageLimit = 20
+
+// handler handles HTTP requests for webhook endpoints
+type handler struct {
+	svc       *Service
+	validator *validator.Validate
+}
+
+// NewHandler creates a new webhook handler with the provided service
+func NewHandler(svc *Service) *handler {
+	return &handler{
+		svc:       svc,
+		validator: validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// Create handles requests to register a webhook endpoint for the authenticated user
+func (h *handler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req CreateEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	endpoint, err := h.svc.Create(ctx, userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidURL):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to create webhook: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, EndpointResponse{Endpoint: endpoint, Secret: endpoint.Secret})
+}
+
+// GetByUserID handles requests to list the webhook endpoints of the authenticated user
+func (h *handler) GetByUserID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	endpoints, err := h.svc.GetByUserID(ctx, userID)
+	if err != nil {
+		log.Ctx(ctx).Error().Msgf("failed to get webhooks: %s", err.Error())
+		render.JSONFromError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, endpoints)
+}
+
+// GetByID handles requests to get a webhook endpoint of the authenticated user
+func (h *handler) GetByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	endpoint, err := h.svc.GetByID(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEndpointNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrEndpointNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get webhook: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, endpoint)
+}
+
+// Update handles requests to change a webhook endpoint of the authenticated user
+func (h *handler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	var req UpdateEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	endpoint, err := h.svc.Update(ctx, userID, int64(id), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEndpointNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrEndpointNotFound.Error()})
+		case errors.Is(err, ErrInvalidURL):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to update webhook: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, endpoint)
+}
+
+// Delete handles requests to remove a webhook endpoint of the authenticated user
+func (h *handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	if err := h.svc.Delete(ctx, userID, int64(id)); err != nil {
+		switch {
+		case errors.Is(err, ErrEndpointNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrEndpointNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to delete webhook: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusNoContent, nil)
+}
+
+// GetDeliveries handles requests to get the delivery log of a webhook endpoint of the
+// authenticated user
+func (h *handler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := &DeliveryParams{
+		Status: query.Get("status"),
+		Limit:  defaultPageLimit,
+		Cursor: query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": "invalid query parameter: limit"})
+			return
+		}
+	}
+
+	if err := h.validator.Struct(params); err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	page, err := h.svc.GetDeliveries(ctx, userID, int64(id), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEndpointNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrEndpointNotFound.Error()})
+		case errors.Is(err, pagination.ErrInvalidCursor):
+			render.JSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to get webhook deliveries: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	if page.HasMore {
+		query.Set("cursor", page.NextCursor)
+		next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	render.JSON(w, http.StatusOK, page)
+}
+
+// SendTest handles requests to send a test event to a webhook endpoint of the authenticated
+// user, responding with the outcome of the delivery
+func (h *handler) SendTest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := auth.GetUserIDFromContext(ctx)
+	if !ok {
+		render.JSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		render.JSONFromError(w, err)
+		return
+	}
+
+	delivery, err := h.svc.SendTest(ctx, userID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEndpointNotFound):
+			render.JSON(w, http.StatusNotFound, map[string]string{"message": ErrEndpointNotFound.Error()})
+		default:
+			log.Ctx(ctx).Error().Msgf("failed to send test webhook: %s", err.Error())
+			render.JSONFromError(w, err)
+		}
+		return
+	}
+
+	render.JSON(w, http.StatusOK, delivery)
+}
@@ -0,0 +1,379 @@
+//go:build integration
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/test"
+)
+
+var sharedContainer *test.Container
+
+func TestMain(m *testing.M) {
+	var cleanup func() int
+	sharedContainer, cleanup = test.SetupTestMain()
+
+	// Run standard migrations + Endpoint and Delivery models
+	sharedContainer.RunStandardMigrations(&testing.T{})
+	if err := sharedContainer.DB.AutoMigrate(&Endpoint{}, &Delivery{}); err != nil {
+		panic("failed to migrate Endpoint and Delivery models: " + err.Error())
+	}
+
+	code := m.Run()
+	os.Exit(cleanup() + code)
+}
+
+func setupTestServices(t *testing.T) (*Service, *handler, *test.Container) {
+	t.Helper()
+
+	// Clean all data before each test
+	sharedContainer.CleanupAll(t)
+
+	service := NewService(NewStore(sharedContainer.DB), NewClient(5*time.Second, true), 2)
+	handler := NewHandler(service)
+
+	return service, handler, sharedContainer
+}
+
+func createAuthenticatedContext(userID int64) context.Context {
+	return context.WithValue(context.Background(), auth.UserIDKey, userID)
+}
+
+// receiver is a webhook endpoint recording the deliveries it gets
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	status   int
+}
+
+// newReceiver starts a receiver answering with the given status
+func newReceiver(t *testing.T, status int) *receiver {
+	t.Helper()
+
+	rcv := &receiver{status: status}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, body)
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+// received returns the number of deliveries received so far
+func (rcv *receiver) received() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+// request sends a request to a handler on behalf of a user, with the given webhook ID
+func request(t *testing.T, fn http.HandlerFunc, userID int64, method, id string, body any) *test.HTTPResponse {
+	t.Helper()
+
+	return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		if id != "" {
+			r.SetPathValue("id", id)
+		}
+		fn(w, r.WithContext(createAuthenticatedContext(userID)))
+	}, test.HTTPRequest{Method: method, URL: "/api/webhooks", Body: body})
+}
+
+func TestWebhookEndpointsIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+
+	resp := request(t, handler.Create, 1, http.MethodPost, "", CreateEndpointRequest{
+		URL:         "https://example.com/hook",
+		Description: "CI",
+		EventTypes:  []string{EventTodoCreated, EventTodoCompleted},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, "https://example.com/hook", resp.Body["url"])
+	assert.Equal(t, true, resp.Body["active"])
+	secret := resp.Body["secret"].(string)
+	assert.Regexp(t, `^whsec_`, secret)
+	id := strconv.FormatInt(int64(resp.Body["id"].(float64)), 10)
+
+	// The secret is only shown once
+	resp = request(t, handler.GetByID, 1, http.MethodGet, id, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, resp.Body, "secret")
+
+	resp = request(t, handler.GetByUserID, 1, http.MethodGet, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var endpoints []map[string]any
+	require.NoError(t, json.Unmarshal(resp.RawBody, &endpoints))
+	require.Len(t, endpoints, 1)
+	assert.NotContains(t, string(resp.RawBody), secret)
+
+	inactive := false
+	resp = request(t, handler.Update, 1, http.MethodPut, id, UpdateEndpointRequest{
+		URL:        "https://example.com/other",
+		EventTypes: []string{EventTodoDeleted},
+		Active:     &inactive,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, "https://example.com/other", resp.Body["url"])
+	assert.Equal(t, []any{EventTodoDeleted}, resp.Body["event_types"])
+	assert.Equal(t, false, resp.Body["active"])
+
+	// Endpoints of other users are out of reach
+	test.AssertErrorResponse(t, request(t, handler.GetByID, 2, http.MethodGet, id, nil), http.StatusNotFound, "webhook not found")
+	test.AssertErrorResponse(t, request(t, handler.Delete, 2, http.MethodDelete, id, nil), http.StatusNotFound, "webhook not found")
+
+	resp = request(t, handler.Delete, 1, http.MethodDelete, id, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	test.AssertErrorResponse(t, request(t, handler.GetByID, 1, http.MethodGet, id, nil), http.StatusNotFound, "webhook not found")
+}
+
+func TestWebhookEndpointsValidationIntegration(t *testing.T) {
+	_, handler, _ := setupTestServices(t)
+
+	tests := []struct {
+		name string
+		body CreateEndpointRequest
+	}{
+		{name: "missing url", body: CreateEndpointRequest{EventTypes: []string{EventTodoCreated}}},
+		{name: "not http", body: CreateEndpointRequest{URL: "ftp://example.com", EventTypes: []string{EventTodoCreated}}},
+		{name: "no event types", body: CreateEndpointRequest{URL: "https://example.com"}},
+		{name: "unknown event type", body: CreateEndpointRequest{URL: "https://example.com", EventTypes: []string{"todo.exploded"}}},
+		{name: "system event type", body: CreateEndpointRequest{URL: "https://example.com", EventTypes: []string{EventUserSignedUp}}},
+		{name: "duplicate event types", body: CreateEndpointRequest{URL: "https://example.com", EventTypes: []string{EventTodoCreated, EventTodoCreated}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := request(t, handler.Create, 1, http.MethodPost, "", tt.body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, string(resp.RawBody))
+		})
+	}
+}
+
+func TestWebhookDeliveryIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+	ctx := context.Background()
+	rcv := newReceiver(t, http.StatusOK)
+
+	endpoint, err := service.Create(ctx, 1, &CreateEndpointRequest{URL: rcv.URL, EventTypes: []string{EventTodoCreated}})
+	require.NoError(t, err)
+	other, err := service.Create(ctx, 2, &CreateEndpointRequest{URL: rcv.URL, EventTypes: []string{EventTodoCreated}})
+	require.NoError(t, err)
+
+	// Only subscribed endpoints of the user get the event
+	require.NoError(t, service.Dispatch(ctx, 1, EventTodoCreated, map[string]any{"id": 7}))
+	require.NoError(t, service.Dispatch(ctx, 1, EventTodoDeleted, map[string]any{"id": 7}))
+	require.NoError(t, service.DeliverDue(ctx))
+	require.Equal(t, 1, rcv.received())
+
+	req, body := rcv.requests[0], rcv.bodies[0]
+	assert.Equal(t, EventTodoCreated, req.Header.Get(HeaderEvent))
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Unix(), timestamp, 5)
+	assert.Equal(t, Sign(endpoint.Secret, time.Unix(timestamp, 0), body), req.Header.Get(HeaderSignature))
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, req.Header.Get(HeaderID), payload["id"])
+	assert.Equal(t, EventTodoCreated, payload["type"])
+	assert.Equal(t, map[string]any{"id": float64(7)}, payload["data"])
+
+	// Nothing is due anymore
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 1, rcv.received())
+
+	resp := request(t, handler.GetDeliveries, 1, http.MethodGet, strconv.FormatInt(endpoint.ID, 10), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	deliveries := resp.Body["data"].([]any)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0].(map[string]any)
+	assert.Equal(t, "succeeded", delivery["status"])
+	assert.Equal(t, float64(1), delivery["attempts"])
+	assert.Equal(t, float64(http.StatusOK), delivery["response_status"])
+	assert.NotNil(t, delivery["delivered_at"])
+	assert.Nil(t, delivery["next_attempt_at"])
+
+	// The log of an endpoint is only shown to its owner
+	resp = request(t, handler.GetDeliveries, 1, http.MethodGet, strconv.FormatInt(other.ID, 10), nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "webhook not found")
+
+	// Events dispatched once with the same key are delivered a single time, with the same ID
+	require.NoError(t, service.DispatchOnce(ctx, "event-1", 1, EventTodoCreated, map[string]any{"id": 8}))
+	require.NoError(t, service.DispatchOnce(ctx, "event-1", 1, EventTodoCreated, map[string]any{"id": 8}))
+	require.NoError(t, service.DeliverDue(ctx))
+	require.Equal(t, 2, rcv.received())
+	require.NoError(t, service.DispatchOnce(ctx, "event-1", 1, EventTodoCreated, map[string]any{"id": 8}))
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 2, rcv.received())
+}
+
+func TestWebhookRetryIntegration(t *testing.T) {
+	service, handler, container := setupTestServices(t)
+	ctx := context.Background()
+	rcv := newReceiver(t, http.StatusServiceUnavailable)
+
+	endpoint, err := service.Create(ctx, 1, &CreateEndpointRequest{URL: rcv.URL, EventTypes: []string{EventTodoCompleted}})
+	require.NoError(t, err)
+	require.NoError(t, service.Dispatch(ctx, 1, EventTodoCompleted, map[string]any{"id": 1}))
+
+	// A failed attempt is retried later, not right away
+	require.NoError(t, service.DeliverDue(ctx))
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 1, rcv.received())
+
+	var delivery Delivery
+	require.NoError(t, container.DB.Where("webhook_id = ?", endpoint.ID).First(&delivery).Error)
+	assert.Equal(t, DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+	assert.Equal(t, "unexpected response status 503", delivery.Error)
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.WithinDuration(t, time.Now().Add(retryDelay(1)), *delivery.NextAttemptAt, 5*time.Second)
+
+	// Once due, it is retried, and dead-lettered after the last attempt
+	require.NoError(t, container.DB.Model(&delivery).Update("next_attempt_at", time.Now()).Error)
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 2, rcv.received())
+
+	require.NoError(t, container.DB.First(&delivery, delivery.ID).Error)
+	assert.Equal(t, DeliveryDead, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+
+	// Both attempts carried the same event
+	assert.Equal(t, rcv.requests[0].Header.Get(HeaderID), rcv.requests[1].Header.Get(HeaderID))
+
+	resp := test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(endpoint.ID, 10))
+		handler.GetDeliveries(w, r.WithContext(createAuthenticatedContext(1)))
+	}, test.HTTPRequest{Method: http.MethodGet, URL: "/api/webhooks/deliveries?status=dead"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, resp.Body["data"], 1)
+
+	resp = test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("id", strconv.FormatInt(endpoint.ID, 10))
+		handler.GetDeliveries(w, r.WithContext(createAuthenticatedContext(1)))
+	}, test.HTTPRequest{Method: http.MethodGet, URL: "/api/webhooks/deliveries?status=pending"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Body["data"])
+}
+
+func TestWebhookDeliveriesPaginationIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+	ctx := context.Background()
+
+	endpoint, err := service.Create(ctx, 1, &CreateEndpointRequest{URL: "https://example.com/hook", EventTypes: []string{EventTodoCreated}})
+	require.NoError(t, err)
+	for i := range 3 {
+		require.NoError(t, service.Dispatch(ctx, 1, EventTodoCreated, map[string]any{"id": i}))
+	}
+
+	list := func(query string) *test.HTTPResponse {
+		return test.MakeJSONRequest(t, func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("id", strconv.FormatInt(endpoint.ID, 10))
+			handler.GetDeliveries(w, r.WithContext(createAuthenticatedContext(1)))
+		}, test.HTTPRequest{Method: http.MethodGet, URL: "/api/webhooks/1/deliveries?" + query})
+	}
+
+	// Newest first
+	resp := list("limit=2")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, resp.Body["data"], 2)
+	assert.Equal(t, true, resp.Body["has_more"])
+	assert.Contains(t, resp.Headers.Get("Link"), `rel="next"`)
+	first := resp.Body["data"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{"id": float64(2)}, first["payload"].(map[string]any)["data"])
+
+	resp = list("limit=2&cursor=" + resp.Body["next_cursor"].(string))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, resp.Body["data"], 1)
+	assert.Equal(t, false, resp.Body["has_more"])
+
+	test.AssertErrorResponse(t, list("cursor=abc"), http.StatusBadRequest, "invalid cursor")
+	assert.Equal(t, http.StatusBadRequest, list("limit=0").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, list("status=lost").StatusCode)
+}
+
+func TestWebhookSendTestIntegration(t *testing.T) {
+	service, handler, _ := setupTestServices(t)
+	ctx := context.Background()
+	rcv := newReceiver(t, http.StatusAccepted)
+
+	endpoint, err := service.Create(ctx, 1, &CreateEndpointRequest{URL: rcv.URL, EventTypes: []string{EventTodoCreated}})
+	require.NoError(t, err)
+
+	// Test events are sent right away, and the outcome returned
+	resp := request(t, handler.SendTest, 1, http.MethodPost, strconv.FormatInt(endpoint.ID, 10), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.RawBody))
+	assert.Equal(t, "succeeded", resp.Body["status"])
+	assert.Equal(t, EventTest, resp.Body["event_type"])
+	assert.Equal(t, float64(http.StatusAccepted), resp.Body["response_status"])
+	require.Equal(t, 1, rcv.received())
+	assert.Equal(t, EventTest, rcv.requests[0].Header.Get(HeaderEvent))
+
+	// Failed tests are reported too, and retried like any delivery
+	rcv.mu.Lock()
+	rcv.status = http.StatusInternalServerError
+	rcv.mu.Unlock()
+	resp = request(t, handler.SendTest, 1, http.MethodPost, strconv.FormatInt(endpoint.ID, 10), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "pending", resp.Body["status"])
+	assert.Equal(t, "unexpected response status 500", resp.Body["error"])
+	assert.NotNil(t, resp.Body["next_attempt_at"])
+
+	resp = request(t, handler.SendTest, 2, http.MethodPost, strconv.FormatInt(endpoint.ID, 10), nil)
+	test.AssertErrorResponse(t, resp, http.StatusNotFound, "webhook not found")
+}
+
+func TestWebhookSystemEndpointIntegration(t *testing.T) {
+	service, _, container := setupTestServices(t)
+	ctx := context.Background()
+	rcv := newReceiver(t, http.StatusOK)
+
+	// Without a configured endpoint, sign ups go nowhere
+	require.NoError(t, service.ConfigureSystemEndpoint(ctx, "", ""))
+	require.NoError(t, service.DispatchSystem(ctx, "1", EventUserSignedUp, map[string]any{"id": 1}))
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 0, rcv.received())
+
+	require.NoError(t, service.ConfigureSystemEndpoint(ctx, rcv.URL, "signup-secret"))
+	require.NoError(t, service.DispatchSystem(ctx, "2", EventUserSignedUp, map[string]any{"id": 2}))
+	require.NoError(t, service.DispatchSystem(ctx, "2", EventUserSignedUp, map[string]any{"id": 2}))
+	require.NoError(t, service.DeliverDue(ctx))
+	require.Equal(t, 1, rcv.received())
+	timestamp, err := strconv.ParseInt(rcv.requests[0].Header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("signup-secret", time.Unix(timestamp, 0), rcv.bodies[0]), rcv.requests[0].Header.Get(HeaderSignature))
+
+	// Configuring it again updates it rather than adding another, and users don't see it
+	require.NoError(t, service.ConfigureSystemEndpoint(ctx, rcv.URL+"/v2", "signup-secret"))
+	var count int64
+	require.NoError(t, container.DB.Model(&Endpoint{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// Removing it from the configuration stops deliveries
+	require.NoError(t, service.ConfigureSystemEndpoint(ctx, "", ""))
+	require.NoError(t, service.DispatchSystem(ctx, "3", EventUserSignedUp, map[string]any{"id": 3}))
+	require.NoError(t, service.DeliverDue(ctx))
+	assert.Equal(t, 1, rcv.received())
+}
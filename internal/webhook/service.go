@@ -0,0 +1,417 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/pagination"
+)
+
+const (
+	// pollInterval is how often due deliveries are looked for, besides right after dispatching
+	pollInterval = 5 * time.Second
+	// claimBatch is how many deliveries are claimed, and sent concurrently, at once
+	claimBatch = 20
+	// claimLease is how long a claimed delivery is left to its instance before being retried,
+	// it must outlast the timeout of the client
+	claimLease = 2 * time.Minute
+	// maxResponseBody is how much of the response to a delivery is kept in the delivery log
+	maxResponseBody = 1 << 10
+)
+
+// Service provides webhook business logic operations and delivers events to endpoints
+type Service struct {
+	store       *store
+	client      *http.Client
+	maxAttempts int
+	wake        chan struct{}
+}
+
+// CreateEndpointRequest represents the request payload for registering a webhook endpoint
+type CreateEndpointRequest struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Description string   `json:"description" validate:"max=200"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,unique,dive,oneof=todo.created todo.updated todo.completed todo.uncompleted todo.deleted todo.reminder"`
+}
+
+// UpdateEndpointRequest represents the request payload for changing a webhook endpoint
+type UpdateEndpointRequest struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Description string   `json:"description" validate:"max=200"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,unique,dive,oneof=todo.created todo.updated todo.completed todo.uncompleted todo.deleted todo.reminder"`
+	Active      *bool    `json:"active"`
+}
+
+// NewService creates a new webhook service with the provided dependencies. Deliveries are
+// sent with client and given up after maxAttempts attempts.
+func NewService(store *store, client *http.Client, maxAttempts int) *Service {
+	return &Service{
+		store:       store,
+		client:      client,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// validateURL checks that an endpoint URL is an absolute HTTP(S) URL
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Create registers a webhook endpoint for the specified user
+func (s *Service) Create(ctx context.Context, userID int64, req *CreateEndpointRequest) (*Endpoint, error) {
+	if err := validateURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := NewEndpoint(userID, req.URL, req.Description, req.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Save(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// GetByUserID retrieves all webhook endpoints of the specified user
+func (s *Service) GetByUserID(ctx context.Context, userID int64) ([]Endpoint, error) {
+	endpoints, err := s.store.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks by user id: %w", err)
+	}
+	return endpoints, nil
+}
+
+// GetByID retrieves a webhook endpoint of the specified user
+func (s *Service) GetByID(ctx context.Context, userID, id int64) (*Endpoint, error) {
+	return s.store.GetByID(ctx, userID, id)
+}
+
+// Update changes a webhook endpoint of the specified user. Endpoints are left active or
+// inactive unless the request says otherwise.
+func (s *Service) Update(ctx context.Context, userID, id int64, req *UpdateEndpointRequest) (*Endpoint, error) {
+	if err := validateURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := s.store.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook for update: %w", err)
+	}
+
+	endpoint.URL = req.URL
+	endpoint.Description = req.Description
+	endpoint.EventTypes = req.EventTypes
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	endpoint.UpdatedAt = time.Now()
+
+	if err := s.store.Save(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// Delete removes a webhook endpoint of the specified user along with its delivery log
+func (s *Service) Delete(ctx context.Context, userID, id int64) error {
+	if err := s.store.Delete(ctx, userID, id); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// GetDeliveries retrieves a page of the delivery log of a webhook endpoint of the specified
+// user, newest first
+func (s *Service) GetDeliveries(ctx context.Context, userID, id int64, params *DeliveryParams) (*DeliveryPage, error) {
+	if _, err := s.store.GetByID(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	afterID, err := pagination.DecodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether a next page exists
+	deliveries, err := s.store.GetDeliveries(ctx, id, params.Status, afterID, params.Limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+
+	page := &DeliveryPage{Data: deliveries}
+	if len(deliveries) > params.Limit {
+		page.Data = deliveries[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = pagination.EncodeCursor(page.Data[params.Limit-1].ID)
+	}
+
+	return page, nil
+}
+
+// SendTest sends a test event to a webhook endpoint of the specified user right away, even
+// an inactive one, and returns the delivery. A failed test is retried like any delivery.
+func (s *Service) SendTest(ctx context.Context, userID, id int64) (*Delivery, error) {
+	endpoint, err := s.store.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := NewDelivery(endpoint.ID, EventTest, map[string]int64{"webhook_id": endpoint.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	// The delivery is claimed by this request, other instances leave it alone
+	leased := time.Now().Add(claimLease)
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = &leased
+
+	if err := s.store.SaveDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+
+	s.attempt(ctx, endpoint, delivery)
+
+	return delivery, nil
+}
+
+// Dispatch queues the delivery of an event to the endpoints of the specified user that
+// subscribe to its type
+func (s *Service) Dispatch(ctx context.Context, userID int64, eventType string, data any) error {
+	return s.dispatch(ctx, uuid.NewString(), userID, eventType, data)
+}
+
+// DispatchOnce queues the delivery of the event identified by the given key like Dispatch,
+// unless it was already queued. Events handled at least once, like those relayed from an
+// outbox, are dispatched this way so that handling one again doesn't deliver it twice.
+func (s *Service) DispatchOnce(ctx context.Context, key string, userID int64, eventType string, data any) error {
+	return s.dispatch(ctx, uuid.NewSHA1(eventNamespace, []byte(key)).String(), userID, eventType, data)
+}
+
+// DispatchSystem queues the delivery of the event identified by the given key to the
+// endpoint configured by the operator, once like DispatchOnce
+func (s *Service) DispatchSystem(ctx context.Context, key, eventType string, data any) error {
+	return s.DispatchOnce(ctx, key, systemOwner, eventType, data)
+}
+
+// dispatch queues the delivery of the event with the given ID to the endpoints of the
+// specified user that subscribe to its type
+func (s *Service) dispatch(ctx context.Context, eventID string, userID int64, eventType string, data any) error {
+	endpoints, err := s.store.GetSubscribed(ctx, userID, eventType)
+	if err != nil {
+		return fmt.Errorf("failed to get subscribed webhooks: %w", err)
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	for _, endpoint := range endpoints {
+		delivery, err := newDelivery(endpoint.ID, eventID, eventType, data)
+		if err != nil {
+			return err
+		}
+		if err := s.store.AddDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to save webhook delivery: %w", err)
+		}
+	}
+
+	// Deliver right away rather than at the next poll
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ConfigureSystemEndpoint sets up the endpoint configured by the operator, which receives
+// user sign ups, signed with the given secret. An empty URL deactivates it.
+func (s *Service) ConfigureSystemEndpoint(ctx context.Context, rawURL, secret string) error {
+	endpoints, err := s.store.GetByUserID(ctx, systemOwner)
+	if err != nil {
+		return fmt.Errorf("failed to get system webhook: %w", err)
+	}
+
+	var endpoint *Endpoint
+	switch {
+	case len(endpoints) > 0:
+		endpoint = &endpoints[0]
+	case rawURL == "":
+		return nil
+	default:
+		endpoint, err = NewEndpoint(systemOwner, rawURL, "system", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rawURL != "" {
+		if err := validateURL(rawURL); err != nil {
+			return err
+		}
+		endpoint.URL = rawURL
+		endpoint.Secret = secret
+	}
+	endpoint.EventTypes = []string{EventUserSignedUp}
+	endpoint.Active = rawURL != ""
+	endpoint.UpdatedAt = time.Now()
+
+	if err := s.store.Save(ctx, endpoint); err != nil {
+		return fmt.Errorf("failed to save system webhook: %w", err)
+	}
+	return nil
+}
+
+// Run delivers due deliveries until the context is canceled, polling for them and right
+// after events are dispatched. Every instance may run it, deliveries are claimed so that
+// each attempt is made by a single one.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to deliver webhooks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// DeliverDue makes an attempt at every delivery that is due
+func (s *Service) DeliverDue(ctx context.Context) error {
+	for {
+		deliveries, err := s.store.ClaimDue(ctx, claimBatch, claimLease)
+		if err != nil {
+			return fmt.Errorf("failed to claim due deliveries: %w", err)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.WebhookID)
+		}
+		endpoints, err := s.store.GetEndpointsByIDs(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("failed to get webhooks of deliveries: %w", err)
+		}
+		byID := make(map[int64]*Endpoint, len(endpoints))
+		for i := range endpoints {
+			byID[endpoints[i].ID] = &endpoints[i]
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			endpoint, ok := byID[deliveries[i].WebhookID]
+			if !ok {
+				// The endpoint was deleted since, along with its deliveries
+				continue
+			}
+			wg.Add(1)
+			go func(delivery *Delivery) {
+				defer wg.Done()
+				s.attempt(ctx, endpoint, delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatch {
+			return nil
+		}
+	}
+}
+
+// attempt sends a claimed delivery to its endpoint and records the outcome
+func (s *Service) attempt(ctx context.Context, endpoint *Endpoint, delivery *Delivery) {
+	start := time.Now()
+	status, body, err := s.send(ctx, endpoint, delivery)
+	now := time.Now()
+
+	delivery.Duration = now.Sub(start).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.UpdatedAt = now
+
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= s.maxAttempts:
+		delivery.Status = DeliveryDead
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(retryDelay(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	// The outcome is recorded even when shutting down, or the attempt would be made again
+	if err := s.store.SaveDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Error().Err(err).Msgf("failed to save webhook delivery %d", delivery.ID)
+	}
+}
+
+// send posts a delivery to its endpoint, signed with the endpoint secret, and returns the
+// status and the beginning of the body of the response
+func (s *Service) send(ctx context.Context, endpoint *Endpoint, delivery *Delivery) (int, string, error) {
+	if !endpoint.Active && delivery.EventType != EventTest {
+		return 0, "", errors.New("webhook is inactive")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-boilerplate-webhooks/1.0")
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	// Responses are shown as text in the delivery log, whatever they contain
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	text := strings.ReplaceAll(strings.ToValidUTF8(string(body), "\uFFFD"), "\x00", "")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, text, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, text, nil
+}
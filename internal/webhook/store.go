@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// store implements webhook data persistence using GORM
+type store struct {
+	dbConn *gorm.DB
+}
+
+// NewStore creates a new webhook store with the provided database connection
+func NewStore(dbConn *gorm.DB) *store {
+	return &store{dbConn: dbConn}
+}
+
+// Save persists an endpoint to the database (create or update)
+func (s *store) Save(ctx context.Context, endpoint *Endpoint, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(endpoint).Error
+}
+
+// GetByID retrieves an endpoint by its ID from the database, scoped to the owning user
+func (s *store) GetByID(ctx context.Context, userID, id int64) (*Endpoint, error) {
+	var endpoint Endpoint
+	err := s.dbConn.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&endpoint).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// GetByUserID retrieves all endpoints of a user, oldest first
+func (s *store) GetByUserID(ctx context.Context, userID int64) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	if err := s.dbConn.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// GetSubscribed retrieves the active endpoints of a user subscribed to an event type
+func (s *store) GetSubscribed(ctx context.Context, userID int64, eventType string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	err := s.dbConn.WithContext(ctx).
+		Where("user_id = ? AND active AND event_types @> jsonb_build_array(?::text)", userID, eventType).
+		Order("id ASC").
+		Find(&endpoints).Error
+	if err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// GetByURL retrieves an endpoint of a user by its URL
+func (s *store) GetByURL(ctx context.Context, userID int64, url string) (*Endpoint, error) {
+	var endpoint Endpoint
+	err := s.dbConn.WithContext(ctx).Where("user_id = ? AND url = ?", userID, url).First(&endpoint).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// Delete removes an endpoint of a user from the database along with its deliveries
+func (s *store) Delete(ctx context.Context, userID, id int64) error {
+	return s.dbConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&Endpoint{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEndpointNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&Delivery{}).Error
+	})
+}
+
+// SaveDelivery persists a delivery to the database (create or update)
+func (s *store) SaveDelivery(ctx context.Context, delivery *Delivery, options ...db.Option) error {
+	dbConn := s.dbConn
+
+	opts := &db.Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.Tx != nil {
+		dbConn = opts.Tx
+	}
+
+	return dbConn.WithContext(ctx).Save(delivery).Error
+}
+
+// AddDelivery saves a new delivery, unless the endpoint already has a delivery of its event
+func (s *store) AddDelivery(ctx context.Context, delivery *Delivery) error {
+	return s.dbConn.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}},
+			DoNothing: true,
+		}).
+		Create(delivery).Error
+}
+
+// GetDeliveries retrieves a page of the deliveries to an endpoint, newest first, after the
+// delivery with the given ID when it isn't zero
+func (s *store) GetDeliveries(ctx context.Context, webhookID int64, status string, afterID int64, limit int) ([]Delivery, error) {
+	query := s.dbConn.WithContext(ctx).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if afterID != 0 {
+		query = query.Where("id < ?", afterID)
+	}
+
+	var deliveries []Delivery
+	if err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDue claims up to limit pending deliveries that are due, for the given lease. Claimed
+// deliveries count an attempt and aren't due again until the lease expires, so that other
+// instances don't send them meanwhile, and a delivery interrupted by a crash is retried.
+func (s *store) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := s.dbConn.WithContext(ctx).Raw(`
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		time.Now().Add(lease), time.Now(), DeliveryPending, time.Now(), limit,
+	).Scan(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetEndpointsByIDs retrieves the endpoints with the given IDs, whoever owns them
+func (s *store) GetEndpointsByIDs(ctx context.Context, ids []int64) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	if err := s.dbConn.WithContext(ctx).Where("id IN ?", ids).Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/syahidfrd/go-boilerplate/internal/auth"
+)
+
+// Types of the events webhooks subscribe to
+const (
+	EventTodoCreated     = "todo.created"
+	EventTodoUpdated     = "todo.updated"
+	EventTodoCompleted   = "todo.completed"
+	EventTodoUncompleted = "todo.uncompleted"
+	EventTodoDeleted     = "todo.deleted"
+	EventTodoReminder    = "todo.reminder"
+	EventUserSignedUp    = auth.EventSignedUp
+	// EventTest is only sent on demand, to check an endpoint
+	EventTest = "webhook.test"
+)
+
+// Headers of webhook deliveries
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// systemOwner owns the endpoints configured by the operator rather than registered by a
+// user, which receive events that aren't about the todos of any user, like sign ups
+const systemOwner = 0
+
+// eventNamespace derives the IDs of events dispatched once from their keys
+var eventNamespace = uuid.MustParse("5d0c3f0e-8a51-4b7e-9a43-2f6c1e9b7d21")
+
+var (
+	// ErrEndpointNotFound is returned when a requested webhook endpoint cannot be found
+	ErrEndpointNotFound = errors.New("webhook not found")
+	// ErrInvalidURL is returned when a webhook endpoint URL isn't an absolute HTTP(S) URL
+	ErrInvalidURL = errors.New("invalid webhook url")
+)
+
+// Endpoint represents a URL events of the subscribed types are delivered to. Its secret
+// signs every delivery, and is only shown when the endpoint is created.
+type Endpoint struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"-" gorm:"index"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	EventTypes  []string  `json:"event_types" gorm:"type:jsonb;serializer:json"`
+	Secret      string    `json:"-"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName keeps webhook endpoints in the webhooks table
+func (Endpoint) TableName() string {
+	return "webhooks"
+}
+
+// NewEndpoint creates an active endpoint of a user with a new random secret
+func NewEndpoint(userID int64, url, description string, eventTypes []string) (*Endpoint, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	now := time.Now()
+	return &Endpoint{
+		UserID:      userID,
+		URL:         url,
+		Description: description,
+		EventTypes:  eventTypes,
+		Secret:      "whsec_" + base64.RawURLEncoding.EncodeToString(b[:]),
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// EndpointResponse represents a newly created endpoint in API responses, the only time its
+// secret is shown
+type EndpointResponse struct {
+	*Endpoint
+	Secret string `json:"secret"`
+}
+
+// DeliveryStatus is the state of the delivery of an event to an endpoint
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySucceeded deliveries got a 2xx response
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead deliveries failed every attempt and aren't retried anymore
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Delivery represents an event sent, or to be sent, to an endpoint along with the outcome
+// of its last attempt. Failed attempts are retried with exponential backoff until the
+// delivery succeeds or runs out of attempts.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id" gorm:"uniqueIndex:idx_webhook_deliveries_event,priority:1"`
+	EventID        string          `json:"event_id" gorm:"uniqueIndex:idx_webhook_deliveries_event,priority:2"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" gorm:"type:jsonb"`
+	Status         DeliveryStatus  `json:"status" gorm:"index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	ResponseStatus int             `json:"response_status"`
+	ResponseBody   string          `json:"response_body"`
+	Error          string          `json:"error"`
+	Duration       int64           `json:"duration_ms"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// TableName keeps webhook deliveries in the webhook_deliveries table
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// envelope is the body of a delivery, the event along with what identifies it
+type envelope struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// NewDelivery creates the pending delivery of a new event to an endpoint
+func NewDelivery(webhookID int64, eventType string, data any) (*Delivery, error) {
+	return newDelivery(webhookID, uuid.NewString(), eventType, data)
+}
+
+// newDelivery creates the pending delivery of the event with the given ID to an endpoint
+func newDelivery(webhookID int64, id, eventType string, data any) (*Delivery, error) {
+	now := time.Now()
+
+	payload, err := json.Marshal(envelope{ID: id, Type: eventType, CreatedAt: now, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	return &Delivery{
+		WebhookID:     webhookID,
+		EventID:       id,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// DeliveryParams represents the filters and pagination of a delivery log request
+type DeliveryParams struct {
+	Status string `validate:"omitempty,oneof=pending succeeded dead"`
+	Limit  int    `validate:"min=1,max=100"`
+	Cursor string
+}
+
+// DeliveryPage represents a single page of deliveries along with the cursor of the next page
+type DeliveryPage struct {
+	Data       []Delivery `json:"data"`
+	NextCursor string     `json:"next_cursor"`
+	HasMore    bool       `json:"has_more"`
+}
+
+// Sign returns the signature of a delivery body sent at the given time, the hex encoded
+// HMAC-SHA256 of the timestamp and the body joined by a dot, keyed with the endpoint secret.
+// Receivers compute it the same way to check deliveries, and reject old timestamps to
+// prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay returns how long to wait before retrying a delivery that failed the given
+// number of attempts, doubling from 30 seconds up to 6 hours
+func retryDelay(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, 6*time.Hour)
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEndpoint(t *testing.T) {
+	endpoint, err := NewEndpoint(3, "https://example.com/hook", "CI", []string{EventTodoCreated})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), endpoint.UserID)
+	assert.True(t, endpoint.Active)
+	assert.Regexp(t, `^whsec_[A-Za-z0-9_-]{43}$`, endpoint.Secret)
+
+	other, err := NewEndpoint(3, "https://example.com/hook", "CI", []string{EventTodoCreated})
+	require.NoError(t, err)
+	assert.NotEqual(t, endpoint.Secret, other.Secret)
+
+	// The secret is never part of the endpoint as returned by the API
+	data, err := json.Marshal(endpoint)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), endpoint.Secret)
+
+	data, err = json.Marshal(EndpointResponse{Endpoint: endpoint, Secret: endpoint.Secret})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"secret":"`+endpoint.Secret+`"`)
+	assert.Contains(t, string(data), `"url":"https://example.com/hook"`)
+}
+
+func TestNewDelivery(t *testing.T) {
+	delivery, err := NewDelivery(7, EventTodoCreated, map[string]any{"id": 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), delivery.WebhookID)
+	assert.Equal(t, DeliveryPending, delivery.Status)
+	assert.Zero(t, delivery.Attempts)
+	require.NotNil(t, delivery.NextAttemptAt)
+	assert.False(t, delivery.NextAttemptAt.After(time.Now()))
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(delivery.Payload, &payload))
+	assert.Equal(t, delivery.EventID, payload["id"])
+	assert.Equal(t, EventTodoCreated, payload["type"])
+	assert.Equal(t, map[string]any{"id": float64(1)}, payload["data"])
+	assert.NotEmpty(t, payload["created_at"])
+}
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+
+	// echo -n '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54", Sign("secret", timestamp, body))
+
+	// Any change to the secret, the time or the body changes the signature
+	signature := Sign("secret", timestamp, body)
+	assert.Equal(t, signature, Sign("secret", timestamp, body))
+	assert.NotEqual(t, signature, Sign("other", timestamp, body))
+	assert.NotEqual(t, signature, Sign("secret", timestamp.Add(time.Second), body))
+	assert.NotEqual(t, signature, Sign("secret", timestamp, []byte(`{"id":"2"}`)))
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 3, expected: 2 * time.Minute},
+		{attempts: 8, expected: 64 * time.Minute},
+		{attempts: 10, expected: 256 * time.Minute},
+		{attempts: 11, expected: 6 * time.Hour},
+		{attempts: 100, expected: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, retryDelay(tt.attempts), "attempts %d", tt.attempts)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, valid := range []string{"https://example.com/hook", "http://example.com:8080"} {
+		assert.NoError(t, validateURL(valid), valid)
+	}
+	for _, invalid := range []string{"ftp://example.com", "example.com/hook", "https://", "mailto:me@example.com"} {
+		assert.ErrorIs(t, validateURL(invalid), ErrInvalidURL, invalid)
+	}
+}
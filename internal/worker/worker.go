@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/syahidfrd/go-boilerplate/internal/app"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/config"
+	"github.com/syahidfrd/go-boilerplate/internal/pkg/jobs"
+)
+
+// Worker represents the process running background jobs
+type Worker struct {
+	jobs *jobs.Worker
+}
+
+// NewWorker creates and configures a new worker with all dependencies and jobs, running up
+// to concurrency jobs at once. The database is migrated by the server, not the worker.
+func NewWorker(concurrency int) *Worker {
+	// Load configuration
+	cfg := config.LoadEnv()
+
+	// Initialize the connections and services shared with the server
+	a := app.New(cfg)
+
+	// Register jobs
+	jobWorker := jobs.NewWorker(a.Jobs, concurrency)
+	a.Todos.RegisterJobs(jobWorker, cfg.TrashRetention)
+
+	return &Worker{jobs: jobWorker}
+}
+
+// Run runs background jobs until the process is interrupted, then waits for the jobs being
+// run to finish
+func (w *Worker) Run() {
+	ctx, stop := context.WithCancel(context.Background())
+
+	// Setup graceful shutdown channels
+	done := make(chan struct{})
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	// Start running jobs
+	log.Info().Msg("worker is running jobs")
+	go func() {
+		w.jobs.Run(ctx)
+		close(done)
+	}()
+
+	<-quit
+	log.Info().Msg("worker is shutting down...")
+	stop()
+
+	// Jobs still running after the timeout are claimed again once their visibility timeout expires
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		log.Fatal().Msg("could not gracefully shutdown the worker")
+	}
+	log.Info().Msg("worker stopped")
+}